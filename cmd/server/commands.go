@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/configs"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/migrations"
+)
+
+// sampleNotes are created by the seed command
+var sampleNotes = []struct{ title, content string }{
+	{"Welcome to Notes App", "This is a simple note-taking application built with Go, Gin, HTMX, and DaisyUI."},
+	{"Getting Started", "You can create, read, update, and delete notes using this application."},
+	{"HTMX", "HTMX allows you to access AJAX, CSS Transitions, WebSockets and Server Sent Events directly in HTML, using attributes."},
+	{"Alpine.js", "Alpine.js offers you the reactive and declarative nature of big frameworks like Vue or React at a much lower cost."},
+}
+
+// openDB connects to the configured database
+func (e *commandEnv) openDB() (*sql.DB, error) {
+	return configs.InitDB(e.cfg.Database)
+}
+
+// withNoteService runs fn with a NoteService backed by the configured database,
+// so commands go through the same business rules as the web app
+func (e *commandEnv) withNoteService(fn func(services.NoteService) error) error {
+	db, err := e.openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return fn(services.NewNoteService(
+		repositories.NewNoteRepository(db, e.cfg.Database.QueryTimeout),
+		repositories.NewShareRepository(db, e.cfg.Database.QueryTimeout),
+		repositories.NewUserRepository(db, e.cfg.Database.QueryTimeout),
+		repositories.NewAuditRepository(db, e.cfg.Database.QueryTimeout),
+		repositories.NewNoteTemplateRepository(db, e.cfg.Database.QueryTimeout),
+		repositories.NewLinkRepository(db, e.cfg.Database.QueryTimeout),
+		repositories.NewTransactor(db),
+	))
+}
+
+// withUserService runs fn with a UserService backed by the configured database
+func (e *commandEnv) withUserService(fn func(services.UserService) error) error {
+	db, err := e.openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return fn(services.NewUserService(
+		repositories.NewUserRepository(db, e.cfg.Database.QueryTimeout),
+		repositories.NewSessionRepository(db, e.cfg.Database.QueryTimeout),
+		e.cfg.Auth.SessionTTL,
+	))
+}
+
+// withAuditService runs fn with an AuditService backed by the configured database
+func (e *commandEnv) withAuditService(fn func(services.AuditService) error) error {
+	db, err := e.openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return fn(services.NewAuditService(repositories.NewAuditRepository(db, e.cfg.Database.QueryTimeout)))
+}
+
+// migrateCommand applies pending migrations, or lists them with "status"
+func migrateCommand(ctx context.Context, env *commandEnv, args []string) error {
+	if len(args) > 1 || (len(args) == 1 && args[0] != "status") {
+		return errUsage
+	}
+
+	db, err := env.openDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if len(args) == 1 {
+		status, err := migrations.Status(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, m := range status {
+			state := "pending"
+			if m.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%-8s %s\n", state, m.Name)
+		}
+		return nil
+	}
+
+	applied, err := migrations.Up(ctx, db)
+	for _, name := range applied {
+		fmt.Println("applied", name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(applied) == 0 {
+		fmt.Println("database is up to date")
+	}
+	return nil
+}
+
+// seedCommand creates the sample notes
+func seedCommand(ctx context.Context, env *commandEnv, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	return env.withNoteService(func(noteService services.NoteService) error {
+		for _, sample := range sampleNotes {
+			note, err := noteService.CreateNote(ctx, sample.title, sample.content, time.Time{}, time.Time{})
+			if err != nil {
+				return err
+			}
+			fmt.Printf("created note %d: %s\n", note.ID, note.Title)
+		}
+		return nil
+	})
+}
+
+// notesListCommand prints every note
+func notesListCommand(ctx context.Context, env *commandEnv, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	return env.withNoteService(func(noteService services.NoteService) error {
+		notes, err := noteService.GetAllNotes(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTITLE\tUPDATED")
+		for _, note := range notes {
+			fmt.Fprintf(w, "%d\t%s\t%s\n", note.ID, note.Title, note.UpdatedAt.Format("2006-01-02 15:04"))
+		}
+		return w.Flush()
+	})
+}
+
+// notesShowCommand prints a single note
+func notesShowCommand(ctx context.Context, env *commandEnv, args []string) error {
+	id, err := noteIDArg(args)
+	if err != nil {
+		return err
+	}
+
+	return env.withNoteService(func(noteService services.NoteService) error {
+		note, err := noteService.GetNoteByID(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("ID:      %d\nTitle:   %s\nCreated: %s\nUpdated: %s\n\n%s\n",
+			note.ID, note.Title,
+			note.CreatedAt.Format("2006-01-02 15:04:05"),
+			note.UpdatedAt.Format("2006-01-02 15:04:05"),
+			note.Content)
+		return nil
+	})
+}
+
+// notesDeleteCommand deletes a note
+func notesDeleteCommand(ctx context.Context, env *commandEnv, args []string) error {
+	id, err := noteIDArg(args)
+	if err != nil {
+		return err
+	}
+
+	return env.withNoteService(func(noteService services.NoteService) error {
+		if err := noteService.DeleteNote(ctx, id); err != nil {
+			return err
+		}
+		fmt.Printf("deleted note %d\n", id)
+		return nil
+	})
+}
+
+// exportCommand writes every note as a JSON array to stdout or a file
+func exportCommand(ctx context.Context, env *commandEnv, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	output := flags.String("o", "", "write to `file` instead of stdout")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 0 {
+		return errUsage
+	}
+
+	return env.withNoteService(func(noteService services.NoteService) error {
+		notes, err := noteService.GetAllNotes(ctx)
+		if err != nil {
+			return err
+		}
+		if notes == nil {
+			notes = []*domain.Note{}
+		}
+
+		var w io.Writer = os.Stdout
+		if *output != "" {
+			f, err := os.Create(*output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(notes)
+	})
+}
+
+// importCommand creates a note for every entry of a JSON export read from a
+// file or stdin. IDs and timestamps in the export are not preserved.
+func importCommand(ctx context.Context, env *commandEnv, args []string) error {
+	if len(args) > 1 {
+		return errUsage
+	}
+
+	var r io.Reader = os.Stdin
+	if len(args) == 1 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var notes []domain.Note
+	if err := json.NewDecoder(r).Decode(&notes); err != nil {
+		return fmt.Errorf("reading export: %w", err)
+	}
+
+	return env.withNoteService(func(noteService services.NoteService) error {
+		for i, note := range notes {
+			created, err := noteService.CreateNote(ctx, note.Title, note.Content, note.DueAt, note.RemindAt)
+			if err != nil {
+				return fmt.Errorf("note %d (%q): %w", i+1, note.Title, err)
+			}
+			fmt.Printf("imported note %d: %s\n", created.ID, created.Title)
+		}
+		return nil
+	})
+}
+
+// usersListCommand prints every user and their role
+func usersListCommand(ctx context.Context, env *commandEnv, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	return env.withUserService(func(userService services.UserService) error {
+		users, err := userService.GetAllUsers(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUSERNAME\tROLE\tCREATED")
+		for _, user := range users {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", user.ID, user.Username, user.Role, user.CreatedAt.Format("2006-01-02 15:04"))
+		}
+		return w.Flush()
+	})
+}
+
+// usersCreateCommand creates a user, reading the password from the first
+// line of stdin so it stays out of the shell history
+func usersCreateCommand(ctx context.Context, env *commandEnv, args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errUsage
+	}
+	role := domain.RoleEditor
+	if len(args) == 2 {
+		role = domain.Role(args[1])
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	password = strings.TrimRight(password, "\r\n")
+
+	return env.withUserService(func(userService services.UserService) error {
+		user, err := userService.CreateUser(ctx, args[0], password, role)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created user %d: %s (%s)\n", user.ID, user.Username, user.Role)
+		return nil
+	})
+}
+
+// usersRoleCommand assigns a role to a user
+func usersRoleCommand(ctx context.Context, env *commandEnv, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+
+	return env.withUserService(func(userService services.UserService) error {
+		users, err := userService.GetAllUsers(ctx)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			if user.Username != args[0] {
+				continue
+			}
+			if _, err := userService.SetRole(ctx, user.ID, domain.Role(args[1])); err != nil {
+				return err
+			}
+			fmt.Printf("%s is now %s\n", user.Username, args[1])
+			return nil
+		}
+		return services.ErrUserNotFound
+	})
+}
+
+// auditVerifyCommand checks the hash chain of the audit log, failing if it
+// was tampered with
+func auditVerifyCommand(ctx context.Context, env *commandEnv, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	return env.withAuditService(func(auditService services.AuditService) error {
+		report, err := auditService.Verify(ctx)
+		if err != nil {
+			return err
+		}
+		if !report.OK() {
+			if report.BrokenAt != 0 {
+				return fmt.Errorf("audit log verification failed at event %d: %s", report.BrokenAt, report.Problem)
+			}
+			return fmt.Errorf("audit log verification failed after %d events: %s", report.Events, report.Problem)
+		}
+		fmt.Printf("audit log intact: %d events verified\n", report.Events)
+		return nil
+	})
+}
+
+// configPrintCommand shows the effective configuration with secrets redacted
+func configPrintCommand(_ context.Context, env *commandEnv, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	return env.cfg.Print(os.Stdout)
+}
+
+// noteIDArg parses the single note ID argument
+func noteIDArg(args []string) (int64, error) {
+	if len(args) != 1 {
+		return 0, errUsage
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid note ID %q", args[0])
+	}
+	return id, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// lifecycle stops the application's components in the reverse order they
+// were started, like deferred calls: the HTTP listeners first, then the
+// background workers and finally the database pool
+type lifecycle struct {
+	logger *slog.Logger
+	hooks  []shutdownHook
+}
+
+type shutdownHook struct {
+	name string
+	stop func(context.Context) error
+}
+
+// OnShutdown registers stop to be called when the application shuts down
+func (l *lifecycle) OnShutdown(name string, stop func(context.Context) error) {
+	l.hooks = append(l.hooks, shutdownHook{name, stop})
+}
+
+// Shutdown runs every hook, newest first, sharing the deadline of ctx.
+// It keeps going when a hook fails and returns all errors joined.
+func (l *lifecycle) Shutdown(ctx context.Context) error {
+	var errs []error
+	for i := len(l.hooks) - 1; i >= 0; i-- {
+		hook := l.hooks[i]
+		if err := hook.stop(ctx); err != nil {
+			l.logger.Error("Shutdown step failed", "component", hook.name, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		l.logger.Info("Stopped", "component", hook.name)
+	}
+	return errors.Join(errs...)
+}
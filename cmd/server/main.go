@@ -1,59 +1,125 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	_ "time/tzdata" // Embed the time zone database for hosts without one
 
-	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql" // Import MySQL driver
-	"github.com/joho/godotenv"
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
 	"github.com/mas-diq/htmx-basic-crud/internals/configs"
-	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
-	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
-	"github.com/mas-diq/htmx-basic-crud/internals/services"
 )
 
+// errUsage is returned by commands called with invalid arguments
+var errUsage = errors.New("invalid arguments")
+
+// command is a subcommand of the server binary
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(ctx context.Context, env *commandEnv, args []string) error
+}
+
+// commandEnv is shared by every command
+type commandEnv struct {
+	cfg    *configs.Config
+	logger *slog.Logger
+}
+
+// commands lists every subcommand; the first one is the default
+var commands = []command{
+	{"serve", "", "start the web server (default)", serveCommand},
+	{"migrate", "[status]", "apply pending database migrations, or list them", migrateCommand},
+	{"seed", "", "create the sample notes", seedCommand},
+	{"notes list", "", "list all notes", notesListCommand},
+	{"notes show", "<id>", "show a note", notesShowCommand},
+	{"notes delete", "<id>", "delete a note", notesDeleteCommand},
+	{"export", "[-o file]", "export all notes as JSON", exportCommand},
+	{"import", "[file]", "create notes from a JSON export", importCommand},
+	{"users list", "", "list all users and their roles", usersListCommand},
+	{"users create", "<username> [role]", "create a user (default role editor), reading the password from stdin", usersCreateCommand},
+	{"users role", "<username> <role>", "assign a role: admin, editor or viewer", usersRoleCommand},
+	{"audit verify", "", "check the audit log hash chain for tampering", auditVerifyCommand},
+	{"config print", "", "show the effective configuration with secrets redacted", configPrintCommand},
+}
+
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("Warning: .env file not found")
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	flag.Usage = usage
+	flag.Parse()
+
+	cmd, args := findCommand(flag.Args())
+	if cmd == nil {
+		usage()
+		os.Exit(2)
 	}
 
-	// Initialize database
-	db, err := configs.InitDB()
+	// Load configuration: defaults, config file, .env, environment
+	cfg, err := configs.Load(*configPath)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fmt.Fprintln(os.Stderr, "Invalid configuration:")
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Fprintln(os.Stderr, "  -", line)
+		}
+		os.Exit(2)
+	}
+
+	env := &commandEnv{cfg: cfg, logger: configs.InitLogger(cfg.Log)}
+
+	// Stop on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Maintenance commands act as an admin; requests served by the web
+	// server carry their own user instead
+	ctx = auth.WithUser(ctx, auth.System)
+
+	if err := cmd.run(ctx, env, args); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "Usage: %s %s %s\n", os.Args[0], cmd.name, cmd.args)
+			os.Exit(2)
+		}
+		env.logger.Error("Command failed", "command", cmd.name, "error", err)
+		os.Exit(1)
+	}
+}
+
+// findCommand matches the longest command name at the start of args and
+// returns it with the remaining arguments
+func findCommand(args []string) (*command, []string) {
+	if len(args) == 0 {
+		return &commands[0], nil
+	}
+
+	var found *command
+	var rest []string
+	for i := range commands {
+		words := strings.Fields(commands[i].name)
+		if len(words) > len(args) || strings.Join(args[:len(words)], " ") != commands[i].name {
+			continue
+		}
+		if found == nil || len(words) > len(strings.Fields(found.name)) {
+			found, rest = &commands[i], args[len(words):]
+		}
 	}
-	defer db.Close()
-
-	// Create router
-	r := gin.Default()
-
-	// Serve static files
-	r.Static("/static", "./web/static")
-	r.LoadHTMLGlob("./web/templates/**/*")
-
-	// Initialize repositories
-	noteRepo := repositories.NewNoteRepository(db)
-
-	// Initialize services
-	noteService := services.NewNoteService(noteRepo)
-
-	// Initialize handlers
-	noteHandler := handlers.NewNoteHandler(noteService)
-
-	// Register routes
-	r.GET("/", noteHandler.Index)
-	r.GET("/notes", noteHandler.Index)
-	r.GET("/notes/new", noteHandler.New)
-	r.POST("/notes", noteHandler.Create)
-	r.GET("/notes/:id", noteHandler.Show)
-	r.GET("/notes/:id/edit", noteHandler.Edit)
-	r.PUT("/notes/:id", noteHandler.Update)
-	r.DELETE("/notes/:id", noteHandler.Delete)
-
-	// Start server
-	log.Println("Server starting on :8080...")
-	if err := r.Run(":8080"); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	return found, rest
+}
+
+// usage prints the available commands
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [-config file] [command]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-32s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.summary)
 	}
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
 }
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/configs"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/jobs"
+	"github.com/mas-diq/htmx-basic-crud/internals/mail"
+	"github.com/mas-diq/htmx-basic-crud/internals/metrics"
+	"github.com/mas-diq/htmx-basic-crud/internals/middlewares"
+	"github.com/mas-diq/htmx-basic-crud/internals/ratelimit"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"github.com/mas-diq/htmx-basic-crud/internals/webhooks"
+	"github.com/mas-diq/htmx-basic-crud/web"
+)
+
+// serveCommand starts the web server
+func serveCommand(ctx context.Context, env *commandEnv, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	if err := run(ctx, env.cfg, env.logger); err != nil {
+		return err
+	}
+	return nil
+}
+
+// run starts the server and blocks until ctx is cancelled and the server has
+// been shut down
+func run(ctx context.Context, cfg *configs.Config, logger *slog.Logger) error {
+	app := &lifecycle{logger: logger}
+	serverErrs := make(chan error, 2)
+
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	// Initialize tracing
+	exporter := cfg.Tracing.Exporter
+	if !cfg.Features.Tracing {
+		exporter = ""
+	}
+	shutdownTracing, err := tracing.Init(ctx, exporter, os.Stdout)
+	if err != nil {
+		return err
+	}
+	app.OnShutdown("tracing", shutdownTracing)
+
+	// Initialize database
+	db, err := configs.InitDB(cfg.Database)
+	if err != nil {
+		return err
+	}
+	app.OnShutdown("database", func(context.Context) error { return db.Close() })
+
+	// Create router
+	r := gin.New()
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxyList()); err != nil {
+		return err
+	}
+	r.Use(gin.Recovery())
+	r.Use(middlewares.TracingMiddleware())
+	r.Use(middlewares.LoggerMiddleware(logger))
+
+	// Initialize metrics
+	var m *metrics.Metrics
+	if cfg.Features.Metrics {
+		m = metrics.New()
+		m.RegisterDB(db, cfg.Database.Name)
+		r.Use(middlewares.MetricsMiddleware(m))
+	}
+
+	// Load templates and static assets, from disk in dev mode
+	assets, renderer, err := loadWeb(cfg.Web)
+	if err != nil {
+		return err
+	}
+	r.HTMLRender = renderer
+
+	// Security headers, then render errors returned by handlers
+	r.Use(middlewares.SecurityHeadersMiddleware(cfg.Security))
+	r.Use(middlewares.ErrorMiddleware())
+
+	// Serve static files; registered before the CSRF middleware so assets
+	// do not issue token cookies
+	r.GET(utils.AssetPrefix+"*filepath", assets.Serve)
+
+	// Initialize repositories
+	noteRepo := repositories.NewNoteRepository(db, cfg.Database.QueryTimeout)
+	if m != nil {
+		noteRepo = repositories.NewInstrumentedNoteRepository(noteRepo, m)
+	}
+	userRepo := repositories.NewUserRepository(db, cfg.Database.QueryTimeout)
+	sessionRepo := repositories.NewSessionRepository(db, cfg.Database.QueryTimeout)
+	shareRepo := repositories.NewShareRepository(db, cfg.Database.QueryTimeout)
+	auditRepo := repositories.NewAuditRepository(db, cfg.Database.QueryTimeout)
+	webhookRepo := repositories.NewWebhookRepository(db, cfg.Database.QueryTimeout)
+	jobRepo := repositories.NewJobRepository(db, cfg.Database.QueryTimeout)
+	notificationRepo := repositories.NewNotificationRepository(db, cfg.Database.QueryTimeout)
+	templateRepo := repositories.NewNoteTemplateRepository(db, cfg.Database.QueryTimeout)
+	linkRepo := repositories.NewLinkRepository(db, cfg.Database.QueryTimeout)
+	savedSearchRepo := repositories.NewSavedSearchRepository(db, cfg.Database.QueryTimeout)
+	transferRepo := repositories.NewTransferRepository(db, cfg.Database.QueryTimeout)
+	transactor := repositories.NewTransactor(db)
+
+	// Initialize services
+	webhookService := services.NewWebhookService(webhookRepo, webhooks.NewClient(cfg.Webhooks.Timeout),
+		cfg.Webhooks.MaxAttempts, cfg.Webhooks.RetryBackoff)
+	noteService := services.NewNoteService(noteRepo, shareRepo, userRepo, auditRepo, templateRepo, linkRepo, transactor)
+	noteService = services.NewWebhookNoteService(noteService, webhookService)
+	if m != nil {
+		noteService = services.NewInstrumentedNoteService(noteService, m)
+	}
+	userService := services.NewUserService(userRepo, sessionRepo, cfg.Auth.SessionTTL)
+	auditService := services.NewAuditService(auditRepo)
+	jobService := services.NewJobService(jobRepo)
+	notificationService := services.NewNotificationService(notificationRepo)
+	templateService := services.NewTemplateService(templateRepo)
+	searchService := services.NewSearchService(noteRepo, savedSearchRepo)
+
+	// Run background jobs; registered after the database so the workers
+	// drain before it closes. Features register their job kinds on queue
+	// before it starts; only registered kinds can be queued.
+	queue := jobs.NewQueue(jobRepo, jobs.Config{
+		Concurrency:  cfg.Jobs.Concurrency,
+		PollInterval: cfg.Jobs.PollInterval,
+		Visibility:   cfg.Jobs.VisibilityTimeout,
+		MaxAttempts:  cfg.Jobs.MaxAttempts,
+		RetryBackoff: cfg.Jobs.RetryBackoff,
+	}, logger)
+	transferService := services.NewTransferService(noteService, userRepo, transferRepo, notificationRepo, transactor, queue)
+	queue.Register(services.ImportJob, transferService.Import)
+	queue.Register(services.ExportJob, transferService.Export)
+	// Without a mail server there is no email job, so none is queued
+	if cfg.SMTP.Host != "" {
+		queue.Register(mail.SendJob, mail.SendHandler(mail.NewSMTPSender(mail.Config{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			From:     cfg.SMTP.From,
+		})))
+	}
+	queue.Start()
+	app.OnShutdown("job queue", queue.Stop)
+
+	// Fire note reminders in the background; registered after the job
+	// queue so it stops before the queue it emails through
+	reminderService := services.NewReminderService(noteRepo, notificationRepo, userRepo, queue)
+	reminderScheduler := jobs.NewPeriodic("reminders", reminderService.FireDue, cfg.Reminders.PollInterval, logger)
+	reminderScheduler.Start()
+	app.OnShutdown("reminder scheduler", reminderScheduler.Stop)
+
+	// Send webhook deliveries in the background; registered after the
+	// database so it stops first
+	webhookWorker := jobs.NewPeriodic("webhook delivery", webhookService.DeliverDue, cfg.Webhooks.PollInterval, logger)
+	webhookWorker.Start()
+	app.OnShutdown("webhook worker", webhookWorker.Stop)
+
+	// Resolve the signed in user before rate limiting so limits apply per user
+	r.Use(middlewares.SessionMiddleware(userService))
+
+	// Limit request rates per client
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled {
+		limiter = newLimiter(cfg.RateLimit)
+		r.Use(middlewares.RateLimitMiddleware(limiter))
+	}
+
+	// Require a CSRF token on state-changing requests
+	if cfg.Security.CSRF {
+		if cfg.Security.CSRFKey == "" {
+			logger.Warn("security.csrf_key is not set, CSRF tokens are signed with a random key until restart")
+		}
+		r.Use(middlewares.CSRFMiddleware(cfg.Security.CSRFKey))
+	}
+
+	// Initialize handlers
+	noteHandler := handlers.NewNoteHandler(noteService, templateService, searchService, cfg.Server.BaseURL)
+	authHandler := handlers.NewAuthHandler(userService, cfg.Auth.SessionTTL)
+	adminHandler := handlers.NewAdminHandler(userService, auditService)
+	webhookHandler := handlers.NewWebhookHandler(webhookService)
+	jobHandler := handlers.NewJobHandler(jobService)
+	notificationHandler := handlers.NewNotificationHandler(notificationService)
+	templateHandler := handlers.NewTemplateHandler(templateService)
+	searchHandler := handlers.NewSearchHandler(searchService)
+	journalHandler := handlers.NewJournalHandler(noteService)
+	transferHandler := handlers.NewTransferHandler(transferService)
+	healthHandler := handlers.NewHealthHandler(db)
+
+	// Register routes
+	r.GET("/healthz", healthHandler.Liveness)
+	r.GET("/readyz", healthHandler.Readiness)
+	r.GET("/login", authHandler.LoginPage)
+	if limiter != nil {
+		r.POST("/login", middlewares.LoginRateLimitMiddleware(limiter), authHandler.Login)
+	} else {
+		r.POST("/login", authHandler.Login)
+	}
+	r.POST("/logout", authHandler.Logout)
+
+	// Public links need no login; their passwords count as login attempts
+	r.GET("/s/:token", noteHandler.SharedLink)
+	if limiter != nil {
+		r.POST("/s/:token", middlewares.LoginRateLimitMiddleware(limiter), noteHandler.SharedLink)
+	} else {
+		r.POST("/s/:token", noteHandler.SharedLink)
+	}
+
+	// Everything else needs a login. The services check every action against
+	// the user's role; the route checks below only avoid showing forms whose
+	// submission would be refused.
+	notes := r.Group("/", middlewares.RequireLogin())
+	notes.GET("/", noteHandler.Index)
+	notes.GET("/notes", noteHandler.Index)
+	notes.GET("/notes/new", middlewares.RequirePermission(domain.PermNotesWrite), noteHandler.New)
+	notes.GET("/notes/shared", noteHandler.Shared)
+	notes.GET("/notes/upcoming", noteHandler.Upcoming)
+	notes.GET("/notes/timeline", noteHandler.Timeline)
+	notes.GET("/notes/calendar", noteHandler.Calendar)
+	notes.GET("/notes/graph", noteHandler.Graph)
+	notes.GET("/notes/graph.json", noteHandler.GraphJSON)
+	notes.GET("/notes/broken-links", noteHandler.BrokenLinks)
+	notes.GET("/notes/link-suggestions", noteHandler.LinkSuggestions)
+	notes.POST("/notes", noteHandler.Create)
+	notes.GET("/notes/:id", noteHandler.Show)
+	notes.GET("/notes/:id/edit", middlewares.RequirePermission(domain.PermNotesWrite), noteHandler.Edit)
+	notes.PUT("/notes/:id", noteHandler.Update)
+	notes.DELETE("/notes/:id", noteHandler.Delete)
+	notes.GET("/notes/:id/share", noteHandler.SharePage)
+	notes.POST("/notes/:id/shares", noteHandler.Share)
+	notes.DELETE("/notes/:id/shares/:userID", noteHandler.Unshare)
+	notes.POST("/notes/:id/links", noteHandler.CreateLink)
+	notes.DELETE("/notes/:id/links/:linkID", noteHandler.RevokeLink)
+	notes.GET("/journal", journalHandler.Today)
+	notes.GET("/journal/:date", journalHandler.Show)
+	notes.POST("/journal/:date", middlewares.RequirePermission(domain.PermNotesWrite), journalHandler.Create)
+	notes.GET("/searches", searchHandler.Index)
+	notes.POST("/searches", searchHandler.Create)
+	notes.DELETE("/searches/:id", searchHandler.Delete)
+	notes.GET("/exports", transferHandler.Index)
+	notes.POST("/exports", transferHandler.Export)
+	notes.GET("/exports/:id", transferHandler.Download)
+	notes.POST("/imports", middlewares.RequirePermission(domain.PermNotesWrite), transferHandler.Import)
+
+	notes.GET("/notifications", notificationHandler.Index)
+	notes.POST("/notifications/read", notificationHandler.ReadAll)
+	notes.POST("/notifications/:id/read", notificationHandler.Read)
+	notes.GET("/account", authHandler.Account)
+	notes.POST("/account", authHandler.UpdateAccount)
+
+	templates := notes.Group("/templates", middlewares.RequirePermission(domain.PermTemplatesManage))
+	templates.GET("", templateHandler.Index)
+	templates.POST("", templateHandler.Create)
+	templates.GET("/:id/edit", templateHandler.Edit)
+	templates.POST("/:id", templateHandler.Update)
+	templates.DELETE("/:id", templateHandler.Delete)
+
+	admin := notes.Group("/admin")
+	admin.GET("/users", middlewares.RequirePermission(domain.PermUsersManage), adminHandler.Users)
+	admin.PUT("/users/:id/role", middlewares.RequirePermission(domain.PermUsersManage), adminHandler.SetRole)
+	admin.GET("/audit", middlewares.RequirePermission(domain.PermAuditRead), adminHandler.Audit)
+	admin.GET("/audit.csv", middlewares.RequirePermission(domain.PermAuditRead), adminHandler.AuditCSV)
+
+	hooks := admin.Group("/webhooks", middlewares.RequirePermission(domain.PermWebhooksManage))
+	hooks.GET("", webhookHandler.Index)
+	hooks.POST("", webhookHandler.Create)
+	hooks.GET("/:id", webhookHandler.Show)
+	hooks.DELETE("/:id", webhookHandler.Delete)
+	hooks.POST("/deliveries/:deliveryID/redeliver", webhookHandler.Redeliver)
+
+	admin.GET("/jobs", middlewares.RequirePermission(domain.PermJobsManage), jobHandler.Index)
+	admin.POST("/jobs/:id/retry", middlewares.RequirePermission(domain.PermJobsManage), jobHandler.Retry)
+
+	r.NoRoute(utils.NotFound)
+
+	// Expose metrics, on a separate admin listener when configured
+	if m != nil && cfg.Metrics.Addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m.Handler())
+		metricsServer := &http.Server{Addr: cfg.Metrics.Addr, Handler: mux, ReadHeaderTimeout: cfg.Server.ReadTimeout}
+		serve(logger, "metrics", metricsServer, configs.ServerConfig{}, serverErrs)
+		app.OnShutdown("metrics server", metricsServer.Shutdown)
+	} else if m != nil {
+		r.GET("/metrics", gin.WrapH(m.Handler()))
+	}
+
+	// Start server
+	server := &http.Server{
+		Addr:         cfg.Server.Addr,
+		Handler:      r,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+	}
+	serve(logger, "http", server, cfg.Server, serverErrs)
+	app.OnShutdown("http server", func(ctx context.Context) error {
+		healthHandler.SetDraining()
+		return server.Shutdown(ctx)
+	})
+
+	// Wait for a signal or a listener failure, then drain within the deadline
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case runErr = <-serverErrs:
+	}
+	stop()
+	logger.Info("Shutting down", "timeout", cfg.Server.ShutdownTimeout)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	return errors.Join(runErr, app.Shutdown(shutdownCtx))
+}
+
+// loadWeb returns the static assets and template renderer, embedded in the
+// binary or read from disk in dev mode
+func loadWeb(cfg configs.WebConfig) (*utils.Assets, *utils.TemplateRenderer, error) {
+	if cfg.Dev {
+		assets, err := utils.NewAssets(os.DirFS(cfg.StaticDir), true)
+		if err != nil {
+			return nil, nil, err
+		}
+		renderer, err := utils.NewReloadingTemplateRenderer(os.DirFS(cfg.TemplatesDir), assets.FuncMap())
+		return assets, renderer, err
+	}
+
+	assets, err := utils.NewAssets(web.Static, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	renderer, err := utils.NewTemplateRenderer(web.Templates, assets.FuncMap())
+	return assets, renderer, err
+}
+
+// newLimiter creates an in-memory rate limiter enforcing cfg
+func newLimiter(cfg configs.RateLimitConfig) *ratelimit.Limiter {
+	return ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.Policy{
+		Reads:            ratelimit.Limit{Requests: cfg.Reads, Per: cfg.Window},
+		Writes:           ratelimit.Limit{Requests: cfg.Writes, Per: cfg.Window},
+		Logins:           ratelimit.Limit{Requests: cfg.Logins, Per: cfg.Window},
+		LockoutThreshold: cfg.LockoutThreshold,
+		LockoutDuration:  cfg.LockoutDuration,
+	})
+}
+
+// serve runs server in the background, over TLS when tls has a certificate,
+// reporting listener failures on errs
+func serve(logger *slog.Logger, name string, server *http.Server, tls configs.ServerConfig, errs chan<- error) {
+	go func() {
+		logger.Info("Server starting", "server", name, "addr", server.Addr, "tls", tls.TLSEnabled())
+
+		var err error
+		if tls.TLSEnabled() {
+			err = server.ListenAndServeTLS(tls.TLSCertFile, tls.TLSKeyFile)
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errs <- fmt.Errorf("%s server: %w", name, err)
+		}
+	}()
+}
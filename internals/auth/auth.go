@@ -0,0 +1,63 @@
+// Package auth carries the signed in user through request contexts and
+// provides password hashing and session tokens.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SessionCookie stores the session token in the browser
+const SessionCookie = "session"
+
+type contextKey struct{}
+
+// System is the user maintenance commands run as: an admin that owns nothing
+var System = &domain.User{Username: "system", Role: domain.RoleAdmin}
+
+// WithUser returns a copy of ctx carrying user
+func WithUser(ctx context.Context, user *domain.User) context.Context {
+	return context.WithValue(ctx, contextKey{}, user)
+}
+
+// UserFromContext returns the user stored by WithUser, or nil for anonymous requests
+func UserFromContext(ctx context.Context) *domain.User {
+	user, _ := ctx.Value(contextKey{}).(*domain.User)
+	return user
+}
+
+// HashPassword returns the bcrypt hash of password
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether password matches hash
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NewToken returns a random URL-safe token
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex SHA-256 of token. Only hashes are stored so a
+// leaked table does not leak usable sessions.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,39 +1,372 @@
 package configs
 
 import (
-	"database/sql"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"strings"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
 )
 
-// InitDB initializes the database connection
-func InitDB() (*sql.DB, error) {
-	dbUser := getEnv("DB_USER", "root")
-	dbPassword := getEnv("DB_PASSWORD", "")
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnv("DB_PORT", "3306")
-	dbName := getEnv("DB_NAME", "notes_db")
+// Config is the effective application configuration.
+//
+// Every field can be set, from lowest to highest precedence, by its default,
+// the optional YAML/TOML config file (using the yaml key path, e.g.
+// server.read_timeout), the .env file and finally the environment variable
+// named by its env tag. Fields tagged secret are redacted when printed.
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Log       LogConfig       `yaml:"log"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	Web       WebConfig       `yaml:"web"`
+	Security  SecurityConfig  `yaml:"security"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Webhooks  WebhookConfig   `yaml:"webhooks"`
+	Jobs      JobConfig       `yaml:"jobs"`
+	SMTP      SMTPConfig      `yaml:"smtp"`
+	Reminders ReminderConfig  `yaml:"reminders"`
+	Features  FeatureConfig   `yaml:"features"`
+}
+
+// ServerConfig holds the HTTP server settings
+type ServerConfig struct {
+	Addr            string        `yaml:"addr" env:"SERVER_ADDR"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout     time.Duration `yaml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	TLSCertFile     string        `yaml:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile      string        `yaml:"tls_key_file" env:"TLS_KEY_FILE"`
+	// TrustedProxies lists, comma separated, the proxy IPs or CIDRs whose
+	// X-Forwarded-For header is believed; empty uses the connection address
+	TrustedProxies string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	// BaseURL is the public URL the app is reached at, e.g.
+	// https://notes.example.com; share links are built from it rather than
+	// from the request's Host header
+	BaseURL string `yaml:"base_url" env:"BASE_URL"`
+}
+
+// TrustedProxyList returns TrustedProxies as a list
+func (c ServerConfig) TrustedProxyList() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(c.TrustedProxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// TLSEnabled reports whether the server should serve HTTPS
+func (c ServerConfig) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// DatabaseConfig holds the MySQL connection and pool settings
+type DatabaseConfig struct {
+	User            string        `yaml:"user" env:"DB_USER"`
+	Password        string        `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Host            string        `yaml:"host" env:"DB_HOST"`
+	Port            int           `yaml:"port" env:"DB_PORT"`
+	Name            string        `yaml:"name" env:"DB_NAME"`
+	MaxOpenConns    int           `yaml:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+	QueryTimeout    time.Duration `yaml:"query_timeout" env:"DB_QUERY_TIMEOUT"`
+}
+
+// DSN returns the go-sql-driver/mysql data source name
+func (c DatabaseConfig) DSN() string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?parseTime=true",
+		c.User, c.Password, c.Host, c.Port, c.Name)
+}
+
+// LogConfig holds the logging settings
+type LogConfig struct {
+	Level string `yaml:"level" env:"LOG_LEVEL"`
+}
+
+// MetricsConfig holds the Prometheus settings
+type MetricsConfig struct {
+	// Addr serves /metrics on a separate admin listener; empty serves it on the main router
+	Addr string `yaml:"addr" env:"METRICS_ADDR"`
+}
+
+// TracingConfig holds the OpenTelemetry settings
+type TracingConfig struct {
+	// Exporter is "otlp", "stdout" or empty to disable exporting
+	Exporter string `yaml:"exporter" env:"TRACE_EXPORTER"`
+}
+
+// WebConfig holds the template and static asset settings
+type WebConfig struct {
+	// Dev reads templates and assets from the directories below on every
+	// request instead of using the copies embedded in the binary
+	Dev          bool   `yaml:"dev" env:"WEB_DEV"`
+	TemplatesDir string `yaml:"templates_dir" env:"WEB_TEMPLATES_DIR"`
+	StaticDir    string `yaml:"static_dir" env:"WEB_STATIC_DIR"`
+}
+
+// SecurityConfig holds the CSRF and security header settings.
+// Empty header values disable the header.
+type SecurityConfig struct {
+	CSRF bool `yaml:"csrf" env:"SECURITY_CSRF"`
+	// CSRFKey signs CSRF tokens; empty uses a random key, so tokens do not
+	// survive a restart or carry over to another instance
+	CSRFKey string `yaml:"csrf_key" env:"SECURITY_CSRF_KEY" secret:"true"`
+	// ContentSecurityPolicy replaces {nonce} with a fresh nonce on every request
+	ContentSecurityPolicy string `yaml:"content_security_policy" env:"SECURITY_CSP"`
+	// HSTSMaxAge is sent on HTTPS requests only; 0 disables HSTS
+	HSTSMaxAge        time.Duration `yaml:"hsts_max_age" env:"SECURITY_HSTS_MAX_AGE"`
+	FrameOptions      string        `yaml:"frame_options" env:"SECURITY_FRAME_OPTIONS"`
+	ReferrerPolicy    string        `yaml:"referrer_policy" env:"SECURITY_REFERRER_POLICY"`
+	PermissionsPolicy string        `yaml:"permissions_policy" env:"SECURITY_PERMISSIONS_POLICY"`
+}
+
+// RateLimitConfig holds the per-client request limits. Each limit allows
+// that many requests per Window; 0 disables it.
+type RateLimitConfig struct {
+	Enabled bool          `yaml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	Window  time.Duration `yaml:"window" env:"RATE_LIMIT_WINDOW"`
+	Reads   int           `yaml:"reads" env:"RATE_LIMIT_READS"`
+	Writes  int           `yaml:"writes" env:"RATE_LIMIT_WRITES"`
+	Logins  int           `yaml:"logins" env:"RATE_LIMIT_LOGINS"`
+	// LockoutThreshold failed logins within LockoutDuration lock the client
+	// out for the rest of LockoutDuration; 0 disables lockouts
+	LockoutThreshold int           `yaml:"lockout_threshold" env:"RATE_LIMIT_LOCKOUT_THRESHOLD"`
+	LockoutDuration  time.Duration `yaml:"lockout_duration" env:"RATE_LIMIT_LOCKOUT_DURATION"`
+}
+
+// AuthConfig holds the login session settings
+type AuthConfig struct {
+	SessionTTL time.Duration `yaml:"session_ttl" env:"AUTH_SESSION_TTL"`
+}
+
+// WebhookConfig holds the webhook delivery settings. Failed deliveries are
+// retried after RetryBackoff, doubling for every further attempt.
+type WebhookConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval" env:"WEBHOOK_POLL_INTERVAL"`
+	Timeout      time.Duration `yaml:"timeout" env:"WEBHOOK_TIMEOUT"`
+	MaxAttempts  int           `yaml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	RetryBackoff time.Duration `yaml:"retry_backoff" env:"WEBHOOK_RETRY_BACKOFF"`
+}
+
+// JobConfig holds the background job settings. A job still running after
+// VisibilityTimeout is assumed abandoned and runs again, so it must outlast
+// the slowest job.
+type JobConfig struct {
+	Concurrency       int           `yaml:"concurrency" env:"JOBS_CONCURRENCY"`
+	PollInterval      time.Duration `yaml:"poll_interval" env:"JOBS_POLL_INTERVAL"`
+	VisibilityTimeout time.Duration `yaml:"visibility_timeout" env:"JOBS_VISIBILITY_TIMEOUT"`
+	MaxAttempts       int           `yaml:"max_attempts" env:"JOBS_MAX_ATTEMPTS"`
+	RetryBackoff      time.Duration `yaml:"retry_backoff" env:"JOBS_RETRY_BACKOFF"`
+}
+
+// SMTPConfig holds the mail server reminders are emailed through. Email is
+// disabled while Host is empty.
+type SMTPConfig struct {
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     int    `yaml:"port" env:"SMTP_PORT"`
+	Username string `yaml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" env:"SMTP_PASSWORD" secret:"true"`
+	From     string `yaml:"from" env:"SMTP_FROM"`
+}
+
+// ReminderConfig holds the note reminder settings
+type ReminderConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval" env:"REMINDERS_POLL_INTERVAL"`
+}
 
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?parseTime=true",
-		dbUser, dbPassword, dbHost, dbPort, dbName)
+// FeatureConfig toggles optional features
+type FeatureConfig struct {
+	Metrics bool `yaml:"metrics" env:"FEATURE_METRICS"`
+	Tracing bool `yaml:"tracing" env:"FEATURE_TRACING"`
+}
 
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return nil, err
+// Default returns the configuration used when nothing else is set
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:            ":8080",
+			ReadTimeout:     15 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 20 * time.Second,
+			BaseURL:         "http://localhost:8080",
+		},
+		Database: DatabaseConfig{
+			User:            "root",
+			Host:            "localhost",
+			Port:            3306,
+			Name:            "notes_db",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 5 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			QueryTimeout:    5 * time.Second,
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+		Web: WebConfig{
+			TemplatesDir: "./web/templates",
+			StaticDir:    "./web/static",
+		},
+		Security: SecurityConfig{
+			CSRF: true,
+			ContentSecurityPolicy: "default-src 'self'; script-src 'self' 'nonce-{nonce}'; style-src 'self'; " +
+				"img-src 'self' data:; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'",
+			HSTSMaxAge:        365 * 24 * time.Hour,
+			FrameOptions:      "DENY",
+			ReferrerPolicy:    "strict-origin-when-cross-origin",
+			PermissionsPolicy: "camera=(), microphone=(), geolocation=(), payment=()",
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:          true,
+			Window:           time.Minute,
+			Reads:            300,
+			Writes:           60,
+			Logins:           10,
+			LockoutThreshold: 5,
+			LockoutDuration:  15 * time.Minute,
+		},
+		Auth: AuthConfig{
+			SessionTTL: 7 * 24 * time.Hour,
+		},
+		Webhooks: WebhookConfig{
+			PollInterval: 5 * time.Second,
+			Timeout:      10 * time.Second,
+			MaxAttempts:  8,
+			RetryBackoff: 30 * time.Second,
+		},
+		Jobs: JobConfig{
+			Concurrency:       4,
+			PollInterval:      time.Second,
+			VisibilityTimeout: 5 * time.Minute,
+			MaxAttempts:       5,
+			RetryBackoff:      10 * time.Second,
+		},
+		SMTP: SMTPConfig{
+			Port: 587,
+		},
+		Reminders: ReminderConfig{
+			PollInterval: 30 * time.Second,
+		},
+		Features: FeatureConfig{
+			Metrics: true,
+			Tracing: true,
+		},
 	}
+}
 
-	if err = db.Ping(); err != nil {
-		return nil, err
+// Validate checks the configuration and returns every problem found
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
 	}
 
-	return db, nil
+	check(validAddr(c.Server.Addr), "server.addr: %q is not a valid host:port", c.Server.Addr)
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout: must not be negative")
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout: must not be negative")
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout: must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout: must be positive")
+	check((c.Server.TLSCertFile == "") == (c.Server.TLSKeyFile == ""),
+		"server.tls_cert_file, server.tls_key_file: must be set together")
+	for key, file := range map[string]string{
+		"server.tls_cert_file": c.Server.TLSCertFile,
+		"server.tls_key_file":  c.Server.TLSKeyFile,
+	} {
+		if file != "" {
+			_, err := os.Stat(file)
+			check(err == nil, "%s: %v", key, err)
+		}
+	}
+
+	check(c.Database.User != "", "database.user: is required")
+	check(c.Database.Host != "", "database.host: is required")
+	check(c.Database.Port > 0 && c.Database.Port < 65536, "database.port: %d is out of range", c.Database.Port)
+	check(c.Database.Name != "", "database.name: is required")
+	check(c.Database.MaxOpenConns >= 0, "database.max_open_conns: must not be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.max_idle_conns: must not be negative")
+	check(c.Database.MaxOpenConns == 0 || c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns: must not exceed database.max_open_conns")
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime: must not be negative")
+	check(c.Database.ConnMaxIdleTime >= 0, "database.conn_max_idle_time: must not be negative")
+	check(c.Database.QueryTimeout >= 0, "database.query_timeout: must not be negative")
+
+	check(utils.ValidLogLevel(c.Log.Level), "log.level: %q is not one of debug, info, warn, error", c.Log.Level)
+	check(c.Metrics.Addr == "" || validAddr(c.Metrics.Addr), "metrics.addr: %q is not a valid host:port", c.Metrics.Addr)
+	check(c.Tracing.Exporter == "" || c.Tracing.Exporter == "otlp" || c.Tracing.Exporter == "stdout",
+		"tracing.exporter: %q is not one of otlp, stdout", c.Tracing.Exporter)
+
+	check(!c.Web.Dev || c.Web.TemplatesDir != "", "web.templates_dir: is required in dev mode")
+	check(!c.Web.Dev || c.Web.StaticDir != "", "web.static_dir: is required in dev mode")
+
+	check(c.Security.HSTSMaxAge >= 0, "security.hsts_max_age: must not be negative")
+	check(c.Security.FrameOptions == "" || c.Security.FrameOptions == "DENY" || c.Security.FrameOptions == "SAMEORIGIN",
+		"security.frame_options: %q is not one of DENY, SAMEORIGIN", c.Security.FrameOptions)
+
+	check(validBaseURL(c.Server.BaseURL), "server.base_url: %q is not an absolute http(s) URL", c.Server.BaseURL)
+	for _, proxy := range c.Server.TrustedProxyList() {
+		check(validProxy(proxy), "server.trusted_proxies: %q is not an IP address or CIDR", proxy)
+	}
+
+	check(!c.RateLimit.Enabled || c.RateLimit.Window > 0, "rate_limit.window: must be positive")
+	check(c.RateLimit.Reads >= 0, "rate_limit.reads: must not be negative")
+	check(c.RateLimit.Writes >= 0, "rate_limit.writes: must not be negative")
+	check(c.RateLimit.Logins >= 0, "rate_limit.logins: must not be negative")
+	check(c.RateLimit.LockoutThreshold >= 0, "rate_limit.lockout_threshold: must not be negative")
+	check(c.RateLimit.LockoutThreshold == 0 || c.RateLimit.LockoutDuration > 0,
+		"rate_limit.lockout_duration: must be positive when lockouts are enabled")
+
+	check(c.Auth.SessionTTL > 0, "auth.session_ttl: must be positive")
+
+	check(c.Webhooks.PollInterval > 0, "webhooks.poll_interval: must be positive")
+	check(c.Webhooks.Timeout > 0, "webhooks.timeout: must be positive")
+	check(c.Webhooks.MaxAttempts > 0, "webhooks.max_attempts: must be positive")
+	check(c.Webhooks.RetryBackoff > 0, "webhooks.retry_backoff: must be positive")
+
+	check(c.Jobs.Concurrency > 0, "jobs.concurrency: must be positive")
+	check(c.Jobs.PollInterval > 0, "jobs.poll_interval: must be positive")
+	check(c.Jobs.VisibilityTimeout > 0, "jobs.visibility_timeout: must be positive")
+	check(c.Jobs.MaxAttempts > 0, "jobs.max_attempts: must be positive")
+	check(c.Jobs.RetryBackoff > 0, "jobs.retry_backoff: must be positive")
+
+	check(c.SMTP.Port > 0 && c.SMTP.Port < 65536, "smtp.port: %d is out of range", c.SMTP.Port)
+	check(c.SMTP.Host == "" || c.SMTP.From != "", "smtp.from: is required when smtp.host is set")
+	check(c.Reminders.PollInterval > 0, "reminders.poll_interval: must be positive")
+
+	return errors.Join(errs...)
 }
 
-// getEnv retrieves the value of the environment variable named by the key
-// If the variable is not present, it returns the fallback value
-func getEnv(key, fallback string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+// validProxy reports whether proxy is an IP address or CIDR
+func validProxy(proxy string) bool {
+	if net.ParseIP(proxy) != nil {
+		return true
 	}
-	return fallback
+	_, _, err := net.ParseCIDR(proxy)
+	return err == nil
+}
+
+// validAddr reports whether addr is a host:port listen address
+func validAddr(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	return err == nil && port != ""
+}
+
+func validBaseURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" &&
+		u.RawQuery == "" && u.Fragment == ""
 }
@@ -0,0 +1,217 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secret values when the configuration is printed
+const redacted = "********"
+
+// Load builds the effective configuration from the defaults, the optional
+// config file at path (.yaml, .yml or .toml), the .env file in the working
+// directory and the environment, then validates it.
+func Load(path string) (*Config, error) {
+	return load(path, ".env", os.LookupEnv)
+}
+
+// load is Load with the .env location and environment lookup injectable
+func load(path, envFile string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := Default()
+	var errs []error
+
+	if path != "" {
+		values, err := readConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, applyFile(cfg, values))
+	}
+
+	dotenv, err := godotenv.Read(envFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("reading %s: %w", envFile, err)
+	}
+
+	errs = append(errs, applyEnv(cfg, func(key string) (string, bool) {
+		if value, ok := lookupEnv(key); ok {
+			return value, true
+		}
+		value, ok := dotenv[key]
+		return value, ok
+	}))
+
+	// Validate even when some values failed to parse so every problem is listed at once
+	errs = append(errs, cfg.Validate())
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadWithEnv is like Load but reads the environment from env and the .env
+// file from envFile instead of the process environment; used by tests
+func LoadWithEnv(path, envFile string, env map[string]string) (*Config, error) {
+	return load(path, envFile, func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	})
+}
+
+// Print writes the configuration as YAML with secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	copied := *c
+	walkFields(reflect.ValueOf(&copied).Elem(), "", func(field reflect.Value, sf reflect.StructField, _ string) {
+		if sf.Tag.Get("secret") == "true" && field.String() != "" {
+			field.SetString(redacted)
+		}
+	})
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&copied); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// readConfigFile decodes a YAML or TOML file into a generic map
+func readConfigFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	values := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format, use .yaml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// applyFile sets every field whose key path is present in values.
+// Unknown keys are reported so typos do not go unnoticed.
+func applyFile(cfg *Config, values map[string]any) error {
+	flat := map[string]any{}
+	flatten("", values, flat)
+
+	var errs []error
+	walkFields(reflect.ValueOf(cfg).Elem(), "", func(field reflect.Value, _ reflect.StructField, key string) {
+		value, ok := flat[key]
+		if !ok {
+			return
+		}
+		delete(flat, key)
+		if err := setField(field, fmt.Sprint(value)); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	})
+	for key := range flat {
+		errs = append(errs, fmt.Errorf("%s: unknown setting", key))
+	}
+	return errors.Join(errs...)
+}
+
+// applyEnv sets every field whose env variable is defined
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	var errs []error
+	walkFields(reflect.ValueOf(cfg).Elem(), "", func(field reflect.Value, sf reflect.StructField, _ string) {
+		name := sf.Tag.Get("env")
+		if name == "" {
+			return
+		}
+		value, ok := lookup(name)
+		if !ok {
+			return
+		}
+		if err := setField(field, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// flatten turns nested maps into dotted keys
+func flatten(prefix string, values map[string]any, out map[string]any) {
+	for key, value := range values {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]any); ok {
+			flatten(key, nested, out)
+			continue
+		}
+		out[key] = value
+	}
+}
+
+// walkFields calls fn for every leaf field of v with its dotted yaml key path
+func walkFields(v reflect.Value, prefix string, fn func(reflect.Value, reflect.StructField, string)) {
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		key := strings.Split(sf.Tag.Get("yaml"), ",")[0]
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			walkFields(field, key, fn)
+			continue
+		}
+		fn(field, sf, key)
+	}
+}
+
+// setField parses value into field according to its type
+func setField(field reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 5s or 1m30s", value)
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		field.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+package configs
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// InitLogger creates the application logger and installs it as the default
+// slog logger
+func InitLogger(cfg LogConfig) *slog.Logger {
+	logger := utils.NewLogger(os.Stdout, cfg.Level)
+	slog.SetDefault(logger)
+	return logger
+}
@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// AuditAction is the kind of change an audit event records
+type AuditAction string
+
+// The note mutations that are audited
+const (
+	AuditNoteCreated AuditAction = "note.created"
+	AuditNoteUpdated AuditAction = "note.updated"
+	AuditNoteDeleted AuditAction = "note.deleted"
+)
+
+// AuditActions lists every audited action
+var AuditActions = []AuditAction{AuditNoteCreated, AuditNoteUpdated, AuditNoteDeleted}
+
+// AuditEvent records who changed a note, and how. Events form a hash chain:
+// each Hash covers the event and the Hash of the event before it, so editing
+// or removing an event breaks every hash after it.
+type AuditEvent struct {
+	ID int64 `json:"id"`
+	// ActorID is 0 for the system user
+	ActorID int64 `json:"actor_id"`
+	// Actor is the username at the time of the event
+	Actor  string      `json:"actor"`
+	Action AuditAction `json:"action"`
+	NoteID int64       `json:"note_id"`
+	// BeforeHash and AfterHash are the NoteHash of the note before and after
+	// the change, empty when it did not exist
+	BeforeHash string    `json:"before_hash"`
+	AfterHash  string    `json:"after_hash"`
+	IP         string    `json:"ip"`
+	RequestID  string    `json:"request_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	PrevHash   string    `json:"prev_hash"`
+	Hash       string    `json:"hash"`
+}
+
+// ChainHash returns the hash of the event when it follows an event hashed
+// prevHash. CreatedAt is hashed at microsecond precision, as it is stored.
+func (e *AuditEvent) ChainHash(prevHash string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%q|%d|%q|%q|%d|%q|%q|%q|%q|%s",
+		prevHash, e.ActorID, e.Actor, e.Action, e.NoteID, e.BeforeHash, e.AfterHash, e.IP, e.RequestID,
+		e.CreatedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano))))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditFilter selects audit events; zero fields match everything
+type AuditFilter struct {
+	Actor  string
+	Action AuditAction
+	NoteID int64
+	// From and To bound CreatedAt, To exclusive
+	From time.Time
+	To   time.Time
+	// Limit caps the number of events, newest first; 0 returns all
+	Limit int
+}
+
+// NoteHash returns the hex SHA-256 of a note's title and content, or "" for nil
+func NoteHash(note *Note) string {
+	if note == nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%q|%q", note.Title, note.Content)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,50 @@
+package domain
+
+import "time"
+
+// JobStatus is the state of a background job
+type JobStatus string
+
+// The states of a job. Queued jobs run once RunAt has passed; a failed
+// attempt queues the job again until it runs out of attempts and is dead.
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobDead      JobStatus = "dead"
+)
+
+// JobStatuses lists every job state in the order of a job's life
+var JobStatuses = []JobStatus{JobQueued, JobRunning, JobSucceeded, JobDead}
+
+// Job is a unit of work run outside the request that queued it. Kind
+// selects the handler and Payload is its JSON input.
+type Job struct {
+	ID          int64     `json:"id"`
+	Kind        string    `json:"kind"`
+	Payload     []byte    `json:"-"`
+	Status      JobStatus `json:"status"`
+	Attempts    int       `json:"attempts"`
+	MaxAttempts int       `json:"max_attempts"`
+	// RunAt is when a queued job is due
+	RunAt time.Time `json:"run_at"`
+	// LockedUntil is when a running job's lease expires; a job still
+	// running then is assumed abandoned and runs again
+	LockedUntil time.Time `json:"locked_until,omitempty"`
+	// LastError is the error of the last failed attempt
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MaxJobError is the longest LastError stored, the size of the
+// jobs.last_error column
+const MaxJobError = 255
+
+// JobFilter selects jobs; zero fields match every job
+type JobFilter struct {
+	Status JobStatus
+	Kind   string
+	// Limit caps the number of jobs returned, 0 returns all
+	Limit int
+}
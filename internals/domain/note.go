@@ -2,13 +2,25 @@ package domain
 
 import "time"
 
-// Note represents a note entity
+// Note represents a note entity. UserID is its owner, or 0 for notes
+// created before accounts existed, which only admins can see.
 type Note struct {
 	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id,omitempty"`
 	Title     string    `json:"title"`
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// DueAt is when the note's follow-up is due and RemindAt when its owner
+	// is reminded of it; both are zero when unset
+	DueAt    time.Time `json:"due_at,omitempty"`
+	RemindAt time.Time `json:"remind_at,omitempty"`
+	// JournalDate is the day a journal note is the entry for, as returned
+	// by DateOf, and zero for other notes. Each user has one entry a day.
+	JournalDate time.Time `json:"journal_date,omitempty"`
+	// Grant is the permission the note is shared with to the user it was
+	// loaded for, empty when it is not shared with them
+	Grant SharePermission `json:"-"`
 }
 
 // NewNote creates a new note
@@ -21,3 +33,15 @@ func NewNote(title, content string) *Note {
 		UpdatedAt: now,
 	}
 }
+
+// DateOf returns the calendar date of t in its location as midnight UTC, so
+// dates compare equal whatever time zone they were taken in
+func DateOf(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// Overdue reports whether the note was due before now
+func (n *Note) Overdue(now time.Time) bool {
+	return !n.DueAt.IsZero() && n.DueAt.Before(now)
+}
@@ -0,0 +1,186 @@
+package domain
+
+import (
+	"cmp"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Ways a note can mention another in its content
+const (
+	// MentionURL is a mention of the note's /notes/:id URL
+	MentionURL = "url"
+	// MentionTitle is a mention of the note's exact title
+	MentionTitle = "title"
+)
+
+// NoteGraph is the graph of notes mentioning each other
+type NoteGraph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+	// Truncated reports that only the most linked notes of a larger graph
+	// are included
+	Truncated bool `json:"truncated"`
+}
+
+// GraphNode is a note in a NoteGraph
+type GraphNode struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	// Depth is the number of edges between the note and the focus note,
+	// 0 for the focus note itself or when the graph has no focus
+	Depth int `json:"depth"`
+}
+
+// GraphEdge is a mention of the Target note in the content of Source
+type GraphEdge struct {
+	Source int64 `json:"source"`
+	Target int64 `json:"target"`
+	// Via is MentionURL or MentionTitle, the former when the note mentions both
+	Via string `json:"via"`
+}
+
+// noteURL matches the path of a note, such as /notes/42 in a pasted URL
+var noteURL = regexp.MustCompile(`/notes/(\d+)`)
+
+// NoteMentions returns how content mentions other notes, by their ID: the
+// notes whose /notes/:id URL it contains, whether or not they exist, and
+// those among notes whose exact title it contains
+func NoteMentions(content string, notes []GraphNode) map[int64]string {
+	mentioned := make(map[int64]string)
+	for _, match := range noteURL.FindAllStringSubmatch(content, -1) {
+		if id, err := strconv.ParseInt(match[1], 10, 64); err == nil {
+			mentioned[id] = MentionURL
+		}
+	}
+	for _, note := range notes {
+		if _, ok := mentioned[note.ID]; !ok && mentionsTitle(content, note.Title) {
+			mentioned[note.ID] = MentionTitle
+		}
+	}
+	return mentioned
+}
+
+// mentionsTitle reports whether content contains title as a whole phrase,
+// so the title "Go" is not found in "Google"
+func mentionsTitle(content, title string) bool {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return false
+	}
+	for offset := 0; ; {
+		i := strings.Index(content[offset:], title)
+		if i < 0 {
+			return false
+		}
+		start, end := offset+i, offset+i+len(title)
+		before, _ := utf8.DecodeLastRuneInString(content[:start])
+		after, _ := utf8.DecodeRuneInString(content[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+		_, size := utf8.DecodeRuneInString(content[start:])
+		offset = start + size
+	}
+}
+
+// isWordRune reports whether r continues a word
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// Around returns the part of the graph within depth edges of the focus
+// note, following edges in either direction, or nil if the focus note is
+// not in the graph
+func (g *NoteGraph) Around(focus int64, depth int) *NoteGraph {
+	neighbours := make(map[int64][]int64)
+	for _, edge := range g.Edges {
+		neighbours[edge.Source] = append(neighbours[edge.Source], edge.Target)
+		neighbours[edge.Target] = append(neighbours[edge.Target], edge.Source)
+	}
+
+	depths := make(map[int64]int)
+	for _, node := range g.Nodes {
+		if node.ID == focus {
+			depths[focus] = 0
+		}
+	}
+	if _, ok := depths[focus]; !ok {
+		return nil
+	}
+	frontier := []int64{focus}
+	for d := 1; d <= depth && len(frontier) > 0; d++ {
+		var next []int64
+		for _, id := range frontier {
+			for _, neighbour := range neighbours[id] {
+				if _, seen := depths[neighbour]; !seen {
+					depths[neighbour] = d
+					next = append(next, neighbour)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	around := &NoteGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for _, node := range g.Nodes {
+		if d, ok := depths[node.ID]; ok {
+			node.Depth = d
+			around.Nodes = append(around.Nodes, node)
+		}
+	}
+	for _, edge := range g.Edges {
+		_, source := depths[edge.Source]
+		_, target := depths[edge.Target]
+		if source && target {
+			around.Edges = append(around.Edges, edge)
+		}
+	}
+	return around
+}
+
+// MostLinked returns the part of the graph made of its n notes with the
+// most edges, in either direction, and the edges between them, marked as
+// truncated when notes were left out. The keep note, such as the focus
+// note, is always included; ties go to the lower ID.
+func (g *NoteGraph) MostLinked(n int, keep int64) *NoteGraph {
+	if len(g.Nodes) <= n {
+		return g
+	}
+	degrees := make(map[int64]int)
+	for _, edge := range g.Edges {
+		degrees[edge.Source]++
+		degrees[edge.Target]++
+	}
+	ranked := slices.Clone(g.Nodes)
+	slices.SortFunc(ranked, func(a, b GraphNode) int {
+		switch keep {
+		case a.ID:
+			return -1
+		case b.ID:
+			return 1
+		}
+		return cmp.Or(cmp.Compare(degrees[b.ID], degrees[a.ID]), cmp.Compare(a.ID, b.ID))
+	})
+	included := make(map[int64]bool, n)
+	for _, node := range ranked[:n] {
+		included[node.ID] = true
+	}
+
+	top := &NoteGraph{Nodes: []GraphNode{}, Edges: []GraphEdge{}, Truncated: true}
+	for _, node := range g.Nodes {
+		if included[node.ID] {
+			top.Nodes = append(top.Nodes, node)
+		}
+	}
+	for _, edge := range g.Edges {
+		if included[edge.Source] && included[edge.Target] {
+			top.Edges = append(top.Edges, edge)
+		}
+	}
+	return top
+}
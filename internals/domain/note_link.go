@@ -0,0 +1,109 @@
+package domain
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// NoteLink is a [[Title]] link in the content of a note. Links resolve to
+// the oldest note of the same owner with that title, compared without
+// regard to case.
+type NoteLink struct {
+	SourceID int64 `json:"source_id"`
+	// SourceTitle is the title of the linking note, loaded where listed
+	SourceTitle string `json:"source_title,omitempty"`
+	TargetTitle string `json:"target_title"`
+	// TargetID is the note the link resolves to, 0 while it is broken
+	TargetID int64 `json:"target_id,omitempty"`
+}
+
+// Broken reports whether no note has the title the link points to
+func (l *NoteLink) Broken() bool {
+	return l.TargetID == 0
+}
+
+// ContentPart is a piece of note content: plain Text, or a link to the
+// note titled Link
+type ContentPart struct {
+	Text string
+	Link string
+}
+
+// maxLinkTitle is the longest title a link can point to, the size of the
+// notes.title column
+const maxLinkTitle = 255
+
+// wikiLink matches a [[Title]] link on a single line
+var wikiLink = regexp.MustCompile(`\[\[([^\[\]\n]+)\]\]`)
+
+// linkTitle returns the title a matched [[...]] points to, or "" if it is
+// not a valid link
+func linkTitle(inner string) string {
+	title := strings.TrimSpace(inner)
+	if utf8.RuneCountInString(title) > maxLinkTitle {
+		return ""
+	}
+	return title
+}
+
+// Linkable reports whether a [[Title]] link can point to title, which
+// rules out titles with brackets or line breaks
+func Linkable(title string) bool {
+	return linkTitle(title) != "" && !strings.ContainsAny(title, "[]\n")
+}
+
+// WikiLinks returns the titles content links to, in order of first
+// appearance and without repeats
+func WikiLinks(content string) []string {
+	var titles []string
+	seen := make(map[string]bool)
+	for _, match := range wikiLink.FindAllStringSubmatch(content, -1) {
+		title := linkTitle(match[1])
+		if title == "" || seen[strings.ToLower(title)] {
+			continue
+		}
+		seen[strings.ToLower(title)] = true
+		titles = append(titles, title)
+	}
+	return titles
+}
+
+// SplitWikiLinks splits content into plain text and links, so templates can
+// render the links while escaping everything else
+func SplitWikiLinks(content string) []ContentPart {
+	var parts []ContentPart
+	last := 0
+	for _, loc := range wikiLink.FindAllStringSubmatchIndex(content, -1) {
+		title := linkTitle(content[loc[2]:loc[3]])
+		if title == "" {
+			continue
+		}
+		if loc[0] > last {
+			parts = append(parts, ContentPart{Text: content[last:loc[0]]})
+		}
+		parts = append(parts, ContentPart{Link: title})
+		last = loc[1]
+	}
+	if last < len(content) {
+		parts = append(parts, ContentPart{Text: content[last:]})
+	}
+	return parts
+}
+
+// RenameWikiLinks points the links to oldTitle in content at newTitle and
+// reports whether there were any
+func RenameWikiLinks(content, oldTitle, newTitle string) (string, bool) {
+	if !Linkable(newTitle) {
+		return content, false
+	}
+	renamed := false
+	content = wikiLink.ReplaceAllStringFunc(content, func(match string) string {
+		if !strings.EqualFold(linkTitle(match[2:len(match)-2]), strings.TrimSpace(oldTitle)) {
+			return match
+		}
+		renamed = true
+		return "[[" + strings.TrimSpace(newTitle) + "]]"
+	})
+	return content, renamed
+}
@@ -0,0 +1,34 @@
+package domain
+
+import "time"
+
+// NoteTemplate is a skeleton that new notes can start from, shared by every
+// user. Its title and content may contain variables such as {{date}} that
+// are expanded when a note is created from it.
+type NoteTemplate struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+	// Counter is the number of notes created from the template, which the
+	// {{counter}} variable expands to
+	Counter int64 `json:"counter"`
+	// CreatedBy is the user who created the template, 0 once they are deleted
+	CreatedBy int64     `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// MaxTemplateName is the longest Name, in characters, the size of the
+// note_templates.name column
+const MaxTemplateName = 100
+
+// TemplateVariables lists the variables expanded in note templates with
+// what they stand for, in the order the help text shows them
+var TemplateVariables = []struct{ Name, Description string }{
+	{"date", "today's date, e.g. 2024-03-15"},
+	{"time", "the current time, e.g. 09:30"},
+	{"weekday", "today's weekday, e.g. Friday"},
+	{"user", "the username of whoever creates the note"},
+	{"counter", "1 for the first note created from the template, 2 for the second, and so on"},
+}
@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// NoteImport is an uploaded JSON export whose notes are created in the
+// background for the user who uploaded it
+type NoteImport struct {
+	ID     int64  `json:"id"`
+	UserID int64  `json:"user_id"`
+	Body   []byte `json:"-"`
+	// Imported is the number of notes of Body created so far
+	Imported  int       `json:"imported"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NoteExport is a JSON export of the notes a user can read, written in the
+// background for them to download
+type NoteExport struct {
+	ID     int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+	// Notes is the number of notes in Body
+	Notes int `json:"notes"`
+	// Body is the JSON array of the notes, loaded only for a download
+	Body      []byte    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,25 @@
+package domain
+
+import "time"
+
+// Notification is a message shown to a user in the navbar, such as a
+// reminder of one of their notes
+type Notification struct {
+	ID     int64 `json:"id"`
+	UserID int64 `json:"user_id"`
+	// NoteID is the note the notification is about, 0 for none
+	NoteID    int64     `json:"note_id,omitempty"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+	// ReadAt is zero until the user has read the notification
+	ReadAt time.Time `json:"read_at,omitempty"`
+}
+
+// MaxNotificationMessage is the longest Message stored, the size of the
+// notifications.message column
+const MaxNotificationMessage = 255
+
+// Unread reports whether the user has not read the notification yet
+func (n *Notification) Unread() bool {
+	return n.ReadAt.IsZero()
+}
@@ -0,0 +1,200 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Fields a search term can filter on
+const (
+	// SearchText matches the title or content of a note
+	SearchText = ""
+	// SearchTitle matches the title of a note
+	SearchTitle = "title"
+	// SearchCreated matches the creation time of a note
+	SearchCreated = NoteCreated
+	// SearchUpdated matches the last update time of a note
+	SearchUpdated = NoteUpdated
+)
+
+// MaxSearchQuery is the longest search query, in characters
+const MaxSearchQuery = 500
+
+// maxSearchTerms caps the terms of a query, each of which adds a condition
+// to the database query
+const maxSearchTerms = 20
+
+// SearchQuery is a parsed search for notes. A note matches when it matches
+// every term.
+type SearchQuery struct {
+	Terms []SearchTerm
+}
+
+// SearchTerm is a condition of a SearchQuery
+type SearchTerm struct {
+	// Field is SearchText, SearchTitle, SearchCreated or SearchUpdated
+	Field string
+	// Negate inverts the term, for a leading -
+	Negate bool
+	// Text is the text searched for by text and title terms, matched
+	// anywhere without regard to case
+	Text string
+	// From and To bound the times matched by date terms: From is included
+	// and To is not. A zero time leaves that end open.
+	From time.Time
+	To   time.Time
+}
+
+// SavedSearch is a search query a user saved under a name
+type SavedSearch struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	Query     string    `json:"query"`
+	CreatedAt time.Time `json:"created_at"`
+	// Count is the number of notes the query matches, loaded where listed
+	Count int `json:"count"`
+}
+
+// MaxSavedSearchName is the longest Name, in characters, the size of the
+// saved_searches.name column
+const MaxSavedSearchName = 100
+
+// ParseSearchQuery parses a search such as
+//
+//	budget -draft title:"q3 plans" created:>2026-01-01 updated:7d
+//
+// Words and "quoted phrases" match the title or content, title: matches the
+// title only, and created: and updated: take a date, optionally after >,
+// >=, < or <=, or a period such as 7d or 2w meaning within the last 7 days
+// or 2 weeks. A leading - negates a term. Dates are days in the location of
+// now, and periods count back from now.
+func ParseSearchQuery(input string, now time.Time) (*SearchQuery, error) {
+	if utf8.RuneCountInString(input) > MaxSearchQuery {
+		return nil, fmt.Errorf("searches are limited to %d characters", MaxSearchQuery)
+	}
+
+	query := &SearchQuery{}
+	for _, token := range splitSearch(input) {
+		term := SearchTerm{Field: SearchText, Negate: token.negate, Text: token.text}
+		if field, value, ok := strings.Cut(token.text, ":"); ok && !token.quotedField {
+			switch strings.ToLower(field) {
+			case SearchTitle:
+				term.Field, term.Text = SearchTitle, value
+				if value == "" {
+					return nil, errors.New("title: needs some text, such as title:plans")
+				}
+			case SearchCreated, SearchUpdated:
+				from, to, err := parseSearchDate(value, now)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", strings.ToLower(field), err)
+				}
+				term = SearchTerm{Field: strings.ToLower(field), Negate: term.Negate, From: from, To: to}
+			}
+		}
+		if term.Field == SearchText && term.Text == "" {
+			continue
+		}
+		query.Terms = append(query.Terms, term)
+	}
+	if len(query.Terms) > maxSearchTerms {
+		return nil, fmt.Errorf("searches are limited to %d terms", maxSearchTerms)
+	}
+	return query, nil
+}
+
+// searchToken is a word or quoted phrase of a search query
+type searchToken struct {
+	text   string
+	negate bool
+	// quotedField is set when the token starts with a quote, so a colon
+	// in it does not name a field
+	quotedField bool
+}
+
+// splitSearch splits a search query into words and "quoted phrases"; an
+// unterminated quote runs to the end of the query and a lone - is ignored
+func splitSearch(input string) []searchToken {
+	var tokens []searchToken
+	var current strings.Builder
+	var token searchToken
+	inToken, quoted := false, false
+	flush := func() {
+		if inToken {
+			token.text = current.String()
+			tokens = append(tokens, token)
+		}
+		current.Reset()
+		token = searchToken{}
+		inToken = false
+	}
+
+	for _, r := range input {
+		switch {
+		case r == '"':
+			if !inToken {
+				token.quotedField = true
+			}
+			inToken = true
+			quoted = !quoted
+		case !quoted && (r == ' ' || r == '\t' || r == '\n' || r == '\r'):
+			flush()
+		case r == '-' && !inToken && !quoted && !token.negate:
+			token.negate = true
+		default:
+			inToken = true
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// parseSearchDate parses the value of a created: or updated: term into the
+// range of times it matches
+func parseSearchDate(value string, now time.Time) (from, to time.Time, err error) {
+	if value == "" {
+		return from, to, errors.New("needs a date such as 2026-01-01 or a period such as 7d")
+	}
+
+	// Periods count back from now
+	if unit := value[len(value)-1]; unit == 'd' || unit == 'w' {
+		n, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil || n < 1 || n > 36500 {
+			return from, to, fmt.Errorf("%q is not a period such as 7d or 2w", value)
+		}
+		if unit == 'w' {
+			n *= 7
+		}
+		return now.AddDate(0, 0, -n), time.Time{}, nil
+	}
+
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<"} {
+		if strings.HasPrefix(value, prefix) {
+			op, value = prefix, value[len(prefix):]
+			break
+		}
+	}
+	day, err := time.ParseInLocation(time.DateOnly, value, now.Location())
+	if err != nil || day.Year() < 1000 {
+		return from, to, fmt.Errorf("%q is not a date such as 2026-01-01", value)
+	}
+	next := day.AddDate(0, 0, 1)
+	switch op {
+	case ">":
+		return next, time.Time{}, nil
+	case ">=":
+		return day, time.Time{}, nil
+	case "<":
+		return time.Time{}, day, nil
+	case "<=":
+		return time.Time{}, next, nil
+	default:
+		return day, next, nil
+	}
+}
@@ -0,0 +1,48 @@
+package domain
+
+import "time"
+
+// SharePermission is what a share grant allows its user to do with a note
+type SharePermission string
+
+// The permissions a note can be shared with
+const (
+	ShareRead SharePermission = "read"
+	ShareEdit SharePermission = "edit"
+)
+
+// Valid reports whether p is a known share permission
+func (p SharePermission) Valid() bool {
+	return p == ShareRead || p == ShareEdit
+}
+
+// Share grants a user other than the owner access to a note
+type Share struct {
+	NoteID     int64           `json:"note_id"`
+	UserID     int64           `json:"user_id"`
+	Username   string          `json:"username"`
+	Permission SharePermission `json:"permission"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// ShareLink is a public read-only link to a note. Only the hash of its token
+// is stored; the token itself is shown once when the link is created.
+type ShareLink struct {
+	ID           int64  `json:"id"`
+	NoteID       int64  `json:"note_id"`
+	TokenHash    string `json:"-"`
+	PasswordHash string `json:"-"`
+	// ExpiresAt is zero for links that never expire
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HasPassword reports whether the link asks for a password
+func (l *ShareLink) HasPassword() bool {
+	return l.PasswordHash != ""
+}
+
+// Expired reports whether the link no longer works at now
+func (l *ShareLink) Expired(now time.Time) bool {
+	return !l.ExpiresAt.IsZero() && !now.Before(l.ExpiresAt)
+}
@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"time"
+)
+
+// Times of a note that notes can be filtered and grouped by
+const (
+	// NoteCreated is the creation time of a note
+	NoteCreated = "created"
+	// NoteUpdated is the last update time of a note
+	NoteUpdated = "updated"
+)
+
+// Periods a timeline groups notes by
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+)
+
+// DateRange selects the notes whose created or updated time falls from From
+// up to but excluding To. A zero time leaves that end open.
+type DateRange struct {
+	// Field is NoteCreated or NoteUpdated
+	Field string
+	From  time.Time
+	To    time.Time
+}
+
+// IsZero reports whether the range is open at both ends
+func (r DateRange) IsZero() bool {
+	return r.From.IsZero() && r.To.IsZero()
+}
+
+// Valid reports whether the range names a known field and does not end
+// before it starts
+func (r DateRange) Valid() bool {
+	if r.Field != NoteCreated && r.Field != NoteUpdated {
+		return false
+	}
+	return r.From.IsZero() || r.To.IsZero() || r.From.Before(r.To)
+}
+
+// Time returns the time of note the range selects by
+func (r DateRange) Time(note *Note) time.Time {
+	if r.Field == NoteUpdated {
+		return note.UpdatedAt
+	}
+	return note.CreatedAt
+}
+
+// TimelineGroup is the notes of one day, week or month of a timeline
+type TimelineGroup struct {
+	// Start is the first date of the period, as returned by DateOf
+	Start  time.Time
+	Period string
+	Notes  []*Note
+}
+
+// Label names the period of the group, e.g. "Week of 2 March 2026"
+func (g TimelineGroup) Label() string {
+	switch g.Period {
+	case PeriodWeek:
+		return g.Start.Format("Week of 2 January 2006")
+	case PeriodMonth:
+		return g.Start.Format("January 2006")
+	default:
+		return g.Start.Format("Monday, 2 January 2006")
+	}
+}
+
+// ValidPeriod reports whether period is PeriodDay, PeriodWeek or PeriodMonth
+func ValidPeriod(period string) bool {
+	return period == PeriodDay || period == PeriodWeek || period == PeriodMonth
+}
+
+// PeriodStart returns the first date of the period containing date, which
+// is taken as a calendar date as DateOf returns. Weeks start on Monday.
+func PeriodStart(date time.Time, period string) time.Time {
+	date = DateOf(date)
+	switch period {
+	case PeriodWeek:
+		return date.AddDate(0, 0, -int((date.Weekday()+6)%7))
+	case PeriodMonth:
+		return date.AddDate(0, 0, 1-date.Day())
+	default:
+		return date
+	}
+}
+
+// GroupNotes groups notes by the period their created or updated time, as
+// dates.Field selects, falls in when taken in loc. Notes keep their order
+// and groups follow the order of their first note, so notes sorted by that
+// time give groups sorted the same way.
+func GroupNotes(notes []*Note, dates DateRange, period string, loc *time.Location) []TimelineGroup {
+	var groups []TimelineGroup
+	index := make(map[time.Time]int)
+	for _, note := range notes {
+		start := PeriodStart(dates.Time(note).In(loc), period)
+		i, ok := index[start]
+		if !ok {
+			i = len(groups)
+			index[start] = i
+			groups = append(groups, TimelineGroup{Start: start, Period: period})
+		}
+		groups[i].Notes = append(groups[i].Notes, note)
+	}
+	return groups
+}
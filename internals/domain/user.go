@@ -0,0 +1,126 @@
+package domain
+
+import (
+	"slices"
+	"time"
+)
+
+// Role is a named set of permissions assigned to a user
+type Role string
+
+// The roles a user can have
+const (
+	RoleAdmin  Role = "admin"
+	RoleEditor Role = "editor"
+	RoleViewer Role = "viewer"
+)
+
+// Roles lists every role from most to least privileged
+var Roles = []Role{RoleAdmin, RoleEditor, RoleViewer}
+
+// Permission allows a user to perform an action
+type Permission string
+
+// The permissions granted by roles
+const (
+	// PermNotesRead allows reading the notes a user owns
+	PermNotesRead Permission = "notes:read"
+	// PermNotesWrite allows creating notes and editing or deleting the notes a user owns
+	PermNotesWrite Permission = "notes:write"
+	// PermNotesReadAll allows reading every note
+	PermNotesReadAll Permission = "notes:read_all"
+	// PermNotesEditAll allows editing and deleting every note
+	PermNotesEditAll Permission = "notes:edit_all"
+	// PermUsersManage allows listing users and assigning their roles
+	PermUsersManage Permission = "users:manage"
+	// PermAuditRead allows reading and exporting the audit log
+	PermAuditRead Permission = "audit:read"
+	// PermWebhooksManage allows managing webhook subscriptions and their deliveries
+	PermWebhooksManage Permission = "webhooks:manage"
+	// PermJobsManage allows listing background jobs and retrying dead ones
+	PermJobsManage Permission = "jobs:manage"
+	// PermTemplatesManage allows creating, editing and deleting note templates
+	PermTemplatesManage Permission = "templates:manage"
+)
+
+// rolePermissions maps every role to the permissions it grants
+var rolePermissions = map[Role][]Permission{
+	RoleAdmin:  {PermNotesRead, PermNotesWrite, PermNotesReadAll, PermNotesEditAll, PermUsersManage, PermAuditRead, PermWebhooksManage, PermJobsManage, PermTemplatesManage},
+	RoleEditor: {PermNotesRead, PermNotesWrite, PermTemplatesManage},
+	RoleViewer: {PermNotesRead},
+}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role grants p
+func (r Role) Can(p Permission) bool {
+	return slices.Contains(rolePermissions[r], p)
+}
+
+// User represents an account that can sign in
+type User struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	// Email receives reminders; empty when the user has not set one
+	Email string `json:"email,omitempty"`
+	// Timezone is the IANA name of the user's time zone, such as
+	// Europe/Berlin; empty for the server's
+	Timezone     string    `json:"timezone,omitempty"`
+	PasswordHash string    `json:"-"`
+	Role         Role      `json:"role"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Sizes of the users columns, the longest values stored
+const (
+	// MaxEmailLength is the size of users.email
+	MaxEmailLength = 255
+	// MaxTimezoneLength is the size of users.timezone
+	MaxTimezoneLength = 64
+)
+
+// Location returns the user's time zone, falling back to the server's when
+// they have none or it is unknown
+func (u *User) Location() *time.Location {
+	if u == nil || u.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(u.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// Can reports whether the user's role grants p; a nil user has no permissions.
+// Templates use it to hide actions, e.g. {{ if .Can "notes:write" }}.
+func (u *User) Can(p Permission) bool {
+	return u != nil && u.Role.Can(p)
+}
+
+// Owns reports whether the user owns note
+func (u *User) Owns(note *Note) bool {
+	return u != nil && note != nil && note.UserID != 0 && note.UserID == u.ID
+}
+
+// CanRead reports whether the user may read note, because they own it or
+// it is shared with them
+func (u *User) CanRead(note *Note) bool {
+	return u.Can(PermNotesReadAll) || (u.Can(PermNotesRead) && (u.Owns(note) || (note != nil && note.Grant.Valid())))
+}
+
+// CanEdit reports whether the user may edit or delete note. Shares never
+// lift a role's limits: viewers stay read-only whatever they are granted.
+func (u *User) CanEdit(note *Note) bool {
+	return u.CanShare(note) || (u.Can(PermNotesWrite) && note != nil && note.Grant == ShareEdit)
+}
+
+// CanShare reports whether the user may share note and manage its links,
+// which is left to its owner and admins
+func (u *User) CanShare(note *Note) bool {
+	return u.Can(PermNotesEditAll) || (u.Can(PermNotesWrite) && u.Owns(note))
+}
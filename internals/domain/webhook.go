@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"slices"
+	"time"
+)
+
+// WebhookEvent names a change webhooks can subscribe to
+type WebhookEvent string
+
+// The events sent to webhooks
+const (
+	WebhookNoteCreated WebhookEvent = "note.created"
+	WebhookNoteUpdated WebhookEvent = "note.updated"
+	WebhookNoteDeleted WebhookEvent = "note.deleted"
+)
+
+// WebhookEvents lists every event webhooks can subscribe to
+var WebhookEvents = []WebhookEvent{WebhookNoteCreated, WebhookNoteUpdated, WebhookNoteDeleted}
+
+// Valid reports whether e is a known event
+func (e WebhookEvent) Valid() bool {
+	return slices.Contains(WebhookEvents, e)
+}
+
+// Webhook is a subscription that receives the events it lists as signed
+// JSON POST requests to its URL
+type Webhook struct {
+	ID  int64  `json:"id"`
+	URL string `json:"url"`
+	// Secret is the HMAC-SHA256 key signing every delivery
+	Secret    string         `json:"-"`
+	Events    []WebhookEvent `json:"events"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// Subscribes reports whether the webhook receives e
+func (w *Webhook) Subscribes(e WebhookEvent) bool {
+	return slices.Contains(w.Events, e)
+}
+
+// DeliveryStatus is the state of a webhook delivery
+type DeliveryStatus string
+
+// The states of a delivery: pending ones are retried until they succeed or
+// run out of attempts and fail
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event queued for, or sent to, a webhook
+type WebhookDelivery struct {
+	ID        int64          `json:"id"`
+	WebhookID int64          `json:"webhook_id"`
+	Event     WebhookEvent   `json:"event"`
+	Payload   []byte         `json:"-"`
+	Status    DeliveryStatus `json:"status"`
+	Attempts  int            `json:"attempts"`
+	// NextAttemptAt is when a pending delivery is due
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	// ResponseCode and Error describe the last attempt
+	ResponseCode int       `json:"response_code,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// MaxDeliveryError is the longest Error stored, the size of the
+// webhook_deliveries.error column
+const MaxDeliveryError = 255
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// AdminHandler handles the user administration and audit log pages
+type AdminHandler struct {
+	userService  services.UserService
+	auditService services.AuditService
+}
+
+// NewAdminHandler creates a new admin handler
+func NewAdminHandler(userService services.UserService, auditService services.AuditService) *AdminHandler {
+	return &AdminHandler{userService, auditService}
+}
+
+// userRow is a row of the user table
+type userRow struct {
+	User  *domain.User
+	Roles []domain.Role
+	// Self marks the signed in admin, whose role cannot be changed
+	Self bool
+}
+
+// Users renders the user list with a role picker per user
+func (h *AdminHandler) Users(c *gin.Context) {
+	users, err := h.userService.GetAllUsers(c.Request.Context())
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch users")
+		return
+	}
+
+	rows := make([]userRow, 0, len(users))
+	for _, user := range users {
+		rows = append(rows, newUserRow(c.Request.Context(), user))
+	}
+	utils.HTMLResponse(c, http.StatusOK, "admin/users.html", gin.H{
+		"title": "Users",
+		"rows":  rows,
+	})
+}
+
+// SetRole assigns the submitted role to a user
+func (h *AdminHandler) SetRole(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "Invalid user ID")
+		return
+	}
+
+	user, err := h.userService.SetRole(c.Request.Context(), id, domain.Role(c.PostForm("role")))
+	if err != nil {
+		h.serviceError(c, err, "Failed to change the role")
+		return
+	}
+
+	if utils.IsHTMXRequest(c) {
+		utils.HTMLResponse(c, http.StatusOK, "partials/user_row.html", gin.H{
+			"row": newUserRow(c.Request.Context(), user),
+		})
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/users")
+}
+
+// newUserRow describes user for the user table shown to the user in ctx
+func newUserRow(ctx context.Context, user *domain.User) userRow {
+	self := auth.UserFromContext(ctx)
+	return userRow{User: user, Roles: domain.Roles, Self: self != nil && self.ID == user.ID}
+}
+
+// serviceError records a user service error with the matching status
+func (h *AdminHandler) serviceError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		_ = c.Error(utils.NewNotFoundError("User not found"))
+	case errors.Is(err, services.ErrInvalidRole):
+		_ = c.Error(utils.NewBadRequestError("Unknown role"))
+	case errors.Is(err, services.ErrOwnRole):
+		_ = c.Error(utils.NewBadRequestError("You cannot change your own role"))
+	case errors.Is(err, services.ErrUnauthenticated):
+		_ = c.Error(utils.NewUnauthorizedError("Please log in"))
+	case errors.Is(err, services.ErrForbidden):
+		_ = c.Error(utils.NewForbiddenError("You do not have permission to do this"))
+	default:
+		_ = c.Error(utils.NewInternalError(message, err))
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// AuthHandler handles logging in and out
+type AuthHandler struct {
+	userService services.UserService
+	sessionTTL  time.Duration
+}
+
+// NewAuthHandler creates a new auth handler whose session cookies last sessionTTL
+func NewAuthHandler(userService services.UserService, sessionTTL time.Duration) *AuthHandler {
+	return &AuthHandler{userService, sessionTTL}
+}
+
+// LoginPage renders the login form
+func (h *AuthHandler) LoginPage(c *gin.Context) {
+	next := safeRedirect(c.Query("next"))
+	if auth.UserFromContext(c.Request.Context()) != nil {
+		c.Redirect(http.StatusSeeOther, next)
+		return
+	}
+
+	utils.HTMLResponse(c, http.StatusOK, "auth/login.html", gin.H{
+		"title": "Log In",
+		"next":  next,
+	})
+}
+
+// Login starts a session and redirects to the page the user came from.
+// Wrong credentials re-render the form with a 401, which the login rate
+// limit counts as a failed attempt.
+func (h *AuthHandler) Login(c *gin.Context) {
+	username := c.PostForm("username")
+	next := safeRedirect(c.PostForm("next"))
+
+	token, _, err := h.userService.Login(c.Request.Context(), username, c.PostForm("password"))
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		utils.HTMLResponse(c, http.StatusUnauthorized, "auth/login.html", gin.H{
+			"title":    "Log In",
+			"next":     next,
+			"username": username,
+			"error":    "Invalid username or password",
+		})
+		return
+	}
+	if err != nil {
+		_ = c.Error(utils.NewInternalError("Failed to log in", err))
+		return
+	}
+
+	h.setSessionCookie(c, token, int(h.sessionTTL.Seconds()))
+	c.Redirect(http.StatusSeeOther, next)
+}
+
+// Logout ends the session and returns to the login page
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if token, err := c.Cookie(auth.SessionCookie); err == nil && token != "" {
+		if err := h.userService.Logout(c.Request.Context(), token); err != nil {
+			_ = c.Error(utils.NewInternalError("Failed to log out", err))
+			return
+		}
+	}
+
+	h.setSessionCookie(c, "", -1)
+	if utils.IsHTMXRequest(c) {
+		c.Header("HX-Redirect", "/login")
+		c.Status(http.StatusOK)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/login")
+}
+
+// Account renders the signed in user's settings
+func (h *AuthHandler) Account(c *gin.Context) {
+	h.renderAccount(c, http.StatusOK, nil)
+}
+
+// UpdateAccount saves the email address reminders are sent to and the
+// time zone journal days start in. Invalid input re-renders the form.
+func (h *AuthHandler) UpdateAccount(c *gin.Context) {
+	email, timezone := c.PostForm("email"), c.PostForm("timezone")
+	form := gin.H{"email": email, "timezone": timezone}
+
+	_, err := h.userService.UpdateAccount(c.Request.Context(), email, timezone)
+	switch {
+	case errors.Is(err, services.ErrInvalidEmail):
+		form["error"] = "Enter a valid email address"
+		h.renderAccount(c, http.StatusBadRequest, form)
+		return
+	case errors.Is(err, services.ErrInvalidTimezone):
+		form["error"] = "Enter a time zone such as Europe/Berlin, or leave it empty"
+		h.renderAccount(c, http.StatusBadRequest, form)
+		return
+	case errors.Is(err, services.ErrUnauthenticated):
+		_ = c.Error(utils.NewUnauthorizedError("Please log in"))
+		return
+	case err != nil:
+		_ = c.Error(utils.NewInternalError("Failed to save account", err))
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/account?saved=1")
+}
+
+// renderAccount renders the account page with status and any form state in extra
+func (h *AuthHandler) renderAccount(c *gin.Context, status int, extra gin.H) {
+	data := gin.H{
+		"title": "Account",
+		"saved": c.Query("saved") != "",
+	}
+	if user := auth.UserFromContext(c.Request.Context()); user != nil {
+		data["email"] = user.Email
+		data["timezone"] = user.Timezone
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	utils.HTMLResponse(c, status, "auth/account.html", data)
+}
+
+// setSessionCookie stores token for maxAge seconds; a negative maxAge deletes it
+func (h *AuthHandler) setSessionCookie(c *gin.Context, token string, maxAge int) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(auth.SessionCookie, token, maxAge, "/", "", utils.IsHTTPS(c), true)
+}
+
+// safeRedirect returns next if it is a path on this site, else /notes, so
+// the login form cannot be used to send users elsewhere
+func safeRedirect(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/notes"
+	}
+	return next
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// HealthHandler serves the liveness and readiness probes
+type HealthHandler struct {
+	db       *sql.DB
+	draining atomic.Bool
+}
+
+// NewHealthHandler creates a new health handler
+func NewHealthHandler(db *sql.DB) *HealthHandler {
+	return &HealthHandler{db: db}
+}
+
+// SetDraining marks the server as shutting down so that readiness fails and
+// the orchestrator stops routing new traffic to it
+func (h *HealthHandler) SetDraining() {
+	h.draining.Store(true)
+}
+
+// Liveness reports that the process is up
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readiness reports whether the server can take traffic, pinging the database
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "draining"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+	defer cancel()
+	if err := h.db.PingContext(ctx); err != nil {
+		utils.LoggerFromContext(ctx).Warn("readiness check failed", "error", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "database": "down"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "database": "up"})
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// jobPageSize caps the jobs listed on the jobs page
+const jobPageSize = 100
+
+// JobHandler handles the background job administration page
+type JobHandler struct {
+	jobService services.JobService
+}
+
+// NewJobHandler creates a new job handler
+func NewJobHandler(jobService services.JobService) *JobHandler {
+	return &JobHandler{jobService}
+}
+
+// Index renders the number of jobs per status and the newest jobs, filtered
+// by the status and kind in the query
+func (h *JobHandler) Index(c *gin.Context) {
+	filter := domain.JobFilter{
+		Status: domain.JobStatus(c.Query("status")),
+		Kind:   c.Query("kind"),
+		Limit:  jobPageSize,
+	}
+	if filter.Status != "" && !slices.Contains(domain.JobStatuses, filter.Status) {
+		utils.BadRequest(c, "Unknown job status")
+		return
+	}
+
+	counts, err := h.jobService.CountJobs(c.Request.Context())
+	if err != nil {
+		h.serviceError(c, err, "Failed to count jobs")
+		return
+	}
+	jobs, err := h.jobService.GetJobs(c.Request.Context(), filter)
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch jobs")
+		return
+	}
+
+	utils.HTMLResponse(c, http.StatusOK, "admin/jobs.html", gin.H{
+		"title":    "Jobs",
+		"jobs":     jobs,
+		"counts":   counts,
+		"statuses": domain.JobStatuses,
+		"status":   string(filter.Status),
+		"kind":     filter.Kind,
+		"backURL":  "/admin/jobs?" + c.Request.URL.Query().Encode(),
+		"limited":  len(jobs) == jobPageSize,
+	})
+}
+
+// Retry queues a dead job again and returns to the list it was retried from
+func (h *JobHandler) Retry(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "Invalid job ID")
+		return
+	}
+
+	if err := h.jobService.RetryJob(c.Request.Context(), id); err != nil {
+		h.serviceError(c, err, "Failed to retry job")
+		return
+	}
+
+	back := "/admin/jobs"
+	if u, err := url.Parse(c.PostForm("back")); err == nil && u.Path == back && u.Host == "" && u.Scheme == "" {
+		back = u.String()
+	}
+	c.Redirect(http.StatusSeeOther, back)
+}
+
+// serviceError records a job service error with the matching status
+func (h *JobHandler) serviceError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		_ = c.Error(utils.NewNotFoundError("Job not found"))
+	case errors.Is(err, services.ErrJobNotDead):
+		_ = c.Error(utils.NewBadRequestError("Only dead jobs can be retried"))
+	case errors.Is(err, services.ErrUnauthenticated):
+		_ = c.Error(utils.NewUnauthorizedError("Please log in"))
+	case errors.Is(err, services.ErrForbidden):
+		_ = c.Error(utils.NewForbiddenError("You do not have permission to do this"))
+	default:
+		_ = c.Error(utils.NewInternalError(message, err))
+	}
+}
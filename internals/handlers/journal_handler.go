@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// JournalHandler handles the daily journal pages
+type JournalHandler struct {
+	noteService services.NoteService
+}
+
+// NewJournalHandler creates a new journal handler
+func NewJournalHandler(noteService services.NoteService) *JournalHandler {
+	return &JournalHandler{noteService}
+}
+
+// calendarDay is a day in the month calendar of the journal and calendar pages
+type calendarDay struct {
+	Date     time.Time
+	InMonth  bool
+	HasEntry bool
+	Today    bool
+	Selected bool
+	// Notes are the first notes of the day on the calendar page, and More
+	// counts the others
+	Notes []*domain.Note
+	More  int
+}
+
+// Today renders the journal entry for today in the user's time zone,
+// creating it for users who may write notes
+func (h *JournalHandler) Today(c *gin.Context) {
+	user := auth.UserFromContext(c.Request.Context())
+	today := domain.DateOf(time.Now().In(user.Location()))
+
+	var note *domain.Note
+	var err error
+	if user.Can(domain.PermNotesWrite) {
+		note, _, err = h.noteService.OpenJournal(c.Request.Context(), today)
+	} else {
+		note, err = h.noteService.GetJournal(c.Request.Context(), today)
+	}
+	if err != nil && !errors.Is(err, services.ErrNoteNotFound) {
+		h.serviceError(c, err, "Failed to open journal")
+		return
+	}
+
+	h.render(c, today, today, note)
+}
+
+// Show renders the journal entry for the date in the path, offering to
+// start one when there is none
+func (h *JournalHandler) Show(c *gin.Context) {
+	date, ok := journalDate(c)
+	if !ok {
+		return
+	}
+
+	note, err := h.noteService.GetJournal(c.Request.Context(), date)
+	if err != nil && !errors.Is(err, services.ErrNoteNotFound) {
+		h.serviceError(c, err, "Failed to fetch journal entry")
+		return
+	}
+
+	user := auth.UserFromContext(c.Request.Context())
+	h.render(c, date, domain.DateOf(time.Now().In(user.Location())), note)
+}
+
+// Create starts the journal entry for the date in the path and shows it
+func (h *JournalHandler) Create(c *gin.Context) {
+	date, ok := journalDate(c)
+	if !ok {
+		return
+	}
+
+	if _, _, err := h.noteService.OpenJournal(c.Request.Context(), date); err != nil {
+		h.serviceError(c, err, "Failed to create journal entry")
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, journalPath(date))
+}
+
+// render renders the journal page for date with its entry, if any, and the
+// calendar of its month
+func (h *JournalHandler) render(c *gin.Context, date, today time.Time, note *domain.Note) {
+	first, start, end := monthGrid(date)
+	dates, err := h.noteService.GetJournalDates(c.Request.Context(), start, end)
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch journal")
+		return
+	}
+	entries := make(map[time.Time]bool, len(dates))
+	for _, d := range dates {
+		entries[domain.DateOf(d)] = true
+	}
+
+	weeks := calendarWeeks(start, end, func(day time.Time) calendarDay {
+		return calendarDay{
+			Date:     day,
+			InMonth:  day.Month() == date.Month(),
+			HasEntry: entries[day],
+			Today:    day.Equal(today),
+			Selected: day.Equal(date),
+		}
+	})
+
+	utils.HTMLResponse(c, http.StatusOK, "notes/journal.html", gin.H{
+		"title":     "Journal",
+		"date":      date,
+		"note":      note,
+		"isToday":   date.Equal(today),
+		"weeks":     weeks,
+		"prevDay":   date.AddDate(0, 0, -1),
+		"nextDay":   date.AddDate(0, 0, 1),
+		"prevMonth": first.AddDate(0, -1, 0),
+		"nextMonth": first.AddDate(0, 1, 0),
+	})
+}
+
+// monthGrid returns the first of the month of date and the dates a month
+// calendar of it covers: from the Monday before the first of the month up
+// to but excluding the Monday after its last day
+func monthGrid(date time.Time) (first, start, end time.Time) {
+	first = time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, time.UTC)
+	start = first.AddDate(0, 0, -int((first.Weekday()+6)%7))
+	last := first.AddDate(0, 1, -1)
+	end = last.AddDate(0, 0, 7-int((last.Weekday()+6)%7))
+	return first, start, end
+}
+
+// calendarWeeks returns the weeks of the days from start, a Monday, up to
+// but excluding end, described by day
+func calendarWeeks(start, end time.Time, day func(time.Time) calendarDay) [][]calendarDay {
+	var weeks [][]calendarDay
+	for d := start; d.Before(end); d = d.AddDate(0, 0, 1) {
+		if d.Weekday() == time.Monday {
+			weeks = append(weeks, make([]calendarDay, 0, 7))
+		}
+		weeks[len(weeks)-1] = append(weeks[len(weeks)-1], day(d))
+	}
+	return weeks
+}
+
+// serviceError records a note service error with the matching status
+func (h *JournalHandler) serviceError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidJournalDate):
+		_ = c.Error(utils.NewBadRequestError("Journal dates must fall between the years 1000 and 9999"))
+	case errors.Is(err, services.ErrUnauthenticated):
+		_ = c.Error(utils.NewUnauthorizedError("Please log in"))
+	case errors.Is(err, services.ErrForbidden):
+		_ = c.Error(utils.NewForbiddenError("You do not have permission to write journal entries"))
+	default:
+		_ = c.Error(utils.NewInternalError(message, err))
+	}
+}
+
+// journalDate parses the YYYY-MM-DD date in the path, answering 400 if it
+// is invalid
+func journalDate(c *gin.Context) (time.Time, bool) {
+	date, err := time.Parse(time.DateOnly, c.Param("date"))
+	if err != nil {
+		utils.BadRequest(c, "Invalid date")
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// journalPath is the journal page of a date
+func journalPath(date time.Time) string {
+	return "/journal/" + date.Format(time.DateOnly)
+}
@@ -1,42 +1,140 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
 	"github.com/mas-diq/htmx-basic-crud/internals/services"
 	"github.com/mas-diq/htmx-basic-crud/internals/utils"
 )
 
 // NoteHandler handles HTTP requests for notes
 type NoteHandler struct {
-	noteService services.NoteService
+	noteService     services.NoteService
+	templateService services.TemplateService
+	searchService   services.SearchService
+	baseURL         string
 }
 
-// NewNoteHandler creates a new note handler
-func NewNoteHandler(noteService services.NoteService) *NoteHandler {
-	return &NoteHandler{noteService}
+// NewNoteHandler creates a new note handler. templateService lists the
+// templates offered when creating a note, searchService searches the notes
+// index and baseURL is the public URL share links are built from.
+func NewNoteHandler(noteService services.NoteService, templateService services.TemplateService, searchService services.SearchService, baseURL string) *NoteHandler {
+	return &NoteHandler{noteService, templateService, searchService, strings.TrimSuffix(baseURL, "/")}
 }
 
-// Index renders the notes index page
+// contentPart is a piece of note content on the note page: plain Text, or
+// a link to the note titled Link, which is TargetID or 0 while it is broken
+type contentPart struct {
+	Text     string
+	Link     string
+	TargetID int64
+}
+
+// Index renders the notes index page beside the user's saved searches. The
+// q query parameter searches the notes and the by, from and to parameters
+// limit them to a date range (see dateRangeQuery). A search or range that
+// is invalid is shown with its error and no notes.
 func (h *NoteHandler) Index(c *gin.Context) {
-	notes, err := h.noteService.GetAllNotes()
-	if err != nil {
-		utils.InternalServerError(c, "Failed to fetch notes")
+	ctx := c.Request.Context()
+	dates, ok := dateRangeQuery(c, auth.UserFromContext(ctx).Location())
+	if !ok {
 		return
 	}
+	query := strings.TrimSpace(c.Query("q"))
+	status := http.StatusOK
+	data := gin.H{
+		"title":      "Notes",
+		"view":       "grid",
+		"searchable": true,
+		"query":      query,
+		"by":         dates.Field,
+		"from":       c.Query("from"),
+		"to":         c.Query("to"),
+	}
 
-	utils.HTMLResponse(c, http.StatusOK, "notes/index.html", gin.H{
-		"title": "Notes",
-		"notes": notes,
-	})
+	var notes []*domain.Note
+	var err error
+	if query != "" || !dates.IsZero() {
+		notes, err = h.searchService.SearchNotes(ctx, query, dates)
+	} else {
+		notes, err = h.noteService.GetAllNotes(ctx)
+	}
+	switch {
+	case errors.Is(err, services.ErrInvalidSearch):
+		status = http.StatusBadRequest
+		data["searchError"] = searchErrorMessage(err)
+	case errors.Is(err, services.ErrInvalidDateRange):
+		status = http.StatusBadRequest
+		data["searchError"] = dateRangeErrorMessage
+	case err != nil:
+		h.serviceError(c, err, "Failed to fetch notes")
+		return
+	}
+	data["notes"] = notes
+
+	if data["savedSearches"], err = h.searchService.GetSavedSearches(ctx); err != nil {
+		h.serviceError(c, err, "Failed to fetch saved searches")
+		return
+	}
+
+	utils.HTMLResponse(c, status, "notes/index.html", data)
 }
 
-// New renders the note creation form
+// New renders the note creation form with a template picker. The template
+// in the template query parameter, if any, prefills the form; its variables
+// are expanded when the note is saved.
 func (h *NoteHandler) New(c *gin.Context) {
-	utils.HTMLResponse(c, http.StatusOK, "notes/create.html", gin.H{
-		"title": "Create Note",
+	templates, err := h.templateService.GetTemplates(c.Request.Context())
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch templates")
+		return
+	}
+	data := gin.H{
+		"title":     "Create Note",
+		"templates": templates,
+	}
+
+	if raw := c.Query("template"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			utils.BadRequest(c, "Invalid template ID")
+			return
+		}
+		tmpl, err := h.templateService.GetTemplate(c.Request.Context(), id)
+		if err != nil {
+			h.serviceError(c, err, "Failed to fetch template")
+			return
+		}
+		data["template"] = tmpl
+	}
+	// Broken [[Title]] links offer to create the note they point to
+	data["newTitle"] = c.Query("title")
+
+	utils.HTMLResponse(c, http.StatusOK, "notes/create.html", data)
+}
+
+// Upcoming renders the notes with a due date, soonest first
+func (h *NoteHandler) Upcoming(c *gin.Context) {
+	notes, err := h.noteService.GetUpcomingNotes(c.Request.Context())
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch notes")
+		return
+	}
+
+	utils.HTMLResponse(c, http.StatusOK, "notes/upcoming.html", gin.H{
+		"title": "Upcoming",
+		"notes": notes,
+		"now":   time.Now(),
 	})
 }
 
@@ -44,20 +142,30 @@ func (h *NoteHandler) New(c *gin.Context) {
 func (h *NoteHandler) Create(c *gin.Context) {
 	title := c.PostForm("title")
 	content := c.PostForm("content")
-
-	if title == "" {
-		utils.BadRequest(c, "Title is required")
+	dueAt, remindAt, _, ok := scheduleForm(c)
+	if !ok {
 		return
 	}
 
-	note, err := h.noteService.CreateNote(title, content)
+	var note *domain.Note
+	var err error
+	if raw := c.PostForm("template_id"); raw != "" {
+		templateID, parseErr := strconv.ParseInt(raw, 10, 64)
+		if parseErr != nil {
+			utils.BadRequest(c, "Invalid template ID")
+			return
+		}
+		note, err = h.noteService.CreateNoteFromTemplate(c.Request.Context(), templateID, title, content, dueAt, remindAt)
+	} else {
+		note, err = h.noteService.CreateNote(c.Request.Context(), title, content, dueAt, remindAt)
+	}
 	if err != nil {
-		utils.InternalServerError(c, "Failed to create note")
+		h.serviceError(c, err, "Failed to create note")
 		return
 	}
 
 	// Check if request is an HTMX request
-	if c.GetHeader("HX-Request") == "true" {
+	if utils.IsHTMXRequest(c) {
 		utils.HTMLResponse(c, http.StatusOK, "notes/index.html", gin.H{
 			"title": "Notes",
 			"notes": []interface{}{note},
@@ -76,19 +184,121 @@ func (h *NoteHandler) Show(c *gin.Context) {
 		return
 	}
 
-	note, err := h.noteService.GetNoteByID(id)
+	note, err := h.noteService.GetNoteByID(c.Request.Context(), id)
 	if err != nil {
-		if err == services.ErrNoteNotFound {
-			utils.NotFound(c)
-		} else {
-			utils.InternalServerError(c, "Failed to fetch note")
-		}
+		h.serviceError(c, err, "Failed to fetch note")
+		return
+	}
+	links, backlinks, err := h.noteService.GetNoteLinks(c.Request.Context(), id)
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch note links")
 		return
 	}
 
+	targets := make(map[string]int64, len(links))
+	var broken []*domain.NoteLink
+	for _, link := range links {
+		targets[strings.ToLower(link.TargetTitle)] = link.TargetID
+		if link.Broken() {
+			broken = append(broken, link)
+		}
+	}
+	var parts []contentPart
+	for _, part := range domain.SplitWikiLinks(note.Content) {
+		parts = append(parts, contentPart{Text: part.Text, Link: part.Link, TargetID: targets[strings.ToLower(part.Link)]})
+	}
+
+	// Notes created from a broken link only fix it when they belong to the
+	// owner of the linking note
+	user := auth.UserFromContext(c.Request.Context())
 	utils.HTMLResponse(c, http.StatusOK, "notes/show.html", gin.H{
-		"title": note.Title,
-		"note":  note,
+		"title":        note.Title,
+		"note":         note,
+		"contentParts": parts,
+		"backlinks":    backlinks,
+		"brokenLinks":  broken,
+		"createLinked": user.Can(domain.PermNotesWrite) && user.ID == note.UserID,
+	})
+}
+
+// Graph renders the graph of the notes mentioning each other, around the
+// note in the focus query parameter, if any
+func (h *NoteHandler) Graph(c *gin.Context) {
+	focusID, depth, ok := graphQuery(c)
+	if !ok {
+		return
+	}
+	notes, err := h.noteService.GetAllNotes(c.Request.Context())
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch notes")
+		return
+	}
+
+	src := "/notes/graph.json"
+	if focusID != 0 {
+		if _, err := h.noteService.GetNoteByID(c.Request.Context(), focusID); err != nil {
+			h.serviceError(c, err, "Failed to fetch note")
+			return
+		}
+		src += "?" + url.Values{"focus": {strconv.FormatInt(focusID, 10)}, "depth": {strconv.Itoa(depth)}}.Encode()
+	}
+
+	depths := make([]int, services.MaxGraphDepth)
+	for i := range depths {
+		depths[i] = i + 1
+	}
+	utils.HTMLResponse(c, http.StatusOK, "notes/graph.html", gin.H{
+		"title":    "Graph",
+		"notes":    notes,
+		"focusID":  focusID,
+		"depth":    depth,
+		"depths":   depths,
+		"src":      src,
+		"maxNodes": services.MaxGraphNodes,
+	})
+}
+
+// GraphJSON returns the graph of the notes mentioning each other as JSON,
+// around the note in the focus query parameter, if any
+func (h *NoteHandler) GraphJSON(c *gin.Context) {
+	focusID, depth, ok := graphQuery(c)
+	if !ok {
+		return
+	}
+	graph, err := h.noteService.GetNoteGraph(c.Request.Context(), focusID, depth)
+	if err != nil {
+		h.serviceError(c, err, "Failed to build graph")
+		return
+	}
+
+	c.JSON(http.StatusOK, graph)
+}
+
+// BrokenLinks renders the links to notes that do not exist
+func (h *NoteHandler) BrokenLinks(c *gin.Context) {
+	links, err := h.noteService.GetBrokenLinks(c.Request.Context())
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch broken links")
+		return
+	}
+
+	utils.HTMLResponse(c, http.StatusOK, "notes/broken_links.html", gin.H{
+		"title": "Broken links",
+		"links": links,
+	})
+}
+
+// LinkSuggestions renders the titles of the user's notes starting with the
+// q query parameter, for completing a [[Title]] link in the editor
+func (h *NoteHandler) LinkSuggestions(c *gin.Context) {
+	titles, err := h.noteService.SuggestLinkTitles(c.Request.Context(), c.Query("q"))
+	if err != nil {
+		h.serviceError(c, err, "Failed to suggest titles")
+		return
+	}
+
+	utils.HTMLResponse(c, http.StatusOK, "partials/link_suggestions.html", gin.H{
+		"titles": titles,
 	})
 }
 
@@ -100,13 +310,13 @@ func (h *NoteHandler) Edit(c *gin.Context) {
 		return
 	}
 
-	note, err := h.noteService.GetNoteByID(id)
+	note, err := h.noteService.GetNoteByID(c.Request.Context(), id)
 	if err != nil {
-		if err == services.ErrNoteNotFound {
-			utils.NotFound(c)
-		} else {
-			utils.InternalServerError(c, "Failed to fetch note")
-		}
+		h.serviceError(c, err, "Failed to fetch note")
+		return
+	}
+	if !auth.UserFromContext(c.Request.Context()).CanEdit(note) {
+		h.serviceError(c, services.ErrForbidden, "")
 		return
 	}
 
@@ -126,24 +336,31 @@ func (h *NoteHandler) Update(c *gin.Context) {
 
 	title := c.PostForm("title")
 	content := c.PostForm("content")
-
-	if title == "" {
-		utils.BadRequest(c, "Title is required")
+	dueAt, remindAt, scheduled, ok := scheduleForm(c)
+	if !ok {
 		return
 	}
+	if scheduled {
+		if err := services.ValidateSchedule(dueAt, remindAt); err != nil {
+			h.serviceError(c, err, "Failed to schedule note")
+			return
+		}
+	}
 
-	note, err := h.noteService.UpdateNote(id, title, content)
+	note, err := h.noteService.UpdateNote(c.Request.Context(), id, title, content)
 	if err != nil {
-		if err == services.ErrNoteNotFound {
-			utils.NotFound(c)
-		} else {
-			utils.InternalServerError(c, "Failed to update note")
-		}
+		h.serviceError(c, err, "Failed to update note")
 		return
 	}
+	if scheduled && (!note.DueAt.Equal(dueAt) || !note.RemindAt.Equal(remindAt)) {
+		if note, err = h.noteService.ScheduleNote(c.Request.Context(), id, dueAt, remindAt); err != nil {
+			h.serviceError(c, err, "Failed to schedule note")
+			return
+		}
+	}
 
 	// Check if request is an HTMX request
-	if c.GetHeader("HX-Request") == "true" {
+	if utils.IsHTMXRequest(c) {
 		utils.HTMLResponse(c, http.StatusOK, "notes/show.html", gin.H{
 			"title": note.Title,
 			"note":  note,
@@ -162,21 +379,124 @@ func (h *NoteHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	err = h.noteService.DeleteNote(id)
+	err = h.noteService.DeleteNote(c.Request.Context(), id)
 	if err != nil {
-		if err == services.ErrNoteNotFound {
-			utils.NotFound(c)
-		} else {
-			utils.InternalServerError(c, "Failed to delete note")
-		}
+		h.serviceError(c, err, "Failed to delete note")
 		return
 	}
 
-	// Check if request is an HTMX request
-	if c.GetHeader("HX-Request") == "true" {
+	// Check if request is an HTMX request; the event refreshes the counts
+	// of the saved searches on the page
+	if utils.IsHTMXRequest(c) {
+		c.Header("HX-Trigger", "notes-changed")
 		c.Status(http.StatusOK)
 		return
 	}
 
 	c.Redirect(http.StatusSeeOther, "/notes")
 }
+
+// serviceError records a note service error, mapping ErrNoteNotFound,
+// ErrShareLinkNotFound and ErrTemplateNotFound to a 404, validation errors to a 400, missing logins
+// to a 401, denied permissions to a 403, query timeouts to a 504 and requests
+// abandoned by the client to a 499
+func (h *NoteHandler) serviceError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrNoteNotFound):
+		_ = c.Error(utils.NewNotFoundError("Note not found"))
+	case errors.Is(err, services.ErrShareLinkNotFound):
+		_ = c.Error(utils.NewNotFoundError("This link does not exist or has expired"))
+	case errors.Is(err, services.ErrTemplateNotFound):
+		_ = c.Error(utils.NewNotFoundError("Template not found"))
+	case errors.Is(err, services.ErrTitleRequired):
+		_ = c.Error(utils.NewBadRequestError("Title is required"))
+	case errors.Is(err, services.ErrInvalidSchedule):
+		_ = c.Error(utils.NewBadRequestError("Due dates and reminders must fall between 1970 and 2037"))
+	case errors.Is(err, services.ErrInvalidGraphDepth):
+		_ = c.Error(utils.NewBadRequestError(fmt.Sprintf("Depth must be between 1 and %d", services.MaxGraphDepth)))
+	case errors.Is(err, services.ErrInvalidSearch):
+		_ = c.Error(utils.NewBadRequestError(searchErrorMessage(err)))
+	case errors.Is(err, services.ErrInvalidDateRange):
+		_ = c.Error(utils.NewBadRequestError(dateRangeErrorMessage))
+	case errors.Is(err, services.ErrInvalidPeriod):
+		_ = c.Error(utils.NewBadRequestError("Timelines group notes by day, week or month"))
+	case errors.Is(err, services.ErrUnauthenticated):
+		_ = c.Error(utils.NewUnauthorizedError("Please log in"))
+	case errors.Is(err, services.ErrForbidden):
+		_ = c.Error(utils.NewForbiddenError("You do not have permission to change this note"))
+	case errors.Is(err, context.Canceled):
+		_ = c.Error(utils.NewHTTPError(utils.StatusClientClosedRequest, "The request was cancelled", err))
+	case errors.Is(err, context.DeadlineExceeded):
+		_ = c.Error(utils.NewHTTPError(http.StatusGatewayTimeout, "The request took too long", err))
+	default:
+		_ = c.Error(utils.NewInternalError(message, err))
+	}
+}
+
+// dateRangeErrorMessage describes an ErrInvalidDateRange to the user
+const dateRangeErrorMessage = "Dates select notes by created or updated time, and the end date must not be before the start date"
+
+// defaultGraphDepth is the depth of the graph around a focus note when the
+// depth query parameter is missing
+const defaultGraphDepth = 2
+
+// graphQuery parses the focus and depth query parameters of the graph,
+// answering 400 if they are invalid
+func graphQuery(c *gin.Context) (focusID int64, depth int, ok bool) {
+	if raw := c.Query("focus"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			utils.BadRequest(c, "Invalid note ID")
+			return 0, 0, false
+		}
+		focusID = id
+	}
+	depth = defaultGraphDepth
+	if raw := c.Query("depth"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > services.MaxGraphDepth {
+			utils.BadRequest(c, fmt.Sprintf("Depth must be between 1 and %d", services.MaxGraphDepth))
+			return 0, 0, false
+		}
+		depth = n
+	}
+	return focusID, depth, true
+}
+
+// dateTimeLocal is the value format of datetime-local inputs, which may
+// include seconds
+var dateTimeLocal = []string{"2006-01-02T15:04", "2006-01-02T15:04:05"}
+
+// scheduleForm parses the due_at and remind_at inputs, in the user's time
+// zone, with empty inputs as zero times. scheduled is false when the form has no
+// due_at input, so forms without one leave the schedule alone. ok is false
+// once a 400 has been answered for an invalid time.
+func scheduleForm(c *gin.Context) (dueAt, remindAt time.Time, scheduled, ok bool) {
+	if _, scheduled = c.GetPostForm("due_at"); !scheduled {
+		return time.Time{}, time.Time{}, false, true
+	}
+	loc := auth.UserFromContext(c.Request.Context()).Location()
+	var err error
+	if dueAt, err = parseDateTimeLocal(c.PostForm("due_at"), loc); err != nil {
+		utils.BadRequest(c, "Invalid due date")
+		return time.Time{}, time.Time{}, false, false
+	}
+	if remindAt, err = parseDateTimeLocal(c.PostForm("remind_at"), loc); err != nil {
+		utils.BadRequest(c, "Invalid reminder time")
+		return time.Time{}, time.Time{}, false, false
+	}
+	return dueAt, remindAt, true, true
+}
+
+// parseDateTimeLocal parses a datetime-local value in loc, empty as the zero time
+func parseDateTimeLocal(value string, loc *time.Location) (t time.Time, err error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range dateTimeLocal {
+		if t, err = time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
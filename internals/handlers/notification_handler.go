@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// NotificationHandler handles the notifications in the navbar
+type NotificationHandler struct {
+	notificationService services.NotificationService
+}
+
+// NewNotificationHandler creates a new notification handler
+func NewNotificationHandler(notificationService services.NotificationService) *NotificationHandler {
+	return &NotificationHandler{notificationService}
+}
+
+// Index renders the navbar bell with the newest notifications. The layout
+// loads it with HTMX and polls it for new ones.
+func (h *NotificationHandler) Index(c *gin.Context) {
+	h.render(c)
+}
+
+// Read marks a notification read and opens the note it is about
+func (h *NotificationHandler) Read(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "Invalid notification ID")
+		return
+	}
+
+	notification, err := h.notificationService.MarkRead(c.Request.Context(), id)
+	if err != nil {
+		h.serviceError(c, err, "Failed to read notification")
+		return
+	}
+
+	if notification.NoteID == 0 {
+		c.Redirect(http.StatusSeeOther, "/notes")
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/notes/"+strconv.FormatInt(notification.NoteID, 10))
+}
+
+// ReadAll marks every notification read, answering HTMX with the updated bell
+func (h *NotificationHandler) ReadAll(c *gin.Context) {
+	if err := h.notificationService.MarkAllRead(c.Request.Context()); err != nil {
+		h.serviceError(c, err, "Failed to read notifications")
+		return
+	}
+
+	if utils.IsHTMXRequest(c) {
+		h.render(c)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/notes")
+}
+
+// render renders the notifications partial
+func (h *NotificationHandler) render(c *gin.Context) {
+	notifications, err := h.notificationService.GetNotifications(c.Request.Context())
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch notifications")
+		return
+	}
+	unread, err := h.notificationService.CountUnread(c.Request.Context())
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch notifications")
+		return
+	}
+
+	utils.HTMLResponse(c, http.StatusOK, "partials/notifications.html", gin.H{
+		"notifications": notifications,
+		"unread":        unread,
+	})
+}
+
+// serviceError records a notification service error with the matching status
+func (h *NotificationHandler) serviceError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrNotificationNotFound):
+		_ = c.Error(utils.NewNotFoundError("Notification not found"))
+	case errors.Is(err, services.ErrUnauthenticated):
+		_ = c.Error(utils.NewUnauthorizedError("Please log in"))
+	default:
+		_ = c.Error(utils.NewInternalError(message, err))
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// SearchHandler handles the saved searches listed beside the notes
+type SearchHandler struct {
+	searchService services.SearchService
+}
+
+// NewSearchHandler creates a new search handler
+func NewSearchHandler(searchService services.SearchService) *SearchHandler {
+	return &SearchHandler{searchService}
+}
+
+// Index renders the user's saved searches with their current counts, which
+// the notes page polls to keep them up to date
+func (h *SearchHandler) Index(c *gin.Context) {
+	h.renderSidebar(c, c.Query("q"))
+}
+
+// Create saves the search in the q form field under the name field
+func (h *SearchHandler) Create(c *gin.Context) {
+	query := c.PostForm("q")
+	if _, err := h.searchService.SaveSearch(c.Request.Context(), c.PostForm("name"), query); err != nil {
+		h.serviceError(c, err, "Failed to save search")
+		return
+	}
+
+	if utils.IsHTMXRequest(c) {
+		h.renderSidebar(c, query)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/notes?"+url.Values{"q": {query}}.Encode())
+}
+
+// Delete deletes a saved search
+func (h *SearchHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "Invalid search ID")
+		return
+	}
+
+	if err := h.searchService.DeleteSavedSearch(c.Request.Context(), id); err != nil {
+		h.serviceError(c, err, "Failed to delete saved search")
+		return
+	}
+
+	if utils.IsHTMXRequest(c) {
+		h.renderSidebar(c, c.Query("q"))
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/notes")
+}
+
+// renderSidebar renders the saved searches, marking the one for query
+func (h *SearchHandler) renderSidebar(c *gin.Context, query string) {
+	searches, err := h.searchService.GetSavedSearches(c.Request.Context())
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch saved searches")
+		return
+	}
+
+	utils.HTMLResponse(c, http.StatusOK, "partials/saved_searches.html", gin.H{
+		"savedSearches": searches,
+		"query":         query,
+	})
+}
+
+// serviceError records a search service error with the matching status
+func (h *SearchHandler) serviceError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrSavedSearchNotFound):
+		_ = c.Error(utils.NewNotFoundError("Saved search not found"))
+	case errors.Is(err, services.ErrInvalidSavedSearch):
+		_ = c.Error(utils.NewBadRequestError(fmt.Sprintf("Saved searches need a name of up to %d characters and a search", domain.MaxSavedSearchName)))
+	case errors.Is(err, services.ErrInvalidSearch):
+		_ = c.Error(utils.NewBadRequestError(searchErrorMessage(err)))
+	case errors.Is(err, services.ErrUnauthenticated):
+		_ = c.Error(utils.NewUnauthorizedError("Please log in"))
+	case errors.Is(err, services.ErrForbidden):
+		_ = c.Error(utils.NewForbiddenError("You do not have permission to search notes"))
+	default:
+		_ = c.Error(utils.NewInternalError(message, err))
+	}
+}
+
+// searchErrorMessage describes an ErrInvalidSearch to the user
+func searchErrorMessage(err error) string {
+	return "Invalid search: " + strings.TrimPrefix(err.Error(), services.ErrInvalidSearch.Error()+": ")
+}
@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// linkExpiries are the lifetimes offered for public links, by form value
+var linkExpiries = map[string]time.Duration{
+	"":     0,
+	"1h":   time.Hour,
+	"24h":  24 * time.Hour,
+	"168h": 7 * 24 * time.Hour,
+	"720h": 30 * 24 * time.Hour,
+}
+
+// Shared renders the notes other users shared with the signed in user
+func (h *NoteHandler) Shared(c *gin.Context) {
+	notes, err := h.noteService.GetSharedNotes(c.Request.Context())
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch shared notes")
+		return
+	}
+
+	utils.HTMLResponse(c, http.StatusOK, "notes/index.html", gin.H{
+		"title":  "Shared with Me",
+		"notes":  notes,
+		"shared": true,
+	})
+}
+
+// SharePage renders the grants and public links of a note
+func (h *NoteHandler) SharePage(c *gin.Context) {
+	h.renderSharePage(c, http.StatusOK, nil)
+}
+
+// Share grants the submitted user access to a note. Unknown users and
+// invalid grants re-render the page with the error.
+func (h *NoteHandler) Share(c *gin.Context) {
+	id, ok := noteID(c)
+	if !ok {
+		return
+	}
+
+	username := c.PostForm("username")
+	_, err := h.noteService.ShareNote(c.Request.Context(), id, username, domain.SharePermission(c.PostForm("permission")))
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		h.renderSharePage(c, http.StatusBadRequest, gin.H{"username": username, "shareError": "There is no user named " + username})
+		return
+	case errors.Is(err, services.ErrInvalidShare):
+		h.renderSharePage(c, http.StatusBadRequest, gin.H{"username": username, "shareError": "Notes can be shared for reading or editing with anyone but their owner"})
+		return
+	case err != nil:
+		h.serviceError(c, err, "Failed to share note")
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, sharePath(id))
+}
+
+// Unshare revokes a user's access to a note
+func (h *NoteHandler) Unshare(c *gin.Context) {
+	id, ok := noteID(c)
+	if !ok {
+		return
+	}
+	userID, err := strconv.ParseInt(c.Param("userID"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "Invalid user ID")
+		return
+	}
+
+	if err := h.noteService.UnshareNote(c.Request.Context(), id, userID); err != nil {
+		h.serviceError(c, err, "Failed to unshare note")
+		return
+	}
+	h.removed(c, sharePath(id))
+}
+
+// CreateLink creates a public link and shows its URL, which cannot be
+// shown again because only the hash of its token is kept
+func (h *NoteHandler) CreateLink(c *gin.Context) {
+	id, ok := noteID(c)
+	if !ok {
+		return
+	}
+	ttl, ok := linkExpiries[c.PostForm("expires")]
+	if !ok {
+		utils.BadRequest(c, "Invalid expiry")
+		return
+	}
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+
+	token, _, err := h.noteService.CreateShareLink(c.Request.Context(), id, c.PostForm("password"), expiresAt)
+	if err != nil {
+		h.serviceError(c, err, "Failed to create link")
+		return
+	}
+
+	h.renderSharePage(c, http.StatusCreated, gin.H{"newLink": h.baseURL + "/s/" + token})
+}
+
+// RevokeLink deletes a public link
+func (h *NoteHandler) RevokeLink(c *gin.Context) {
+	id, ok := noteID(c)
+	if !ok {
+		return
+	}
+	linkID, err := strconv.ParseInt(c.Param("linkID"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "Invalid link ID")
+		return
+	}
+
+	if err := h.noteService.RevokeShareLink(c.Request.Context(), id, linkID); err != nil {
+		h.serviceError(c, err, "Failed to revoke link")
+		return
+	}
+	h.removed(c, sharePath(id))
+}
+
+// SharedLink renders the note behind a public link read-only. Links with a
+// password first show a password form, posted back to the same URL; wrong
+// passwords answer 401 so the login rate limit counts them.
+func (h *NoteHandler) SharedLink(c *gin.Context) {
+	// Keep shared notes out of search engines and shared caches
+	c.Header("X-Robots-Tag", "noindex")
+	c.Header("Cache-Control", "no-store")
+
+	note, err := h.noteService.GetNoteByShareToken(c.Request.Context(), c.Param("token"), c.PostForm("password"))
+	if errors.Is(err, services.ErrSharePassword) {
+		data := gin.H{"title": "Password Required"}
+		if c.Request.Method == http.MethodPost {
+			data["error"] = "Incorrect password"
+		}
+		utils.HTMLResponse(c, http.StatusUnauthorized, "notes/share_password.html", data)
+		return
+	}
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch note")
+		return
+	}
+
+	// Visitors have no time zone of their own, so dates are shown in UTC
+	utils.HTMLResponse(c, http.StatusOK, "notes/show.html", gin.H{
+		"title":    note.Title,
+		"note":     note,
+		"readOnly": true,
+		"location": time.UTC,
+	})
+}
+
+// renderSharePage renders the share page of the note in the URL with extra
+// template data
+func (h *NoteHandler) renderSharePage(c *gin.Context, status int, extra gin.H) {
+	id, ok := noteID(c)
+	if !ok {
+		return
+	}
+	note, err := h.noteService.GetNoteByID(c.Request.Context(), id)
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch note")
+		return
+	}
+	shares, links, err := h.noteService.GetShares(c.Request.Context(), id)
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch shares")
+		return
+	}
+
+	data := gin.H{
+		"title":       "Share " + note.Title,
+		"note":        note,
+		"shares":      shares,
+		"links":       links,
+		"permissions": []domain.SharePermission{domain.ShareRead, domain.ShareEdit},
+		"now":         time.Now(),
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	utils.HTMLResponse(c, status, "notes/share.html", data)
+}
+
+// removed answers a successful deletion: HTMX removes the row itself,
+// browsers return to back
+func (h *NoteHandler) removed(c *gin.Context, back string) {
+	if utils.IsHTMXRequest(c) {
+		c.Status(http.StatusOK)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, back)
+}
+
+// noteID parses the note ID in the URL, answering 400 if it is invalid
+func noteID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "Invalid note ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// sharePath is the share page of a note
+func sharePath(id int64) string {
+	return "/notes/" + strconv.FormatInt(id, 10) + "/share"
+}
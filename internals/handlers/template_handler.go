@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// templateError is shown when a template form is rejected
+var templateError = fmt.Sprintf("Enter a name of up to %d characters and a title", domain.MaxTemplateName)
+
+// TemplateHandler handles the note template management pages
+type TemplateHandler struct {
+	templateService services.TemplateService
+}
+
+// NewTemplateHandler creates a new template handler
+func NewTemplateHandler(templateService services.TemplateService) *TemplateHandler {
+	return &TemplateHandler{templateService}
+}
+
+// Index renders the templates with a form creating a new one
+func (h *TemplateHandler) Index(c *gin.Context) {
+	h.renderIndex(c, http.StatusOK, nil)
+}
+
+// Create adds the submitted template. Invalid input re-renders the form.
+func (h *TemplateHandler) Create(c *gin.Context) {
+	name, title, content := c.PostForm("name"), c.PostForm("title"), c.PostForm("content")
+
+	_, err := h.templateService.CreateTemplate(c.Request.Context(), name, title, content)
+	if errors.Is(err, services.ErrInvalidTemplate) {
+		h.renderIndex(c, http.StatusBadRequest, gin.H{
+			"name": name, "templateTitle": title, "content": content, "templateError": templateError,
+		})
+		return
+	}
+	if err != nil {
+		h.serviceError(c, err, "Failed to create template")
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/templates")
+}
+
+// Edit renders the form changing a template
+func (h *TemplateHandler) Edit(c *gin.Context) {
+	id, ok := templateID(c)
+	if !ok {
+		return
+	}
+
+	tmpl, err := h.templateService.GetTemplate(c.Request.Context(), id)
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch template")
+		return
+	}
+
+	h.renderEdit(c, http.StatusOK, tmpl, nil)
+}
+
+// Update saves the submitted template. Invalid input re-renders the form.
+func (h *TemplateHandler) Update(c *gin.Context) {
+	id, ok := templateID(c)
+	if !ok {
+		return
+	}
+	name, title, content := c.PostForm("name"), c.PostForm("title"), c.PostForm("content")
+
+	_, err := h.templateService.UpdateTemplate(c.Request.Context(), id, name, title, content)
+	if errors.Is(err, services.ErrInvalidTemplate) {
+		tmpl := &domain.NoteTemplate{ID: id, Name: name, Title: title, Content: content}
+		h.renderEdit(c, http.StatusBadRequest, tmpl, gin.H{"templateError": templateError})
+		return
+	}
+	if err != nil {
+		h.serviceError(c, err, "Failed to update template")
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, "/templates")
+}
+
+// Delete removes a template
+func (h *TemplateHandler) Delete(c *gin.Context) {
+	id, ok := templateID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.templateService.DeleteTemplate(c.Request.Context(), id); err != nil {
+		h.serviceError(c, err, "Failed to delete template")
+		return
+	}
+
+	if utils.IsHTMXRequest(c) {
+		c.Status(http.StatusOK)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/templates")
+}
+
+// renderIndex renders the template list with status and any form state in extra
+func (h *TemplateHandler) renderIndex(c *gin.Context, status int, extra gin.H) {
+	templates, err := h.templateService.GetTemplates(c.Request.Context())
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch templates")
+		return
+	}
+
+	data := gin.H{
+		"title":     "Templates",
+		"templates": templates,
+		"variables": domain.TemplateVariables,
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	utils.HTMLResponse(c, status, "note_templates/index.html", data)
+}
+
+// renderEdit renders the form changing tmpl with status and any errors in extra
+func (h *TemplateHandler) renderEdit(c *gin.Context, status int, tmpl *domain.NoteTemplate, extra gin.H) {
+	data := gin.H{
+		"title":     "Edit Template",
+		"template":  tmpl,
+		"variables": domain.TemplateVariables,
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	utils.HTMLResponse(c, status, "note_templates/edit.html", data)
+}
+
+// serviceError records a template service error with the matching status
+func (h *TemplateHandler) serviceError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrTemplateNotFound):
+		_ = c.Error(utils.NewNotFoundError("Template not found"))
+	case errors.Is(err, services.ErrInvalidTemplate):
+		_ = c.Error(utils.NewBadRequestError(templateError))
+	case errors.Is(err, services.ErrUnauthenticated):
+		_ = c.Error(utils.NewUnauthorizedError("Please log in"))
+	case errors.Is(err, services.ErrForbidden):
+		_ = c.Error(utils.NewForbiddenError("You do not have permission to do this"))
+	default:
+		_ = c.Error(utils.NewInternalError(message, err))
+	}
+}
+
+// templateID parses the template ID in the path, answering 400 if it is invalid
+func templateID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "Invalid template ID")
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// calendarDayNotes is the number of notes listed on a day of the calendar
+const calendarDayNotes = 3
+
+// timelineGroup is a day, week or month on the timeline page
+type timelineGroup struct {
+	Label string
+	Notes []timelineNote
+}
+
+// timelineNote is a note on the timeline page with the time it is placed
+// by, in the user's time zone
+type timelineNote struct {
+	*domain.Note
+	At time.Time
+}
+
+// Timeline renders the notes grouped by the day, week or month of their
+// created or updated time, as the by and period query parameters select,
+// within the from and to dates if given
+func (h *NoteHandler) Timeline(c *gin.Context) {
+	loc := auth.UserFromContext(c.Request.Context()).Location()
+	dates, ok := dateRangeQuery(c, loc)
+	if !ok {
+		return
+	}
+	period := c.DefaultQuery("period", domain.PeriodWeek)
+
+	groups, err := h.noteService.GetTimeline(c.Request.Context(), dates, period)
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch timeline")
+		return
+	}
+
+	timeline := make([]timelineGroup, 0, len(groups))
+	for _, group := range groups {
+		notes := make([]timelineNote, 0, len(group.Notes))
+		for _, note := range group.Notes {
+			notes = append(notes, timelineNote{note, dates.Time(note).In(loc)})
+		}
+		timeline = append(timeline, timelineGroup{group.Label(), notes})
+	}
+
+	utils.HTMLResponse(c, http.StatusOK, "notes/timeline.html", gin.H{
+		"title":    "Timeline",
+		"view":     "timeline",
+		"timeline": timeline,
+		"by":       dates.Field,
+		"period":   period,
+		"periods":  []string{domain.PeriodDay, domain.PeriodWeek, domain.PeriodMonth},
+		"from":     c.Query("from"),
+		"to":       c.Query("to"),
+	})
+}
+
+// Calendar renders the month in the month query parameter, YYYY-MM, or the
+// current one, with the notes created or updated on each day as the by
+// query parameter selects
+func (h *NoteHandler) Calendar(c *gin.Context) {
+	loc := auth.UserFromContext(c.Request.Context()).Location()
+	now := time.Now().In(loc)
+	month := now
+	if raw := c.Query("month"); raw != "" {
+		var err error
+		if month, err = time.Parse("2006-01", raw); err != nil || month.Year() < 1000 {
+			utils.BadRequest(c, "Months must look like 2026-01")
+			return
+		}
+	}
+
+	first, start, end := monthGrid(month)
+	dates := domain.DateRange{
+		Field: c.DefaultQuery("by", domain.NoteCreated),
+		From:  time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc),
+		To:    time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, loc),
+	}
+	groups, err := h.noteService.GetTimeline(c.Request.Context(), dates, domain.PeriodDay)
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch calendar")
+		return
+	}
+	days := make(map[time.Time][]*domain.Note, len(groups))
+	for _, group := range groups {
+		days[group.Start] = group.Notes
+	}
+
+	today := domain.DateOf(now)
+	weeks := calendarWeeks(start, end, func(day time.Time) calendarDay {
+		notes := days[day]
+		more := 0
+		if len(notes) > calendarDayNotes {
+			notes, more = notes[:calendarDayNotes], len(notes)-calendarDayNotes
+		}
+		return calendarDay{
+			Date:    day,
+			InMonth: day.Month() == first.Month(),
+			Today:   day.Equal(today),
+			Notes:   notes,
+			More:    more,
+		}
+	})
+
+	utils.HTMLResponse(c, http.StatusOK, "notes/calendar.html", gin.H{
+		"title":     "Calendar",
+		"view":      "calendar",
+		"month":     first,
+		"weeks":     weeks,
+		"by":        dates.Field,
+		"prevMonth": first.AddDate(0, -1, 0),
+		"nextMonth": first.AddDate(0, 1, 0),
+	})
+}
+
+// dateRangeQuery parses the by, from and to query parameters into a date
+// range: from and to are YYYY-MM-DD dates in loc, both included, and by is
+// created, the default, or updated. It answers 400 if a date is invalid.
+func dateRangeQuery(c *gin.Context, loc *time.Location) (dates domain.DateRange, ok bool) {
+	dates.Field = c.DefaultQuery("by", domain.NoteCreated)
+	for _, bound := range []struct {
+		param string
+		date  *time.Time
+		days  int
+	}{{"from", &dates.From, 0}, {"to", &dates.To, 1}} {
+		raw := c.Query(bound.param)
+		if raw == "" {
+			continue
+		}
+		day, err := time.ParseInLocation(time.DateOnly, raw, loc)
+		if err != nil || day.Year() < 1000 {
+			utils.BadRequest(c, "Dates must look like 2026-01-31")
+			return dates, false
+		}
+		*bound.date = day.AddDate(0, 0, bound.days)
+	}
+	return dates, true
+}
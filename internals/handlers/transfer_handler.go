@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// maxImportSize caps the size of an uploaded import; the job stores it in
+// the payload of the import job
+const maxImportSize = 8 << 20
+
+// importError is shown when an uploaded import is rejected
+const importError = "Choose a JSON export of up to 8 MB, with a title for every note and dates between 1970 and 2037"
+
+// TransferHandler handles the page importing and exporting notes
+type TransferHandler struct {
+	transferService services.TransferService
+}
+
+// NewTransferHandler creates a new transfer handler
+func NewTransferHandler(transferService services.TransferService) *TransferHandler {
+	return &TransferHandler{transferService}
+}
+
+// Index renders the import form and the user's exports
+func (h *TransferHandler) Index(c *gin.Context) {
+	h.render(c, http.StatusOK, nil)
+}
+
+// Import queues the import of the uploaded file. An invalid file re-renders
+// the page with an error.
+func (h *TransferHandler) Import(c *gin.Context) {
+	file, err := c.FormFile("file")
+	if err != nil || file.Size > maxImportSize {
+		h.render(c, http.StatusBadRequest, gin.H{"importError": importError})
+		return
+	}
+	f, err := file.Open()
+	if err != nil {
+		_ = c.Error(utils.NewInternalError("Failed to read import", err))
+		return
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxImportSize))
+	if err != nil {
+		_ = c.Error(utils.NewInternalError("Failed to read import", err))
+		return
+	}
+
+	count, err := h.transferService.QueueImport(c.Request.Context(), data)
+	if errors.Is(err, services.ErrInvalidImport) {
+		h.render(c, http.StatusBadRequest, gin.H{"importError": importError})
+		return
+	}
+	if err != nil {
+		h.serviceError(c, err, "Failed to queue import")
+		return
+	}
+	h.render(c, http.StatusAccepted, gin.H{
+		"queued": fmt.Sprintf("Importing %d notes; a notification tells you when they are created.", count),
+	})
+}
+
+// Export queues an export of the user's notes
+func (h *TransferHandler) Export(c *gin.Context) {
+	if err := h.transferService.QueueExport(c.Request.Context()); err != nil {
+		h.serviceError(c, err, "Failed to queue export")
+		return
+	}
+	h.render(c, http.StatusAccepted, gin.H{
+		"queued": "Exporting your notes; a notification tells you when the export is ready below.",
+	})
+}
+
+// Download sends an export as a JSON file
+func (h *TransferHandler) Download(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "Invalid export ID")
+		return
+	}
+
+	export, err := h.transferService.GetExport(c.Request.Context(), id)
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch export")
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="notes-`+export.CreatedAt.Format("20060102-150405")+`.json"`)
+	c.Data(http.StatusOK, "application/json; charset=utf-8", export.Body)
+}
+
+// render renders the page with status and any messages in extra
+func (h *TransferHandler) render(c *gin.Context, status int, extra gin.H) {
+	exports, err := h.transferService.GetExports(c.Request.Context())
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch exports")
+		return
+	}
+
+	data := gin.H{
+		"title":   "Import and export",
+		"exports": exports,
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	utils.HTMLResponse(c, status, "notes/transfer.html", data)
+}
+
+// serviceError records a transfer service error with the matching status
+func (h *TransferHandler) serviceError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrExportNotFound):
+		_ = c.Error(utils.NewNotFoundError("Export not found"))
+	case errors.Is(err, services.ErrUnauthenticated):
+		_ = c.Error(utils.NewUnauthorizedError("Please log in"))
+	case errors.Is(err, services.ErrForbidden):
+		_ = c.Error(utils.NewForbiddenError("You do not have permission to do this"))
+	default:
+		_ = c.Error(utils.NewInternalError(message, err))
+	}
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// deliveryPageSize caps the deliveries listed on a webhook's page
+const deliveryPageSize = 50
+
+// WebhookHandler handles the webhook administration pages
+type WebhookHandler struct {
+	webhookService services.WebhookService
+}
+
+// NewWebhookHandler creates a new webhook handler
+func NewWebhookHandler(webhookService services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhookService}
+}
+
+// Index renders the webhooks with a form subscribing a new one
+func (h *WebhookHandler) Index(c *gin.Context) {
+	h.renderIndex(c, http.StatusOK, nil)
+}
+
+// Create subscribes the submitted URL to the checked events and shows the
+// new webhook with its secret. Invalid input re-renders the form.
+func (h *WebhookHandler) Create(c *gin.Context) {
+	rawURL := c.PostForm("url")
+	events := make([]domain.WebhookEvent, 0, len(domain.WebhookEvents))
+	for _, event := range c.PostFormArray("events") {
+		events = append(events, domain.WebhookEvent(event))
+	}
+
+	hook, err := h.webhookService.CreateWebhook(c.Request.Context(), rawURL, events)
+	if errors.Is(err, services.ErrInvalidWebhook) {
+		h.renderIndex(c, http.StatusBadRequest, gin.H{"url": rawURL, "webhookError": "Enter an http or https URL and pick at least one event"})
+		return
+	}
+	if err != nil {
+		h.serviceError(c, err, "Failed to create webhook")
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, webhookPath(hook.ID))
+}
+
+// Show renders a webhook with its secret and newest deliveries
+func (h *WebhookHandler) Show(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	hook, err := h.webhookService.GetWebhook(c.Request.Context(), id)
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch webhook")
+		return
+	}
+	deliveries, err := h.webhookService.GetDeliveries(c.Request.Context(), id, deliveryPageSize)
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch deliveries")
+		return
+	}
+
+	utils.HTMLResponse(c, http.StatusOK, "admin/webhook.html", gin.H{
+		"title":      "Webhook",
+		"webhook":    hook,
+		"deliveries": deliveries,
+	})
+}
+
+// Delete removes a webhook with its deliveries
+func (h *WebhookHandler) Delete(c *gin.Context) {
+	id, ok := webhookID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.DeleteWebhook(c.Request.Context(), id); err != nil {
+		h.serviceError(c, err, "Failed to delete webhook")
+		return
+	}
+
+	if utils.IsHTMXRequest(c) {
+		c.Header("HX-Redirect", "/admin/webhooks")
+		c.Status(http.StatusOK)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, "/admin/webhooks")
+}
+
+// Redeliver queues a delivery to be sent again and returns to its webhook
+func (h *WebhookHandler) Redeliver(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("deliveryID"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "Invalid delivery ID")
+		return
+	}
+
+	delivery, err := h.webhookService.Redeliver(c.Request.Context(), id)
+	if err != nil {
+		h.serviceError(c, err, "Failed to redeliver")
+		return
+	}
+
+	c.Redirect(http.StatusSeeOther, webhookPath(delivery.WebhookID))
+}
+
+// renderIndex renders the webhook list with status and any form state in extra
+func (h *WebhookHandler) renderIndex(c *gin.Context, status int, extra gin.H) {
+	hooks, err := h.webhookService.GetWebhooks(c.Request.Context())
+	if err != nil {
+		h.serviceError(c, err, "Failed to fetch webhooks")
+		return
+	}
+
+	data := gin.H{
+		"title":    "Webhooks",
+		"webhooks": hooks,
+		"events":   domain.WebhookEvents,
+	}
+	for k, v := range extra {
+		data[k] = v
+	}
+	utils.HTMLResponse(c, status, "admin/webhooks.html", data)
+}
+
+// serviceError records a webhook service error with the matching status
+func (h *WebhookHandler) serviceError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrWebhookNotFound):
+		_ = c.Error(utils.NewNotFoundError("Webhook not found"))
+	case errors.Is(err, services.ErrDeliveryNotFound):
+		_ = c.Error(utils.NewNotFoundError("Delivery not found"))
+	case errors.Is(err, services.ErrUnauthenticated):
+		_ = c.Error(utils.NewUnauthorizedError("Please log in"))
+	case errors.Is(err, services.ErrForbidden):
+		_ = c.Error(utils.NewForbiddenError("You do not have permission to do this"))
+	default:
+		_ = c.Error(utils.NewInternalError(message, err))
+	}
+}
+
+// webhookID parses the webhook ID in the path, answering 400 if it is invalid
+func webhookID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		utils.BadRequest(c, "Invalid webhook ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// webhookPath is the page of a webhook
+func webhookPath(id int64) string {
+	return "/admin/webhooks/" + strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,253 @@
+// Package jobs runs work outside the request that asked for it. Jobs are
+// stored in the database, so they survive restarts and are shared by every
+// instance; a pool of workers claims and runs them.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// maxBackoff caps the delay before a job is retried
+const maxBackoff = time.Hour
+
+// Handler runs a job of one kind with its JSON payload. A returned error
+// retries the job; wrap it with Permanent when retrying cannot help.
+type Handler func(ctx context.Context, payload []byte) error
+
+// permanentError marks an error that retrying cannot fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so the job fails at once instead of being retried
+func Permanent(err error) error {
+	return &permanentError{err}
+}
+
+// Config tunes a Queue
+type Config struct {
+	// Concurrency is the number of jobs run at the same time
+	Concurrency int
+	// PollInterval is how long an idle worker waits before looking again
+	PollInterval time.Duration
+	// Visibility is how long a job may run. A job still running after it is
+	// assumed abandoned by a crashed worker and runs again.
+	Visibility time.Duration
+	// MaxAttempts is the number of attempts before a job is dead
+	MaxAttempts int
+	// RetryBackoff is the delay before the first retry, doubled for every
+	// further one up to an hour
+	RetryBackoff time.Duration
+}
+
+// Queue enqueues jobs and runs them with a pool of workers
+type Queue struct {
+	repo     repositories.JobRepository
+	cfg      Config
+	logger   *slog.Logger
+	handlers map[string]Handler
+
+	cancel context.CancelFunc
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewQueue creates a queue whose workers are stopped
+func NewQueue(repo repositories.JobRepository, cfg Config, logger *slog.Logger) *Queue {
+	return &Queue{repo: repo, cfg: cfg, logger: logger, handlers: map[string]Handler{}}
+}
+
+// Register sets the handler of kind. Handlers must be registered before Start.
+func (q *Queue) Register(kind string, handler Handler) {
+	q.handlers[kind] = handler
+}
+
+// Handles reports whether a handler is registered for kind
+func (q *Queue) Handles(kind string) bool {
+	_, ok := q.handlers[kind]
+	return ok
+}
+
+// ErrNoHandler is returned when enqueueing a job of a kind without handler,
+// which would only ever fail
+var ErrNoHandler = errors.New("no handler for job kind")
+
+// Enqueue queues a job of kind to run as soon as a worker is free. payload
+// is stored as JSON. Only kinds with a registered handler are queued.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload any) (int64, error) {
+	return q.EnqueueAt(ctx, kind, payload, time.Now())
+}
+
+// EnqueueAt queues a job of kind to run at runAt
+func (q *Queue) EnqueueAt(ctx context.Context, kind string, payload any, runAt time.Time) (int64, error) {
+	if !q.Handles(kind) {
+		return 0, fmt.Errorf("%w %q", ErrNoHandler, kind)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("encoding %s job: %w", kind, err)
+	}
+	now := time.Now()
+	return q.repo.Enqueue(ctx, &domain.Job{
+		Kind:        kind,
+		Payload:     body,
+		Status:      domain.JobQueued,
+		MaxAttempts: q.cfg.MaxAttempts,
+		RunAt:       runAt,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	})
+}
+
+// RunOnce claims one job and runs it, reporting whether there was one
+func (q *Queue) RunOnce(ctx context.Context) (bool, error) {
+	jobs, err := q.repo.Claim(ctx, time.Now(), q.cfg.Visibility, 1)
+	if err != nil || len(jobs) == 0 {
+		return false, err
+	}
+	job := jobs[0]
+	q.run(ctx, job)
+	// Save the outcome even when shutdown cancelled the job
+	return true, q.repo.Finish(context.WithoutCancel(ctx), job)
+}
+
+// errLeaseExpired fails jobs whose workers kept dying or overrunning the
+// visibility timeout until they used up their attempts
+var errLeaseExpired = errors.New("job did not finish within the visibility timeout")
+
+// run attempts job and records the outcome in it: succeeded, queued for a
+// retry after the backoff, or dead
+func (q *Queue) run(ctx context.Context, job *domain.Job) {
+	logger := q.logger.With("job_id", job.ID, "kind", job.Kind, "attempt", job.Attempts)
+	handler, ok := q.handlers[job.Kind]
+
+	var err error
+	switch {
+	case job.Attempts > job.MaxAttempts:
+		err = Permanent(errLeaseExpired)
+	case !ok:
+		// Queued by an instance registering kinds this one does not
+		err = Permanent(fmt.Errorf("%w %q", ErrNoHandler, job.Kind))
+	default:
+		jobCtx, cancel := context.WithTimeout(utils.WithLogger(ctx, logger), q.cfg.Visibility)
+		err = call(jobCtx, handler, job.Payload)
+		cancel()
+	}
+
+	now := time.Now()
+	job.LockedUntil = time.Time{}
+	job.UpdatedAt = now
+	job.LastError = ""
+	var permanent *permanentError
+	switch {
+	case err == nil:
+		job.Status = domain.JobSucceeded
+		logger.Info("job succeeded")
+		return
+	case errors.As(err, &permanent) || job.Attempts >= job.MaxAttempts:
+		job.Status = domain.JobDead
+		logger.Error("job failed for good", "error", err)
+	default:
+		job.Status = domain.JobQueued
+		job.RunAt = now.Add(Backoff(job.Attempts, q.cfg.RetryBackoff))
+		logger.Warn("job failed, will retry", "error", err, "run_at", job.RunAt)
+	}
+	job.LastError = utils.Truncate(err.Error(), domain.MaxJobError)
+}
+
+// call runs handler, turning a panic into an error so it cannot take the
+// worker down
+func call(ctx context.Context, handler Handler, payload []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return handler(ctx, payload)
+}
+
+// Start runs the workers in the background
+func (q *Queue) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+	q.stop = make(chan struct{})
+
+	for range q.cfg.Concurrency {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+			q.work(ctx)
+		}()
+	}
+}
+
+// work runs jobs back to back, waiting a poll interval whenever there is
+// none, until Stop is called
+func (q *Queue) work(ctx context.Context) {
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		ran, err := q.RunOnce(ctx)
+		if err != nil {
+			q.logger.Error("job queue failed", "error", err)
+		}
+		if ran && err == nil {
+			continue
+		}
+		select {
+		case <-q.stop:
+			return
+		case <-time.After(q.cfg.PollInterval):
+		}
+	}
+}
+
+// Stop stops claiming jobs and waits for the running ones to finish. If ctx
+// ends first they are cancelled; a job that ignores the cancellation runs
+// again once its lease expires.
+func (q *Queue) Stop(ctx context.Context) error {
+	if q.stop == nil {
+		return nil
+	}
+	close(q.stop)
+	defer q.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Backoff returns how long to wait after the given number of failed
+// attempts: base, doubled for every attempt after the first, at most an hour
+func Backoff(attempts int, base time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
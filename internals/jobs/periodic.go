@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// Periodic calls run every interval until stopped. run does the work that
+// is due, such as sending webhook deliveries or firing reminders, and
+// returns how many items it handled.
+type Periodic struct {
+	name     string
+	run      func(context.Context) (int, error)
+	interval time.Duration
+	logger   *slog.Logger
+	cancel   context.CancelFunc
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewPeriodic creates a stopped periodic task; name identifies it in logs
+func NewPeriodic(name string, run func(context.Context) (int, error), interval time.Duration, logger *slog.Logger) *Periodic {
+	return &Periodic{name: name, run: run, interval: interval, logger: logger}
+}
+
+// Start runs the task in the background
+func (p *Periodic) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+			}
+			// Keep going while items come back so a backlog drains without
+			// waiting an interval per batch
+			for !p.stopping() {
+				n, err := p.run(ctx)
+				if err != nil {
+					p.logger.Error(p.name+" failed", "error", err)
+				}
+				if err != nil || n == 0 {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// stopping reports whether Stop has been called
+func (p *Periodic) stopping() bool {
+	select {
+	case <-p.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop stops polling and waits for the batch in flight to finish. If ctx
+// ends first the batch is cancelled; the work it abandons must be picked up
+// again by a later batch.
+func (p *Periodic) Stop(ctx context.Context) error {
+	if p.stop == nil {
+		return nil
+	}
+	close(p.stop)
+	defer p.cancel()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
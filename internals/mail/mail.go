@@ -0,0 +1,144 @@
+// Package mail sends plain text emails through an SMTP server. Emails are
+// sent by a background job so a slow or unreachable server never holds up
+// the caller and failed sends are retried.
+package mail
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/jobs"
+)
+
+// SendJob is the kind of the job sending a Message
+const SendJob = "email.send"
+
+// Message is a plain text email
+type Message struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+// Sender sends emails
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Config holds the SMTP server settings
+type Config struct {
+	Host string
+	Port int
+	// Username and Password authenticate with the server; an empty
+	// Username skips authentication
+	Username string
+	Password string
+	// From is the sender address
+	From string
+}
+
+// SMTPSender sends emails through an SMTP server, upgrading to TLS when the
+// server offers STARTTLS
+type SMTPSender struct {
+	cfg Config
+}
+
+// NewSMTPSender creates a sender for the server in cfg
+func NewSMTPSender(cfg Config) *SMTPSender {
+	return &SMTPSender{cfg}
+}
+
+// errHeader rejects addresses and subjects that would inject headers
+var errHeader = errors.New("email header contains a line break")
+
+// Send delivers msg, giving up when ctx ends
+func (s *SMTPSender) Send(ctx context.Context, msg Message) error {
+	if strings.ContainsAny(msg.To+msg.Subject+s.cfg.From, "\r\n") {
+		return errHeader
+	}
+
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("greeting %s: %w", addr, err)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+			return fmt.Errorf("starting TLS: %w", err)
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)); err != nil {
+			return fmt.Errorf("authenticating: %w", err)
+		}
+	}
+	if err := client.Mail(s.cfg.From); err != nil {
+		return fmt.Errorf("sender %s: %w", s.cfg.From, err)
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("recipient %s: %w", msg.To, err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(s.format(msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// format renders msg with its headers; the SMTP data writer converts line
+// endings and escapes leading dots
+func (s *SMTPSender) format(msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\n", s.cfg.From)
+	fmt.Fprintf(&b, "To: %s\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\n\n")
+	b.WriteString(msg.Body)
+	return []byte(b.String())
+}
+
+// SendHandler returns the job handler sending the Message in its payload
+// through sender
+func SendHandler(sender Sender) jobs.Handler {
+	return func(ctx context.Context, payload []byte) error {
+		var msg Message
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return jobs.Permanent(fmt.Errorf("decoding email: %w", err))
+		}
+		if err := sender.Send(ctx, msg); err != nil {
+			if errors.Is(err, errHeader) {
+				return jobs.Permanent(err)
+			}
+			return err
+		}
+		return nil
+	}
+}
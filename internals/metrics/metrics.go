@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics holds the Prometheus collectors exposed on /metrics
+type Metrics struct {
+	registry *prometheus.Registry
+
+	HTTPRequests        *prometheus.CounterVec
+	HTTPRequestDuration *prometheus.HistogramVec
+	RepositoryDuration  *prometheus.HistogramVec
+	NotesCreated        prometheus.Counter
+	NotesUpdated        prometheus.Counter
+	NotesDeleted        prometheus.Counter
+}
+
+// New creates the application metrics on a dedicated registry
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		HTTPRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Number of HTTP requests by method, route and status.",
+		}, []string{"method", "route", "status"}),
+		HTTPRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by method and route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		RepositoryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "repository_operation_duration_seconds",
+			Help:    "Repository operation latency by operation and outcome.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"operation", "outcome"}),
+		NotesCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "notes_created_total",
+			Help: "Number of notes created.",
+		}),
+		NotesUpdated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "notes_updated_total",
+			Help: "Number of notes updated.",
+		}),
+		NotesDeleted: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "notes_deleted_total",
+			Help: "Number of notes deleted.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.HTTPRequests,
+		m.HTTPRequestDuration,
+		m.RepositoryDuration,
+		m.NotesCreated,
+		m.NotesUpdated,
+		m.NotesDeleted,
+	)
+
+	return m
+}
+
+// RegisterDB exposes the connection pool statistics of db
+func (m *Metrics) RegisterDB(db *sql.DB, name string) {
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// ObserveRepository records the duration of a repository operation
+func (m *Metrics) ObserveRepository(operation string, start time.Time, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "error"
+	}
+	m.RepositoryDuration.WithLabelValues(operation, outcome).Observe(time.Since(start).Seconds())
+}
+
+// Handler returns the HTTP handler serving the metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// ErrorMiddleware renders errors attached to the context with c.Error.
+// The last error wins; anything that is not a utils.HTTPError is reported
+// as an internal server error.
+func ErrorMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := utils.AsHTTPError(c.Errors.Last().Err)
+		if err.Status >= 500 {
+			utils.LoggerFromContext(c.Request.Context()).Error("request failed", "error", err)
+		}
+		utils.RenderError(c, err)
+	}
+}
@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/ratelimit"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// LoginRateLimitMiddleware subjects the login handler it guards to the login
+// limit and lockouts. The handler reports a failed login by responding with
+// a 401; any other non-error status counts as a successful login.
+func LoginRateLimitMiddleware(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientKey := "ip:" + c.ClientIP()
+		if !allowLogin(c, limiter, clientKey) {
+			return
+		}
+
+		c.Next()
+
+		switch status := c.Writer.Status(); {
+		case status == http.StatusUnauthorized:
+			loginFailed(c, limiter, clientKey)
+		case status < http.StatusBadRequest:
+			if err := limiter.LoginSucceeded(c.Request.Context(), clientKey); err != nil {
+				utils.LoggerFromContext(c.Request.Context()).Warn("resetting failed logins failed", "error", err)
+			}
+		}
+	}
+}
+
+// allowLogin rejects login attempts from a locked out client or beyond the
+// login limit and reports whether the attempt may proceed
+func allowLogin(c *gin.Context, limiter *ratelimit.Limiter, key string) bool {
+	locked, err := limiter.Locked(c.Request.Context(), key)
+	if err != nil {
+		utils.LoggerFromContext(c.Request.Context()).Warn("lockout check failed", "error", err)
+	}
+	if locked > 0 {
+		tooManyRequests(c, locked, "Too many failed attempts, try again later")
+		return false
+	}
+	return rateLimit(c, limiter, ratelimit.Login, key)
+}
+
+// loginFailed records a failed login attempt, logging when it locks the client out
+func loginFailed(c *gin.Context, limiter *ratelimit.Limiter, key string) {
+	logger := utils.LoggerFromContext(c.Request.Context())
+	locked, err := limiter.LoginFailed(c.Request.Context(), key)
+	if err != nil {
+		logger.Warn("recording failed login failed", "error", err)
+	}
+	if locked > 0 {
+		logger.Warn("client locked out after failed logins", "client", key, "duration", locked)
+	}
+}
@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/ratelimit"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// RateLimitMiddleware limits every client to the read limit for GET, HEAD
+// and OPTIONS requests and to the write limit for everything else. Clients
+// are told their quota in X-RateLimit-* headers and how long to wait in
+// Retry-After once it is used up.
+func RateLimitMiddleware(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class := ratelimit.Write
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			class = ratelimit.Read
+		}
+
+		if !rateLimit(c, limiter, class, ClientKey(c)) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// ClientKey identifies the client a request is counted against: the user
+// signed in by SessionMiddleware, else its IP address. Nothing a client
+// sends unauthenticated picks its bucket, so it cannot start afresh.
+func ClientKey(c *gin.Context) string {
+	if user, ok := c.Get(UserKey); ok {
+		return fmt.Sprintf("user:%v", user)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// rateLimit takes a token of class for key, setting the X-RateLimit-*
+// headers, and aborts with a 429 when none is left. It reports whether the
+// request may continue. Store failures let the request through.
+func rateLimit(c *gin.Context, limiter *ratelimit.Limiter, class ratelimit.Class, key string) bool {
+	result, err := limiter.Allow(c.Request.Context(), class, key)
+	if err != nil {
+		utils.LoggerFromContext(c.Request.Context()).Warn("rate limit check failed", "class", class, "error", err)
+		return true
+	}
+	if result.Limit == 0 {
+		return true
+	}
+
+	c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("X-RateLimit-Reset", seconds(result.Reset))
+
+	if !result.Allowed {
+		tooManyRequests(c, result.RetryAfter, "Too many requests, please slow down")
+		return false
+	}
+	return true
+}
+
+// tooManyRequests aborts with a 429 telling the client to retry after wait
+func tooManyRequests(c *gin.Context, wait time.Duration, message string) {
+	c.Header("Retry-After", seconds(wait))
+	utils.TooManyRequests(c, message)
+}
+
+// seconds formats d as whole seconds, rounded up
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,83 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// CurrentUserKey is the template value holding the signed in user
+const CurrentUserKey = "currentUser"
+
+// SessionMiddleware resolves the session cookie to its user and stores it in
+// the request context for the services, in the gin context under UserKey for
+// logging and rate limiting, and in the currentUser template value. Requests
+// without a valid session continue anonymously.
+func SessionMiddleware(users services.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := c.Cookie(auth.SessionCookie)
+		if err != nil || token == "" {
+			c.Next()
+			return
+		}
+
+		user, err := users.UserForSession(c.Request.Context(), token)
+		if err != nil {
+			utils.LoggerFromContext(c.Request.Context()).Warn("session lookup failed", "error", err)
+		}
+		if user != nil {
+			SetUser(c, user)
+		}
+		c.Next()
+	}
+}
+
+// SetUser makes user the signed in user of the request
+func SetUser(c *gin.Context, user *domain.User) {
+	c.Request = c.Request.WithContext(auth.WithUser(c.Request.Context(), user))
+	c.Set(UserKey, user.Username)
+	utils.SetViewData(c, CurrentUserKey, user)
+}
+
+// RequireLogin rejects anonymous requests. Browsers navigating to a page are
+// redirected to the login page, HTMX requests are told to go there and
+// everything else gets a 401.
+func RequireLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if auth.UserFromContext(c.Request.Context()) != nil {
+			c.Next()
+			return
+		}
+
+		login := "/login?next=" + url.QueryEscape(c.Request.URL.RequestURI())
+		switch {
+		case utils.IsHTMXRequest(c):
+			c.Header("HX-Redirect", login)
+		case c.Request.Method == http.MethodGet && c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) == gin.MIMEHTML:
+			c.Redirect(http.StatusSeeOther, login)
+			c.Abort()
+			return
+		}
+		utils.Unauthorized(c, "Please log in")
+	}
+}
+
+// RequirePermission rejects requests from users whose role does not grant p
+func RequirePermission(p domain.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := auth.UserFromContext(c.Request.Context())
+		switch {
+		case user == nil:
+			utils.Unauthorized(c, "Please log in")
+		case !user.Can(p):
+			utils.Forbidden(c, "You do not have permission to do that")
+		default:
+			c.Next()
+		}
+	}
+}
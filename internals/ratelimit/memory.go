@@ -0,0 +1,144 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often idle buckets and expired failure counts are dropped
+const sweepInterval = time.Minute
+
+// MemoryStore is a Store keeping its state in process memory
+type MemoryStore struct {
+	mu        sync.Mutex
+	now       func() time.Time
+	buckets   map[string]*bucket
+	failures  map[string]*failureCount
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // when the bucket will be full again
+}
+
+type failureCount struct {
+	count   int
+	expires time.Time
+}
+
+// MemoryOption configures a MemoryStore
+type MemoryOption func(*MemoryStore)
+
+// WithClock makes the store read the time from now; used by tests
+func WithClock(now func() time.Time) MemoryOption {
+	return func(s *MemoryStore) {
+		s.now = now
+	}
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore(opts ...MemoryOption) *MemoryStore {
+	s := &MemoryStore{
+		now:      time.Now,
+		buckets:  make(map[string]*bucket),
+		failures: make(map[string]*failureCount),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.lastSweep = s.now()
+	return s
+}
+
+// Take implements Store
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	interval := limit.interval()
+	capacity := float64(limit.Requests)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		s.buckets[key] = b
+	}
+	b.tokens = min(capacity, b.tokens+float64(now.Sub(b.updated))/float64(interval))
+	b.updated = now
+
+	result := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(interval))
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = time.Duration((capacity - b.tokens) * float64(interval))
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
+
+// AddFailure implements Store
+func (s *MemoryStore) AddFailure(_ context.Context, key string, window time.Duration) (int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	f, ok := s.failures[key]
+	if !ok || !now.Before(f.expires) {
+		f = &failureCount{expires: now.Add(window)}
+		s.failures[key] = f
+	}
+	f.count++
+	return f.count, f.expires.Sub(now), nil
+}
+
+// Failures implements Store
+func (s *MemoryStore) Failures(_ context.Context, key string) (int, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	f, ok := s.failures[key]
+	if !ok || !now.Before(f.expires) {
+		return 0, 0, nil
+	}
+	return f.count, f.expires.Sub(now), nil
+}
+
+// ResetFailures implements Store
+func (s *MemoryStore) ResetFailures(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	return nil
+}
+
+// sweep drops full buckets and expired failure counts, which behave exactly
+// like missing ones, so memory stays bounded by the active clients.
+// Called with s.mu held.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, f := range s.failures {
+		if !now.Before(f.expires) {
+			delete(s.failures, key)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit allows Requests per Per, refilled continuously, with bursts of up
+// to Requests
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Enabled reports whether the limit applies
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Per > 0
+}
+
+// interval is the time it takes to refill one token
+func (l Limit) interval() time.Duration {
+	return l.Per / time.Duration(l.Requests)
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next token is available when the
+	// request was not allowed
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// Store keeps token buckets and failed attempt counters. MemoryStore serves
+// a single instance; implement Store on a shared database or cache to apply
+// the limits across several instances.
+type Store interface {
+	// Take removes one token from the bucket key, created full on first use
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+	// AddFailure records a failed attempt for key and returns the number of
+	// failures since the first one and how long until the count resets.
+	// The count resets window after the first failure.
+	AddFailure(ctx context.Context, key string, window time.Duration) (int, time.Duration, error)
+	// Failures returns the current failure count of key and how long until it resets
+	Failures(ctx context.Context, key string) (int, time.Duration, error)
+	// ResetFailures clears the failures of key
+	ResetFailures(ctx context.Context, key string) error
+}
+
+// Class selects which limit applies to a request
+type Class string
+
+const (
+	Read  Class = "read"
+	Write Class = "write"
+	Login Class = "login"
+)
+
+// Policy holds the limit of every class and the lockout settings. A zero
+// Limit disables limiting for its class and a zero LockoutThreshold disables
+// lockouts.
+type Policy struct {
+	Reads  Limit
+	Writes Limit
+	Logins Limit
+	// LockoutThreshold failed logins within LockoutDuration lock the key out
+	// until LockoutDuration has passed since the first failure
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+}
+
+// Limiter applies a Policy on top of a Store
+type Limiter struct {
+	store  Store
+	policy Policy
+}
+
+// NewLimiter creates a Limiter enforcing policy with store
+func NewLimiter(store Store, policy Policy) *Limiter {
+	return &Limiter{store: store, policy: policy}
+}
+
+// Allow takes a token for key from the bucket of class. The result is
+// always allowed when the class has no limit.
+func (l *Limiter) Allow(ctx context.Context, class Class, key string) (Result, error) {
+	limit := l.limit(class)
+	if !limit.Enabled() {
+		return Result{Allowed: true}, nil
+	}
+	return l.store.Take(ctx, string(class)+":"+key, limit)
+}
+
+// Locked returns how long key stays locked out after repeated failed
+// logins, or 0 when it is not locked
+func (l *Limiter) Locked(ctx context.Context, key string) (time.Duration, error) {
+	if l.policy.LockoutThreshold <= 0 {
+		return 0, nil
+	}
+	failures, reset, err := l.store.Failures(ctx, lockoutKey(key))
+	if err != nil || failures < l.policy.LockoutThreshold {
+		return 0, err
+	}
+	return reset, nil
+}
+
+// LoginFailed records a failed login for key and returns how long it is
+// now locked out, or 0
+func (l *Limiter) LoginFailed(ctx context.Context, key string) (time.Duration, error) {
+	if l.policy.LockoutThreshold <= 0 {
+		return 0, nil
+	}
+	failures, reset, err := l.store.AddFailure(ctx, lockoutKey(key), l.policy.LockoutDuration)
+	if err != nil || failures < l.policy.LockoutThreshold {
+		return 0, err
+	}
+	return reset, nil
+}
+
+// LoginSucceeded clears the failed logins of key
+func (l *Limiter) LoginSucceeded(ctx context.Context, key string) error {
+	if l.policy.LockoutThreshold <= 0 {
+		return nil
+	}
+	return l.store.ResetFailures(ctx, lockoutKey(key))
+}
+
+// limit returns the limit of class
+func (l *Limiter) limit(class Class) Limit {
+	switch class {
+	case Read:
+		return l.policy.Reads
+	case Write:
+		return l.policy.Writes
+	case Login:
+		return l.policy.Logins
+	}
+	return Limit{}
+}
+
+// lockoutKey is the store key counting the failed logins of key
+func lockoutKey(key string) string {
+	return "lockout:" + key
+}
@@ -0,0 +1,180 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+)
+
+// AuditRepository defines the interface for the append-only audit log.
+// There are deliberately no methods to change or remove events.
+type AuditRepository interface {
+	// Append chains event to the newest event, setting its PrevHash, Hash and ID
+	Append(ctx context.Context, event *domain.AuditEvent) error
+	// Find returns the events matching filter, newest first
+	Find(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEvent, error)
+	// Walk calls fn with every event, oldest first, and returns the hash the
+	// chain head records for the newest event
+	Walk(ctx context.Context, fn func(*domain.AuditEvent) error) (string, error)
+}
+
+type auditRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewAuditRepository creates a new audit repository.
+// Every statement is bounded by queryTimeout; zero disables the timeout.
+func NewAuditRepository(db *sql.DB, queryTimeout time.Duration) AuditRepository {
+	return &auditRepository{db, queryTimeout}
+}
+
+// auditColumns are the columns scanned by scanAuditEvent
+const auditColumns = `id, actor_id, actor, action, note_id, before_hash, after_hash, ip, request_id, created_at, prev_hash, hash`
+
+// appendQuery inserts an event once the chain head is locked
+const appendQuery = `INSERT INTO audit_events
+(actor_id, actor, action, note_id, before_hash, after_hash, ip, request_id, created_at, prev_hash, hash)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// Append stores an event in a transaction holding the chain head, so
+// concurrent appends cannot fork the chain. Inside Transactor.InTx it joins
+// that transaction, holding the head until the whole change commits.
+func (r *auditRepository) Append(ctx context.Context, event *domain.AuditEvent) (err error) {
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "audit_events", "Append", appendQuery)
+	defer span.End()
+	defer func() {
+		if err != nil {
+			err = logQueryError(ctx, "audit_events", "Append", err, "note_id", event.NoteID)
+		}
+	}()
+
+	return inTx(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
+		var prevHash string
+		if err := tx.QueryRowContext(ctx, `SELECT hash FROM audit_chain WHERE id = 1 FOR UPDATE`).Scan(&prevHash); err != nil {
+			return err
+		}
+
+		event.CreatedAt = event.CreatedAt.Truncate(time.Microsecond)
+		event.PrevHash = prevHash
+		event.Hash = event.ChainHash(prevHash)
+		result, err := tx.ExecContext(ctx, appendQuery,
+			nullID(event.ActorID), event.Actor, event.Action, event.NoteID, event.BeforeHash, event.AfterHash,
+			event.IP, event.RequestID, event.CreatedAt, event.PrevHash, event.Hash)
+		if err != nil {
+			return err
+		}
+		if event.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `UPDATE audit_chain SET hash = ? WHERE id = 1`, event.Hash)
+		return err
+	})
+}
+
+// Find returns the events matching filter, newest first
+func (r *auditRepository) Find(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEvent, error) {
+	var where []string
+	var args []any
+	if filter.Actor != "" {
+		where = append(where, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.NoteID != 0 {
+		where = append(where, "note_id = ?")
+		args = append(args, filter.NoteID)
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.From)
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.To)
+	}
+
+	query := `SELECT ` + auditColumns + ` FROM audit_events`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	var events []*domain.AuditEvent
+	err := r.query(ctx, "Find", query, args, func(event *domain.AuditEvent) error {
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+// Walk calls fn with every event, oldest first
+func (r *auditRepository) Walk(ctx context.Context, fn func(*domain.AuditEvent) error) (string, error) {
+	if err := r.query(ctx, "Walk", `SELECT `+auditColumns+` FROM audit_events ORDER BY id`, nil, fn); err != nil {
+		return "", err
+	}
+
+	query := `SELECT hash FROM audit_chain WHERE id = 1`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "audit_chain", "Walk", query)
+	defer span.End()
+
+	var head string
+	if err := r.db.QueryRowContext(ctx, query).Scan(&head); err != nil {
+		return "", logQueryError(ctx, "audit_chain", "Walk", err)
+	}
+	return head, nil
+}
+
+// query runs a query returning events and calls fn with each of them
+func (r *auditRepository) query(ctx context.Context, op, query string, args []any, fn func(*domain.AuditEvent) error) error {
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "audit_events", op, query)
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return logQueryError(ctx, "audit_events", op, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanAuditEvent(rows)
+		if err != nil {
+			return logQueryError(ctx, "audit_events", op, err)
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return logQueryError(ctx, "audit_events", op, err)
+	}
+	return nil
+}
+
+// scanAuditEvent reads the auditColumns of a row
+func scanAuditEvent(row interface{ Scan(...any) error }) (*domain.AuditEvent, error) {
+	event := &domain.AuditEvent{}
+	var actorID sql.NullInt64
+	if err := row.Scan(&event.ID, &actorID, &event.Actor, &event.Action, &event.NoteID, &event.BeforeHash,
+		&event.AfterHash, &event.IP, &event.RequestID, &event.CreatedAt, &event.PrevHash, &event.Hash); err != nil {
+		return nil, err
+	}
+	event.ActorID = actorID.Int64
+	return event, nil
+}
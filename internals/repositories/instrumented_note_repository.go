@@ -0,0 +1,147 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/metrics"
+)
+
+type instrumentedNoteRepository struct {
+	NoteRepository
+	metrics *metrics.Metrics
+}
+
+// NewInstrumentedNoteRepository wraps repo so that every operation records its latency
+func NewInstrumentedNoteRepository(repo NoteRepository, m *metrics.Metrics) NoteRepository {
+	return &instrumentedNoteRepository{repo, m}
+}
+
+// FindAll returns all notes
+func (r *instrumentedNoteRepository) FindAll(ctx context.Context) ([]*domain.Note, error) {
+	start := time.Now()
+	notes, err := r.NoteRepository.FindAll(ctx)
+	r.metrics.ObserveRepository("FindAll", start, err)
+	return notes, err
+}
+
+// FindByOwner returns the notes owned by a user
+func (r *instrumentedNoteRepository) FindByOwner(ctx context.Context, userID int64) ([]*domain.Note, error) {
+	start := time.Now()
+	notes, err := r.NoteRepository.FindByOwner(ctx, userID)
+	r.metrics.ObserveRepository("FindByOwner", start, err)
+	return notes, err
+}
+
+// FindByID returns a note by ID
+func (r *instrumentedNoteRepository) FindByID(ctx context.Context, id int64) (*domain.Note, error) {
+	start := time.Now()
+	note, err := r.NoteRepository.FindByID(ctx, id)
+	r.metrics.ObserveRepository("FindByID", start, err)
+	return note, err
+}
+
+// Create creates a new note
+func (r *instrumentedNoteRepository) Create(ctx context.Context, note *domain.Note) (int64, error) {
+	start := time.Now()
+	id, err := r.NoteRepository.Create(ctx, note)
+	r.metrics.ObserveRepository("Create", start, err)
+	return id, err
+}
+
+// Update updates an existing note
+func (r *instrumentedNoteRepository) Update(ctx context.Context, note *domain.Note) error {
+	start := time.Now()
+	err := r.NoteRepository.Update(ctx, note)
+	r.metrics.ObserveRepository("Update", start, err)
+	return err
+}
+
+// Delete deletes a note
+func (r *instrumentedNoteRepository) Delete(ctx context.Context, id int64) error {
+	start := time.Now()
+	err := r.NoteRepository.Delete(ctx, id)
+	r.metrics.ObserveRepository("Delete", start, err)
+	return err
+}
+
+// UpdateSchedule saves the due date and reminder time of a note
+func (r *instrumentedNoteRepository) UpdateSchedule(ctx context.Context, note *domain.Note) error {
+	start := time.Now()
+	err := r.NoteRepository.UpdateSchedule(ctx, note)
+	r.metrics.ObserveRepository("UpdateSchedule", start, err)
+	return err
+}
+
+// FindUpcoming returns the notes with a due date
+func (r *instrumentedNoteRepository) FindUpcoming(ctx context.Context, userID int64) ([]*domain.Note, error) {
+	start := time.Now()
+	notes, err := r.NoteRepository.FindUpcoming(ctx, userID)
+	r.metrics.ObserveRepository("FindUpcoming", start, err)
+	return notes, err
+}
+
+// FindDueReminders returns the notes whose reminder is due
+func (r *instrumentedNoteRepository) FindDueReminders(ctx context.Context, now time.Time, limit int) ([]*domain.Note, error) {
+	start := time.Now()
+	notes, err := r.NoteRepository.FindDueReminders(ctx, now, limit)
+	r.metrics.ObserveRepository("FindDueReminders", start, err)
+	return notes, err
+}
+
+// MarkReminded records that a reminder fired
+func (r *instrumentedNoteRepository) MarkReminded(ctx context.Context, id int64, remindAt, now time.Time) (bool, error) {
+	start := time.Now()
+	ok, err := r.NoteRepository.MarkReminded(ctx, id, remindAt, now)
+	r.metrics.ObserveRepository("MarkReminded", start, err)
+	return ok, err
+}
+
+// FindJournal returns the journal entry of a user for a date
+func (r *instrumentedNoteRepository) FindJournal(ctx context.Context, userID int64, date time.Time) (*domain.Note, error) {
+	start := time.Now()
+	note, err := r.NoteRepository.FindJournal(ctx, userID, date)
+	r.metrics.ObserveRepository("FindJournal", start, err)
+	return note, err
+}
+
+// FindJournalDates returns the dates a user has journal entries on
+func (r *instrumentedNoteRepository) FindJournalDates(ctx context.Context, userID int64, from, to time.Time) ([]time.Time, error) {
+	start := time.Now()
+	dates, err := r.NoteRepository.FindJournalDates(ctx, userID, from, to)
+	r.metrics.ObserveRepository("FindJournalDates", start, err)
+	return dates, err
+}
+
+// FindByTitlePrefix returns the notes of a user whose title starts with a prefix
+func (r *instrumentedNoteRepository) FindByTitlePrefix(ctx context.Context, userID int64, prefix string, limit int) ([]*domain.Note, error) {
+	start := time.Now()
+	notes, err := r.NoteRepository.FindByTitlePrefix(ctx, userID, prefix, limit)
+	r.metrics.ObserveRepository("FindByTitlePrefix", start, err)
+	return notes, err
+}
+
+// Search returns the notes matching a search
+func (r *instrumentedNoteRepository) Search(ctx context.Context, userID int64, query *domain.SearchQuery) ([]*domain.Note, error) {
+	start := time.Now()
+	notes, err := r.NoteRepository.Search(ctx, userID, query)
+	r.metrics.ObserveRepository("Search", start, err)
+	return notes, err
+}
+
+// CountSearch counts the notes matching a search
+func (r *instrumentedNoteRepository) CountSearch(ctx context.Context, userID int64, query *domain.SearchQuery) (int, error) {
+	start := time.Now()
+	count, err := r.NoteRepository.CountSearch(ctx, userID, query)
+	r.metrics.ObserveRepository("CountSearch", start, err)
+	return count, err
+}
+
+// FindByDateRange returns the notes whose created or updated time falls in a range
+func (r *instrumentedNoteRepository) FindByDateRange(ctx context.Context, userID int64, dates domain.DateRange) ([]*domain.Note, error) {
+	start := time.Now()
+	notes, err := r.NoteRepository.FindByDateRange(ctx, userID, dates)
+	r.metrics.ObserveRepository("FindByDateRange", start, err)
+	return notes, err
+}
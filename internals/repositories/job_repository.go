@@ -0,0 +1,255 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+)
+
+// JobRepository defines the interface for background job database operations
+type JobRepository interface {
+	Enqueue(ctx context.Context, job *domain.Job) (int64, error)
+	// FindByID returns a job by ID, or nil if there is none
+	FindByID(ctx context.Context, id int64) (*domain.Job, error)
+	// Find returns the jobs matching filter, newest first
+	Find(ctx context.Context, filter domain.JobFilter) ([]*domain.Job, error)
+	// CountByStatus returns the number of jobs in every status
+	CountByStatus(ctx context.Context) (map[domain.JobStatus]int, error)
+	// Claim marks up to limit jobs running for the visibility timeout and
+	// counts an attempt for each. Due queued jobs and running jobs whose
+	// lease expired are claimed, skipping those another worker is claiming.
+	Claim(ctx context.Context, now time.Time, visibility time.Duration, limit int) ([]*domain.Job, error)
+	// Finish saves the outcome of the attempt that claimed job. It does
+	// nothing if the job was claimed again since, so a worker that overran
+	// its lease cannot overwrite the newer attempt.
+	Finish(ctx context.Context, job *domain.Job) error
+	// Requeue queues a dead job to run again with fresh attempts, reporting
+	// whether the job was dead
+	Requeue(ctx context.Context, id int64, now time.Time) (bool, error)
+}
+
+type jobRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewJobRepository creates a new job repository.
+// Every statement is bounded by queryTimeout; zero disables the timeout.
+func NewJobRepository(db *sql.DB, queryTimeout time.Duration) JobRepository {
+	return &jobRepository{db, queryTimeout}
+}
+
+// jobColumns are the columns scanned by scanJob
+const jobColumns = `id, kind, payload, status, attempts, max_attempts, run_at, locked_until, last_error, created_at, updated_at`
+
+// Enqueue stores a job
+func (r *jobRepository) Enqueue(ctx context.Context, job *domain.Job) (int64, error) {
+	query := `INSERT INTO jobs (kind, payload, status, max_attempts, run_at, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "jobs", "Enqueue", query)
+	defer span.End()
+
+	result, err := r.db.ExecContext(ctx, query, job.Kind, job.Payload, job.Status, job.MaxAttempts, job.RunAt, job.CreatedAt, job.UpdatedAt)
+	if err != nil {
+		return 0, logQueryError(ctx, "jobs", "Enqueue", err, "kind", job.Kind)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, logQueryError(ctx, "jobs", "Enqueue", err, "kind", job.Kind)
+	}
+	return id, nil
+}
+
+// FindByID returns a job by ID
+func (r *jobRepository) FindByID(ctx context.Context, id int64) (*domain.Job, error) {
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "jobs", "FindByID", query)
+	defer span.End()
+
+	job, err := scanJob(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, logQueryError(ctx, "jobs", "FindByID", err, "job_id", id)
+	}
+	return job, nil
+}
+
+// Find returns the jobs matching filter, newest first
+func (r *jobRepository) Find(ctx context.Context, filter domain.JobFilter) ([]*domain.Job, error) {
+	var where []string
+	var args []any
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.Kind != "" {
+		where = append(where, "kind = ?")
+		args = append(args, filter.Kind)
+	}
+
+	query := `SELECT ` + jobColumns + ` FROM jobs`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY id DESC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+	return r.findJobs(ctx, r.db, "Find", query, args...)
+}
+
+// CountByStatus returns the number of jobs in every status
+func (r *jobRepository) CountByStatus(ctx context.Context) (map[domain.JobStatus]int, error) {
+	query := `SELECT status, COUNT(*) FROM jobs GROUP BY status`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "jobs", "CountByStatus", query)
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, logQueryError(ctx, "jobs", "CountByStatus", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[domain.JobStatus]int, len(domain.JobStatuses))
+	for rows.Next() {
+		var status domain.JobStatus
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, logQueryError(ctx, "jobs", "CountByStatus", err)
+		}
+		counts[status] = n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "jobs", "CountByStatus", err)
+	}
+	return counts, nil
+}
+
+// Claim locks the claimable jobs and leases them to the caller
+func (r *jobRepository) Claim(ctx context.Context, now time.Time, visibility time.Duration, limit int) ([]*domain.Job, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, logQueryError(ctx, "jobs", "Claim", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	jobs, err := r.findJobs(ctx, tx, "Claim", `SELECT `+jobColumns+` FROM jobs
+WHERE (status = ? AND run_at <= ?) OR (status = ? AND locked_until <= ?)
+ORDER BY run_at LIMIT ? FOR UPDATE SKIP LOCKED`,
+		domain.JobQueued, now, domain.JobRunning, now, limit)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+
+	lockedUntil := now.Add(visibility)
+	args := make([]any, 0, len(jobs)+3)
+	args = append(args, domain.JobRunning, lockedUntil, now)
+	for _, job := range jobs {
+		job.Status = domain.JobRunning
+		job.Attempts++
+		job.LockedUntil = lockedUntil
+		job.UpdatedAt = now
+		args = append(args, job.ID)
+	}
+	query := `UPDATE jobs SET status = ?, attempts = attempts + 1, locked_until = ?, updated_at = ?
+WHERE id IN (?` + strings.Repeat(", ?", len(jobs)-1) + `)`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "jobs", "Claim", query)
+	defer span.End()
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, logQueryError(ctx, "jobs", "Claim", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, logQueryError(ctx, "jobs", "Claim", err)
+	}
+	return jobs, nil
+}
+
+// Finish saves the outcome of an attempt, matched by its attempt number
+func (r *jobRepository) Finish(ctx context.Context, job *domain.Job) error {
+	query := `UPDATE jobs SET status = ?, run_at = ?, locked_until = ?, last_error = ?, updated_at = ?
+WHERE id = ? AND attempts = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "jobs", "Finish", query)
+	defer span.End()
+
+	_, err := r.db.ExecContext(ctx, query, job.Status, job.RunAt,
+		sql.NullTime{Time: job.LockedUntil, Valid: !job.LockedUntil.IsZero()},
+		job.LastError, job.UpdatedAt, job.ID, job.Attempts)
+	if err != nil {
+		return logQueryError(ctx, "jobs", "Finish", err, "job_id", job.ID)
+	}
+	return nil
+}
+
+// Requeue queues a dead job again
+func (r *jobRepository) Requeue(ctx context.Context, id int64, now time.Time) (bool, error) {
+	query := `UPDATE jobs SET status = ?, attempts = 0, run_at = ?, locked_until = NULL, updated_at = ? WHERE id = ? AND status = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "jobs", "Requeue", query)
+	defer span.End()
+
+	result, err := r.db.ExecContext(ctx, query, domain.JobQueued, now, now, id, domain.JobDead)
+	if err != nil {
+		return false, logQueryError(ctx, "jobs", "Requeue", err, "job_id", id)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, logQueryError(ctx, "jobs", "Requeue", err, "job_id", id)
+	}
+	return n > 0, nil
+}
+
+// findJobs runs a query returning jobs
+func (r *jobRepository) findJobs(ctx context.Context, q querier, op, query string, args ...any) ([]*domain.Job, error) {
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "jobs", op, query)
+	defer span.End()
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, logQueryError(ctx, "jobs", op, err)
+	}
+	defer rows.Close()
+
+	var jobs []*domain.Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "jobs", op, err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "jobs", op, err)
+	}
+	return jobs, nil
+}
+
+// scanJob reads the jobColumns of a row
+func scanJob(row interface{ Scan(...any) error }) (*domain.Job, error) {
+	job := &domain.Job{}
+	var lockedUntil sql.NullTime
+	if err := row.Scan(&job.ID, &job.Kind, &job.Payload, &job.Status, &job.Attempts, &job.MaxAttempts, &job.RunAt,
+		&lockedUntil, &job.LastError, &job.CreatedAt, &job.UpdatedAt); err != nil {
+		return nil, err
+	}
+	job.LockedUntil = lockedUntil.Time
+	return job, nil
+}
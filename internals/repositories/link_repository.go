@@ -0,0 +1,324 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+)
+
+// LinkRepository defines the interface for the [[Title]] links between
+// notes, and for the mentions of notes in others' content the graph is drawn
+// from. Links and title mentions resolve among the notes of the linking
+// note's owner.
+type LinkRepository interface {
+	// ReplaceLinks stores titles as the links of a note in place of the
+	// ones it had, resolving each to the oldest note of ownerID with that title
+	ReplaceLinks(ctx context.Context, sourceID, ownerID int64, titles []string) error
+	// ResolveLinks resolves the links of ownerID's notes to title again,
+	// after a note with that title was created, renamed or deleted
+	ResolveLinks(ctx context.Context, ownerID int64, title string) error
+	// FindLinks returns the links of a note in title order
+	FindLinks(ctx context.Context, sourceID int64) ([]*domain.NoteLink, error)
+	// FindBacklinks returns the notes linking to a note, newest first
+	FindBacklinks(ctx context.Context, targetID int64) ([]*domain.Note, error)
+	// FindBroken returns the broken links in the notes of a user, or of
+	// every user when userID is 0, with the titles of their notes
+	FindBroken(ctx context.Context, userID int64) ([]*domain.NoteLink, error)
+	// FindTitles returns the IDs and titles of the notes of ownerID
+	FindTitles(ctx context.Context, ownerID int64) ([]domain.GraphNode, error)
+	// ReplaceMentions stores mentions, keyed by target note ID, in place of
+	// the ones a note had; targets that do not exist are skipped
+	ReplaceMentions(ctx context.Context, sourceID int64, mentions map[int64]string) error
+	// FindMentioning returns the notes of ownerID whose content may mention
+	// title, matched without regard to case, and the notes that mention
+	// targetID by title
+	FindMentioning(ctx context.Context, ownerID int64, title string, targetID int64) ([]*domain.Note, error)
+	// FindGraph returns the notes a user owns or was shared, or every note
+	// when userID is 0, with the mentions among them, ordered by ID
+	FindGraph(ctx context.Context, userID int64) (*domain.NoteGraph, error)
+}
+
+type linkRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewLinkRepository creates a new link repository.
+// Every statement is bounded by queryTimeout; zero disables the timeout.
+func NewLinkRepository(db *sql.DB, queryTimeout time.Duration) LinkRepository {
+	return &linkRepository{db, queryTimeout}
+}
+
+// linkTarget resolves a title among the notes of an owner; its arguments
+// are the owner and the title
+const linkTarget = `(SELECT MIN(n.id) FROM notes n WHERE n.user_id <=> ? AND n.title = ?)`
+
+// ReplaceLinks stores the links of a note in one transaction, so readers
+// never see a note without its links
+func (r *linkRepository) ReplaceLinks(ctx context.Context, sourceID, ownerID int64, titles []string) error {
+	// Titles the collation considers equal, such as accented variants,
+	// share one link
+	query := `INSERT INTO note_links (source_id, target_title, target_id) VALUES (?, ?, ` + linkTarget + `)
+ON DUPLICATE KEY UPDATE source_id = source_id`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_links", "ReplaceLinks", query)
+	defer span.End()
+
+	err := inTx(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM note_links WHERE source_id = ?`, sourceID); err != nil {
+			return err
+		}
+		for _, title := range titles {
+			if _, err := tx.ExecContext(ctx, query, sourceID, title, nullID(ownerID), title); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return logQueryError(ctx, "note_links", "ReplaceLinks", err, "note_id", sourceID)
+	}
+	return nil
+}
+
+// ResolveLinks resolves the links to a title again
+func (r *linkRepository) ResolveLinks(ctx context.Context, ownerID int64, title string) error {
+	query := `UPDATE note_links SET target_id = ` + linkTarget + `
+WHERE target_title = ? AND source_id IN (SELECT s.id FROM notes s WHERE s.user_id <=> ?)`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_links", "ResolveLinks", query)
+	defer span.End()
+
+	owner := nullID(ownerID)
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, owner, title, title, owner); err != nil {
+		return logQueryError(ctx, "note_links", "ResolveLinks", err, "user_id", ownerID)
+	}
+	return nil
+}
+
+// FindLinks returns the links of a note
+func (r *linkRepository) FindLinks(ctx context.Context, sourceID int64) ([]*domain.NoteLink, error) {
+	return r.findLinks(ctx, "FindLinks",
+		`SELECT l.source_id, '', l.target_title, l.target_id FROM note_links l WHERE l.source_id = ? ORDER BY l.target_title`,
+		sourceID)
+}
+
+// FindBacklinks returns the notes linking to a note
+func (r *linkRepository) FindBacklinks(ctx context.Context, targetID int64) ([]*domain.Note, error) {
+	query := `SELECT ` + prefixedNoteColumns + ` FROM note_links l JOIN notes n ON n.id = l.source_id
+WHERE l.target_id = ? AND l.source_id <> l.target_id ORDER BY n.created_at DESC, n.id DESC`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_links", "FindBacklinks", query)
+	defer span.End()
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, targetID)
+	if err != nil {
+		return nil, logQueryError(ctx, "note_links", "FindBacklinks", err, "note_id", targetID)
+	}
+	defer rows.Close()
+
+	var notes []*domain.Note
+	for rows.Next() {
+		note, err := scanNote(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "note_links", "FindBacklinks", err, "note_id", targetID)
+		}
+		notes = append(notes, note)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "note_links", "FindBacklinks", err, "note_id", targetID)
+	}
+	return notes, nil
+}
+
+// FindBroken returns the broken links in the notes of a user
+func (r *linkRepository) FindBroken(ctx context.Context, userID int64) ([]*domain.NoteLink, error) {
+	query := `SELECT l.source_id, n.title, l.target_title, l.target_id FROM note_links l JOIN notes n ON n.id = l.source_id
+WHERE l.target_id IS NULL`
+	if userID == 0 {
+		return r.findLinks(ctx, "FindBroken", query+` ORDER BY n.title, l.source_id, l.target_title`)
+	}
+	return r.findLinks(ctx, "FindBroken", query+` AND n.user_id = ? ORDER BY n.title, l.source_id, l.target_title`, userID)
+}
+
+// findLinks runs a query returning links
+func (r *linkRepository) findLinks(ctx context.Context, op, query string, args ...any) ([]*domain.NoteLink, error) {
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_links", op, query)
+	defer span.End()
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, logQueryError(ctx, "note_links", op, err)
+	}
+	defer rows.Close()
+
+	var links []*domain.NoteLink
+	for rows.Next() {
+		link := &domain.NoteLink{}
+		var targetID sql.NullInt64
+		if err := rows.Scan(&link.SourceID, &link.SourceTitle, &link.TargetTitle, &targetID); err != nil {
+			return nil, logQueryError(ctx, "note_links", op, err)
+		}
+		link.TargetID = targetID.Int64
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "note_links", op, err)
+	}
+	return links, nil
+}
+
+// FindTitles returns the IDs and titles of the notes of an owner
+func (r *linkRepository) FindTitles(ctx context.Context, ownerID int64) ([]domain.GraphNode, error) {
+	query := `SELECT n.id, n.title FROM notes n WHERE n.user_id <=> ? ORDER BY n.id`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notes", "FindTitles", query)
+	defer span.End()
+
+	nodes, err := scanNodes(ctx, conn(ctx, r.db), query, nullID(ownerID))
+	if err != nil {
+		return nil, logQueryError(ctx, "notes", "FindTitles", err, "user_id", ownerID)
+	}
+	return nodes, nil
+}
+
+// ReplaceMentions stores the mentions of a note in one transaction
+func (r *linkRepository) ReplaceMentions(ctx context.Context, sourceID int64, mentions map[int64]string) error {
+	// Selecting the target from notes skips mentions of URLs of notes that
+	// do not exist
+	query := `INSERT INTO note_mentions (source_id, target_id, via) SELECT ?, n.id, ? FROM notes n WHERE n.id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_mentions", "ReplaceMentions", query)
+	defer span.End()
+
+	targets := make([]int64, 0, len(mentions))
+	for target := range mentions {
+		targets = append(targets, target)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i] < targets[j] })
+
+	err := inTx(ctx, r.db, func(ctx context.Context, tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM note_mentions WHERE source_id = ?`, sourceID); err != nil {
+			return err
+		}
+		for _, target := range targets {
+			if _, err := tx.ExecContext(ctx, query, sourceID, mentions[target], target); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return logQueryError(ctx, "note_mentions", "ReplaceMentions", err, "note_id", sourceID)
+	}
+	return nil
+}
+
+// FindMentioning returns the notes that may mention a title
+func (r *linkRepository) FindMentioning(ctx context.Context, ownerID int64, title string, targetID int64) ([]*domain.Note, error) {
+	query := `SELECT ` + prefixedNoteColumns + ` FROM notes n WHERE n.user_id <=> ? AND n.content LIKE ?
+UNION
+SELECT ` + prefixedNoteColumns + ` FROM note_mentions m JOIN notes n ON n.id = m.source_id
+WHERE m.target_id = ? AND m.via = 'title'`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_mentions", "FindMentioning", query)
+	defer span.End()
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, nullID(ownerID), "%"+escapeLike(title)+"%", targetID)
+	if err != nil {
+		return nil, logQueryError(ctx, "note_mentions", "FindMentioning", err, "note_id", targetID)
+	}
+	defer rows.Close()
+
+	var notes []*domain.Note
+	for rows.Next() {
+		note, err := scanNote(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "note_mentions", "FindMentioning", err, "note_id", targetID)
+		}
+		notes = append(notes, note)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "note_mentions", "FindMentioning", err, "note_id", targetID)
+	}
+	return notes, nil
+}
+
+// FindGraph returns the graph of the notes a user can read, from their
+// titles and stored mentions only
+func (r *linkRepository) FindGraph(ctx context.Context, userID int64) (*domain.NoteGraph, error) {
+	readable := ``
+	var args []any
+	if userID != 0 {
+		readable = ` WHERE n.user_id = ? OR n.id IN (SELECT s.note_id FROM note_shares s WHERE s.user_id = ?)`
+		args = []any{userID, userID}
+	}
+	nodesQuery := `SELECT n.id, n.title FROM notes n` + readable + ` ORDER BY n.id`
+	edgesQuery := `SELECT m.source_id, m.target_id, m.via FROM note_mentions m JOIN notes n ON n.id = m.source_id` +
+		readable + ` ORDER BY m.source_id, m.target_id`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_mentions", "FindGraph", nodesQuery)
+	defer span.End()
+
+	db := conn(ctx, r.db)
+	nodes, err := scanNodes(ctx, db, nodesQuery, args...)
+	if err != nil {
+		return nil, logQueryError(ctx, "note_mentions", "FindGraph", err, "user_id", userID)
+	}
+	graph := &domain.NoteGraph{Nodes: nodes, Edges: []domain.GraphEdge{}}
+	ids := make(map[int64]bool, len(nodes))
+	for _, node := range nodes {
+		ids[node.ID] = true
+	}
+
+	rows, err := db.QueryContext(ctx, edgesQuery, args...)
+	if err != nil {
+		return nil, logQueryError(ctx, "note_mentions", "FindGraph", err, "user_id", userID)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var edge domain.GraphEdge
+		if err := rows.Scan(&edge.Source, &edge.Target, &edge.Via); err != nil {
+			return nil, logQueryError(ctx, "note_mentions", "FindGraph", err, "user_id", userID)
+		}
+		// Mentions of notes the user cannot read are left out
+		if ids[edge.Target] {
+			graph.Edges = append(graph.Edges, edge)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "note_mentions", "FindGraph", err, "user_id", userID)
+	}
+	return graph, nil
+}
+
+// scanNodes runs a query returning the IDs and titles of notes
+func scanNodes(ctx context.Context, db executor, query string, args ...any) ([]domain.GraphNode, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nodes := []domain.GraphNode{}
+	for rows.Next() {
+		var node domain.GraphNode
+		if err := rows.Scan(&node.ID, &node.Title); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, rows.Err()
+}
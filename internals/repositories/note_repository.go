@@ -1,7 +1,10 @@
 package repositories
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/mas-diq/htmx-basic-crud/internals/domain"
@@ -9,91 +12,358 @@ import (
 
 // NoteRepository defines the interface for note database operations
 type NoteRepository interface {
-	FindAll() ([]*domain.Note, error)
-	FindByID(id int64) (*domain.Note, error)
-	Create(note *domain.Note) (int64, error)
-	Update(note *domain.Note) error
-	Delete(id int64) error
+	FindAll(ctx context.Context) ([]*domain.Note, error)
+	FindByOwner(ctx context.Context, userID int64) ([]*domain.Note, error)
+	FindByID(ctx context.Context, id int64) (*domain.Note, error)
+	// Create stores a note, returning ErrDuplicate if its owner already has
+	// a journal entry for its journal date
+	Create(ctx context.Context, note *domain.Note) (int64, error)
+	Update(ctx context.Context, note *domain.Note) error
+	Delete(ctx context.Context, id int64) error
+
+	// UpdateSchedule saves the due date and reminder time of a note. A
+	// changed reminder time fires again even if the old one had fired.
+	UpdateSchedule(ctx context.Context, note *domain.Note) error
+	// FindUpcoming returns the notes with a due date owned by userID, or
+	// every user's when userID is 0, soonest first
+	FindUpcoming(ctx context.Context, userID int64) ([]*domain.Note, error)
+	// FindDueReminders returns up to limit notes whose reminder is due at
+	// now and has not fired yet
+	FindDueReminders(ctx context.Context, now time.Time, limit int) ([]*domain.Note, error)
+	// MarkReminded records that the reminder of a note fired at now. It
+	// reports false if it already fired or remindAt is no longer the
+	// note's reminder time, so every reminder fires once.
+	MarkReminded(ctx context.Context, id int64, remindAt, now time.Time) (bool, error)
+
+	// FindByTitlePrefix returns up to limit notes of a user whose title
+	// starts with prefix, ordered by title
+	FindByTitlePrefix(ctx context.Context, userID int64, prefix string, limit int) ([]*domain.Note, error)
+	// Search returns the notes of a user matching query, or those of every
+	// user when userID is 0, newest first
+	Search(ctx context.Context, userID int64, query *domain.SearchQuery) ([]*domain.Note, error)
+	// CountSearch returns the number of notes Search would return
+	CountSearch(ctx context.Context, userID int64, query *domain.SearchQuery) (int, error)
+	// FindByDateRange returns the notes of a user, or of every user when
+	// userID is 0, whose time named by dates.Field falls in the range,
+	// latest first by that time
+	FindByDateRange(ctx context.Context, userID int64, dates domain.DateRange) ([]*domain.Note, error)
+
+	// FindJournal returns the journal entry of a user for date, or nil if
+	// there is none
+	FindJournal(ctx context.Context, userID int64, date time.Time) (*domain.Note, error)
+	// FindJournalDates returns the dates from from up to but excluding to
+	// on which a user has a journal entry, in order
+	FindJournalDates(ctx context.Context, userID int64, from, to time.Time) ([]time.Time, error)
 }
 
 type noteRepository struct {
-	db *sql.DB
+	db           *sql.DB
+	queryTimeout time.Duration
 }
 
-// NewNoteRepository creates a new note repository
-func NewNoteRepository(db *sql.DB) NoteRepository {
-	return &noteRepository{db}
+// NewNoteRepository creates a new note repository.
+// Every statement is bounded by queryTimeout; zero disables the timeout.
+func NewNoteRepository(db *sql.DB, queryTimeout time.Duration) NoteRepository {
+	return &noteRepository{db, queryTimeout}
+}
+
+// noteColumns are the columns scanned by scanNote
+const noteColumns = `id, user_id, title, content, created_at, updated_at, due_at, remind_at, journal_date`
+
+// dateColumns maps the note times of date ranges and searches to their
+// columns. Only these names are ever written into a query; every value is
+// a placeholder.
+var dateColumns = map[string]string{
+	domain.NoteCreated: "created_at",
+	domain.NoteUpdated: "updated_at",
 }
 
+// prefixedNoteColumns are the noteColumns of the notes aliased n in a join
+const prefixedNoteColumns = `n.id, n.user_id, n.title, n.content, n.created_at, n.updated_at, n.due_at, n.remind_at, n.journal_date`
+
 // FindAll returns all notes
-func (r *noteRepository) FindAll() ([]*domain.Note, error) {
-	query := `SELECT id, title, content, created_at, updated_at FROM notes ORDER BY created_at DESC`
-	rows, err := r.db.Query(query)
+func (r *noteRepository) FindAll(ctx context.Context) ([]*domain.Note, error) {
+	return r.findNotes(ctx, "FindAll", `SELECT `+noteColumns+` FROM notes ORDER BY created_at DESC`)
+}
+
+// FindByOwner returns the notes owned by a user
+func (r *noteRepository) FindByOwner(ctx context.Context, userID int64) ([]*domain.Note, error) {
+	return r.findNotes(ctx, "FindByOwner",
+		`SELECT `+noteColumns+` FROM notes WHERE user_id = ? ORDER BY created_at DESC`, userID)
+}
+
+// findNotes runs a query returning notes
+func (r *noteRepository) findNotes(ctx context.Context, op, query string, args ...any) ([]*domain.Note, error) {
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notes", op, query)
+	defer span.End()
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "notes", op, err)
 	}
 	defer rows.Close()
 
 	var notes []*domain.Note
 	for rows.Next() {
-		note := &domain.Note{}
-		if err := rows.Scan(&note.ID, &note.Title, &note.Content, &note.CreatedAt, &note.UpdatedAt); err != nil {
-			return nil, err
+		note, err := scanNote(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "notes", op, err)
 		}
 		notes = append(notes, note)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "notes", op, err)
 	}
 
 	return notes, nil
 }
 
 // FindByID returns a note by ID
-func (r *noteRepository) FindByID(id int64) (*domain.Note, error) {
-	query := `SELECT id, title, content, created_at, updated_at FROM notes WHERE id = ?`
-	row := r.db.QueryRow(query, id)
+func (r *noteRepository) FindByID(ctx context.Context, id int64) (*domain.Note, error) {
+	query := `SELECT ` + noteColumns + ` FROM notes WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notes", "FindByID", query)
+	defer span.End()
 
-	note := &domain.Note{}
-	err := row.Scan(&note.ID, &note.Title, &note.Content, &note.CreatedAt, &note.UpdatedAt)
+	row := conn(ctx, r.db).QueryRowContext(ctx, query, id)
+
+	note, err := scanNote(row)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		return nil, err
+		return nil, logQueryError(ctx, "notes", "FindByID", err, "note_id", id)
 	}
 
 	return note, nil
 }
 
 // Create creates a new note
-func (r *noteRepository) Create(note *domain.Note) (int64, error) {
-	query := `INSERT INTO notes (title, content, created_at, updated_at) VALUES (?, ?, ?, ?)`
-	result, err := r.db.Exec(query, note.Title, note.Content, note.CreatedAt, note.UpdatedAt)
+func (r *noteRepository) Create(ctx context.Context, note *domain.Note) (int64, error) {
+	query := `INSERT INTO notes (user_id, title, content, created_at, updated_at, due_at, remind_at, journal_date)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notes", "Create", query)
+	defer span.End()
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, nullID(note.UserID), note.Title, note.Content, note.CreatedAt, note.UpdatedAt,
+		nullTime(note.DueAt), nullTime(note.RemindAt), nullDate(note.JournalDate))
+	if isDuplicate(err) {
+		return 0, ErrDuplicate
+	}
 	if err != nil {
-		return 0, err
+		return 0, logQueryError(ctx, "notes", "Create", err)
 	}
 
 	id, err := result.LastInsertId()
 	if err != nil {
-		return 0, err
+		return 0, logQueryError(ctx, "notes", "Create", err)
 	}
 
 	return id, nil
 }
 
 // Update updates an existing note
-func (r *noteRepository) Update(note *domain.Note) error {
+func (r *noteRepository) Update(ctx context.Context, note *domain.Note) error {
 	note.UpdatedAt = time.Now()
 	query := `UPDATE notes SET title = ?, content = ?, updated_at = ? WHERE id = ?`
-	_, err := r.db.Exec(query, note.Title, note.Content, note.UpdatedAt, note.ID)
-	return err
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notes", "Update", query)
+	defer span.End()
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, note.Title, note.Content, note.UpdatedAt, note.ID)
+	if err != nil {
+		return logQueryError(ctx, "notes", "Update", err, "note_id", note.ID)
+	}
+	return nil
 }
 
 // Delete deletes a note
-func (r *noteRepository) Delete(id int64) error {
+func (r *noteRepository) Delete(ctx context.Context, id int64) error {
 	query := `DELETE FROM notes WHERE id = ?`
-	_, err := r.db.Exec(query, id)
-	return err
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notes", "Delete", query)
+	defer span.End()
+
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id)
+	if err != nil {
+		return logQueryError(ctx, "notes", "Delete", err, "note_id", id)
+	}
+	return nil
+}
+
+// UpdateSchedule saves the due date and reminder time of a note. reminded_at
+// is set first so it is compared with the old reminder time.
+func (r *noteRepository) UpdateSchedule(ctx context.Context, note *domain.Note) error {
+	query := `UPDATE notes SET reminded_at = IF(remind_at <=> ?, reminded_at, NULL), due_at = ?, remind_at = ? WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notes", "UpdateSchedule", query)
+	defer span.End()
+
+	remindAt := nullTime(note.RemindAt)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, remindAt, nullTime(note.DueAt), remindAt, note.ID)
+	if err != nil {
+		return logQueryError(ctx, "notes", "UpdateSchedule", err, "note_id", note.ID)
+	}
+	return nil
+}
+
+// FindUpcoming returns the notes with a due date, soonest first
+func (r *noteRepository) FindUpcoming(ctx context.Context, userID int64) ([]*domain.Note, error) {
+	if userID == 0 {
+		return r.findNotes(ctx, "FindUpcoming",
+			`SELECT `+noteColumns+` FROM notes WHERE due_at IS NOT NULL ORDER BY due_at, id`)
+	}
+	return r.findNotes(ctx, "FindUpcoming",
+		`SELECT `+noteColumns+` FROM notes WHERE user_id = ? AND due_at IS NOT NULL ORDER BY due_at, id`, userID)
+}
+
+// FindDueReminders returns the notes whose reminder is due, oldest first
+func (r *noteRepository) FindDueReminders(ctx context.Context, now time.Time, limit int) ([]*domain.Note, error) {
+	return r.findNotes(ctx, "FindDueReminders", `SELECT `+noteColumns+` FROM notes
+WHERE remind_at <= ? AND reminded_at IS NULL ORDER BY remind_at, id LIMIT ?`, now, limit)
+}
+
+// MarkReminded records that a reminder fired, unless it already had
+func (r *noteRepository) MarkReminded(ctx context.Context, id int64, remindAt, now time.Time) (bool, error) {
+	query := `UPDATE notes SET reminded_at = ? WHERE id = ? AND remind_at = ? AND reminded_at IS NULL`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notes", "MarkReminded", query)
+	defer span.End()
+
+	result, err := conn(ctx, r.db).ExecContext(ctx, query, now, id, remindAt)
+	if err != nil {
+		return false, logQueryError(ctx, "notes", "MarkReminded", err, "note_id", id)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, logQueryError(ctx, "notes", "MarkReminded", err, "note_id", id)
+	}
+	return n > 0, nil
+}
+
+// FindByTitlePrefix returns the notes of a user whose title starts with prefix
+func (r *noteRepository) FindByTitlePrefix(ctx context.Context, userID int64, prefix string, limit int) ([]*domain.Note, error) {
+	return r.findNotes(ctx, "FindByTitlePrefix", `SELECT `+noteColumns+` FROM notes
+WHERE user_id = ? AND title LIKE ? ORDER BY title, id LIMIT ?`, userID, escapeLike(prefix)+"%", limit)
+}
+
+// FindByDateRange returns the notes whose created or updated time falls in a range
+func (r *noteRepository) FindByDateRange(ctx context.Context, userID int64, dates domain.DateRange) ([]*domain.Note, error) {
+	column, ok := dateColumns[dates.Field]
+	if !ok {
+		return nil, fmt.Errorf("unknown note date field %q", dates.Field)
+	}
+
+	var conditions []string
+	var args []any
+	if userID != 0 {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, userID)
+	}
+	if !dates.From.IsZero() {
+		conditions = append(conditions, column+" >= ?")
+		args = append(args, dates.From)
+	}
+	if !dates.To.IsZero() {
+		conditions = append(conditions, column+" < ?")
+		args = append(args, dates.To)
+	}
+	query := `SELECT ` + noteColumns + ` FROM notes`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	return r.findNotes(ctx, "FindByDateRange", query+` ORDER BY `+column+` DESC, id DESC`, args...)
+}
+
+// FindJournal returns the journal entry of a user for date
+func (r *noteRepository) FindJournal(ctx context.Context, userID int64, date time.Time) (*domain.Note, error) {
+	query := `SELECT ` + noteColumns + ` FROM notes WHERE user_id = ? AND journal_date = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notes", "FindJournal", query)
+	defer span.End()
+
+	note, err := scanNote(conn(ctx, r.db).QueryRowContext(ctx, query, userID, nullDate(date)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, logQueryError(ctx, "notes", "FindJournal", err, "user_id", userID)
+	}
+	return note, nil
+}
+
+// FindJournalDates returns the dates a user has journal entries on
+func (r *noteRepository) FindJournalDates(ctx context.Context, userID int64, from, to time.Time) ([]time.Time, error) {
+	query := `SELECT journal_date FROM notes WHERE user_id = ? AND journal_date >= ? AND journal_date < ? ORDER BY journal_date`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notes", "FindJournalDates", query)
+	defer span.End()
+
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID, nullDate(from), nullDate(to))
+	if err != nil {
+		return nil, logQueryError(ctx, "notes", "FindJournalDates", err, "user_id", userID)
+	}
+	defer rows.Close()
+
+	var dates []time.Time
+	for rows.Next() {
+		var date time.Time
+		if err := rows.Scan(&date); err != nil {
+			return nil, logQueryError(ctx, "notes", "FindJournalDates", err, "user_id", userID)
+		}
+		dates = append(dates, date)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "notes", "FindJournalDates", err, "user_id", userID)
+	}
+	return dates, nil
+}
+
+// scanNote reads the noteColumns of a row
+func scanNote(row interface{ Scan(...any) error }) (*domain.Note, error) {
+	note := &domain.Note{}
+	var userID sql.NullInt64
+	var dueAt, remindAt, journalDate sql.NullTime
+	if err := row.Scan(&note.ID, &userID, &note.Title, &note.Content, &note.CreatedAt, &note.UpdatedAt,
+		&dueAt, &remindAt, &journalDate); err != nil {
+		return nil, err
+	}
+	note.UserID = userID.Int64
+	note.DueAt = dueAt.Time
+	note.RemindAt = remindAt.Time
+	note.JournalDate = journalDate.Time
+	return note, nil
+}
+
+// nullID stores a zero ID as NULL
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+// nullTime stores a zero time as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern with the default
+// backslash escape character
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// nullDate stores a zero date as NULL and others as YYYY-MM-DD for DATE columns
+func nullDate(t time.Time) sql.NullString {
+	return sql.NullString{String: t.Format(time.DateOnly), Valid: !t.IsZero()}
 }
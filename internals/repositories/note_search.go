@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+)
+
+// searchWhere builds the WHERE clause of a search of the notes of userID,
+// or of every user when userID is 0, and its arguments
+func searchWhere(userID int64, query *domain.SearchQuery) (string, []any) {
+	var conditions []string
+	var args []any
+	if userID != 0 {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, userID)
+	}
+
+	for _, term := range query.Terms {
+		var condition string
+		switch term.Field {
+		case domain.SearchText:
+			condition = "(title LIKE ? OR content LIKE ?)"
+			pattern := "%" + escapeLike(term.Text) + "%"
+			args = append(args, pattern, pattern)
+		case domain.SearchTitle:
+			condition = "title LIKE ?"
+			args = append(args, "%"+escapeLike(term.Text)+"%")
+		default:
+			column, ok := dateColumns[term.Field]
+			if !ok {
+				continue
+			}
+			var bounds []string
+			if !term.From.IsZero() {
+				bounds = append(bounds, column+" >= ?")
+				args = append(args, term.From)
+			}
+			if !term.To.IsZero() {
+				bounds = append(bounds, column+" < ?")
+				args = append(args, term.To)
+			}
+			if len(bounds) == 0 {
+				continue
+			}
+			condition = "(" + strings.Join(bounds, " AND ") + ")"
+		}
+		if term.Negate {
+			// content may be NULL, which leaves a term NULL rather than
+			// false; a negated term matches such notes
+			condition = "NOT COALESCE(" + condition + ", FALSE)"
+		}
+		conditions = append(conditions, condition)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// Search returns the notes matching a search
+func (r *noteRepository) Search(ctx context.Context, userID int64, query *domain.SearchQuery) ([]*domain.Note, error) {
+	where, args := searchWhere(userID, query)
+	return r.findNotes(ctx, "Search", `SELECT `+noteColumns+` FROM notes`+where+` ORDER BY created_at DESC, id DESC`, args...)
+}
+
+// CountSearch counts the notes matching a search
+func (r *noteRepository) CountSearch(ctx context.Context, userID int64, query *domain.SearchQuery) (int, error) {
+	where, args := searchWhere(userID, query)
+	statement := `SELECT COUNT(*) FROM notes` + where
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notes", "CountSearch", statement)
+	defer span.End()
+
+	var count int
+	if err := conn(ctx, r.db).QueryRowContext(ctx, statement, args...).Scan(&count); err != nil {
+		return 0, logQueryError(ctx, "notes", "CountSearch", err, "user_id", userID)
+	}
+	return count, nil
+}
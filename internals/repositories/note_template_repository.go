@@ -0,0 +1,171 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+)
+
+// NoteTemplateRepository defines the interface for note template database operations
+type NoteTemplateRepository interface {
+	// FindAll returns every template ordered by name
+	FindAll(ctx context.Context) ([]*domain.NoteTemplate, error)
+	// FindByID returns a template by ID, or nil if there is none
+	FindByID(ctx context.Context, id int64) (*domain.NoteTemplate, error)
+	Create(ctx context.Context, tmpl *domain.NoteTemplate) (int64, error)
+	Update(ctx context.Context, tmpl *domain.NoteTemplate) error
+	Delete(ctx context.Context, id int64) error
+	// NextCounter bumps the counter of a template and returns the new
+	// value, or 0 if there is no such template. Concurrent callers never
+	// get the same value.
+	NextCounter(ctx context.Context, id int64) (int64, error)
+}
+
+type noteTemplateRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewNoteTemplateRepository creates a new note template repository.
+// Every statement is bounded by queryTimeout; zero disables the timeout.
+func NewNoteTemplateRepository(db *sql.DB, queryTimeout time.Duration) NoteTemplateRepository {
+	return &noteTemplateRepository{db, queryTimeout}
+}
+
+// templateColumns are the columns scanned by scanTemplate
+const templateColumns = `id, name, title, content, counter, created_by, created_at, updated_at`
+
+// FindAll returns every template ordered by name
+func (r *noteTemplateRepository) FindAll(ctx context.Context) ([]*domain.NoteTemplate, error) {
+	query := `SELECT ` + templateColumns + ` FROM note_templates ORDER BY name, id`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_templates", "FindAll", query)
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, logQueryError(ctx, "note_templates", "FindAll", err)
+	}
+	defer rows.Close()
+
+	var templates []*domain.NoteTemplate
+	for rows.Next() {
+		tmpl, err := scanTemplate(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "note_templates", "FindAll", err)
+		}
+		templates = append(templates, tmpl)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "note_templates", "FindAll", err)
+	}
+	return templates, nil
+}
+
+// FindByID returns a template by ID
+func (r *noteTemplateRepository) FindByID(ctx context.Context, id int64) (*domain.NoteTemplate, error) {
+	query := `SELECT ` + templateColumns + ` FROM note_templates WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_templates", "FindByID", query)
+	defer span.End()
+
+	tmpl, err := scanTemplate(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, logQueryError(ctx, "note_templates", "FindByID", err, "template_id", id)
+	}
+	return tmpl, nil
+}
+
+// Create stores a template
+func (r *noteTemplateRepository) Create(ctx context.Context, tmpl *domain.NoteTemplate) (int64, error) {
+	query := `INSERT INTO note_templates (name, title, content, created_by, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_templates", "Create", query)
+	defer span.End()
+
+	result, err := r.db.ExecContext(ctx, query, tmpl.Name, tmpl.Title, tmpl.Content, nullID(tmpl.CreatedBy),
+		tmpl.CreatedAt, tmpl.UpdatedAt)
+	if err != nil {
+		return 0, logQueryError(ctx, "note_templates", "Create", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, logQueryError(ctx, "note_templates", "Create", err)
+	}
+	return id, nil
+}
+
+// Update saves the name, title and content of a template
+func (r *noteTemplateRepository) Update(ctx context.Context, tmpl *domain.NoteTemplate) error {
+	query := `UPDATE note_templates SET name = ?, title = ?, content = ?, updated_at = ? WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_templates", "Update", query)
+	defer span.End()
+
+	if _, err := r.db.ExecContext(ctx, query, tmpl.Name, tmpl.Title, tmpl.Content, tmpl.UpdatedAt, tmpl.ID); err != nil {
+		return logQueryError(ctx, "note_templates", "Update", err, "template_id", tmpl.ID)
+	}
+	return nil
+}
+
+// Delete removes a template
+func (r *noteTemplateRepository) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM note_templates WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_templates", "Delete", query)
+	defer span.End()
+
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return logQueryError(ctx, "note_templates", "Delete", err, "template_id", id)
+	}
+	return nil
+}
+
+// NextCounter bumps the counter of a template. LAST_INSERT_ID(expr) makes
+// MySQL report the new value as the statement's insert ID, so it is read
+// back without a second query racing other callers.
+func (r *noteTemplateRepository) NextCounter(ctx context.Context, id int64) (int64, error) {
+	query := `UPDATE note_templates SET counter = LAST_INSERT_ID(counter + 1) WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_templates", "NextCounter", query)
+	defer span.End()
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return 0, logQueryError(ctx, "note_templates", "NextCounter", err, "template_id", id)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		if err != nil {
+			return 0, logQueryError(ctx, "note_templates", "NextCounter", err, "template_id", id)
+		}
+		return 0, nil
+	}
+	counter, err := result.LastInsertId()
+	if err != nil {
+		return 0, logQueryError(ctx, "note_templates", "NextCounter", err, "template_id", id)
+	}
+	return counter, nil
+}
+
+// scanTemplate reads the templateColumns of a row
+func scanTemplate(row interface{ Scan(...any) error }) (*domain.NoteTemplate, error) {
+	tmpl := &domain.NoteTemplate{}
+	var createdBy sql.NullInt64
+	if err := row.Scan(&tmpl.ID, &tmpl.Name, &tmpl.Title, &tmpl.Content, &tmpl.Counter, &createdBy,
+		&tmpl.CreatedAt, &tmpl.UpdatedAt); err != nil {
+		return nil, err
+	}
+	tmpl.CreatedBy = createdBy.Int64
+	return tmpl, nil
+}
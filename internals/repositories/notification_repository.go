@@ -0,0 +1,151 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+)
+
+// NotificationRepository defines the interface for notification database operations
+type NotificationRepository interface {
+	Create(ctx context.Context, notification *domain.Notification) (int64, error)
+	// FindByUser returns up to limit notifications of a user, newest first
+	FindByUser(ctx context.Context, userID int64, limit int) ([]*domain.Notification, error)
+	// CountUnread returns the number of notifications a user has not read
+	CountUnread(ctx context.Context, userID int64) (int, error)
+	// MarkRead marks a notification of a user read at now and returns it,
+	// or nil if the user has no such notification
+	MarkRead(ctx context.Context, userID, id int64, now time.Time) (*domain.Notification, error)
+	// MarkAllRead marks every notification of a user read at now
+	MarkAllRead(ctx context.Context, userID int64, now time.Time) error
+}
+
+type notificationRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewNotificationRepository creates a new notification repository.
+// Every statement is bounded by queryTimeout; zero disables the timeout.
+func NewNotificationRepository(db *sql.DB, queryTimeout time.Duration) NotificationRepository {
+	return &notificationRepository{db, queryTimeout}
+}
+
+// notificationColumns are the columns scanned by scanNotification
+const notificationColumns = `id, user_id, note_id, message, created_at, read_at`
+
+// Create stores a notification
+func (r *notificationRepository) Create(ctx context.Context, notification *domain.Notification) (int64, error) {
+	query := `INSERT INTO notifications (user_id, note_id, message, created_at) VALUES (?, ?, ?, ?)`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notifications", "Create", query)
+	defer span.End()
+
+	result, err := r.db.ExecContext(ctx, query, notification.UserID, nullID(notification.NoteID),
+		notification.Message, notification.CreatedAt)
+	if err != nil {
+		return 0, logQueryError(ctx, "notifications", "Create", err, "user_id", notification.UserID)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, logQueryError(ctx, "notifications", "Create", err, "user_id", notification.UserID)
+	}
+	return id, nil
+}
+
+// FindByUser returns the newest notifications of a user
+func (r *notificationRepository) FindByUser(ctx context.Context, userID int64, limit int) ([]*domain.Notification, error) {
+	query := `SELECT ` + notificationColumns + ` FROM notifications WHERE user_id = ? ORDER BY id DESC LIMIT ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notifications", "FindByUser", query)
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, logQueryError(ctx, "notifications", "FindByUser", err, "user_id", userID)
+	}
+	defer rows.Close()
+
+	var notifications []*domain.Notification
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "notifications", "FindByUser", err, "user_id", userID)
+		}
+		notifications = append(notifications, notification)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "notifications", "FindByUser", err, "user_id", userID)
+	}
+	return notifications, nil
+}
+
+// CountUnread returns the number of unread notifications of a user
+func (r *notificationRepository) CountUnread(ctx context.Context, userID int64) (int, error) {
+	query := `SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notifications", "CountUnread", query)
+	defer span.End()
+
+	var n int
+	if err := r.db.QueryRowContext(ctx, query, userID).Scan(&n); err != nil {
+		return 0, logQueryError(ctx, "notifications", "CountUnread", err, "user_id", userID)
+	}
+	return n, nil
+}
+
+// MarkRead marks a notification read, keeping the time it was first read
+func (r *notificationRepository) MarkRead(ctx context.Context, userID, id int64, now time.Time) (*domain.Notification, error) {
+	query := `UPDATE notifications SET read_at = COALESCE(read_at, ?) WHERE id = ? AND user_id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notifications", "MarkRead", query)
+	defer span.End()
+
+	if _, err := r.db.ExecContext(ctx, query, now, id, userID); err != nil {
+		return nil, logQueryError(ctx, "notifications", "MarkRead", err, "notification_id", id)
+	}
+
+	query = `SELECT ` + notificationColumns + ` FROM notifications WHERE id = ? AND user_id = ?`
+	notification, err := scanNotification(r.db.QueryRowContext(ctx, query, id, userID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, logQueryError(ctx, "notifications", "MarkRead", err, "notification_id", id)
+	}
+	return notification, nil
+}
+
+// MarkAllRead marks every unread notification of a user read
+func (r *notificationRepository) MarkAllRead(ctx context.Context, userID int64, now time.Time) error {
+	query := `UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "notifications", "MarkAllRead", query)
+	defer span.End()
+
+	if _, err := r.db.ExecContext(ctx, query, now, userID); err != nil {
+		return logQueryError(ctx, "notifications", "MarkAllRead", err, "user_id", userID)
+	}
+	return nil
+}
+
+// scanNotification reads the notificationColumns of a row
+func scanNotification(row interface{ Scan(...any) error }) (*domain.Notification, error) {
+	notification := &domain.Notification{}
+	var noteID sql.NullInt64
+	var readAt sql.NullTime
+	if err := row.Scan(&notification.ID, &notification.UserID, &noteID, &notification.Message,
+		&notification.CreatedAt, &readAt); err != nil {
+		return nil, err
+	}
+	notification.NoteID = noteID.Int64
+	notification.ReadAt = readAt.Time
+	return notification, nil
+}
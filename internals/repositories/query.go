@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrDuplicate is returned when a row would repeat a unique key
+var ErrDuplicate = errors.New("duplicate key")
+
+// mysqlDuplicateEntry is the MySQL error number of a unique key violation
+const mysqlDuplicateEntry = 1062
+
+// isDuplicate reports whether err is a unique key violation
+func isDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry
+}
+
+// withTimeout bounds ctx by the configured query timeout; zero disables it
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// startQuery starts a client span describing a SQL statement on table
+func startQuery(ctx context.Context, table, op, query string) (context.Context, trace.Span) {
+	return otel.Tracer(tracing.Name).Start(ctx, table+"."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemMySQL,
+			semconv.DBOperationName(op),
+			semconv.DBQueryText(query),
+		),
+	)
+}
+
+// logQueryError logs a failed query with the request scoped logger, marks the
+// current span as failed and returns err
+func logQueryError(ctx context.Context, table, op string, err error, args ...any) error {
+	args = append([]any{"table", table, "op", op, "error", err}, args...)
+	level := slog.LevelError
+	if ctx.Err() != nil {
+		// Cancelled or timed out statements are expected under load
+		level = slog.LevelWarn
+	}
+	utils.LoggerFromContext(ctx).Log(ctx, level, "query failed", args...)
+
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+)
+
+// SavedSearchRepository defines the interface for saved search database operations
+type SavedSearchRepository interface {
+	// FindByUser returns the saved searches of a user ordered by name
+	FindByUser(ctx context.Context, userID int64) ([]*domain.SavedSearch, error)
+	// FindByID returns a saved search by ID, or nil if there is none
+	FindByID(ctx context.Context, id int64) (*domain.SavedSearch, error)
+	Create(ctx context.Context, search *domain.SavedSearch) (int64, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+type savedSearchRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewSavedSearchRepository creates a new saved search repository.
+// Every statement is bounded by queryTimeout; zero disables the timeout.
+func NewSavedSearchRepository(db *sql.DB, queryTimeout time.Duration) SavedSearchRepository {
+	return &savedSearchRepository{db, queryTimeout}
+}
+
+// savedSearchColumns are the columns scanned by scanSavedSearch
+const savedSearchColumns = `id, user_id, name, query, created_at`
+
+// FindByUser returns the saved searches of a user
+func (r *savedSearchRepository) FindByUser(ctx context.Context, userID int64) ([]*domain.SavedSearch, error) {
+	query := `SELECT ` + savedSearchColumns + ` FROM saved_searches WHERE user_id = ? ORDER BY name, id`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "saved_searches", "FindByUser", query)
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, logQueryError(ctx, "saved_searches", "FindByUser", err, "user_id", userID)
+	}
+	defer rows.Close()
+
+	var searches []*domain.SavedSearch
+	for rows.Next() {
+		search, err := scanSavedSearch(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "saved_searches", "FindByUser", err, "user_id", userID)
+		}
+		searches = append(searches, search)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "saved_searches", "FindByUser", err, "user_id", userID)
+	}
+	return searches, nil
+}
+
+// FindByID returns a saved search by ID
+func (r *savedSearchRepository) FindByID(ctx context.Context, id int64) (*domain.SavedSearch, error) {
+	query := `SELECT ` + savedSearchColumns + ` FROM saved_searches WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "saved_searches", "FindByID", query)
+	defer span.End()
+
+	search, err := scanSavedSearch(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, logQueryError(ctx, "saved_searches", "FindByID", err, "search_id", id)
+	}
+	return search, nil
+}
+
+// Create stores a saved search
+func (r *savedSearchRepository) Create(ctx context.Context, search *domain.SavedSearch) (int64, error) {
+	query := `INSERT INTO saved_searches (user_id, name, query, created_at) VALUES (?, ?, ?, ?)`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "saved_searches", "Create", query)
+	defer span.End()
+
+	result, err := r.db.ExecContext(ctx, query, search.UserID, search.Name, search.Query, search.CreatedAt)
+	if err != nil {
+		return 0, logQueryError(ctx, "saved_searches", "Create", err, "user_id", search.UserID)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, logQueryError(ctx, "saved_searches", "Create", err, "user_id", search.UserID)
+	}
+	return id, nil
+}
+
+// Delete removes a saved search
+func (r *savedSearchRepository) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM saved_searches WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "saved_searches", "Delete", query)
+	defer span.End()
+
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return logQueryError(ctx, "saved_searches", "Delete", err, "search_id", id)
+	}
+	return nil
+}
+
+// scanSavedSearch reads the savedSearchColumns of a row
+func scanSavedSearch(row interface{ Scan(...any) error }) (*domain.SavedSearch, error) {
+	search := &domain.SavedSearch{}
+	if err := row.Scan(&search.ID, &search.UserID, &search.Name, &search.Query, &search.CreatedAt); err != nil {
+		return nil, err
+	}
+	return search, nil
+}
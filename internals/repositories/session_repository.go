@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+)
+
+// SessionRepository defines the interface for login session database
+// operations. Sessions are identified by the hash of their token.
+type SessionRepository interface {
+	Create(ctx context.Context, tokenHash string, userID int64, expiresAt time.Time) error
+	FindUser(ctx context.Context, tokenHash string, now time.Time) (*domain.User, error)
+	Delete(ctx context.Context, tokenHash string) error
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
+
+type sessionRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewSessionRepository creates a new session repository.
+// Every statement is bounded by queryTimeout; zero disables the timeout.
+func NewSessionRepository(db *sql.DB, queryTimeout time.Duration) SessionRepository {
+	return &sessionRepository{db, queryTimeout}
+}
+
+// Create stores a session for a user
+func (r *sessionRepository) Create(ctx context.Context, tokenHash string, userID int64, expiresAt time.Time) error {
+	return r.exec(ctx, "Create",
+		`INSERT INTO sessions (token_hash, user_id, expires_at) VALUES (?, ?, ?)`, tokenHash, userID, expiresAt)
+}
+
+// FindUser returns the user of a session that has not expired at now, or nil
+func (r *sessionRepository) FindUser(ctx context.Context, tokenHash string, now time.Time) (*domain.User, error) {
+	query := `SELECT u.id, u.username, u.email, u.timezone, u.password_hash, u.role, u.created_at
+FROM sessions s JOIN users u ON u.id = s.user_id
+WHERE s.token_hash = ? AND s.expires_at > ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "sessions", "FindUser", query)
+	defer span.End()
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, tokenHash, now))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, logQueryError(ctx, "sessions", "FindUser", err)
+	}
+	return user, nil
+}
+
+// Delete removes a session
+func (r *sessionRepository) Delete(ctx context.Context, tokenHash string) error {
+	return r.exec(ctx, "Delete", `DELETE FROM sessions WHERE token_hash = ?`, tokenHash)
+}
+
+// DeleteExpired removes every session that expired before now
+func (r *sessionRepository) DeleteExpired(ctx context.Context, now time.Time) error {
+	return r.exec(ctx, "DeleteExpired", `DELETE FROM sessions WHERE expires_at <= ?`, now)
+}
+
+// exec runs a statement that returns no rows
+func (r *sessionRepository) exec(ctx context.Context, op, query string, args ...any) error {
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "sessions", op, query)
+	defer span.End()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return logQueryError(ctx, "sessions", op, err)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+)
+
+// ShareRepository defines the interface for note share and public link
+// database operations
+type ShareRepository interface {
+	// Grant shares a note with a user, replacing any earlier permission
+	Grant(ctx context.Context, noteID, userID int64, permission domain.SharePermission) error
+	Revoke(ctx context.Context, noteID, userID int64) error
+	// FindGrant returns the permission a note is shared with to a user, or "" if it is not
+	FindGrant(ctx context.Context, noteID, userID int64) (domain.SharePermission, error)
+	FindByNote(ctx context.Context, noteID int64) ([]*domain.Share, error)
+	// FindSharedWith returns the notes shared with a user, with Grant set
+	FindSharedWith(ctx context.Context, userID int64) ([]*domain.Note, error)
+
+	CreateLink(ctx context.Context, link *domain.ShareLink) (int64, error)
+	FindLinksByNote(ctx context.Context, noteID int64) ([]*domain.ShareLink, error)
+	// FindLinkByToken returns the link with a token hash, or nil if there is none
+	FindLinkByToken(ctx context.Context, tokenHash string) (*domain.ShareLink, error)
+	DeleteLink(ctx context.Context, noteID, linkID int64) error
+}
+
+type shareRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewShareRepository creates a new share repository.
+// Every statement is bounded by queryTimeout; zero disables the timeout.
+func NewShareRepository(db *sql.DB, queryTimeout time.Duration) ShareRepository {
+	return &shareRepository{db, queryTimeout}
+}
+
+// Grant shares a note with a user
+func (r *shareRepository) Grant(ctx context.Context, noteID, userID int64, permission domain.SharePermission) error {
+	return r.exec(ctx, "note_shares", "Grant",
+		`INSERT INTO note_shares (note_id, user_id, permission) VALUES (?, ?, ?)
+ON DUPLICATE KEY UPDATE permission = VALUES(permission)`, noteID, userID, permission)
+}
+
+// Revoke stops sharing a note with a user
+func (r *shareRepository) Revoke(ctx context.Context, noteID, userID int64) error {
+	return r.exec(ctx, "note_shares", "Revoke",
+		`DELETE FROM note_shares WHERE note_id = ? AND user_id = ?`, noteID, userID)
+}
+
+// FindGrant returns the permission a note is shared with to a user
+func (r *shareRepository) FindGrant(ctx context.Context, noteID, userID int64) (domain.SharePermission, error) {
+	query := `SELECT permission FROM note_shares WHERE note_id = ? AND user_id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_shares", "FindGrant", query)
+	defer span.End()
+
+	var permission domain.SharePermission
+	if err := r.db.QueryRowContext(ctx, query, noteID, userID).Scan(&permission); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", logQueryError(ctx, "note_shares", "FindGrant", err, "note_id", noteID)
+	}
+	return permission, nil
+}
+
+// FindByNote returns the grants of a note ordered by username
+func (r *shareRepository) FindByNote(ctx context.Context, noteID int64) ([]*domain.Share, error) {
+	query := `SELECT s.note_id, s.user_id, u.username, s.permission, s.created_at
+FROM note_shares s JOIN users u ON u.id = s.user_id
+WHERE s.note_id = ? ORDER BY u.username`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_shares", "FindByNote", query)
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, query, noteID)
+	if err != nil {
+		return nil, logQueryError(ctx, "note_shares", "FindByNote", err, "note_id", noteID)
+	}
+	defer rows.Close()
+
+	var shares []*domain.Share
+	for rows.Next() {
+		share := &domain.Share{}
+		if err := rows.Scan(&share.NoteID, &share.UserID, &share.Username, &share.Permission, &share.CreatedAt); err != nil {
+			return nil, logQueryError(ctx, "note_shares", "FindByNote", err, "note_id", noteID)
+		}
+		shares = append(shares, share)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "note_shares", "FindByNote", err, "note_id", noteID)
+	}
+	return shares, nil
+}
+
+// FindSharedWith returns the notes shared with a user, newest first
+func (r *shareRepository) FindSharedWith(ctx context.Context, userID int64) ([]*domain.Note, error) {
+	query := `SELECT n.id, n.user_id, n.title, n.content, n.created_at, n.updated_at, s.permission
+FROM note_shares s JOIN notes n ON n.id = s.note_id
+WHERE s.user_id = ? ORDER BY n.created_at DESC`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_shares", "FindSharedWith", query)
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, logQueryError(ctx, "note_shares", "FindSharedWith", err)
+	}
+	defer rows.Close()
+
+	var notes []*domain.Note
+	for rows.Next() {
+		note := &domain.Note{}
+		var ownerID sql.NullInt64
+		if err := rows.Scan(&note.ID, &ownerID, &note.Title, &note.Content, &note.CreatedAt, &note.UpdatedAt, &note.Grant); err != nil {
+			return nil, logQueryError(ctx, "note_shares", "FindSharedWith", err)
+		}
+		note.UserID = ownerID.Int64
+		notes = append(notes, note)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "note_shares", "FindSharedWith", err)
+	}
+	return notes, nil
+}
+
+// linkColumns are the columns scanned by scanLink
+const linkColumns = `id, note_id, token_hash, password_hash, expires_at, created_at`
+
+// CreateLink stores a public link
+func (r *shareRepository) CreateLink(ctx context.Context, link *domain.ShareLink) (int64, error) {
+	query := `INSERT INTO share_links (note_id, token_hash, password_hash, expires_at) VALUES (?, ?, ?, ?)`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "share_links", "CreateLink", query)
+	defer span.End()
+
+	result, err := r.db.ExecContext(ctx, query, link.NoteID, link.TokenHash,
+		sql.NullString{String: link.PasswordHash, Valid: link.PasswordHash != ""},
+		sql.NullTime{Time: link.ExpiresAt, Valid: !link.ExpiresAt.IsZero()})
+	if err != nil {
+		return 0, logQueryError(ctx, "share_links", "CreateLink", err, "note_id", link.NoteID)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, logQueryError(ctx, "share_links", "CreateLink", err, "note_id", link.NoteID)
+	}
+	return id, nil
+}
+
+// FindLinksByNote returns the links of a note, newest first
+func (r *shareRepository) FindLinksByNote(ctx context.Context, noteID int64) ([]*domain.ShareLink, error) {
+	query := `SELECT ` + linkColumns + ` FROM share_links WHERE note_id = ? ORDER BY created_at DESC, id DESC`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "share_links", "FindLinksByNote", query)
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, query, noteID)
+	if err != nil {
+		return nil, logQueryError(ctx, "share_links", "FindLinksByNote", err, "note_id", noteID)
+	}
+	defer rows.Close()
+
+	var links []*domain.ShareLink
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "share_links", "FindLinksByNote", err, "note_id", noteID)
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "share_links", "FindLinksByNote", err, "note_id", noteID)
+	}
+	return links, nil
+}
+
+// FindLinkByToken returns a link by the hash of its token
+func (r *shareRepository) FindLinkByToken(ctx context.Context, tokenHash string) (*domain.ShareLink, error) {
+	query := `SELECT ` + linkColumns + ` FROM share_links WHERE token_hash = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "share_links", "FindLinkByToken", query)
+	defer span.End()
+
+	link, err := scanLink(r.db.QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, logQueryError(ctx, "share_links", "FindLinkByToken", err)
+	}
+	return link, nil
+}
+
+// DeleteLink revokes a link of a note
+func (r *shareRepository) DeleteLink(ctx context.Context, noteID, linkID int64) error {
+	return r.exec(ctx, "share_links", "DeleteLink",
+		`DELETE FROM share_links WHERE id = ? AND note_id = ?`, linkID, noteID)
+}
+
+// exec runs a statement on table that returns no rows
+func (r *shareRepository) exec(ctx context.Context, table, op, query string, args ...any) error {
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, table, op, query)
+	defer span.End()
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return logQueryError(ctx, table, op, err)
+	}
+	return nil
+}
+
+// scanLink reads the linkColumns of a row
+func scanLink(row interface{ Scan(...any) error }) (*domain.ShareLink, error) {
+	link := &domain.ShareLink{}
+	var password sql.NullString
+	var expiresAt sql.NullTime
+	if err := row.Scan(&link.ID, &link.NoteID, &link.TokenHash, &password, &expiresAt, &link.CreatedAt); err != nil {
+		return nil, err
+	}
+	link.PasswordHash = password.String
+	link.ExpiresAt = expiresAt.Time
+	return link, nil
+}
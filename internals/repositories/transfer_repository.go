@@ -0,0 +1,170 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+)
+
+// TransferRepository defines the interface for the uploaded imports and the
+// written exports of notes
+type TransferRepository interface {
+	CreateImport(ctx context.Context, upload *domain.NoteImport) (int64, error)
+	// FindImport returns an import by ID, or nil once it was deleted
+	FindImport(ctx context.Context, id int64) (*domain.NoteImport, error)
+	// SetImported records that the first imported notes of an import exist
+	SetImported(ctx context.Context, id int64, imported int) error
+	DeleteImport(ctx context.Context, id int64) error
+	CreateExport(ctx context.Context, export *domain.NoteExport) (int64, error)
+	// FindExports returns up to limit exports of a user, newest first,
+	// without their bodies
+	FindExports(ctx context.Context, userID int64, limit int) ([]*domain.NoteExport, error)
+	// FindExport returns an export of a user with its body, or nil if the
+	// user has no such export
+	FindExport(ctx context.Context, userID, id int64) (*domain.NoteExport, error)
+}
+
+type transferRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewTransferRepository creates a new transfer repository.
+// Every statement is bounded by queryTimeout; zero disables the timeout.
+func NewTransferRepository(db *sql.DB, queryTimeout time.Duration) TransferRepository {
+	return &transferRepository{db, queryTimeout}
+}
+
+// CreateImport stores an uploaded import
+func (r *transferRepository) CreateImport(ctx context.Context, upload *domain.NoteImport) (int64, error) {
+	query := `INSERT INTO note_imports (user_id, body, created_at) VALUES (?, ?, ?)`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_imports", "CreateImport", query)
+	defer span.End()
+
+	result, err := r.db.ExecContext(ctx, query, upload.UserID, upload.Body, upload.CreatedAt)
+	if err != nil {
+		return 0, logQueryError(ctx, "note_imports", "CreateImport", err, "user_id", upload.UserID)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, logQueryError(ctx, "note_imports", "CreateImport", err, "user_id", upload.UserID)
+	}
+	return id, nil
+}
+
+// FindImport returns an import by ID
+func (r *transferRepository) FindImport(ctx context.Context, id int64) (*domain.NoteImport, error) {
+	query := `SELECT id, user_id, body, imported, created_at FROM note_imports WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_imports", "FindImport", query)
+	defer span.End()
+
+	upload := &domain.NoteImport{}
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, id).Scan(&upload.ID, &upload.UserID, &upload.Body, &upload.Imported, &upload.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, logQueryError(ctx, "note_imports", "FindImport", err, "import_id", id)
+	}
+	return upload, nil
+}
+
+// SetImported updates the progress of an import
+func (r *transferRepository) SetImported(ctx context.Context, id int64, imported int) error {
+	query := `UPDATE note_imports SET imported = ? WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_imports", "SetImported", query)
+	defer span.End()
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, imported, id); err != nil {
+		return logQueryError(ctx, "note_imports", "SetImported", err, "import_id", id)
+	}
+	return nil
+}
+
+// DeleteImport removes an import
+func (r *transferRepository) DeleteImport(ctx context.Context, id int64) error {
+	query := `DELETE FROM note_imports WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_imports", "DeleteImport", query)
+	defer span.End()
+
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, id); err != nil {
+		return logQueryError(ctx, "note_imports", "DeleteImport", err, "import_id", id)
+	}
+	return nil
+}
+
+// CreateExport stores an export
+func (r *transferRepository) CreateExport(ctx context.Context, export *domain.NoteExport) (int64, error) {
+	query := `INSERT INTO note_exports (user_id, notes, body, created_at) VALUES (?, ?, ?, ?)`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_exports", "CreateExport", query)
+	defer span.End()
+
+	result, err := r.db.ExecContext(ctx, query, export.UserID, export.Notes, export.Body, export.CreatedAt)
+	if err != nil {
+		return 0, logQueryError(ctx, "note_exports", "CreateExport", err, "user_id", export.UserID)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, logQueryError(ctx, "note_exports", "CreateExport", err, "user_id", export.UserID)
+	}
+	return id, nil
+}
+
+// FindExports returns the newest exports of a user
+func (r *transferRepository) FindExports(ctx context.Context, userID int64, limit int) ([]*domain.NoteExport, error) {
+	query := `SELECT id, user_id, notes, created_at FROM note_exports WHERE user_id = ? ORDER BY id DESC LIMIT ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_exports", "FindExports", query)
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, logQueryError(ctx, "note_exports", "FindExports", err, "user_id", userID)
+	}
+	defer rows.Close()
+
+	var exports []*domain.NoteExport
+	for rows.Next() {
+		export := &domain.NoteExport{}
+		if err := rows.Scan(&export.ID, &export.UserID, &export.Notes, &export.CreatedAt); err != nil {
+			return nil, logQueryError(ctx, "note_exports", "FindExports", err, "user_id", userID)
+		}
+		exports = append(exports, export)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "note_exports", "FindExports", err, "user_id", userID)
+	}
+	return exports, nil
+}
+
+// FindExport returns an export of a user
+func (r *transferRepository) FindExport(ctx context.Context, userID, id int64) (*domain.NoteExport, error) {
+	query := `SELECT id, user_id, notes, body, created_at FROM note_exports WHERE id = ? AND user_id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "note_exports", "FindExport", query)
+	defer span.End()
+
+	export := &domain.NoteExport{}
+	err := r.db.QueryRowContext(ctx, query, id, userID).Scan(&export.ID, &export.UserID, &export.Notes, &export.Body, &export.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, logQueryError(ctx, "note_exports", "FindExport", err, "export_id", id)
+	}
+	return export, nil
+}
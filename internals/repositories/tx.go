@@ -0,0 +1,107 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Transactor runs units of work in one database transaction
+type Transactor interface {
+	// InTx calls fn with a context in which the statements of the note, link
+	// and audit repositories, and those reading and updating imports, run in
+	// one transaction, committed when fn returns nil and rolled back
+	// otherwise. InTx inside fn joins the transaction of the outer call.
+	// Functions passed to AfterCommit in fn run once it commits.
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type transactor struct {
+	db *sql.DB
+}
+
+// NewTransactor creates a transactor over db
+func NewTransactor(db *sql.DB) Transactor {
+	return &transactor{db}
+}
+
+// InTx runs fn in a transaction
+func (t *transactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return inTx(ctx, t.db, func(ctx context.Context, _ *sql.Tx) error { return fn(ctx) })
+}
+
+// txKey is the context key of the transaction statements join
+type txKey struct{}
+
+// inTx calls fn with the transaction ctx carries or, when it carries none, a
+// new one on db that is committed when fn returns nil
+func inTx(ctx context.Context, db *sql.DB, fn func(ctx context.Context, tx *sql.Tx) error) error {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx, tx)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	txCtx, committed := WithAfterCommit(ctx)
+	if err := fn(context.WithValue(txCtx, txKey{}, tx), tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	committed()
+	return nil
+}
+
+// afterCommitKey is the context key of the functions AfterCommit defers
+type afterCommitKey struct{}
+
+// afterCommit holds the functions deferred until a transaction commits
+type afterCommit struct {
+	fns []func(ctx context.Context)
+}
+
+// WithAfterCommit returns a context in which AfterCommit defers functions,
+// and the function a Transactor calls to run them once it commits. When ctx
+// already defers them, as inside a joined transaction, it is returned as is
+// and they run when the outermost transaction commits.
+func WithAfterCommit(ctx context.Context) (context.Context, func()) {
+	if _, ok := ctx.Value(afterCommitKey{}).(*afterCommit); ok {
+		return ctx, func() {}
+	}
+	deferred := &afterCommit{}
+	return context.WithValue(ctx, afterCommitKey{}, deferred), func() {
+		for _, fn := range deferred.fns {
+			fn(ctx)
+		}
+	}
+}
+
+// AfterCommit calls fn once the transaction ctx is in commits, with a
+// context outside it, and never if it rolls back. Outside a transaction fn
+// runs at once. Side effects that must not outlive a rolled back change,
+// such as webhook deliveries, are deferred with it.
+func AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	if deferred, ok := ctx.Value(afterCommitKey{}).(*afterCommit); ok {
+		deferred.fns = append(deferred.fns, fn)
+		return
+	}
+	fn(ctx)
+}
+
+// executor runs statements, on the database or in a transaction
+type executor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn returns the transaction ctx carries, so that statements join it, or db
+func conn(ctx context.Context, db *sql.DB) executor {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
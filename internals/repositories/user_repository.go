@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+)
+
+// UserRepository defines the interface for user database operations
+type UserRepository interface {
+	FindAll(ctx context.Context) ([]*domain.User, error)
+	FindByID(ctx context.Context, id int64) (*domain.User, error)
+	FindByUsername(ctx context.Context, username string) (*domain.User, error)
+	Create(ctx context.Context, user *domain.User) (int64, error)
+	UpdateRole(ctx context.Context, id int64, role domain.Role) error
+	UpdateAccount(ctx context.Context, id int64, email, timezone string) error
+}
+
+type userRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewUserRepository creates a new user repository.
+// Every statement is bounded by queryTimeout; zero disables the timeout.
+func NewUserRepository(db *sql.DB, queryTimeout time.Duration) UserRepository {
+	return &userRepository{db, queryTimeout}
+}
+
+// userColumns are the columns scanned by scanUser
+const userColumns = `id, username, email, timezone, password_hash, role, created_at`
+
+// FindAll returns all users ordered by username
+func (r *userRepository) FindAll(ctx context.Context) ([]*domain.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users ORDER BY username`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "users", "FindAll", query)
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, logQueryError(ctx, "users", "FindAll", err)
+	}
+	defer rows.Close()
+
+	var users []*domain.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "users", "FindAll", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "users", "FindAll", err)
+	}
+
+	return users, nil
+}
+
+// FindByID returns a user by ID, or nil if there is none
+func (r *userRepository) FindByID(ctx context.Context, id int64) (*domain.User, error) {
+	return r.findOne(ctx, "FindByID", `SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+}
+
+// FindByUsername returns a user by username, or nil if there is none
+func (r *userRepository) FindByUsername(ctx context.Context, username string) (*domain.User, error) {
+	return r.findOne(ctx, "FindByUsername", `SELECT `+userColumns+` FROM users WHERE username = ?`, username)
+}
+
+// findOne runs a query returning at most one user
+func (r *userRepository) findOne(ctx context.Context, op, query string, args ...any) (*domain.User, error) {
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "users", op, query)
+	defer span.End()
+
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, args...))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, logQueryError(ctx, "users", op, err)
+	}
+	return user, nil
+}
+
+// Create creates a new user
+func (r *userRepository) Create(ctx context.Context, user *domain.User) (int64, error) {
+	query := `INSERT INTO users (username, email, password_hash, role, created_at) VALUES (?, ?, ?, ?, ?)`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "users", "Create", query)
+	defer span.End()
+
+	result, err := r.db.ExecContext(ctx, query, user.Username, user.Email, user.PasswordHash, user.Role, user.CreatedAt)
+	if err != nil {
+		return 0, logQueryError(ctx, "users", "Create", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, logQueryError(ctx, "users", "Create", err)
+	}
+
+	return id, nil
+}
+
+// UpdateRole changes the role of a user
+func (r *userRepository) UpdateRole(ctx context.Context, id int64, role domain.Role) error {
+	query := `UPDATE users SET role = ? WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "users", "UpdateRole", query)
+	defer span.End()
+
+	if _, err := r.db.ExecContext(ctx, query, role, id); err != nil {
+		return logQueryError(ctx, "users", "UpdateRole", err, "user_id", id)
+	}
+	return nil
+}
+
+// UpdateAccount changes the email address and time zone of a user
+func (r *userRepository) UpdateAccount(ctx context.Context, id int64, email, timezone string) error {
+	query := `UPDATE users SET email = ?, timezone = ? WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "users", "UpdateAccount", query)
+	defer span.End()
+
+	if _, err := r.db.ExecContext(ctx, query, email, timezone, id); err != nil {
+		return logQueryError(ctx, "users", "UpdateAccount", err, "user_id", id)
+	}
+	return nil
+}
+
+// scanUser reads the userColumns of a row
+func scanUser(row interface{ Scan(...any) error }) (*domain.User, error) {
+	user := &domain.User{}
+	if err := row.Scan(&user.ID, &user.Username, &user.Email, &user.Timezone, &user.PasswordHash, &user.Role, &user.CreatedAt); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,278 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+)
+
+// WebhookRepository defines the interface for webhook subscription and
+// delivery database operations
+type WebhookRepository interface {
+	FindAll(ctx context.Context) ([]*domain.Webhook, error)
+	// FindByID returns a webhook by ID, or nil if there is none
+	FindByID(ctx context.Context, id int64) (*domain.Webhook, error)
+	Create(ctx context.Context, webhook *domain.Webhook) (int64, error)
+	Delete(ctx context.Context, id int64) error
+
+	CreateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (int64, error)
+	// FindDelivery returns a delivery by ID, or nil if there is none
+	FindDelivery(ctx context.Context, id int64) (*domain.WebhookDelivery, error)
+	// FindDeliveries returns the newest deliveries of a webhook
+	FindDeliveries(ctx context.Context, webhookID int64, limit int) ([]*domain.WebhookDelivery, error)
+	// ClaimDeliveries returns up to limit pending deliveries due at now and
+	// postpones them by lease, so other workers skip them while they are sent
+	ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*domain.WebhookDelivery, error)
+	// UpdateDelivery saves the outcome of an attempt
+	UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error
+}
+
+type webhookRepository struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+// NewWebhookRepository creates a new webhook repository.
+// Every statement is bounded by queryTimeout; zero disables the timeout.
+func NewWebhookRepository(db *sql.DB, queryTimeout time.Duration) WebhookRepository {
+	return &webhookRepository{db, queryTimeout}
+}
+
+// webhookColumns are the columns scanned by scanWebhook
+const webhookColumns = `id, url, secret, events, created_at`
+
+// FindAll returns every webhook, oldest first
+func (r *webhookRepository) FindAll(ctx context.Context) ([]*domain.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks ORDER BY id`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "webhooks", "FindAll", query)
+	defer span.End()
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, logQueryError(ctx, "webhooks", "FindAll", err)
+	}
+	defer rows.Close()
+
+	var webhooks []*domain.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "webhooks", "FindAll", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "webhooks", "FindAll", err)
+	}
+	return webhooks, nil
+}
+
+// FindByID returns a webhook by ID
+func (r *webhookRepository) FindByID(ctx context.Context, id int64) (*domain.Webhook, error) {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "webhooks", "FindByID", query)
+	defer span.End()
+
+	webhook, err := scanWebhook(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, logQueryError(ctx, "webhooks", "FindByID", err, "webhook_id", id)
+	}
+	return webhook, nil
+}
+
+// Create stores a webhook
+func (r *webhookRepository) Create(ctx context.Context, webhook *domain.Webhook) (int64, error) {
+	events := make([]string, len(webhook.Events))
+	for i, event := range webhook.Events {
+		events[i] = string(event)
+	}
+	return r.insert(ctx, "webhooks", "Create", `INSERT INTO webhooks (url, secret, events, created_at) VALUES (?, ?, ?, ?)`,
+		webhook.URL, webhook.Secret, strings.Join(events, ","), webhook.CreatedAt)
+}
+
+// Delete removes a webhook and its deliveries
+func (r *webhookRepository) Delete(ctx context.Context, id int64) error {
+	query := `DELETE FROM webhooks WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "webhooks", "Delete", query)
+	defer span.End()
+
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return logQueryError(ctx, "webhooks", "Delete", err, "webhook_id", id)
+	}
+	return nil
+}
+
+// deliveryColumns are the columns scanned by scanDelivery
+const deliveryColumns = `id, webhook_id, event, payload, status, attempts, next_attempt_at, response_code, error, created_at, updated_at`
+
+// CreateDelivery queues a delivery
+func (r *webhookRepository) CreateDelivery(ctx context.Context, d *domain.WebhookDelivery) (int64, error) {
+	return r.insert(ctx, "webhook_deliveries", "CreateDelivery",
+		`INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		d.WebhookID, d.Event, d.Payload, d.Status, d.NextAttemptAt, d.CreatedAt, d.UpdatedAt)
+}
+
+// FindDelivery returns a delivery by ID
+func (r *webhookRepository) FindDelivery(ctx context.Context, id int64) (*domain.WebhookDelivery, error) {
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "webhook_deliveries", "FindDelivery", query)
+	defer span.End()
+
+	delivery, err := scanDelivery(r.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, logQueryError(ctx, "webhook_deliveries", "FindDelivery", err, "delivery_id", id)
+	}
+	return delivery, nil
+}
+
+// FindDeliveries returns the newest deliveries of a webhook
+func (r *webhookRepository) FindDeliveries(ctx context.Context, webhookID int64, limit int) ([]*domain.WebhookDelivery, error) {
+	return r.findDeliveries(ctx, r.db, "FindDeliveries",
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`, webhookID, limit)
+}
+
+// ClaimDeliveries locks the due deliveries, skipping those another worker
+// holds, and moves their next attempt past the lease
+func (r *webhookRepository) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) (deliveries []*domain.WebhookDelivery, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, logQueryError(ctx, "webhook_deliveries", "ClaimDeliveries", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	deliveries, err = r.findDeliveries(ctx, tx, "ClaimDeliveries",
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries
+WHERE status = ? AND next_attempt_at <= ? ORDER BY next_attempt_at LIMIT ? FOR UPDATE SKIP LOCKED`,
+		domain.DeliveryPending, now, limit)
+	if err != nil || len(deliveries) == 0 {
+		return nil, err
+	}
+
+	ids := make([]any, 0, len(deliveries)+1)
+	ids = append(ids, now.Add(lease))
+	for _, d := range deliveries {
+		ids = append(ids, d.ID)
+	}
+	query := `UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id IN (?` + strings.Repeat(", ?", len(deliveries)-1) + `)`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "webhook_deliveries", "ClaimDeliveries", query)
+	defer span.End()
+
+	if _, err := tx.ExecContext(ctx, query, ids...); err != nil {
+		return nil, logQueryError(ctx, "webhook_deliveries", "ClaimDeliveries", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, logQueryError(ctx, "webhook_deliveries", "ClaimDeliveries", err)
+	}
+	return deliveries, nil
+}
+
+// UpdateDelivery saves the outcome of an attempt
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, d *domain.WebhookDelivery) error {
+	query := `UPDATE webhook_deliveries
+SET status = ?, attempts = ?, next_attempt_at = ?, response_code = ?, error = ?, updated_at = ? WHERE id = ?`
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "webhook_deliveries", "UpdateDelivery", query)
+	defer span.End()
+
+	_, err := r.db.ExecContext(ctx, query, d.Status, d.Attempts, d.NextAttemptAt, d.ResponseCode, d.Error, d.UpdatedAt, d.ID)
+	if err != nil {
+		return logQueryError(ctx, "webhook_deliveries", "UpdateDelivery", err, "delivery_id", d.ID)
+	}
+	return nil
+}
+
+// querier is implemented by *sql.DB and *sql.Tx
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// findDeliveries runs a query returning deliveries
+func (r *webhookRepository) findDeliveries(ctx context.Context, q querier, op, query string, args ...any) ([]*domain.WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, "webhook_deliveries", op, query)
+	defer span.End()
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, logQueryError(ctx, "webhook_deliveries", op, err)
+	}
+	defer rows.Close()
+
+	var deliveries []*domain.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanDelivery(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "webhook_deliveries", op, err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "webhook_deliveries", op, err)
+	}
+	return deliveries, nil
+}
+
+// insert runs an INSERT on table and returns the new ID
+func (r *webhookRepository) insert(ctx context.Context, table, op, query string, args ...any) (int64, error) {
+	ctx, cancel := withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+	ctx, span := startQuery(ctx, table, op, query)
+	defer span.End()
+
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, logQueryError(ctx, table, op, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, logQueryError(ctx, table, op, err)
+	}
+	return id, nil
+}
+
+// scanWebhook reads the webhookColumns of a row
+func scanWebhook(row interface{ Scan(...any) error }) (*domain.Webhook, error) {
+	webhook := &domain.Webhook{}
+	var events string
+	if err := row.Scan(&webhook.ID, &webhook.URL, &webhook.Secret, &events, &webhook.CreatedAt); err != nil {
+		return nil, err
+	}
+	for _, event := range strings.Split(events, ",") {
+		if event != "" {
+			webhook.Events = append(webhook.Events, domain.WebhookEvent(event))
+		}
+	}
+	return webhook, nil
+}
+
+// scanDelivery reads the deliveryColumns of a row
+func scanDelivery(row interface{ Scan(...any) error }) (*domain.WebhookDelivery, error) {
+	d := &domain.WebhookDelivery{}
+	if err := row.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.ResponseCode, &d.Error, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+)
+
+// ErrUnauthenticated is returned when a request carries no signed in user
+var ErrUnauthenticated = errors.New("authentication required")
+
+// ErrForbidden is returned when the user's role does not allow an action
+var ErrForbidden = errors.New("permission denied")
+
+// authorize returns the user in ctx if their role grants p
+func authorize(ctx context.Context, p domain.Permission) (*domain.User, error) {
+	user := auth.UserFromContext(ctx)
+	if user == nil {
+		return nil, ErrUnauthenticated
+	}
+	if !user.Can(p) {
+		return nil, ErrForbidden
+	}
+	return user, nil
+}
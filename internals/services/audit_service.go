@@ -0,0 +1,116 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// AuditReport is the outcome of verifying the audit log
+type AuditReport struct {
+	// Events is the number of events checked
+	Events int
+	// BrokenAt is the ID of the first event failing verification, 0 when the
+	// chain is intact or only its newest events are missing
+	BrokenAt int64
+	// Problem describes why verification failed, empty when it passed
+	Problem string
+}
+
+// OK reports whether the chain is intact
+func (r *AuditReport) OK() bool {
+	return r.Problem == ""
+}
+
+// AuditService defines the interface for reading and verifying the audit log
+// that NoteService writes. Both need the audit:read permission.
+type AuditService interface {
+	GetEvents(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEvent, error)
+	Verify(ctx context.Context) (*AuditReport, error)
+}
+
+type auditService struct {
+	repo repositories.AuditRepository
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(repo repositories.AuditRepository) AuditService {
+	return &auditService{repo}
+}
+
+// GetEvents returns the events matching filter, newest first
+func (s *auditService) GetEvents(ctx context.Context, filter domain.AuditFilter) (events []*domain.AuditEvent, err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.GetEvents")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := authorize(ctx, domain.PermAuditRead); err != nil {
+		return nil, err
+	}
+	return s.repo.Find(ctx, filter)
+}
+
+// errChainBroken stops walking the log at the first broken event
+var errChainBroken = errors.New("audit chain broken")
+
+// Verify recomputes the hash chain from the oldest event and compares its end
+// with the chain head, detecting edited, removed and reordered events
+func (s *auditService) Verify(ctx context.Context) (report *AuditReport, err error) {
+	ctx, span := tracing.Start(ctx, "AuditService.Verify")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := authorize(ctx, domain.PermAuditRead); err != nil {
+		return nil, err
+	}
+
+	report = &AuditReport{}
+	prevHash := ""
+	head, err := s.repo.Walk(ctx, func(event *domain.AuditEvent) error {
+		switch {
+		case event.PrevHash != prevHash:
+			report.Problem = "the previous event is missing or was changed"
+		case event.ChainHash(prevHash) != event.Hash:
+			report.Problem = "the event was changed"
+		default:
+			report.Events++
+			prevHash = event.Hash
+			return nil
+		}
+		report.BrokenAt = event.ID
+		return errChainBroken
+	})
+	if err != nil && !errors.Is(err, errChainBroken) {
+		return nil, err
+	}
+	if report.OK() && head != prevHash {
+		report.Problem = "the newest events are missing"
+	}
+	return report, nil
+}
+
+// audit records that user changed the note with ID id from before to after.
+// It runs in the transaction of the change, which a failure rolls back.
+func (s *noteService) audit(ctx context.Context, user *domain.User, action domain.AuditAction, id int64, before, after *domain.Note) error {
+	info := utils.RequestInfoFromContext(ctx)
+	event := &domain.AuditEvent{
+		ActorID:    user.ID,
+		Actor:      user.Username,
+		Action:     action,
+		NoteID:     id,
+		BeforeHash: domain.NoteHash(before),
+		AfterHash:  domain.NoteHash(after),
+		IP:         info.ClientIP,
+		RequestID:  info.ID,
+		CreatedAt:  time.Now(),
+	}
+	if err := s.audits.Append(ctx, event); err != nil {
+		utils.LoggerFromContext(ctx).ErrorContext(ctx, "audit event not recorded, change rolled back",
+			"action", action, "note_id", id, "user_id", user.ID, "error", err)
+		return err
+	}
+	return nil
+}
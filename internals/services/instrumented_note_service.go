@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/metrics"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type instrumentedNoteService struct {
+	NoteService
+	metrics *metrics.Metrics
+}
+
+// NewInstrumentedNoteService wraps svc so that successful mutations are
+// counted, once the transaction they are part of commits
+func NewInstrumentedNoteService(svc NoteService, m *metrics.Metrics) NoteService {
+	return wrap(svc, &instrumentedNoteService{svc, m})
+}
+
+func (s *instrumentedNoteService) wrappedBy(outer NoteService) {
+	wrap(s.NoteService, outer)
+}
+
+// CreateNote creates a new note
+func (s *instrumentedNoteService) CreateNote(ctx context.Context, title, content string, dueAt, remindAt time.Time) (*domain.Note, error) {
+	note, err := s.NoteService.CreateNote(ctx, title, content, dueAt, remindAt)
+	if err == nil {
+		count(ctx, s.metrics.NotesCreated)
+	}
+	return note, err
+}
+
+// CreateNoteFromTemplate creates a note from a template
+func (s *instrumentedNoteService) CreateNoteFromTemplate(ctx context.Context, templateID int64, title, content string, dueAt, remindAt time.Time) (*domain.Note, error) {
+	note, err := s.NoteService.CreateNoteFromTemplate(ctx, templateID, title, content, dueAt, remindAt)
+	if err == nil {
+		count(ctx, s.metrics.NotesCreated)
+	}
+	return note, err
+}
+
+// OpenJournal returns a journal entry, creating it if needed
+func (s *instrumentedNoteService) OpenJournal(ctx context.Context, date time.Time) (*domain.Note, bool, error) {
+	note, created, err := s.NoteService.OpenJournal(ctx, date)
+	if created {
+		count(ctx, s.metrics.NotesCreated)
+	}
+	return note, created, err
+}
+
+// UpdateNote updates an existing note
+func (s *instrumentedNoteService) UpdateNote(ctx context.Context, id int64, title, content string) (*domain.Note, error) {
+	note, err := s.NoteService.UpdateNote(ctx, id, title, content)
+	if err == nil {
+		count(ctx, s.metrics.NotesUpdated)
+	}
+	return note, err
+}
+
+// ScheduleNote sets the due date and reminder time of a note
+func (s *instrumentedNoteService) ScheduleNote(ctx context.Context, id int64, dueAt, remindAt time.Time) (*domain.Note, error) {
+	note, err := s.NoteService.ScheduleNote(ctx, id, dueAt, remindAt)
+	if err == nil {
+		count(ctx, s.metrics.NotesUpdated)
+	}
+	return note, err
+}
+
+// DeleteNote deletes a note
+func (s *instrumentedNoteService) DeleteNote(ctx context.Context, id int64) error {
+	err := s.NoteService.DeleteNote(ctx, id)
+	if err == nil {
+		count(ctx, s.metrics.NotesDeleted)
+	}
+	return err
+}
+
+// count increments counter after the change commits
+func count(ctx context.Context, counter prometheus.Counter) {
+	repositories.AfterCommit(ctx, func(context.Context) { counter.Inc() })
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrJobNotFound is returned when a job is not found
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobNotDead is returned when retrying a job that has not failed for good
+var ErrJobNotDead = errors.New("only dead jobs can be retried")
+
+// JobService defines the interface for inspecting the background job queue.
+// Every method needs the jobs:manage permission; jobs themselves are queued
+// with jobs.Queue.
+type JobService interface {
+	GetJobs(ctx context.Context, filter domain.JobFilter) ([]*domain.Job, error)
+	CountJobs(ctx context.Context) (map[domain.JobStatus]int, error)
+	// RetryJob queues a dead job again with fresh attempts
+	RetryJob(ctx context.Context, id int64) error
+}
+
+type jobService struct {
+	repo repositories.JobRepository
+}
+
+// NewJobService creates a new job service
+func NewJobService(repo repositories.JobRepository) JobService {
+	return &jobService{repo}
+}
+
+// GetJobs returns the jobs matching filter, newest first
+func (s *jobService) GetJobs(ctx context.Context, filter domain.JobFilter) (jobs []*domain.Job, err error) {
+	ctx, span := tracing.Start(ctx, "JobService.GetJobs")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := authorize(ctx, domain.PermJobsManage); err != nil {
+		return nil, err
+	}
+	return s.repo.Find(ctx, filter)
+}
+
+// CountJobs returns the number of jobs in every status
+func (s *jobService) CountJobs(ctx context.Context) (counts map[domain.JobStatus]int, err error) {
+	ctx, span := tracing.Start(ctx, "JobService.CountJobs")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := authorize(ctx, domain.PermJobsManage); err != nil {
+		return nil, err
+	}
+	return s.repo.CountByStatus(ctx)
+}
+
+// RetryJob queues a dead job again
+func (s *jobService) RetryJob(ctx context.Context, id int64) (err error) {
+	ctx, span := tracing.Start(ctx, "JobService.RetryJob", attribute.Int64("job.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermJobsManage)
+	if err != nil {
+		return err
+	}
+	requeued, err := s.repo.Requeue(ctx, id, time.Now())
+	if err != nil {
+		return err
+	}
+	if !requeued {
+		job, err := s.repo.FindByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			return ErrJobNotFound
+		}
+		return ErrJobNotDead
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "job requeued", "job_id", id, "user_id", user.ID)
+	return nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// MaxGraphDepth is the widest neighbourhood of a focus note GetNoteGraph returns
+const MaxGraphDepth = 5
+
+// MaxGraphNodes is the most notes GetNoteGraph returns, which bounds the
+// layout the browser computes
+const MaxGraphNodes = 200
+
+// ErrInvalidGraphDepth is returned for a depth outside 1 to MaxGraphDepth
+var ErrInvalidGraphDepth = fmt.Errorf("graph depth must be between 1 and %d", MaxGraphDepth)
+
+// GetNoteGraph returns the graph of the notes GetAllNotes and GetSharedNotes
+// would return, linked by the URLs and titles their content mentions. With a
+// focus note, only the notes within depth edges of it are included. The
+// graph is read from the titles and stored mentions of the notes, not their
+// content. Beyond MaxGraphNodes notes, only the most linked ones and the
+// focus note are returned, and the graph is marked as truncated.
+func (s *noteService) GetNoteGraph(ctx context.Context, focusID int64, depth int) (graph *domain.NoteGraph, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.GetNoteGraph", attribute.Int64("note.id", focusID), attribute.Int("graph.depth", depth))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return nil, err
+	}
+	if focusID != 0 && (depth < 1 || depth > MaxGraphDepth) {
+		return nil, ErrInvalidGraphDepth
+	}
+
+	if user.Can(domain.PermNotesReadAll) {
+		graph, err = s.links.FindGraph(ctx, 0)
+	} else {
+		graph, err = s.links.FindGraph(ctx, user.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if focusID != 0 {
+		if graph = graph.Around(focusID, depth); graph == nil {
+			return nil, ErrNoteNotFound
+		}
+	}
+	if graph = graph.MostLinked(MaxGraphNodes, focusID); graph.Truncated {
+		span.SetAttributes(attribute.Bool("graph.truncated", true))
+	}
+	return graph, nil
+}
+
+// saveMentions stores the notes the content of note mentions. When its title
+// changed, the mentions of the owner's notes that may mention the new title
+// or mentioned the old one are stored again too.
+func (s *noteService) saveMentions(ctx context.Context, note *domain.Note, retitled bool) error {
+	titles, err := s.links.FindTitles(ctx, note.UserID)
+	if err != nil {
+		return err
+	}
+	if err := s.replaceMentions(ctx, note, titles); err != nil {
+		return err
+	}
+	if !retitled {
+		return nil
+	}
+
+	sources, err := s.links.FindMentioning(ctx, note.UserID, strings.TrimSpace(note.Title), note.ID)
+	if err != nil {
+		return err
+	}
+	for _, source := range sources {
+		if source.ID == note.ID {
+			continue
+		}
+		if err := s.replaceMentions(ctx, source, titles); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceMentions stores the notes the content of note mentions by URL or
+// by one of titles
+func (s *noteService) replaceMentions(ctx context.Context, note *domain.Note, titles []domain.GraphNode) error {
+	mentions := domain.NoteMentions(note.Content, titles)
+	delete(mentions, note.ID)
+	return s.links.ReplaceMentions(ctx, note.ID, mentions)
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrInvalidJournalDate is returned for a journal date that cannot be stored
+var ErrInvalidJournalDate = errors.New("journal dates must fall between the years 1000 and 9999")
+
+// journalTitle is the layout of the title of new journal entries
+const journalTitle = "Monday, 2 January 2006"
+
+// GetJournal returns the user's journal entry for a date
+func (s *noteService) GetJournal(ctx context.Context, date time.Time) (note *domain.Note, err error) {
+	date = domain.DateOf(date)
+	ctx, span := tracing.Start(ctx, "NoteService.GetJournal", attribute.String("journal.date", date.Format(time.DateOnly)))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return nil, err
+	}
+	if !validJournalDate(date) {
+		return nil, ErrInvalidJournalDate
+	}
+
+	note, err = s.repo.FindJournal(ctx, user.ID, date)
+	if err != nil {
+		return nil, err
+	}
+	if note == nil {
+		return nil, ErrNoteNotFound
+	}
+	return note, nil
+}
+
+// OpenJournal returns the user's journal entry for a date, creating it
+// titled with the date if needed. Opening the same day twice at once
+// creates one entry: the unique key on the date makes the loser load the
+// winner's.
+func (s *noteService) OpenJournal(ctx context.Context, date time.Time) (note *domain.Note, created bool, err error) {
+	date = domain.DateOf(date)
+	ctx, span := tracing.Start(ctx, "NoteService.OpenJournal", attribute.String("journal.date", date.Format(time.DateOnly)))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesWrite)
+	if err != nil {
+		return nil, false, err
+	}
+	if !validJournalDate(date) {
+		return nil, false, ErrInvalidJournalDate
+	}
+
+	if note, err = s.repo.FindJournal(ctx, user.ID, date); err != nil || note != nil {
+		return note, false, err
+	}
+	note = domain.NewNote(date.Format(journalTitle), "")
+	note.JournalDate = date
+	note, err = s.create(ctx, user, note)
+	if errors.Is(err, repositories.ErrDuplicate) {
+		note, err = s.repo.FindJournal(ctx, user.ID, date)
+		if err == nil && note == nil {
+			err = ErrNoteNotFound
+		}
+		return note, false, err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	span.SetAttributes(attribute.Int64("note.id", note.ID))
+	return note, true, nil
+}
+
+// GetJournalDates returns the dates the user has journal entries on
+func (s *noteService) GetJournalDates(ctx context.Context, from, to time.Time) (dates []time.Time, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.GetJournalDates")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindJournalDates(ctx, user.ID, domain.DateOf(from), domain.DateOf(to))
+}
+
+// validJournalDate reports whether date fits a DATE column
+func validJournalDate(date time.Time) bool {
+	return date.Year() >= 1000 && date.Year() <= 9999
+}
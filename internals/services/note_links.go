@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxLinkSuggestions caps the titles suggested while typing a link
+const maxLinkSuggestions = 8
+
+// GetNoteLinks returns the links of a note and the readable notes linking to it
+func (s *noteService) GetNoteLinks(ctx context.Context, id int64) (links []*domain.NoteLink, backlinks []*domain.Note, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.GetNoteLinks", attribute.Int64("note.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := s.findNote(ctx, user, id); err != nil {
+		return nil, nil, err
+	}
+
+	if links, err = s.links.FindLinks(ctx, id); err != nil {
+		return nil, nil, err
+	}
+	sources, err := s.links.FindBacklinks(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, source := range sources {
+		ok, err := s.canRead(ctx, user, source)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			backlinks = append(backlinks, source)
+		}
+	}
+	return links, backlinks, nil
+}
+
+// GetBrokenLinks returns the links to missing notes
+func (s *noteService) GetBrokenLinks(ctx context.Context) (links []*domain.NoteLink, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.GetBrokenLinks")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return nil, err
+	}
+	if user.Can(domain.PermNotesReadAll) {
+		return s.links.FindBroken(ctx, 0)
+	}
+	return s.links.FindBroken(ctx, user.ID)
+}
+
+// SuggestLinkTitles returns the titles of the user's notes starting with prefix
+func (s *noteService) SuggestLinkTitles(ctx context.Context, prefix string) (titles []string, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.SuggestLinkTitles")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := s.repo.FindByTitlePrefix(ctx, user.ID, strings.TrimSpace(prefix), maxLinkSuggestions)
+	if err != nil {
+		return nil, err
+	}
+	for _, note := range notes {
+		if domain.Linkable(note.Title) {
+			titles = append(titles, strings.TrimSpace(note.Title))
+		}
+	}
+	return titles, nil
+}
+
+// saveLinks stores the links in the content of note and resolves the links
+// of its owner's notes to its title
+func (s *noteService) saveLinks(ctx context.Context, note *domain.Note) error {
+	if err := s.links.ReplaceLinks(ctx, note.ID, note.UserID, domain.WikiLinks(note.Content)); err != nil {
+		return err
+	}
+	return s.links.ResolveLinks(ctx, note.UserID, strings.TrimSpace(note.Title))
+}
+
+// renameLinks rewrites the links to note in the notes linking to it after
+// it was renamed from oldTitle, in the transaction of the rename. Each
+// rewrite is an UpdateNote through the outermost decorator, so it is
+// audited, published and counted like any other edit by user; the notes
+// user may not edit keep their links, which then break.
+func (s *noteService) renameLinks(ctx context.Context, user *domain.User, note *domain.Note, oldTitle string) error {
+	sources, err := s.links.FindBacklinks(ctx, note.ID)
+	if err != nil {
+		return err
+	}
+	for _, source := range sources {
+		content, renamed := domain.RenameWikiLinks(source.Content, oldTitle, note.Title)
+		if !renamed {
+			continue
+		}
+		ok, err := s.canRead(ctx, user, source)
+		if err != nil {
+			return err
+		}
+		if !ok || !user.CanEdit(source) {
+			utils.LoggerFromContext(ctx).InfoContext(ctx, "note links not renamed", "note_id", source.ID, "target_id", note.ID, "user_id", user.ID)
+			continue
+		}
+		if _, err := s.outer.UpdateNote(ctx, source.ID, source.Title, content); err != nil {
+			return err
+		}
+	}
+	// Links to the old title that were not rewritten may now resolve to
+	// another note with it
+	return s.links.ResolveLinks(ctx, note.UserID, strings.TrimSpace(oldTitle))
+}
@@ -1,88 +1,454 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/mas-diq/htmx-basic-crud/internals/domain"
 	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ErrNoteNotFound is returned when a note is not found
 var ErrNoteNotFound = errors.New("note not found")
 
-// NoteService defines the interface for note business logic
+// ErrTitleRequired is returned when a note is saved without a title
+var ErrTitleRequired = errors.New("title is required")
+
+// ErrInvalidSchedule is returned for a due date or reminder time that
+// cannot be stored
+var ErrInvalidSchedule = errors.New("due date and reminder must fall between 1970 and 2037")
+
+// NoteService defines the interface for note business logic. Every method
+// acts on behalf of the user in ctx (see auth.WithUser) and enforces the
+// permissions of their role: notes a user may not read are reported as not
+// found, changes they may not make as ErrForbidden. Notes shared with the
+// user count as theirs to read or edit as far as the grant and their role allow.
+// Every create, update and delete is recorded in the audit log.
 type NoteService interface {
-	GetAllNotes() ([]*domain.Note, error)
-	GetNoteByID(id int64) (*domain.Note, error)
-	CreateNote(title, content string) (*domain.Note, error)
-	UpdateNote(id int64, title, content string) (*domain.Note, error)
-	DeleteNote(id int64) error
+	GetAllNotes(ctx context.Context) ([]*domain.Note, error)
+	GetNoteByID(ctx context.Context, id int64) (*domain.Note, error)
+	// CreateNote creates a note due at dueAt with its owner reminded at
+	// remindAt; zero times leave them unset
+	CreateNote(ctx context.Context, title, content string, dueAt, remindAt time.Time) (*domain.Note, error)
+	// CreateNoteFromTemplate creates a note from a template, expanding the
+	// template variables in title and content, scheduled like CreateNote.
+	// An empty title or content falls back to the template's.
+	CreateNoteFromTemplate(ctx context.Context, templateID int64, title, content string, dueAt, remindAt time.Time) (*domain.Note, error)
+	UpdateNote(ctx context.Context, id int64, title, content string) (*domain.Note, error)
+	DeleteNote(ctx context.Context, id int64) error
+	// ScheduleNote sets the due date and reminder time of a note; zero
+	// times clear them. The owner is reminded at remindAt.
+	ScheduleNote(ctx context.Context, id int64, dueAt, remindAt time.Time) (*domain.Note, error)
+	// GetUpcomingNotes returns the notes GetAllNotes would that have a due
+	// date, soonest first
+	GetUpcomingNotes(ctx context.Context) ([]*domain.Note, error)
+	// GetNotesInRange returns the notes GetAllNotes would return whose
+	// created or updated time falls in dates, latest first by that time
+	GetNotesInRange(ctx context.Context, dates domain.DateRange) ([]*domain.Note, error)
+	// GetTimeline returns the notes GetNotesInRange would return grouped by
+	// the day, week or month of that time in the user's time zone
+	GetTimeline(ctx context.Context, dates domain.DateRange, period string) ([]domain.TimelineGroup, error)
+
+	// GetJournal returns the user's journal entry for the calendar date of
+	// date, or ErrNoteNotFound if they have none
+	GetJournal(ctx context.Context, date time.Time) (*domain.Note, error)
+	// OpenJournal returns the user's journal entry for the calendar date of
+	// date, creating it if it does not exist yet; created reports whether it did
+	OpenJournal(ctx context.Context, date time.Time) (note *domain.Note, created bool, err error)
+	// GetJournalDates returns the dates from from up to but excluding to on
+	// which the user has a journal entry
+	GetJournalDates(ctx context.Context, from, to time.Time) ([]time.Time, error)
+
+	// GetNoteLinks returns the [[Title]] links of a note and the notes the
+	// user may read that link to it
+	GetNoteLinks(ctx context.Context, id int64) ([]*domain.NoteLink, []*domain.Note, error)
+	// GetBrokenLinks returns the links to missing notes in the notes
+	// GetAllNotes would return
+	GetBrokenLinks(ctx context.Context) ([]*domain.NoteLink, error)
+	// SuggestLinkTitles returns titles of the user's notes starting with
+	// prefix, for completing links while typing
+	SuggestLinkTitles(ctx context.Context, prefix string) ([]string, error)
+	// GetNoteGraph returns the graph of the notes the user may read that
+	// mention each other, within depth edges of the focus note unless
+	// focusID is 0
+	GetNoteGraph(ctx context.Context, focusID int64, depth int) (*domain.NoteGraph, error)
+
+	GetSharedNotes(ctx context.Context) ([]*domain.Note, error)
+	GetShares(ctx context.Context, id int64) ([]*domain.Share, []*domain.ShareLink, error)
+	ShareNote(ctx context.Context, id int64, username string, permission domain.SharePermission) (*domain.Share, error)
+	UnshareNote(ctx context.Context, id, userID int64) error
+	CreateShareLink(ctx context.Context, id int64, password string, expiresAt time.Time) (string, *domain.ShareLink, error)
+	RevokeShareLink(ctx context.Context, id, linkID int64) error
+	// GetNoteByShareToken returns the note behind a public link. It needs
+	// no user in ctx: the token and password are the credentials.
+	GetNoteByShareToken(ctx context.Context, token, password string) (*domain.Note, error)
 }
 
 type noteService struct {
-	repo repositories.NoteRepository
+	repo      repositories.NoteRepository
+	shares    repositories.ShareRepository
+	users     repositories.UserRepository
+	audits    repositories.AuditRepository
+	templates repositories.NoteTemplateRepository
+	links     repositories.LinkRepository
+	tx        repositories.Transactor
+	// outer is the outermost decorator wrapping the service, which the
+	// changes the service makes on its own pass through
+	outer NoteService
+}
+
+// NewNoteService creates a new note service. users resolves the usernames
+// notes are shared with, audits receives an event for every change,
+// templates holds the templates notes can be created from and links the
+// [[Title]] links between notes, which are kept up to date on every change.
+// tx saves each change together with its audit event and links, so none is
+// saved without the others.
+func NewNoteService(repo repositories.NoteRepository, shares repositories.ShareRepository, users repositories.UserRepository, audits repositories.AuditRepository, templates repositories.NoteTemplateRepository, links repositories.LinkRepository, tx repositories.Transactor) NoteService {
+	s := &noteService{repo: repo, shares: shares, users: users, audits: audits, templates: templates, links: links, tx: tx}
+	s.outer = s
+	return s
+}
+
+// wrappable is implemented by note services that decorators can wrap
+type wrappable interface {
+	wrappedBy(outer NoteService)
+}
+
+// wrap tells svc, and whatever it wraps, that outer now wraps it
+func wrap(svc, outer NoteService) NoteService {
+	if w, ok := svc.(wrappable); ok {
+		w.wrappedBy(outer)
+	}
+	return outer
 }
 
-// NewNoteService creates a new note service
-func NewNoteService(repo repositories.NoteRepository) NoteService {
-	return &noteService{repo}
+func (s *noteService) wrappedBy(outer NoteService) {
+	s.outer = outer
 }
 
-// GetAllNotes returns all notes
-func (s *noteService) GetAllNotes() ([]*domain.Note, error) {
-	return s.repo.FindAll()
+// GetAllNotes returns every note the user may read apart from those shared
+// with them, which GetSharedNotes lists
+func (s *noteService) GetAllNotes(ctx context.Context) (notes []*domain.Note, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.GetAllNotes")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return nil, err
+	}
+	if user.Can(domain.PermNotesReadAll) {
+		return s.repo.FindAll(ctx)
+	}
+	return s.repo.FindByOwner(ctx, user.ID)
 }
 
 // GetNoteByID returns a note by ID
-func (s *noteService) GetNoteByID(id int64) (*domain.Note, error) {
-	note, err := s.repo.FindByID(id)
+func (s *noteService) GetNoteByID(ctx context.Context, id int64) (note *domain.Note, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.GetNoteByID", attribute.Int64("note.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
 	if err != nil {
 		return nil, err
 	}
-	if note == nil {
-		return nil, ErrNoteNotFound
+	return s.findNote(ctx, user, id)
+}
+
+// CreateNote creates a new note owned by the user
+func (s *noteService) CreateNote(ctx context.Context, title, content string, dueAt, remindAt time.Time) (note *domain.Note, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.CreateNote")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesWrite)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(title) == "" {
+		return nil, ErrTitleRequired
+	}
+	if dueAt, remindAt, err = storedSchedule(dueAt, remindAt); err != nil {
+		return nil, err
 	}
+
+	if note, err = s.create(ctx, user, scheduledNote(title, content, dueAt, remindAt)); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int64("note.id", note.ID))
 	return note, nil
 }
 
-// CreateNote creates a new note
-func (s *noteService) CreateNote(title, content string) (*domain.Note, error) {
-	note := domain.NewNote(title, content)
-	id, err := s.repo.Create(note)
+// CreateNoteFromTemplate creates a note from a template. Every note created
+// bumps the template's counter, even if saving the note then fails.
+func (s *noteService) CreateNoteFromTemplate(ctx context.Context, templateID int64, title, content string, dueAt, remindAt time.Time) (note *domain.Note, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.CreateNoteFromTemplate", attribute.Int64("template.id", templateID))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesWrite)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := findTemplate(ctx, s.templates, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if title == "" {
+		title = tmpl.Title
+	}
+	if content == "" {
+		content = tmpl.Content
+	}
+	if strings.TrimSpace(title) == "" {
+		return nil, ErrTitleRequired
+	}
+	if dueAt, remindAt, err = storedSchedule(dueAt, remindAt); err != nil {
+		return nil, err
+	}
+
+	counter, err := s.templates.NextCounter(ctx, templateID)
 	if err != nil {
 		return nil, err
 	}
-	note.ID = id
+	if counter == 0 {
+		return nil, ErrTemplateNotFound
+	}
+	vars := templateValues(user, time.Now(), counter)
+	if note, err = s.create(ctx, user, scheduledNote(expandTemplate(title, vars), expandTemplate(content, vars), dueAt, remindAt)); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int64("note.id", note.ID))
+	return note, nil
+}
+
+// create stores note as a new note owned by user and records it in the
+// audit log
+func (s *noteService) create(ctx context.Context, user *domain.User, note *domain.Note) (*domain.Note, error) {
+	note.UserID = user.ID
+	err := s.tx.InTx(ctx, func(ctx context.Context) error {
+		id, err := s.repo.Create(ctx, note)
+		if err != nil {
+			return err
+		}
+		note.ID = id
+		if err := s.audit(ctx, user, domain.AuditNoteCreated, id, nil, note); err != nil {
+			return err
+		}
+		if err := s.saveLinks(ctx, note); err != nil {
+			return err
+		}
+		return s.saveMentions(ctx, note, true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "note created", "note_id", note.ID, "user_id", user.ID)
 	return note, nil
 }
 
 // UpdateNote updates an existing note
-func (s *noteService) UpdateNote(id int64, title, content string) (*domain.Note, error) {
-	note, err := s.repo.FindByID(id)
+func (s *noteService) UpdateNote(ctx context.Context, id int64, title, content string) (note *domain.Note, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.UpdateNote", attribute.Int64("note.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesWrite)
 	if err != nil {
 		return nil, err
 	}
-	if note == nil {
-		return nil, ErrNoteNotFound
+	if strings.TrimSpace(title) == "" {
+		return nil, ErrTitleRequired
 	}
 
+	note, err = s.findEditableNote(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *note
 	note.Title = title
 	note.Content = content
 
-	if err := s.repo.Update(note); err != nil {
+	err = s.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.Update(ctx, note); err != nil {
+			return err
+		}
+		if err := s.audit(ctx, user, domain.AuditNoteUpdated, id, &before, note); err != nil {
+			return err
+		}
+		if err := s.saveLinks(ctx, note); err != nil {
+			return err
+		}
+		if err := s.saveMentions(ctx, note, strings.TrimSpace(before.Title) != strings.TrimSpace(note.Title)); err != nil {
+			return err
+		}
+		if strings.EqualFold(strings.TrimSpace(before.Title), strings.TrimSpace(note.Title)) {
+			return nil
+		}
+		return s.renameLinks(ctx, user, note, before.Title)
+	})
+	if err != nil {
 		return nil, err
 	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "note updated", "note_id", id, "user_id", user.ID)
 	return note, nil
 }
 
 // DeleteNote deletes a note
-func (s *noteService) DeleteNote(id int64) error {
-	note, err := s.repo.FindByID(id)
+func (s *noteService) DeleteNote(ctx context.Context, id int64) (err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.DeleteNote", attribute.Int64("note.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesWrite)
 	if err != nil {
 		return err
 	}
+	note, err := s.findEditableNote(ctx, user, id)
+	if err != nil {
+		return err
+	}
+	err = s.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.Delete(ctx, id); err != nil {
+			return err
+		}
+		if err := s.audit(ctx, user, domain.AuditNoteDeleted, id, note, nil); err != nil {
+			return err
+		}
+		// Links to the note now point to another note with its title, if any
+		return s.links.ResolveLinks(ctx, note.UserID, strings.TrimSpace(note.Title))
+	})
+	if err != nil {
+		return err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "note deleted", "note_id", id, "user_id", user.ID)
+	return nil
+}
+
+// ScheduleNote sets the due date and reminder time of a note
+func (s *noteService) ScheduleNote(ctx context.Context, id int64, dueAt, remindAt time.Time) (note *domain.Note, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.ScheduleNote", attribute.Int64("note.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesWrite)
+	if err != nil {
+		return nil, err
+	}
+	if dueAt, remindAt, err = storedSchedule(dueAt, remindAt); err != nil {
+		return nil, err
+	}
+
+	note, err = s.findEditableNote(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	if note.DueAt.Equal(dueAt) && note.RemindAt.Equal(remindAt) {
+		return note, nil
+	}
+
+	before := *note
+	note.DueAt = dueAt
+	note.RemindAt = remindAt
+	err = s.tx.InTx(ctx, func(ctx context.Context) error {
+		if err := s.repo.UpdateSchedule(ctx, note); err != nil {
+			return err
+		}
+		return s.audit(ctx, user, domain.AuditNoteUpdated, id, &before, note)
+	})
+	if err != nil {
+		return nil, err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "note scheduled", "note_id", id, "user_id", user.ID)
+	return note, nil
+}
+
+// GetUpcomingNotes returns the notes with a due date, soonest first
+func (s *noteService) GetUpcomingNotes(ctx context.Context) (notes []*domain.Note, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.GetUpcomingNotes")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return nil, err
+	}
+	if user.Can(domain.PermNotesReadAll) {
+		return s.repo.FindUpcoming(ctx, 0)
+	}
+	return s.repo.FindUpcoming(ctx, user.ID)
+}
+
+// ValidateSchedule returns ErrInvalidSchedule if dueAt or remindAt cannot be
+// stored, so that callers can reject a schedule before writing anything else
+func ValidateSchedule(dueAt, remindAt time.Time) error {
+	_, _, err := storedSchedule(dueAt, remindAt)
+	return err
+}
+
+// storedSchedule returns dueAt and remindAt as they are stored, without
+// fractions of a second so that they compare equal once read back, or
+// ErrInvalidSchedule if either does not fit a TIMESTAMP column
+func storedSchedule(dueAt, remindAt time.Time) (time.Time, time.Time, error) {
+	dueAt, remindAt = dueAt.Truncate(time.Second), remindAt.Truncate(time.Second)
+	if !validScheduleTime(dueAt) || !validScheduleTime(remindAt) {
+		return time.Time{}, time.Time{}, ErrInvalidSchedule
+	}
+	return dueAt, remindAt, nil
+}
+
+// validScheduleTime reports whether t is unset or fits a TIMESTAMP column
+func validScheduleTime(t time.Time) bool {
+	return t.IsZero() || (t.Year() >= 1970 && t.Year() <= 2037)
+}
+
+// scheduledNote returns a new note due at dueAt with a reminder at remindAt
+func scheduledNote(title, content string, dueAt, remindAt time.Time) *domain.Note {
+	note := domain.NewNote(title, content)
+	note.DueAt = dueAt
+	note.RemindAt = remindAt
+	return note
+}
+
+// findNote returns a note the user may read, hiding the others as not found.
+// The grant of notes shared with the user is loaded into note.Grant.
+func (s *noteService) findNote(ctx context.Context, user *domain.User, id int64) (*domain.Note, error) {
+	note, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 	if note == nil {
-		return ErrNoteNotFound
+		return nil, ErrNoteNotFound
 	}
-	return s.repo.Delete(id)
+	ok, err := s.canRead(ctx, user, note)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNoteNotFound
+	}
+	return note, nil
+}
+
+// canRead reports whether the user may read note, loading the grant of a
+// note shared with them into note.Grant
+func (s *noteService) canRead(ctx context.Context, user *domain.User, note *domain.Note) (bool, error) {
+	if !user.Owns(note) && !user.Can(domain.PermNotesReadAll) {
+		var err error
+		if note.Grant, err = s.shares.FindGrant(ctx, note.ID, user.ID); err != nil {
+			return false, err
+		}
+	}
+	return user.CanRead(note), nil
+}
+
+// findEditableNote returns a note the user may edit
+func (s *noteService) findEditableNote(ctx context.Context, user *domain.User, id int64) (*domain.Note, error) {
+	note, err := s.findNote(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	if !user.CanEdit(note) {
+		return nil, ErrForbidden
+	}
+	return note, nil
 }
@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrInvalidShare is returned when a note is shared with its owner or with
+// an unknown permission
+var ErrInvalidShare = errors.New("notes can be shared with read or edit permission with anyone but their owner")
+
+// ErrShareLinkNotFound is returned for unknown, revoked and expired links
+var ErrShareLinkNotFound = errors.New("share link not found")
+
+// ErrSharePassword is returned when a link's password is missing or wrong
+var ErrSharePassword = errors.New("share link password required")
+
+// GetSharedNotes returns the notes other users shared with the user
+func (s *noteService) GetSharedNotes(ctx context.Context) (notes []*domain.Note, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.GetSharedNotes")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return nil, err
+	}
+	return s.shares.FindSharedWith(ctx, user.ID)
+}
+
+// GetShares returns the grants and public links of a note the user may share
+func (s *noteService) GetShares(ctx context.Context, id int64) (shares []*domain.Share, links []*domain.ShareLink, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.GetShares", attribute.Int64("note.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := s.findSharableNote(ctx, id); err != nil {
+		return nil, nil, err
+	}
+	if shares, err = s.shares.FindByNote(ctx, id); err != nil {
+		return nil, nil, err
+	}
+	if links, err = s.shares.FindLinksByNote(ctx, id); err != nil {
+		return nil, nil, err
+	}
+	return shares, links, nil
+}
+
+// ShareNote grants the user named username permission on a note, replacing
+// any permission granted before
+func (s *noteService) ShareNote(ctx context.Context, id int64, username string, permission domain.SharePermission) (share *domain.Share, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.ShareNote", attribute.Int64("note.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	note, err := s.findSharableNote(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !permission.Valid() {
+		return nil, ErrInvalidShare
+	}
+	grantee, err := s.users.FindByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if grantee == nil {
+		return nil, ErrUserNotFound
+	}
+	if grantee.Owns(note) {
+		return nil, ErrInvalidShare
+	}
+
+	if err := s.shares.Grant(ctx, id, grantee.ID, permission); err != nil {
+		return nil, err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "note shared",
+		"note_id", id, "user_id", auth.UserFromContext(ctx).ID, "grantee_id", grantee.ID, "permission", permission)
+	return &domain.Share{
+		NoteID:     id,
+		UserID:     grantee.ID,
+		Username:   grantee.Username,
+		Permission: permission,
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// UnshareNote revokes the grant of a user on a note
+func (s *noteService) UnshareNote(ctx context.Context, id, userID int64) (err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.UnshareNote", attribute.Int64("note.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := s.findSharableNote(ctx, id); err != nil {
+		return err
+	}
+	if err := s.shares.Revoke(ctx, id, userID); err != nil {
+		return err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "note unshared",
+		"note_id", id, "user_id", auth.UserFromContext(ctx).ID, "grantee_id", userID)
+	return nil
+}
+
+// CreateShareLink creates a public read-only link to a note and returns its
+// token, which is not stored and cannot be shown again. An empty password
+// leaves the link open and a zero expiresAt keeps it working until revoked.
+func (s *noteService) CreateShareLink(ctx context.Context, id int64, password string, expiresAt time.Time) (token string, link *domain.ShareLink, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.CreateShareLink", attribute.Int64("note.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := s.findSharableNote(ctx, id); err != nil {
+		return "", nil, err
+	}
+
+	token, err = auth.NewToken()
+	if err != nil {
+		return "", nil, err
+	}
+	link = &domain.ShareLink{
+		NoteID:    id,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	if password != "" {
+		if link.PasswordHash, err = auth.HashPassword(password); err != nil {
+			return "", nil, err
+		}
+	}
+
+	if link.ID, err = s.shares.CreateLink(ctx, link); err != nil {
+		return "", nil, err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "share link created",
+		"note_id", id, "user_id", auth.UserFromContext(ctx).ID, "link_id", link.ID)
+	return token, link, nil
+}
+
+// RevokeShareLink deletes a public link of a note
+func (s *noteService) RevokeShareLink(ctx context.Context, id, linkID int64) (err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.RevokeShareLink", attribute.Int64("note.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := s.findSharableNote(ctx, id); err != nil {
+		return err
+	}
+	if err := s.shares.DeleteLink(ctx, id, linkID); err != nil {
+		return err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "share link revoked",
+		"note_id", id, "user_id", auth.UserFromContext(ctx).ID, "link_id", linkID)
+	return nil
+}
+
+// GetNoteByShareToken returns the note a public link points to
+func (s *noteService) GetNoteByShareToken(ctx context.Context, token, password string) (note *domain.Note, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.GetNoteByShareToken")
+	defer func() { tracing.End(span, err) }()
+
+	link, err := s.shares.FindLinkByToken(ctx, auth.HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if link == nil || link.Expired(time.Now()) {
+		return nil, ErrShareLinkNotFound
+	}
+	span.SetAttributes(attribute.Int64("note.id", link.NoteID))
+	if link.HasPassword() && !auth.CheckPassword(link.PasswordHash, password) {
+		return nil, ErrSharePassword
+	}
+
+	note, err = s.repo.FindByID(ctx, link.NoteID)
+	if err != nil {
+		return nil, err
+	}
+	if note == nil {
+		return nil, ErrShareLinkNotFound
+	}
+	return note, nil
+}
+
+// findSharableNote returns a note the user in ctx may share
+func (s *noteService) findSharableNote(ctx context.Context, id int64) (*domain.Note, error) {
+	user, err := authorize(ctx, domain.PermNotesWrite)
+	if err != nil {
+		return nil, err
+	}
+	note, err := s.findNote(ctx, user, id)
+	if err != nil {
+		return nil, err
+	}
+	if !user.CanShare(note) {
+		return nil, ErrForbidden
+	}
+	return note, nil
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrInvalidDateRange is returned for a date range on an unknown field or
+// ending before it starts
+var ErrInvalidDateRange = errors.New("date ranges select by created or updated time and must not end before they start")
+
+// ErrInvalidPeriod is returned for a timeline period other than a day, week or month
+var ErrInvalidPeriod = errors.New("timelines group notes by day, week or month")
+
+// GetNotesInRange returns the notes the user may list in a date range
+func (s *noteService) GetNotesInRange(ctx context.Context, dates domain.DateRange) (notes []*domain.Note, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.GetNotesInRange", attribute.String("dates.field", dates.Field))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return nil, err
+	}
+	if !dates.Valid() {
+		return nil, ErrInvalidDateRange
+	}
+
+	if user.Can(domain.PermNotesReadAll) {
+		return s.repo.FindByDateRange(ctx, 0, dates)
+	}
+	return s.repo.FindByDateRange(ctx, user.ID, dates)
+}
+
+// GetTimeline groups the notes in a date range by day, week or month
+func (s *noteService) GetTimeline(ctx context.Context, dates domain.DateRange, period string) (groups []domain.TimelineGroup, err error) {
+	ctx, span := tracing.Start(ctx, "NoteService.GetTimeline", attribute.String("dates.field", dates.Field), attribute.String("timeline.period", period))
+	defer func() { tracing.End(span, err) }()
+
+	if !domain.ValidPeriod(period) {
+		return nil, ErrInvalidPeriod
+	}
+	notes, err := s.GetNotesInRange(ctx, dates)
+	if err != nil {
+		return nil, err
+	}
+	return domain.GroupNotes(notes, dates, period, auth.UserFromContext(ctx).Location()), nil
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrNotificationNotFound is returned when a notification is not found
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// notificationPageSize caps the notifications listed in the navbar
+const notificationPageSize = 20
+
+// NotificationService defines the interface for the notifications of the
+// signed in user. Every user may read their own notifications only.
+type NotificationService interface {
+	// GetNotifications returns the newest notifications of the user
+	GetNotifications(ctx context.Context) ([]*domain.Notification, error)
+	CountUnread(ctx context.Context) (int, error)
+	// MarkRead marks a notification read and returns it
+	MarkRead(ctx context.Context, id int64) (*domain.Notification, error)
+	MarkAllRead(ctx context.Context) error
+}
+
+type notificationService struct {
+	repo repositories.NotificationRepository
+}
+
+// NewNotificationService creates a new notification service
+func NewNotificationService(repo repositories.NotificationRepository) NotificationService {
+	return &notificationService{repo}
+}
+
+// GetNotifications returns the newest notifications of the user
+func (s *notificationService) GetNotifications(ctx context.Context) (notifications []*domain.Notification, err error) {
+	ctx, span := tracing.Start(ctx, "NotificationService.GetNotifications")
+	defer func() { tracing.End(span, err) }()
+
+	user := auth.UserFromContext(ctx)
+	if user == nil {
+		return nil, ErrUnauthenticated
+	}
+	return s.repo.FindByUser(ctx, user.ID, notificationPageSize)
+}
+
+// CountUnread returns the number of notifications the user has not read
+func (s *notificationService) CountUnread(ctx context.Context) (n int, err error) {
+	ctx, span := tracing.Start(ctx, "NotificationService.CountUnread")
+	defer func() { tracing.End(span, err) }()
+
+	user := auth.UserFromContext(ctx)
+	if user == nil {
+		return 0, ErrUnauthenticated
+	}
+	return s.repo.CountUnread(ctx, user.ID)
+}
+
+// MarkRead marks a notification of the user read
+func (s *notificationService) MarkRead(ctx context.Context, id int64) (notification *domain.Notification, err error) {
+	ctx, span := tracing.Start(ctx, "NotificationService.MarkRead", attribute.Int64("notification.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	user := auth.UserFromContext(ctx)
+	if user == nil {
+		return nil, ErrUnauthenticated
+	}
+	notification, err = s.repo.MarkRead(ctx, user.ID, id, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if notification == nil {
+		return nil, ErrNotificationNotFound
+	}
+	return notification, nil
+}
+
+// MarkAllRead marks every notification of the user read
+func (s *notificationService) MarkAllRead(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "NotificationService.MarkAllRead")
+	defer func() { tracing.End(span, err) }()
+
+	user := auth.UserFromContext(ctx)
+	if user == nil {
+		return ErrUnauthenticated
+	}
+	return s.repo.MarkAllRead(ctx, user.ID, time.Now())
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/jobs"
+	"github.com/mas-diq/htmx-basic-crud/internals/mail"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// reminderBatchSize caps the reminders fired by one FireDue call
+const reminderBatchSize = 100
+
+// ReminderService fires the reminders of notes. It runs in the background
+// rather than on behalf of a user, so it checks no permissions.
+type ReminderService interface {
+	// FireDue notifies the owners of the notes whose reminder is due and
+	// returns how many reminders fired. Each reminder fires once even with
+	// several instances running.
+	FireDue(ctx context.Context) (int, error)
+}
+
+type reminderService struct {
+	notes         repositories.NoteRepository
+	notifications repositories.NotificationRepository
+	users         repositories.UserRepository
+	queue         *jobs.Queue
+}
+
+// NewReminderService creates a new reminder service. Reminders are also
+// emailed to owners with an address through queue, unless it is nil or has
+// no mail.SendJob handler because no mail server is configured.
+func NewReminderService(notes repositories.NoteRepository, notifications repositories.NotificationRepository, users repositories.UserRepository, queue *jobs.Queue) ReminderService {
+	return &reminderService{notes, notifications, users, queue}
+}
+
+// FireDue fires the reminders that are due
+func (s *reminderService) FireDue(ctx context.Context) (fired int, err error) {
+	ctx, span := tracing.Start(ctx, "ReminderService.FireDue")
+	defer func() {
+		span.SetAttributes(attribute.Int("reminders.fired", fired))
+		tracing.End(span, err)
+	}()
+
+	now := time.Now()
+	notes, err := s.notes.FindDueReminders(ctx, now, reminderBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, note := range notes {
+		// Marking first claims the reminder, so an instance racing this one
+		// skips it. A failure below loses the reminder rather than sending
+		// it twice.
+		ok, err := s.notes.MarkReminded(ctx, note.ID, note.RemindAt, now)
+		if err != nil {
+			return fired, err
+		}
+		if !ok {
+			continue
+		}
+		fired++
+		if note.UserID == 0 {
+			continue
+		}
+		if err := s.notify(ctx, note, now); err != nil {
+			return fired, err
+		}
+	}
+	return fired, nil
+}
+
+// notify tells the owner of note about its reminder in the navbar and, if
+// they have an address, by email
+func (s *reminderService) notify(ctx context.Context, note *domain.Note, now time.Time) error {
+	subject := "Reminder: " + note.Title
+	_, err := s.notifications.Create(ctx, &domain.Notification{
+		UserID:    note.UserID,
+		NoteID:    note.ID,
+		Message:   utils.Truncate(subject, domain.MaxNotificationMessage),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "reminder fired", "note_id", note.ID, "user_id", note.UserID)
+
+	if s.queue == nil || !s.queue.Handles(mail.SendJob) {
+		return nil
+	}
+	user, err := s.users.FindByID(ctx, note.UserID)
+	if err != nil || user == nil || user.Email == "" {
+		return err
+	}
+	_, err = s.queue.Enqueue(ctx, mail.SendJob, mail.Message{
+		To:      user.Email,
+		Subject: subject,
+		Body:    reminderBody(note, user.Location()),
+	})
+	return err
+}
+
+// reminderBody is the text of the email reminding of note, with times in loc
+func reminderBody(note *domain.Note, loc *time.Location) string {
+	body := fmt.Sprintf("This is your reminder for the note %q.\n", note.Title)
+	if !note.DueAt.IsZero() {
+		body += fmt.Sprintf("It is due %s.\n", note.DueAt.In(loc).Format("Mon 2 Jan 2006 15:04 MST"))
+	}
+	return body + "\nOpen the note at /notes/" + fmt.Sprint(note.ID) + " after signing in.\n"
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrInvalidSearch is returned, wrapping the reason, for a search query
+// that cannot be parsed
+var ErrInvalidSearch = errors.New("invalid search")
+
+// ErrSavedSearchNotFound is returned when a saved search is not found or
+// belongs to another user
+var ErrSavedSearchNotFound = errors.New("saved search not found")
+
+// ErrInvalidSavedSearch is returned when a saved search has no name or
+// query, or its name is too long
+var ErrInvalidSavedSearch = fmt.Errorf("saved searches need a name of up to %d characters and a search", domain.MaxSavedSearchName)
+
+// SearchService defines the interface for searching notes with the query
+// language of domain.ParseSearchQuery and for the searches each user saves.
+// Searches cover the notes GetAllNotes returns.
+type SearchService interface {
+	// SearchNotes returns the notes matching query whose created or updated
+	// time also falls in dates, unless dates is zero
+	SearchNotes(ctx context.Context, query string, dates domain.DateRange) ([]*domain.Note, error)
+	// GetSavedSearches returns the user's saved searches ordered by name,
+	// with the number of notes each matches
+	GetSavedSearches(ctx context.Context) ([]*domain.SavedSearch, error)
+	SaveSearch(ctx context.Context, name, query string) (*domain.SavedSearch, error)
+	DeleteSavedSearch(ctx context.Context, id int64) error
+}
+
+type searchService struct {
+	notes    repositories.NoteRepository
+	searches repositories.SavedSearchRepository
+}
+
+// NewSearchService creates a new search service
+func NewSearchService(notes repositories.NoteRepository, searches repositories.SavedSearchRepository) SearchService {
+	return &searchService{notes, searches}
+}
+
+// SearchNotes returns the notes matching a query, newest first
+func (s *searchService) SearchNotes(ctx context.Context, query string, dates domain.DateRange) (notes []*domain.Note, err error) {
+	ctx, span := tracing.Start(ctx, "SearchService.SearchNotes")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := parseSearch(user, query)
+	if err != nil {
+		return nil, err
+	}
+	if !dates.IsZero() {
+		if !dates.Valid() {
+			return nil, ErrInvalidDateRange
+		}
+		parsed.Terms = append(parsed.Terms, domain.SearchTerm{Field: dates.Field, From: dates.From, To: dates.To})
+	}
+	return s.notes.Search(ctx, searchScope(user), parsed)
+}
+
+// GetSavedSearches returns the user's saved searches with their counts
+func (s *searchService) GetSavedSearches(ctx context.Context) (searches []*domain.SavedSearch, err error) {
+	ctx, span := tracing.Start(ctx, "SearchService.GetSavedSearches")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return nil, err
+	}
+	if searches, err = s.searches.FindByUser(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	for _, search := range searches {
+		parsed, err := parseSearch(user, search.Query)
+		if err != nil {
+			// Queries are checked when saved; one that no longer parses
+			// is listed without a count
+			continue
+		}
+		if search.Count, err = s.notes.CountSearch(ctx, searchScope(user), parsed); err != nil {
+			return nil, err
+		}
+	}
+	return searches, nil
+}
+
+// SaveSearch saves a query under a name for the user
+func (s *searchService) SaveSearch(ctx context.Context, name, query string) (search *domain.SavedSearch, err error) {
+	ctx, span := tracing.Start(ctx, "SearchService.SaveSearch")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return nil, err
+	}
+	name, query = strings.TrimSpace(name), strings.TrimSpace(query)
+	if name == "" || utf8.RuneCountInString(name) > domain.MaxSavedSearchName || query == "" {
+		return nil, ErrInvalidSavedSearch
+	}
+	if _, err := parseSearch(user, query); err != nil {
+		return nil, err
+	}
+
+	search = &domain.SavedSearch{UserID: user.ID, Name: name, Query: query, CreatedAt: time.Now()}
+	if search.ID, err = s.searches.Create(ctx, search); err != nil {
+		return nil, err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "search saved", "search_id", search.ID, "user_id", user.ID)
+	return search, nil
+}
+
+// DeleteSavedSearch deletes one of the user's saved searches
+func (s *searchService) DeleteSavedSearch(ctx context.Context, id int64) (err error) {
+	ctx, span := tracing.Start(ctx, "SearchService.DeleteSavedSearch", attribute.Int64("search.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return err
+	}
+	search, err := s.searches.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if search == nil || search.UserID != user.ID {
+		return ErrSavedSearchNotFound
+	}
+	if err := s.searches.Delete(ctx, id); err != nil {
+		return err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "saved search deleted", "search_id", id, "user_id", user.ID)
+	return nil
+}
+
+// parseSearch parses a query with dates in the user's time zone
+func parseSearch(user *domain.User, query string) (*domain.SearchQuery, error) {
+	parsed, err := domain.ParseSearchQuery(query, time.Now().In(user.Location()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSearch, err)
+	}
+	return parsed, nil
+}
+
+// searchScope returns the owner whose notes the user searches, 0 for
+// users who may read every note
+func searchScope(user *domain.User) int64 {
+	if user.Can(domain.PermNotesReadAll) {
+		return 0
+	}
+	return user.ID
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrTemplateNotFound is returned when a note template is not found
+var ErrTemplateNotFound = errors.New("template not found")
+
+// ErrInvalidTemplate is returned when a template has no name or title, or
+// either is too long
+var ErrInvalidTemplate = fmt.Errorf("templates need a name of up to %d characters and a title", domain.MaxTemplateName)
+
+// TemplateService defines the interface for the note templates shared by
+// every user. Anyone who may create notes may list templates; changing them
+// needs the templates:manage permission. Notes are created from templates
+// with NoteService.CreateNoteFromTemplate.
+type TemplateService interface {
+	GetTemplates(ctx context.Context) ([]*domain.NoteTemplate, error)
+	GetTemplate(ctx context.Context, id int64) (*domain.NoteTemplate, error)
+	CreateTemplate(ctx context.Context, name, title, content string) (*domain.NoteTemplate, error)
+	UpdateTemplate(ctx context.Context, id int64, name, title, content string) (*domain.NoteTemplate, error)
+	DeleteTemplate(ctx context.Context, id int64) error
+}
+
+type templateService struct {
+	repo repositories.NoteTemplateRepository
+}
+
+// NewTemplateService creates a new template service
+func NewTemplateService(repo repositories.NoteTemplateRepository) TemplateService {
+	return &templateService{repo}
+}
+
+// GetTemplates returns every template ordered by name
+func (s *templateService) GetTemplates(ctx context.Context) (templates []*domain.NoteTemplate, err error) {
+	ctx, span := tracing.Start(ctx, "TemplateService.GetTemplates")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := authorize(ctx, domain.PermNotesWrite); err != nil {
+		return nil, err
+	}
+	return s.repo.FindAll(ctx)
+}
+
+// GetTemplate returns a template by ID
+func (s *templateService) GetTemplate(ctx context.Context, id int64) (tmpl *domain.NoteTemplate, err error) {
+	ctx, span := tracing.Start(ctx, "TemplateService.GetTemplate", attribute.Int64("template.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := authorize(ctx, domain.PermNotesWrite); err != nil {
+		return nil, err
+	}
+	return findTemplate(ctx, s.repo, id)
+}
+
+// CreateTemplate creates a template
+func (s *templateService) CreateTemplate(ctx context.Context, name, title, content string) (tmpl *domain.NoteTemplate, err error) {
+	ctx, span := tracing.Start(ctx, "TemplateService.CreateTemplate")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermTemplatesManage)
+	if err != nil {
+		return nil, err
+	}
+	name, title = strings.TrimSpace(name), strings.TrimSpace(title)
+	if !validTemplate(name, title) {
+		return nil, ErrInvalidTemplate
+	}
+
+	now := time.Now()
+	tmpl = &domain.NoteTemplate{Name: name, Title: title, Content: content, CreatedBy: user.ID, CreatedAt: now, UpdatedAt: now}
+	if tmpl.ID, err = s.repo.Create(ctx, tmpl); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int64("template.id", tmpl.ID))
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "template created", "template_id", tmpl.ID, "user_id", user.ID)
+	return tmpl, nil
+}
+
+// UpdateTemplate changes the name, title and content of a template
+func (s *templateService) UpdateTemplate(ctx context.Context, id int64, name, title, content string) (tmpl *domain.NoteTemplate, err error) {
+	ctx, span := tracing.Start(ctx, "TemplateService.UpdateTemplate", attribute.Int64("template.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermTemplatesManage)
+	if err != nil {
+		return nil, err
+	}
+	name, title = strings.TrimSpace(name), strings.TrimSpace(title)
+	if !validTemplate(name, title) {
+		return nil, ErrInvalidTemplate
+	}
+
+	tmpl, err = findTemplate(ctx, s.repo, id)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.Name, tmpl.Title, tmpl.Content, tmpl.UpdatedAt = name, title, content, time.Now()
+	if err := s.repo.Update(ctx, tmpl); err != nil {
+		return nil, err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "template updated", "template_id", id, "user_id", user.ID)
+	return tmpl, nil
+}
+
+// DeleteTemplate removes a template; notes created from it are kept
+func (s *templateService) DeleteTemplate(ctx context.Context, id int64) (err error) {
+	ctx, span := tracing.Start(ctx, "TemplateService.DeleteTemplate", attribute.Int64("template.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermTemplatesManage)
+	if err != nil {
+		return err
+	}
+	if _, err := findTemplate(ctx, s.repo, id); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "template deleted", "template_id", id, "user_id", user.ID)
+	return nil
+}
+
+// findTemplate returns a template, or ErrTemplateNotFound
+func findTemplate(ctx context.Context, repo repositories.NoteTemplateRepository, id int64) (*domain.NoteTemplate, error) {
+	tmpl, err := repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if tmpl == nil {
+		return nil, ErrTemplateNotFound
+	}
+	return tmpl, nil
+}
+
+// validTemplate reports whether name and title can be stored
+func validTemplate(name, title string) bool {
+	return name != "" && title != "" && utf8.RuneCountInString(name) <= domain.MaxTemplateName
+}
+
+// templateVariable matches a variable such as {{date}} or {{ user }}
+var templateVariable = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// expandTemplate replaces the variables in text with their values in vars,
+// leaving unknown ones as they are
+func expandTemplate(text string, vars map[string]string) string {
+	return templateVariable.ReplaceAllStringFunc(text, func(match string) string {
+		if value, ok := vars[templateVariable.FindStringSubmatch(match)[1]]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// templateValues returns the values of the variables in
+// domain.TemplateVariables for a note created by user at now
+func templateValues(user *domain.User, now time.Time, counter int64) map[string]string {
+	return map[string]string{
+		"date":    now.Format("2006-01-02"),
+		"time":    now.Format("15:04"),
+		"weekday": now.Weekday().String(),
+		"user":    user.Username,
+		"counter": strconv.FormatInt(counter, 10),
+	}
+}
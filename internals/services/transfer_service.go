@@ -0,0 +1,283 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/jobs"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Kinds of the jobs importing and exporting notes
+const (
+	ImportJob = "notes.import"
+	ExportJob = "notes.export"
+)
+
+// exportPageSize caps the exports listed on the import and export page
+const exportPageSize = 10
+
+// importBatchSize is the most notes an import creates in one transaction,
+// which bounds how long it holds the audit chain other note writes wait for
+const importBatchSize = 50
+
+var (
+	// ErrInvalidImport is returned for an import that is not a JSON array of
+	// notes with titles and dates that can be stored
+	ErrInvalidImport = errors.New("import must be a JSON array of notes with titles and dates between 1970 and 2037")
+	// ErrExportNotFound is returned when an export is not found
+	ErrExportNotFound = errors.New("export not found")
+)
+
+// TransferService imports and exports notes in the background. Queueing an
+// import needs the notes:write permission and everything else notes:read;
+// the jobs run as the user who queued them, with their permissions then.
+type TransferService interface {
+	// QueueImport checks that data is a JSON export, such as the export
+	// command writes, and queues a job creating its notes. It returns the
+	// number of notes queued.
+	QueueImport(ctx context.Context, data []byte) (int, error)
+	// QueueExport queues a job exporting the notes of the user
+	QueueExport(ctx context.Context) error
+	// GetExports returns the newest exports of the user, without their bodies
+	GetExports(ctx context.Context) ([]*domain.NoteExport, error)
+	// GetExport returns an export of the user with its body
+	GetExport(ctx context.Context, id int64) (*domain.NoteExport, error)
+	// Import and Export are the handlers of ImportJob and ExportJob
+	Import(ctx context.Context, payload []byte) error
+	Export(ctx context.Context, payload []byte) error
+}
+
+type transferService struct {
+	notes         NoteService
+	users         repositories.UserRepository
+	transfers     repositories.TransferRepository
+	notifications repositories.NotificationRepository
+	tx            repositories.Transactor
+	queue         *jobs.Queue
+}
+
+// NewTransferService creates a new transfer service queueing its jobs on
+// queue. notes creates and reads the notes; pass the decorated service so
+// imports are published and counted like any other change, once each batch
+// commits.
+func NewTransferService(notes NoteService, users repositories.UserRepository, transfers repositories.TransferRepository, notifications repositories.NotificationRepository, tx repositories.Transactor, queue *jobs.Queue) TransferService {
+	return &transferService{notes, users, transfers, notifications, tx, queue}
+}
+
+// importPayload is the payload of an ImportJob. The upload is stored apart
+// so the jobs page does not show it.
+type importPayload struct {
+	ImportID int64 `json:"import_id"`
+}
+
+// exportPayload is the payload of an ExportJob
+type exportPayload struct {
+	UserID int64 `json:"user_id"`
+}
+
+// QueueImport queues the import of data
+func (s *transferService) QueueImport(ctx context.Context, data []byte) (count int, err error) {
+	ctx, span := tracing.Start(ctx, "TransferService.QueueImport")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesWrite)
+	if err != nil {
+		return 0, err
+	}
+	notes, err := decodeImport(data)
+	if err != nil {
+		return 0, err
+	}
+
+	importID, err := s.transfers.CreateImport(ctx, &domain.NoteImport{UserID: user.ID, Body: data, CreatedAt: time.Now()})
+	if err != nil {
+		return 0, err
+	}
+	id, err := s.queue.Enqueue(ctx, ImportJob, importPayload{ImportID: importID})
+	if err != nil {
+		return 0, err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "import queued", "job_id", id, "notes", len(notes), "user_id", user.ID)
+	return len(notes), nil
+}
+
+// decodeImport returns the notes of a JSON export, each with a title and a
+// schedule CreateNote accepts, so an import fails before creating any note
+func decodeImport(data []byte) ([]domain.Note, error) {
+	var notes []domain.Note
+	if err := json.Unmarshal(data, &notes); err != nil || len(notes) == 0 {
+		return nil, ErrInvalidImport
+	}
+	for _, note := range notes {
+		if strings.TrimSpace(note.Title) == "" {
+			return nil, ErrInvalidImport
+		}
+		if _, _, err := storedSchedule(note.DueAt, note.RemindAt); err != nil {
+			return nil, ErrInvalidImport
+		}
+	}
+	return notes, nil
+}
+
+// QueueExport queues an export of the user's notes
+func (s *transferService) QueueExport(ctx context.Context) (err error) {
+	ctx, span := tracing.Start(ctx, "TransferService.QueueExport")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return err
+	}
+	id, err := s.queue.Enqueue(ctx, ExportJob, exportPayload{UserID: user.ID})
+	if err != nil {
+		return err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "export queued", "job_id", id, "user_id", user.ID)
+	return nil
+}
+
+// GetExports returns the newest exports of the user
+func (s *transferService) GetExports(ctx context.Context) (exports []*domain.NoteExport, err error) {
+	ctx, span := tracing.Start(ctx, "TransferService.GetExports")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return nil, err
+	}
+	return s.transfers.FindExports(ctx, user.ID, exportPageSize)
+}
+
+// GetExport returns an export of the user
+func (s *transferService) GetExport(ctx context.Context, id int64) (export *domain.NoteExport, err error) {
+	ctx, span := tracing.Start(ctx, "TransferService.GetExport", attribute.Int64("export.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermNotesRead)
+	if err != nil {
+		return nil, err
+	}
+	export, err = s.transfers.FindExport(ctx, user.ID, id)
+	if err != nil {
+		return nil, err
+	}
+	if export == nil {
+		return nil, ErrExportNotFound
+	}
+	return export, nil
+}
+
+// Import creates the notes of an ImportJob in batches of importBatchSize,
+// recording with each batch how many notes exist so that a retry resumes
+// after the last committed batch, and deletes the upload once all do
+func (s *transferService) Import(ctx context.Context, payload []byte) error {
+	var job importPayload
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return jobs.Permanent(fmt.Errorf("decoding import job: %w", err))
+	}
+	upload, err := s.transfers.FindImport(ctx, job.ImportID)
+	if err != nil || upload == nil {
+		return err
+	}
+	notes, err := decodeImport(upload.Body)
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	ctx, err = s.runAs(ctx, upload.UserID)
+	if err != nil {
+		return err
+	}
+
+	for start := upload.Imported; start < len(notes); start += importBatchSize {
+		end := min(start+importBatchSize, len(notes))
+		err = s.tx.InTx(ctx, func(ctx context.Context) error {
+			for i, note := range notes[start:end] {
+				if _, err := s.notes.CreateNote(ctx, note.Title, note.Content, note.DueAt, note.RemindAt); err != nil {
+					return fmt.Errorf("note %d (%q): %w", start+i+1, note.Title, err)
+				}
+			}
+			return s.transfers.SetImported(ctx, upload.ID, end)
+		})
+		if errors.Is(err, ErrForbidden) {
+			return jobs.Permanent(fmt.Errorf("imported %d of %d notes: %w", start, len(notes), err))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.transfers.DeleteImport(ctx, upload.ID); err != nil {
+		return err
+	}
+	return s.notify(ctx, upload.UserID, fmt.Sprintf("Imported %d notes", len(notes)))
+}
+
+// Export stores the notes the user of an ExportJob can read as a JSON array
+// formatted like the export command's
+func (s *transferService) Export(ctx context.Context, payload []byte) error {
+	var job exportPayload
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return jobs.Permanent(fmt.Errorf("decoding export job: %w", err))
+	}
+	ctx, err := s.runAs(ctx, job.UserID)
+	if err != nil {
+		return err
+	}
+
+	notes, err := s.notes.GetAllNotes(ctx)
+	if errors.Is(err, ErrForbidden) {
+		return jobs.Permanent(err)
+	}
+	if err != nil {
+		return err
+	}
+	if notes == nil {
+		notes = []*domain.Note{}
+	}
+	body, err := json.MarshalIndent(notes, "", "  ")
+	if err != nil {
+		return jobs.Permanent(err)
+	}
+	if _, err := s.transfers.CreateExport(ctx, &domain.NoteExport{
+		UserID:    job.UserID,
+		Notes:     len(notes),
+		Body:      append(body, '\n'),
+		CreatedAt: time.Now(),
+	}); err != nil {
+		return err
+	}
+	return s.notify(ctx, job.UserID, fmt.Sprintf("Your export of %d notes is ready under Import and export", len(notes)))
+}
+
+// runAs returns ctx signed in as the user with userID, failing for good
+// once they no longer exist
+func (s *transferService) runAs(ctx context.Context, userID int64) (context.Context, error) {
+	user, err := s.users.FindByID(ctx, userID)
+	if err != nil {
+		return ctx, err
+	}
+	if user == nil {
+		return ctx, jobs.Permanent(fmt.Errorf("user %d no longer exists", userID))
+	}
+	return auth.WithUser(ctx, user), nil
+}
+
+// notify tells the user the job finished
+func (s *transferService) notify(ctx context.Context, userID int64, message string) error {
+	_, err := s.notifications.Create(ctx, &domain.Notification{
+		UserID:    userID,
+		Message:   utils.Truncate(message, domain.MaxNotificationMessage),
+		CreatedAt: time.Now(),
+	})
+	return err
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrInvalidCredentials is returned when a login does not match any user
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// ErrUserNotFound is returned when a user is not found
+var ErrUserNotFound = errors.New("user not found")
+
+// ErrUsernameTaken is returned when creating a user whose username exists
+var ErrUsernameTaken = errors.New("username is already taken")
+
+// ErrInvalidUser is returned when a username or password is unacceptable
+var ErrInvalidUser = errors.New("username is required and passwords need at least 8 characters")
+
+// ErrInvalidRole is returned for a role that does not exist
+var ErrInvalidRole = errors.New("invalid role")
+
+// ErrOwnRole is returned when an admin tries to change their own role, which
+// could leave nobody able to manage users
+var ErrOwnRole = errors.New("you cannot change your own role")
+
+// ErrInvalidEmail is returned for an email address that cannot be mailed
+var ErrInvalidEmail = errors.New("invalid email address")
+
+// minPasswordLength is the shortest password accepted
+const minPasswordLength = 8
+
+// ErrInvalidTimezone is returned for a time zone name that is not in the
+// IANA database
+var ErrInvalidTimezone = errors.New("unknown time zone")
+
+// dummyHash is compared against when a username does not exist so that
+// failed logins take the same time either way
+const dummyHash = "$2a$10$oWhLMqkacO463b9O8m18S.Mb/tiI3YdJr0ycRfVwMbK/8hvb1Ge7."
+
+// UserService defines the interface for accounts, logins and roles.
+// Managing users requires the users:manage permission.
+type UserService interface {
+	Login(ctx context.Context, username, password string) (token string, user *domain.User, err error)
+	Logout(ctx context.Context, token string) error
+	UserForSession(ctx context.Context, token string) (*domain.User, error)
+	GetAllUsers(ctx context.Context) ([]*domain.User, error)
+	CreateUser(ctx context.Context, username, password string, role domain.Role) (*domain.User, error)
+	SetRole(ctx context.Context, id int64, role domain.Role) (*domain.User, error)
+	// UpdateAccount changes the email address reminders are sent to and
+	// the time zone dates are shown in for the signed in user, saving
+	// neither unless both are valid. An empty address stops emails, an
+	// empty time zone uses the server's.
+	UpdateAccount(ctx context.Context, email, timezone string) (*domain.User, error)
+}
+
+type userService struct {
+	users      repositories.UserRepository
+	sessions   repositories.SessionRepository
+	sessionTTL time.Duration
+}
+
+// NewUserService creates a new user service whose sessions last sessionTTL
+func NewUserService(users repositories.UserRepository, sessions repositories.SessionRepository, sessionTTL time.Duration) UserService {
+	return &userService{users, sessions, sessionTTL}
+}
+
+// Login checks a username and password and starts a session, returning its token
+func (s *userService) Login(ctx context.Context, username, password string) (token string, user *domain.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Login")
+	defer func() { tracing.End(span, err) }()
+
+	user, err = s.users.FindByUsername(ctx, strings.TrimSpace(username))
+	if err != nil {
+		return "", nil, err
+	}
+	if user == nil {
+		auth.CheckPassword(dummyHash, password)
+		return "", nil, ErrInvalidCredentials
+	}
+	if !auth.CheckPassword(user.PasswordHash, password) {
+		return "", nil, ErrInvalidCredentials
+	}
+
+	token, err = auth.NewToken()
+	if err != nil {
+		return "", nil, err
+	}
+	now := time.Now()
+	if err := s.sessions.Create(ctx, auth.HashToken(token), user.ID, now.Add(s.sessionTTL)); err != nil {
+		return "", nil, err
+	}
+	// Expired sessions are only ever read as missing, so clearing them is best effort
+	if err := s.sessions.DeleteExpired(ctx, now); err != nil {
+		utils.LoggerFromContext(ctx).WarnContext(ctx, "deleting expired sessions failed", "error", err)
+	}
+
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "user logged in", "user_id", user.ID)
+	return token, user, nil
+}
+
+// Logout ends the session identified by token
+func (s *userService) Logout(ctx context.Context, token string) (err error) {
+	ctx, span := tracing.Start(ctx, "UserService.Logout")
+	defer func() { tracing.End(span, err) }()
+
+	return s.sessions.Delete(ctx, auth.HashToken(token))
+}
+
+// UserForSession returns the user of an unexpired session, or nil
+func (s *userService) UserForSession(ctx context.Context, token string) (user *domain.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.UserForSession")
+	defer func() { tracing.End(span, err) }()
+
+	return s.sessions.FindUser(ctx, auth.HashToken(token), time.Now())
+}
+
+// GetAllUsers returns every user
+func (s *userService) GetAllUsers(ctx context.Context) (users []*domain.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.GetAllUsers")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := authorize(ctx, domain.PermUsersManage); err != nil {
+		return nil, err
+	}
+	return s.users.FindAll(ctx)
+}
+
+// CreateUser creates a user with a role
+func (s *userService) CreateUser(ctx context.Context, username, password string, role domain.Role) (user *domain.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.CreateUser")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := authorize(ctx, domain.PermUsersManage); err != nil {
+		return nil, err
+	}
+	username = strings.TrimSpace(username)
+	if username == "" || len(password) < minPasswordLength {
+		return nil, ErrInvalidUser
+	}
+	if !role.Valid() {
+		return nil, ErrInvalidRole
+	}
+
+	existing, err := s.users.FindByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrUsernameTaken
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	user = &domain.User{Username: username, PasswordHash: hash, Role: role, CreatedAt: time.Now()}
+	if user.ID, err = s.users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int64("user.id", user.ID))
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "user created", "user_id", user.ID, "role", role)
+	return user, nil
+}
+
+// SetRole assigns a role to a user other than the caller
+func (s *userService) SetRole(ctx context.Context, id int64, role domain.Role) (user *domain.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.SetRole", attribute.Int64("user.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	admin, err := authorize(ctx, domain.PermUsersManage)
+	if err != nil {
+		return nil, err
+	}
+	if !role.Valid() {
+		return nil, ErrInvalidRole
+	}
+	if admin.ID == id {
+		return nil, ErrOwnRole
+	}
+
+	user, err = s.users.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if err := s.users.UpdateRole(ctx, id, role); err != nil {
+		return nil, err
+	}
+	user.Role = role
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "user role changed", "user_id", id, "role", role, "by", admin.ID)
+	return user, nil
+}
+
+// UpdateAccount changes the email address and time zone of the signed in user
+func (s *userService) UpdateAccount(ctx context.Context, email, timezone string) (user *domain.User, err error) {
+	ctx, span := tracing.Start(ctx, "UserService.UpdateAccount")
+	defer func() { tracing.End(span, err) }()
+
+	user = auth.UserFromContext(ctx)
+	if user == nil {
+		return nil, ErrUnauthenticated
+	}
+	email = strings.TrimSpace(email)
+	if email != "" {
+		addr, err := mail.ParseAddress(email)
+		if err != nil || addr.Address != email || len(email) > domain.MaxEmailLength {
+			return nil, ErrInvalidEmail
+		}
+	}
+	timezone = strings.TrimSpace(timezone)
+	if timezone != "" {
+		// LoadLocation also accepts "Local", which is the server's zone
+		if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" || len(timezone) > domain.MaxTimezoneLength {
+			return nil, ErrInvalidTimezone
+		}
+	}
+
+	if err := s.users.UpdateAccount(ctx, user.ID, email, timezone); err != nil {
+		return nil, err
+	}
+	updated := *user
+	updated.Email = email
+	updated.Timezone = timezone
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "user account changed", "user_id", user.ID, "timezone", timezone)
+	return &updated, nil
+}
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+type webhookNoteService struct {
+	NoteService
+	webhooks WebhookService
+}
+
+// NewWebhookNoteService wraps svc so that successful mutations are published
+// to webhooks, once the transaction they are part of commits. The change is
+// saved by then, so a failure to queue the deliveries is logged rather than
+// returned.
+func NewWebhookNoteService(svc NoteService, webhooks WebhookService) NoteService {
+	return wrap(svc, &webhookNoteService{svc, webhooks})
+}
+
+func (s *webhookNoteService) wrappedBy(outer NoteService) {
+	wrap(s.NoteService, outer)
+}
+
+// deletedNote is the payload of note.deleted, whose note no longer exists
+type deletedNote struct {
+	ID int64 `json:"id"`
+}
+
+// CreateNote creates a new note
+func (s *webhookNoteService) CreateNote(ctx context.Context, title, content string, dueAt, remindAt time.Time) (*domain.Note, error) {
+	note, err := s.NoteService.CreateNote(ctx, title, content, dueAt, remindAt)
+	if err == nil {
+		s.publish(ctx, domain.WebhookNoteCreated, note.ID, note)
+	}
+	return note, err
+}
+
+// CreateNoteFromTemplate creates a note from a template
+func (s *webhookNoteService) CreateNoteFromTemplate(ctx context.Context, templateID int64, title, content string, dueAt, remindAt time.Time) (*domain.Note, error) {
+	note, err := s.NoteService.CreateNoteFromTemplate(ctx, templateID, title, content, dueAt, remindAt)
+	if err == nil {
+		s.publish(ctx, domain.WebhookNoteCreated, note.ID, note)
+	}
+	return note, err
+}
+
+// OpenJournal returns a journal entry, creating it if needed
+func (s *webhookNoteService) OpenJournal(ctx context.Context, date time.Time) (*domain.Note, bool, error) {
+	note, created, err := s.NoteService.OpenJournal(ctx, date)
+	if created {
+		s.publish(ctx, domain.WebhookNoteCreated, note.ID, note)
+	}
+	return note, created, err
+}
+
+// UpdateNote updates an existing note
+func (s *webhookNoteService) UpdateNote(ctx context.Context, id int64, title, content string) (*domain.Note, error) {
+	note, err := s.NoteService.UpdateNote(ctx, id, title, content)
+	if err == nil {
+		s.publish(ctx, domain.WebhookNoteUpdated, id, note)
+	}
+	return note, err
+}
+
+// ScheduleNote sets the due date and reminder time of a note
+func (s *webhookNoteService) ScheduleNote(ctx context.Context, id int64, dueAt, remindAt time.Time) (*domain.Note, error) {
+	note, err := s.NoteService.ScheduleNote(ctx, id, dueAt, remindAt)
+	if err == nil {
+		s.publish(ctx, domain.WebhookNoteUpdated, id, note)
+	}
+	return note, err
+}
+
+// DeleteNote deletes a note
+func (s *webhookNoteService) DeleteNote(ctx context.Context, id int64) error {
+	err := s.NoteService.DeleteNote(ctx, id)
+	if err == nil {
+		s.publish(ctx, domain.WebhookNoteDeleted, id, deletedNote{id})
+	}
+	return err
+}
+
+// publish queues event after the change commits, logging a failure
+func (s *webhookNoteService) publish(ctx context.Context, event domain.WebhookEvent, id int64, note any) {
+	repositories.AfterCommit(ctx, func(ctx context.Context) {
+		if err := s.webhooks.Publish(ctx, event, note); err != nil {
+			utils.LoggerFromContext(ctx).ErrorContext(ctx, "webhook event not queued", "event", event, "note_id", id, "error", err)
+		}
+	})
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"github.com/mas-diq/htmx-basic-crud/internals/webhooks"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrWebhookNotFound is returned when a webhook is not found
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// ErrDeliveryNotFound is returned when a webhook delivery is not found
+var ErrDeliveryNotFound = errors.New("delivery not found")
+
+// ErrInvalidWebhook is returned when a webhook has no http(s) URL or no known events
+var ErrInvalidWebhook = errors.New("webhooks need an http or https URL and at least one event")
+
+// deliveryBatchSize is the number of deliveries DeliverDue sends at once
+const deliveryBatchSize = 10
+
+// deliveryLease is how long a claimed delivery is hidden from other workers.
+// It outlasts a batch of attempts, so a delivery is only retried early if
+// its worker died.
+const deliveryLease = 5 * time.Minute
+
+// WebhookService defines the interface for webhook subscriptions and their
+// deliveries. Managing them needs the webhooks:manage permission; Publish
+// and DeliverDue run on behalf of the application and check nothing.
+type WebhookService interface {
+	GetWebhooks(ctx context.Context) ([]*domain.Webhook, error)
+	GetWebhook(ctx context.Context, id int64) (*domain.Webhook, error)
+	// CreateWebhook subscribes rawURL to events with a new random secret
+	CreateWebhook(ctx context.Context, rawURL string, events []domain.WebhookEvent) (*domain.Webhook, error)
+	DeleteWebhook(ctx context.Context, id int64) error
+	// GetDeliveries returns the newest deliveries of a webhook
+	GetDeliveries(ctx context.Context, id int64, limit int) ([]*domain.WebhookDelivery, error)
+	// Redeliver queues a copy of a delivery to be sent again
+	Redeliver(ctx context.Context, deliveryID int64) (*domain.WebhookDelivery, error)
+
+	// Publish queues event about note for every webhook subscribed to it
+	Publish(ctx context.Context, event domain.WebhookEvent, note any) error
+	// DeliverDue sends a batch of due deliveries and returns how many it attempted
+	DeliverDue(ctx context.Context) (int, error)
+}
+
+type webhookService struct {
+	repo         repositories.WebhookRepository
+	client       *webhooks.Client
+	maxAttempts  int
+	retryBackoff time.Duration
+}
+
+// NewWebhookService creates a new webhook service. Deliveries failing
+// maxAttempts times are marked failed; the first retry waits retryBackoff
+// and every further one twice as long as the one before.
+func NewWebhookService(repo repositories.WebhookRepository, client *webhooks.Client, maxAttempts int, retryBackoff time.Duration) WebhookService {
+	return &webhookService{repo, client, maxAttempts, retryBackoff}
+}
+
+// GetWebhooks returns every webhook
+func (s *webhookService) GetWebhooks(ctx context.Context) (hooks []*domain.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetWebhooks")
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := authorize(ctx, domain.PermWebhooksManage); err != nil {
+		return nil, err
+	}
+	return s.repo.FindAll(ctx)
+}
+
+// GetWebhook returns a webhook by ID
+func (s *webhookService) GetWebhook(ctx context.Context, id int64) (hook *domain.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetWebhook", attribute.Int64("webhook.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := authorize(ctx, domain.PermWebhooksManage); err != nil {
+		return nil, err
+	}
+	return s.findWebhook(ctx, id)
+}
+
+// CreateWebhook subscribes a URL to events
+func (s *webhookService) CreateWebhook(ctx context.Context, rawURL string, events []domain.WebhookEvent) (hook *domain.Webhook, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.CreateWebhook")
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermWebhooksManage)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidWebhook
+	}
+	if len(events) == 0 || slices.ContainsFunc(events, func(e domain.WebhookEvent) bool { return !e.Valid() }) {
+		return nil, ErrInvalidWebhook
+	}
+
+	secret, err := auth.NewToken()
+	if err != nil {
+		return nil, err
+	}
+	hook = &domain.Webhook{
+		URL:       u.String(),
+		Secret:    secret,
+		Events:    slices.Compact(slices.Sorted(slices.Values(events))),
+		CreatedAt: time.Now(),
+	}
+	if hook.ID, err = s.repo.Create(ctx, hook); err != nil {
+		return nil, err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "webhook created", "webhook_id", hook.ID, "user_id", user.ID)
+	return hook, nil
+}
+
+// DeleteWebhook removes a webhook with its deliveries
+func (s *webhookService) DeleteWebhook(ctx context.Context, id int64) (err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.DeleteWebhook", attribute.Int64("webhook.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermWebhooksManage)
+	if err != nil {
+		return err
+	}
+	if _, err := s.findWebhook(ctx, id); err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "webhook deleted", "webhook_id", id, "user_id", user.ID)
+	return nil
+}
+
+// GetDeliveries returns the newest deliveries of a webhook
+func (s *webhookService) GetDeliveries(ctx context.Context, id int64, limit int) (deliveries []*domain.WebhookDelivery, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.GetDeliveries", attribute.Int64("webhook.id", id))
+	defer func() { tracing.End(span, err) }()
+
+	if _, err := authorize(ctx, domain.PermWebhooksManage); err != nil {
+		return nil, err
+	}
+	if _, err := s.findWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.FindDeliveries(ctx, id, limit)
+}
+
+// Redeliver queues a copy of a delivery, keeping the original as it was so
+// the log shows every attempt
+func (s *webhookService) Redeliver(ctx context.Context, deliveryID int64) (delivery *domain.WebhookDelivery, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.Redeliver", attribute.Int64("delivery.id", deliveryID))
+	defer func() { tracing.End(span, err) }()
+
+	user, err := authorize(ctx, domain.PermWebhooksManage)
+	if err != nil {
+		return nil, err
+	}
+	original, err := s.repo.FindDelivery(ctx, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	if original == nil {
+		return nil, ErrDeliveryNotFound
+	}
+
+	delivery, err = s.queue(ctx, original.WebhookID, original.Event, original.Payload)
+	if err != nil {
+		return nil, err
+	}
+	utils.LoggerFromContext(ctx).InfoContext(ctx, "webhook delivery requeued",
+		"delivery_id", delivery.ID, "original_id", deliveryID, "user_id", user.ID)
+	return delivery, nil
+}
+
+// webhookPayload is the JSON body of a delivery
+type webhookPayload struct {
+	Event      domain.WebhookEvent `json:"event"`
+	OccurredAt time.Time           `json:"occurred_at"`
+	Actor      *webhookActor       `json:"actor,omitempty"`
+	Note       any                 `json:"note"`
+}
+
+// webhookActor is the user who caused an event
+type webhookActor struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// Publish queues event for every subscribed webhook. The payload is built
+// once, so every webhook receives the same body.
+func (s *webhookService) Publish(ctx context.Context, event domain.WebhookEvent, note any) (err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.Publish", attribute.String("webhook.event", string(event)))
+	defer func() { tracing.End(span, err) }()
+
+	hooks, err := s.repo.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+	hooks = slices.DeleteFunc(hooks, func(h *domain.Webhook) bool { return !h.Subscribes(event) })
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	payload := webhookPayload{Event: event, OccurredAt: time.Now().UTC(), Note: note}
+	if user := auth.UserFromContext(ctx); user != nil {
+		payload.Actor = &webhookActor{ID: user.ID, Username: user.Username}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, hook := range hooks {
+		if _, err := s.queue(ctx, hook.ID, event, body); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DeliverDue claims the due deliveries and attempts each of them once
+func (s *webhookService) DeliverDue(ctx context.Context) (n int, err error) {
+	ctx, span := tracing.Start(ctx, "WebhookService.DeliverDue")
+	defer func() { tracing.End(span, err) }()
+
+	deliveries, err := s.repo.ClaimDeliveries(ctx, time.Now(), deliveryLease, deliveryBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	hooks := map[int64]*domain.Webhook{}
+	var errs []error
+	for _, delivery := range deliveries {
+		hook, ok := hooks[delivery.WebhookID]
+		if !ok {
+			if hook, err = s.repo.FindByID(ctx, delivery.WebhookID); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			hooks[delivery.WebhookID] = hook
+		}
+		// A webhook deleted since the claim takes its deliveries with it
+		if hook == nil {
+			continue
+		}
+		if err := s.attempt(ctx, hook, delivery); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	span.SetAttributes(attribute.Int("webhook.deliveries", len(deliveries)))
+	return len(deliveries), errors.Join(errs...)
+}
+
+// attempt sends a delivery and saves the outcome: succeeded, pending for a
+// retry after the backoff, or failed once it has run out of attempts
+func (s *webhookService) attempt(ctx context.Context, hook *domain.Webhook, delivery *domain.WebhookDelivery) error {
+	code, sendErr := s.client.Send(ctx, webhooks.Request{
+		URL:        hook.URL,
+		Secret:     hook.Secret,
+		Event:      string(delivery.Event),
+		DeliveryID: delivery.ID,
+		Body:       delivery.Payload,
+	})
+
+	now := time.Now()
+	delivery.Attempts++
+	delivery.ResponseCode = code
+	delivery.UpdatedAt = now
+	delivery.Error = ""
+	switch {
+	case sendErr == nil:
+		delivery.Status = domain.DeliverySucceeded
+	case delivery.Attempts >= s.maxAttempts:
+		delivery.Status = domain.DeliveryFailed
+	default:
+		delivery.Status = domain.DeliveryPending
+		delivery.NextAttemptAt = now.Add(webhooks.Backoff(delivery.Attempts, s.retryBackoff))
+	}
+	if sendErr != nil {
+		delivery.Error = utils.Truncate(sendErr.Error(), domain.MaxDeliveryError)
+		utils.LoggerFromContext(ctx).WarnContext(ctx, "webhook delivery attempt failed",
+			"delivery_id", delivery.ID, "webhook_id", hook.ID, "attempts", delivery.Attempts,
+			"status", delivery.Status, "error", sendErr)
+	}
+	return s.repo.UpdateDelivery(ctx, delivery)
+}
+
+// queue stores a pending delivery due now
+func (s *webhookService) queue(ctx context.Context, webhookID int64, event domain.WebhookEvent, payload []byte) (*domain.WebhookDelivery, error) {
+	now := time.Now()
+	delivery := &domain.WebhookDelivery{
+		WebhookID:     webhookID,
+		Event:         event,
+		Payload:       payload,
+		Status:        domain.DeliveryPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	id, err := s.repo.CreateDelivery(ctx, delivery)
+	if err != nil {
+		return nil, err
+	}
+	delivery.ID = id
+	return delivery, nil
+}
+
+// findWebhook returns a webhook or ErrWebhookNotFound
+func (s *webhookService) findWebhook(ctx context.Context, id int64) (*domain.Webhook, error) {
+	hook, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if hook == nil {
+		return nil, ErrWebhookNotFound
+	}
+	return hook, nil
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AssetPrefix is the URL path static assets are served under
+const AssetPrefix = "/static/"
+
+// Assets serves static files under content-hashed URLs, e.g.
+// /static/css/styles.3f2a1b9c0d.css, so they can be cached forever and are
+// refetched as soon as their content changes.
+//
+// In dev mode files are read from disk on every request and served under
+// their plain names without caching, so edits show up on reload.
+type Assets struct {
+	fsys   fs.FS
+	dev    bool
+	hashed map[string]string // plain name -> hashed name
+	plain  map[string]string // hashed name -> plain name
+	etags  map[string]string // plain name -> ETag
+	sri    map[string]string // plain name -> subresource integrity hash
+}
+
+// NewAssets indexes every file in fsys. With dev set, nothing is hashed.
+func NewAssets(fsys fs.FS, dev bool) (*Assets, error) {
+	a := &Assets{
+		fsys:   fsys,
+		dev:    dev,
+		hashed: make(map[string]string),
+		plain:  make(map[string]string),
+		etags:  make(map[string]string),
+		sri:    make(map[string]string),
+	}
+	if dev {
+		return a, nil
+	}
+
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])[:10]
+
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "." + hash + ext
+		a.hashed[name] = hashed
+		a.plain[hashed] = name
+		a.etags[name] = `"` + hash + `"`
+		a.sri[name] = integrity(data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Path returns the URL of the asset name, e.g. "css/styles.css"
+func (a *Assets) Path(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if hashed, ok := a.hashed[name]; ok {
+		return AssetPrefix + hashed
+	}
+	return AssetPrefix + name
+}
+
+// Integrity returns the subresource integrity hash of the asset name for
+// the integrity attribute of script and link tags, or "" if it does not exist
+func (a *Assets) Integrity(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if !a.dev {
+		return a.sri[name]
+	}
+	data, err := fs.ReadFile(a.fsys, name)
+	if err != nil {
+		return ""
+	}
+	return integrity(data)
+}
+
+// FuncMap exposes Path and Integrity to templates as
+// {{ asset "js/app.js" }} and {{ integrity "js/app.js" }}
+func (a *Assets) FuncMap() template.FuncMap {
+	return template.FuncMap{"asset": a.Path, "integrity": a.Integrity}
+}
+
+// integrity formats the SHA-384 digest of data as an integrity attribute value
+func integrity(data []byte) string {
+	sum := sha512.Sum384(data)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Serve is a gin handler for AssetPrefix + "*filepath".
+// Hashed URLs are immutable; plain URLs are revalidated on every use.
+func (a *Assets) Serve(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("filepath"), "/")
+
+	if plain, ok := a.plain[name]; ok {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+		c.Header("ETag", a.etags[plain])
+		http.ServeFileFS(c.Writer, c.Request, a.fsys, plain)
+		return
+	}
+
+	if !fs.ValidPath(name) {
+		NotFound(c)
+		return
+	}
+	info, err := fs.Stat(a.fsys, name)
+	if err != nil || info.IsDir() {
+		NotFound(c)
+		return
+	}
+	c.Header("Cache-Control", "no-cache")
+	if etag, ok := a.etags[name]; ok {
+		c.Header("ETag", etag)
+	}
+	http.ServeFileFS(c.Writer, c.Request, a.fsys, name)
+}
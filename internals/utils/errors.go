@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+)
+
+// StatusClientClosedRequest is the non-standard status recorded when the
+// client went away before the response was ready
+const StatusClientClosedRequest = 499
+
+// HTTPError is an error that knows which HTTP status and message it should be
+// rendered with. Handlers attach it to the gin context with c.Error and the
+// error middleware turns it into a response.
+type HTTPError struct {
+	Status  int
+	Message string
+	Err     error
+}
+
+// Error implements the error interface
+func (e *HTTPError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the underlying cause
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// Title returns the standard status text for the error status
+func (e *HTTPError) Title() string {
+	if e.Status == StatusClientClosedRequest {
+		return "Client Closed Request"
+	}
+	return http.StatusText(e.Status)
+}
+
+// NewHTTPError creates a new HTTP error
+func NewHTTPError(status int, message string, err error) *HTTPError {
+	return &HTTPError{Status: status, Message: message, Err: err}
+}
+
+// NewNotFoundError creates a 404 error
+func NewNotFoundError(message string) *HTTPError {
+	return NewHTTPError(http.StatusNotFound, message, nil)
+}
+
+// NewBadRequestError creates a 400 error
+func NewBadRequestError(message string) *HTTPError {
+	return NewHTTPError(http.StatusBadRequest, message, nil)
+}
+
+// NewUnauthorizedError creates a 401 error
+func NewUnauthorizedError(message string) *HTTPError {
+	return NewHTTPError(http.StatusUnauthorized, message, nil)
+}
+
+// NewForbiddenError creates a 403 error
+func NewForbiddenError(message string) *HTTPError {
+	return NewHTTPError(http.StatusForbidden, message, nil)
+}
+
+// NewTooManyRequestsError creates a 429 error
+func NewTooManyRequestsError(message string) *HTTPError {
+	return NewHTTPError(http.StatusTooManyRequests, message, nil)
+}
+
+// NewInternalError creates a 500 error wrapping the given cause
+func NewInternalError(message string, err error) *HTTPError {
+	return NewHTTPError(http.StatusInternalServerError, message, err)
+}
+
+// AsHTTPError converts any error into an HTTP error.
+// Errors that are not HTTP errors are reported as 500s without leaking their message.
+func AsHTTPError(err error) *HTTPError {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+	return NewInternalError("Something went wrong", err)
+}
@@ -0,0 +1,23 @@
+package utils
+
+import "context"
+
+type requestInfoKey struct{}
+
+// RequestInfo describes the HTTP request a context belongs to
+type RequestInfo struct {
+	ID       string
+	ClientIP string
+}
+
+// WithRequestInfo returns a copy of ctx carrying info
+func WithRequestInfo(ctx context.Context, info RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFromContext returns the info stored by WithRequestInfo, empty
+// outside HTTP requests
+func RequestInfoFromContext(ctx context.Context) RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(RequestInfo)
+	return info
+}
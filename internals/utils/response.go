@@ -1,11 +1,15 @@
 package utils
 
 import (
+	"encoding/json"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
+// MIMEProblemJSON is the media type for RFC 7807 problem details
+const MIMEProblemJSON = "application/problem+json"
+
 // Response represents a standard API response
 type Response struct {
 	Success bool        `json:"success"`
@@ -13,6 +17,15 @@ type Response struct {
 	Data    interface{} `json:"data,omitempty"`
 }
 
+// Problem represents an RFC 7807 problem details response
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
 // SuccessResponse returns a success response
 func SuccessResponse(c *gin.Context, status int, message string, data interface{}) {
 	c.JSON(status, Response{
@@ -30,22 +43,133 @@ func ErrorResponse(c *gin.Context, status int, message string) {
 	})
 }
 
+// viewDataKey is the context key of the values added to every template
+const viewDataKey = "viewData"
+
+// SetViewData makes value available as .key to every template rendered for
+// this request, e.g. the CSRF token set by a middleware
+func SetViewData(c *gin.Context, key string, value any) {
+	data, _ := c.Get(viewDataKey)
+	values, ok := data.(gin.H)
+	if !ok {
+		values = gin.H{}
+		c.Set(viewDataKey, values)
+	}
+	values[key] = value
+}
+
+// withViewData merges the values set with SetViewData into data
+func withViewData(c *gin.Context, data gin.H) gin.H {
+	values, ok := c.Get(viewDataKey)
+	if !ok {
+		return data
+	}
+	merged := gin.H{}
+	for k, v := range values.(gin.H) {
+		merged[k] = v
+	}
+	for k, v := range data {
+		merged[k] = v
+	}
+	return merged
+}
+
 // HTMLResponse renders an HTML template
 func HTMLResponse(c *gin.Context, status int, template string, data gin.H) {
-	c.HTML(status, template, data)
+	c.HTML(status, template, withViewData(c, data))
+}
+
+// IsHTMXRequest reports whether the request was issued by HTMX
+func IsHTMXRequest(c *gin.Context) bool {
+	return c.GetHeader("HX-Request") == "true"
+}
+
+// IsHTTPS reports whether the request reached us, or the proxy in front of
+// us, over TLS
+func IsHTTPS(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+// RenderError writes err in the format the client asked for:
+// a toast fragment for HTMX requests, an HTML page for browser navigations
+// and problem+json for everything else.
+func RenderError(c *gin.Context, err *HTTPError) {
+	if IsHTMXRequest(c) {
+		// HTMX does not swap error responses into its original target,
+		// so point it at the toast container instead.
+		c.Header("HX-Retarget", "#toast-container")
+		c.Header("HX-Reswap", "beforeend")
+		HTMLResponse(c, err.Status, "partials/error_toast.html", gin.H{
+			"status":  err.Status,
+			"message": err.Message,
+		})
+		return
+	}
+
+	switch c.NegotiateFormat(MIMEProblemJSON, gin.MIMEJSON, gin.MIMEHTML) {
+	case gin.MIMEHTML:
+		HTMLResponse(c, err.Status, "errors/error.html", gin.H{
+			"title":   err.Title(),
+			"status":  err.Status,
+			"message": err.Message,
+		})
+	default:
+		c.Render(err.Status, problemRender{Problem{
+			Type:     "about:blank",
+			Title:    err.Title(),
+			Status:   err.Status,
+			Detail:   err.Message,
+			Instance: c.Request.URL.Path,
+		}})
+	}
+}
+
+// abortWithError records err on the context so the error middleware renders it
+func abortWithError(c *gin.Context, err *HTTPError) {
+	_ = c.Error(err)
+	c.Abort()
 }
 
 // NotFound returns a 404 response
 func NotFound(c *gin.Context) {
-	ErrorResponse(c, http.StatusNotFound, "Resource not found")
+	abortWithError(c, NewNotFoundError("Resource not found"))
 }
 
 // BadRequest returns a 400 response
 func BadRequest(c *gin.Context, message string) {
-	ErrorResponse(c, http.StatusBadRequest, message)
+	abortWithError(c, NewBadRequestError(message))
+}
+
+// Unauthorized returns a 401 response
+func Unauthorized(c *gin.Context, message string) {
+	abortWithError(c, NewUnauthorizedError(message))
+}
+
+// Forbidden returns a 403 response
+func Forbidden(c *gin.Context, message string) {
+	abortWithError(c, NewForbiddenError(message))
+}
+
+// TooManyRequests returns a 429 response
+func TooManyRequests(c *gin.Context, message string) {
+	abortWithError(c, NewTooManyRequestsError(message))
 }
 
 // InternalServerError returns a 500 response
-func InternalServerError(c *gin.Context, message string) {
-	ErrorResponse(c, http.StatusInternalServerError, message)
+func InternalServerError(c *gin.Context, message string, err error) {
+	abortWithError(c, NewInternalError(message, err))
+}
+
+// problemRender renders a Problem with the problem+json content type
+type problemRender struct {
+	problem Problem
+}
+
+func (r problemRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return json.NewEncoder(w).Encode(r.problem)
+}
+
+func (r problemRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", MIMEProblemJSON+"; charset=utf-8")
 }
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin/render"
+)
+
+// TemplateRenderer is a gin HTML renderer that wraps every page template in
+// the layouts found under layouts/. Templates under partials/ are rendered on
+// their own so they can be returned as HTMX fragments.
+type TemplateRenderer struct {
+	fsys      fs.FS
+	funcs     template.FuncMap
+	reload    bool
+	templates map[string]*template.Template
+}
+
+// NewTemplateRenderer parses every template found in fsys once, making funcs
+// available to them. Templates are looked up by their path, e.g. "notes/index.html".
+func NewTemplateRenderer(fsys fs.FS, funcs template.FuncMap) (*TemplateRenderer, error) {
+	templates, err := parseTemplates(fsys, funcs)
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateRenderer{fsys: fsys, funcs: funcs, templates: templates}, nil
+}
+
+// NewReloadingTemplateRenderer is like NewTemplateRenderer but parses the
+// templates again on every render so edits show up without a restart; for
+// development only
+func NewReloadingTemplateRenderer(fsys fs.FS, funcs template.FuncMap) (*TemplateRenderer, error) {
+	r, err := NewTemplateRenderer(fsys, funcs)
+	if err != nil {
+		return nil, err
+	}
+	r.reload = true
+	return r, nil
+}
+
+// Instance implements render.HTMLRender
+func (r *TemplateRenderer) Instance(name string, data any) render.Render {
+	templates := r.templates
+	if r.reload {
+		var err error
+		if templates, err = parseTemplates(r.fsys, r.funcs); err != nil {
+			return brokenTemplate{err}
+		}
+	}
+
+	tmpl, ok := templates[name]
+	if !ok || tmpl == nil {
+		return brokenTemplate{fmt.Errorf("html/template: %q is undefined", name)}
+	}
+	return render.HTML{Template: tmpl, Data: data}
+}
+
+// parseTemplates parses every page and partial in fsys keyed by its path
+func parseTemplates(fsys fs.FS, funcs template.FuncMap) (map[string]*template.Template, error) {
+	layouts, err := fs.Glob(fsys, "layouts/*.html")
+	if err != nil {
+		return nil, err
+	}
+	partials, err := fs.Glob(fsys, "partials/*.html")
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make(map[string]*template.Template)
+
+	for _, name := range partials {
+		tmpl, err := template.New(path.Base(name)).Funcs(funcs).ParseFS(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		templates[name] = tmpl
+	}
+
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(name) != ".html" ||
+			strings.HasPrefix(name, "layouts/") || strings.HasPrefix(name, "partials/") {
+			return nil
+		}
+
+		patterns := append(append([]string{}, layouts...), partials...)
+		patterns = append(patterns, name)
+		tmpl, err := template.New("base.html").Funcs(funcs).ParseFS(fsys, patterns...)
+		if err != nil {
+			return err
+		}
+		templates[name] = tmpl.Lookup("base.html")
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+// brokenTemplate is returned for unknown or unparsable templates so that the
+// error surfaces through gin instead of a nil pointer panic
+type brokenTemplate struct {
+	err error
+}
+
+func (b brokenTemplate) Render(http.ResponseWriter) error {
+	return b.err
+}
+
+func (b brokenTemplate) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+}
@@ -0,0 +1,23 @@
+-- Share grants give another user read or edit access to a note
+CREATE TABLE IF NOT EXISTS note_shares (
+    note_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    permission VARCHAR(8) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (note_id, user_id),
+    INDEX idx_note_shares_user_id (user_id),
+    CONSTRAINT fk_note_shares_note FOREIGN KEY (note_id) REFERENCES notes (id) ON DELETE CASCADE,
+    CONSTRAINT fk_note_shares_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- Public read-only links are looked up by the SHA-256 of their token
+CREATE TABLE IF NOT EXISTS share_links (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    note_id BIGINT NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NULL,
+    expires_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_share_links_note_id (note_id),
+    CONSTRAINT fk_share_links_note FOREIGN KEY (note_id) REFERENCES notes (id) ON DELETE CASCADE
+);
@@ -0,0 +1,28 @@
+-- Append-only log of note mutations; the application never updates or
+-- deletes rows, and each hash chains to the previous one
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    actor_id BIGINT NULL,
+    actor VARCHAR(64) NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    note_id BIGINT NOT NULL,
+    before_hash CHAR(64) NOT NULL DEFAULT '',
+    after_hash CHAR(64) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    request_id VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP(6) NOT NULL,
+    prev_hash CHAR(64) NOT NULL DEFAULT '',
+    hash CHAR(64) NOT NULL,
+    INDEX idx_audit_events_created_at (created_at),
+    INDEX idx_audit_events_note_id (note_id),
+    INDEX idx_audit_events_actor (actor)
+);
+
+-- Holds the hash of the newest event. Appends lock its single row, which
+-- orders concurrent writers and lets verification detect a truncated log.
+CREATE TABLE IF NOT EXISTS audit_chain (
+    id TINYINT PRIMARY KEY,
+    hash CHAR(64) NOT NULL DEFAULT ''
+);
+
+INSERT IGNORE INTO audit_chain (id, hash) VALUES (1, '');
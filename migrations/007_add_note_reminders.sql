@@ -0,0 +1,24 @@
+-- Optional due date and reminder time of a note. reminded_at is set once the
+-- reminder has fired and cleared when remind_at changes.
+ALTER TABLE notes
+    ADD COLUMN due_at TIMESTAMP NULL,
+    ADD COLUMN remind_at TIMESTAMP NULL,
+    ADD COLUMN reminded_at TIMESTAMP NULL,
+    ADD INDEX idx_notes_due_at (due_at),
+    ADD INDEX idx_notes_remind_at (remind_at, reminded_at);
+
+-- Reminders are also emailed to users who set an address
+ALTER TABLE users
+    ADD COLUMN email VARCHAR(255) NOT NULL DEFAULT '' AFTER username;
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    note_id BIGINT NULL,
+    message VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    read_at TIMESTAMP NULL,
+    INDEX idx_notifications_user (user_id, read_at, id),
+    CONSTRAINT fk_notifications_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    CONSTRAINT fk_notifications_note FOREIGN KEY (note_id) REFERENCES notes (id) ON DELETE CASCADE
+);
@@ -0,0 +1,14 @@
+-- Skeletons new notes can start from. counter numbers the notes created
+-- from a template and is bumped every time one is.
+CREATE TABLE IF NOT EXISTS note_templates (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    counter BIGINT NOT NULL DEFAULT 0,
+    created_by BIGINT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    INDEX idx_note_templates_name (name),
+    CONSTRAINT fk_note_templates_user FOREIGN KEY (created_by) REFERENCES users (id) ON DELETE SET NULL
+);
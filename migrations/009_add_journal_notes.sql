@@ -0,0 +1,9 @@
+-- Daily journal notes. A note with a journal_date is its owner's entry for
+-- that day, and each user has at most one entry a day.
+ALTER TABLE notes
+    ADD COLUMN journal_date DATE NULL,
+    ADD UNIQUE INDEX uq_notes_journal_date (user_id, journal_date);
+
+-- Journal days start at midnight in the user's time zone, the server's when empty
+ALTER TABLE users
+    ADD COLUMN timezone VARCHAR(64) NOT NULL DEFAULT '' AFTER email;
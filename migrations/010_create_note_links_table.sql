@@ -0,0 +1,16 @@
+-- [[Title]] links between notes, rebuilt whenever a note is saved. target_id
+-- is the note the link resolves to and NULL while the link is broken.
+CREATE TABLE IF NOT EXISTS note_links (
+    source_id BIGINT NOT NULL,
+    target_title VARCHAR(255) NOT NULL,
+    target_id BIGINT NULL,
+    PRIMARY KEY (source_id, target_title),
+    INDEX idx_note_links_target_id (target_id),
+    INDEX idx_note_links_target_title (target_title),
+    CONSTRAINT fk_note_links_source FOREIGN KEY (source_id) REFERENCES notes (id) ON DELETE CASCADE,
+    CONSTRAINT fk_note_links_target FOREIGN KEY (target_id) REFERENCES notes (id) ON DELETE SET NULL
+);
+
+-- Links resolve by title among the notes of one owner
+ALTER TABLE notes
+    ADD INDEX idx_notes_user_title (user_id, title);
@@ -0,0 +1,10 @@
+-- Note searches users saved under a name to rerun from the notes page
+CREATE TABLE IF NOT EXISTS saved_searches (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    query VARCHAR(500) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_saved_searches_user_name (user_id, name),
+    CONSTRAINT fk_saved_searches_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+-- The timeline, calendar and date filters select notes by created or
+-- updated time, per owner and across every owner for admins
+ALTER TABLE notes
+    ADD INDEX idx_notes_user_created_at (user_id, created_at),
+    ADD INDEX idx_notes_user_updated_at (user_id, updated_at),
+    ADD INDEX idx_notes_created_at (created_at),
+    ADD INDEX idx_notes_updated_at (updated_at);
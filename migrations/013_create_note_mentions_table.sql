@@ -0,0 +1,13 @@
+-- Mentions of notes in the content of others, which the graph is drawn
+-- from, rebuilt whenever a note is saved. via is 'url' for the note's
+-- /notes/:id URL and 'title' for its exact title, matched among the notes
+-- of the mentioning note's owner.
+CREATE TABLE IF NOT EXISTS note_mentions (
+    source_id BIGINT NOT NULL,
+    target_id BIGINT NOT NULL,
+    via VARCHAR(5) NOT NULL,
+    PRIMARY KEY (source_id, target_id),
+    INDEX idx_note_mentions_target_id (target_id),
+    CONSTRAINT fk_note_mentions_source FOREIGN KEY (source_id) REFERENCES notes (id) ON DELETE CASCADE,
+    CONSTRAINT fk_note_mentions_target FOREIGN KEY (target_id) REFERENCES notes (id) ON DELETE CASCADE
+);
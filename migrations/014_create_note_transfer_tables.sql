@@ -0,0 +1,23 @@
+-- Uploaded JSON exports waiting for the notes.import job to create their
+-- notes, deleted once it has. The job commits the notes in batches and
+-- records in imported how many it has created, where a retry resumes.
+CREATE TABLE IF NOT EXISTS note_imports (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    body MEDIUMTEXT NOT NULL,
+    imported INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_note_imports_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- JSON exports of notes written by the notes.export job, kept for the user
+-- who asked for them to download
+CREATE TABLE IF NOT EXISTS note_exports (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    notes INT NOT NULL,
+    body MEDIUMTEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_note_exports_user (user_id, id),
+    CONSTRAINT fk_note_exports_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
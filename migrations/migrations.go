@@ -0,0 +1,122 @@
+// Package migrations embeds the SQL migrations and applies them in order.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// Migration is a single numbered SQL file
+type Migration struct {
+	Name    string
+	Applied bool
+}
+
+// createVersionTable records which migrations have been applied
+const createVersionTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    name VARCHAR(255) PRIMARY KEY,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
+
+// Status lists every migration and whether it has been applied
+func Status(ctx context.Context, db *sql.DB) ([]Migration, error) {
+	if _, err := db.ExecContext(ctx, createVersionTable); err != nil {
+		return nil, err
+	}
+
+	applied := map[string]bool{}
+	rows, err := db.QueryContext(ctx, `SELECT name FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		applied[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	names, err := fs.Glob(files, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+
+	migrations := make([]Migration, 0, len(names))
+	for _, name := range names {
+		migrations = append(migrations, Migration{Name: name, Applied: applied[name]})
+	}
+	return migrations, nil
+}
+
+// Up applies every pending migration in name order and returns their names
+func Up(ctx context.Context, db *sql.DB) ([]string, error) {
+	migrations, err := Status(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []string
+	for _, m := range migrations {
+		if m.Applied {
+			continue
+		}
+		if err := apply(ctx, db, m.Name); err != nil {
+			return applied, fmt.Errorf("migration %s: %w", m.Name, err)
+		}
+		applied = append(applied, m.Name)
+	}
+	return applied, nil
+}
+
+// apply runs the statements of one migration and records it.
+// MySQL commits DDL implicitly, so statements are not wrapped in a transaction.
+func apply(ctx context.Context, db *sql.DB, name string) error {
+	data, err := files.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range Statements(string(data)) {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO schema_migrations (name) VALUES (?)`, name)
+	return err
+}
+
+// Statements splits a SQL script into statements terminated by a semicolon
+// at the end of a line, dropping "--" comment lines
+func Statements(script string) []string {
+	var stmts []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
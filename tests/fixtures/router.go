@@ -0,0 +1,35 @@
+// Package fixtures holds the fixtures shared by the unit and integration tests
+package fixtures
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/middlewares"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"github.com/mas-diq/htmx-basic-crud/web"
+)
+
+// NewRouter returns a router rendering pages and errors as the server does,
+// signing every request in as user unless it is nil. Tests register their
+// own routes and middlewares on it.
+func NewRouter(t testing.TB, user *domain.User) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	assets, err := utils.NewAssets(web.Static, false)
+	if err != nil {
+		t.Fatalf("Failed to load assets: %v", err)
+	}
+	renderer, err := utils.NewTemplateRenderer(web.Templates, assets.FuncMap())
+	if err != nil {
+		t.Fatalf("Failed to load templates: %v", err)
+	}
+	r.HTMLRender = renderer
+	r.Use(middlewares.ErrorMiddleware())
+	if user != nil {
+		r.Use(func(c *gin.Context) { middlewares.SetUser(c, user) })
+	}
+	return r
+}
@@ -5,14 +5,18 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
 	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
 	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
 	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
 )
 
 // Setup test database connection
@@ -27,24 +31,28 @@ func setupTestDB(t *testing.T) *sql.DB {
 		t.Fatalf("Failed to ping test database: %v", err)
 	}
 
-	// Clear test database
-	_, err = db.Exec("TRUNCATE TABLE notes")
+	// Clear test database. Notes are referenced by shares and links, which
+	// MySQL refuses to truncate, so delete them and let those cascade.
+	_, err = db.Exec("DELETE FROM notes")
 	if err != nil {
-		t.Fatalf("Failed to truncate notes table: %v", err)
+		t.Fatalf("Failed to clear notes table: %v", err)
 	}
 
 	return db
 }
 
 // Setup Gin router for testing
-func setupRouter(db *sql.DB) *gin.Engine {
-	gin.SetMode(gin.TestMode)
-	r := gin.Default()
-	r.LoadHTMLGlob("../../web/templates/**/*")
-
-	noteRepo := repositories.NewNoteRepository(db)
-	noteService := services.NewNoteService(noteRepo)
-	noteHandler := handlers.NewNoteHandler(noteService)
+func setupRouter(t *testing.T, db *sql.DB) *gin.Engine {
+	r := fixtures.NewRouter(t, auth.System)
+
+	noteRepo := repositories.NewNoteRepository(db, 5*time.Second)
+	shareRepo := repositories.NewShareRepository(db, 5*time.Second)
+	userRepo := repositories.NewUserRepository(db, 5*time.Second)
+	auditRepo := repositories.NewAuditRepository(db, 5*time.Second)
+	templateRepo := repositories.NewNoteTemplateRepository(db, 5*time.Second)
+	noteService := services.NewNoteService(noteRepo, shareRepo, userRepo, auditRepo, templateRepo, repositories.NewLinkRepository(db, 5*time.Second), repositories.NewTransactor(db))
+	searchService := services.NewSearchService(noteRepo, repositories.NewSavedSearchRepository(db, 5*time.Second))
+	noteHandler := handlers.NewNoteHandler(noteService, services.NewTemplateService(templateRepo), searchService, "http://localhost:8080")
 
 	r.GET("/notes", noteHandler.Index)
 	r.POST("/notes", noteHandler.Create)
@@ -63,7 +71,7 @@ func TestCreateNoteIntegration(t *testing.T) {
 
 	db := setupTestDB(t)
 	defer db.Close()
-	router := setupRouter(db)
+	router := setupRouter(t, db)
 
 	// Create a new note
 	form := url.Values{}
@@ -104,7 +112,7 @@ func TestGetNoteIntegration(t *testing.T) {
 
 	db := setupTestDB(t)
 	defer db.Close()
-	router := setupRouter(db)
+	router := setupRouter(t, db)
 
 	// First create a note
 	_, err := db.Exec("INSERT INTO notes (title, content) VALUES (?, ?)", "Test Note", "Test Content")
@@ -120,7 +128,7 @@ func TestGetNoteIntegration(t *testing.T) {
 	}
 
 	// Request the note
-	req, _ := http.NewRequest("GET", "/notes/"+string(id), nil)
+	req, _ := http.NewRequest("GET", "/notes/"+strconv.FormatInt(id, 10), nil)
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
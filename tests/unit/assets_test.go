@@ -0,0 +1,204 @@
+package unit
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/middlewares"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"github.com/mas-diq/htmx-basic-crud/web"
+)
+
+// Setup a router serving assets and rendering page.html with the asset func
+func setupAssetsRouter(t *testing.T, assets *utils.Assets, templates fstest.MapFS, reload bool) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	newRenderer := utils.NewTemplateRenderer
+	if reload {
+		newRenderer = utils.NewReloadingTemplateRenderer
+	}
+	renderer, err := newRenderer(templates, assets.FuncMap())
+	if err != nil {
+		t.Fatalf("Failed to load templates: %v", err)
+	}
+	r.HTMLRender = renderer
+	r.Use(middlewares.ErrorMiddleware())
+
+	r.GET(utils.AssetPrefix+"*filepath", assets.Serve)
+	r.GET("/page", func(c *gin.Context) {
+		c.HTML(http.StatusOK, "page.html", nil)
+	})
+	return r
+}
+
+func get(router *gin.Engine, url string, header map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", url, nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAssetsHashedURLsAreImmutable(t *testing.T) {
+	assets, err := utils.NewAssets(web.Static, false)
+	if err != nil {
+		t.Fatalf("Failed to load assets: %v", err)
+	}
+	templates := fstest.MapFS{
+		"layouts/base.html": {Data: []byte(`{{ template "content" . }}`)},
+		"page.html":         {Data: []byte(`{{ define "content" }}{{ asset "css/styles.css" }}{{ end }}`)},
+	}
+	router := setupAssetsRouter(t, assets, templates, false)
+
+	url := get(router, "/page", nil).Body.String()
+	if !regexp.MustCompile(`^/static/css/styles\.[0-9a-f]{10}\.css$`).MatchString(url) {
+		t.Fatalf("Expected a hashed asset URL, got %q", url)
+	}
+
+	w := get(router, url, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Header().Get("Cache-Control"), "immutable") {
+		t.Errorf("Expected an immutable cache header, got %q", w.Header().Get("Cache-Control"))
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/css") {
+		t.Errorf("Expected a CSS content type, got %q", w.Header().Get("Content-Type"))
+	}
+
+	if w := get(router, url, map[string]string{"If-None-Match": w.Header().Get("ETag")}); w.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d for a matching ETag, got %d", http.StatusNotModified, w.Code)
+	}
+
+	// Plain names still work but must be revalidated
+	w = get(router, "/static/css/styles.css", nil)
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Expected a revalidated plain asset, got %d %q", w.Code, w.Header().Get("Cache-Control"))
+	}
+
+	for _, url := range []string{"/static/css", "/static/missing.js", "/static/../web.go"} {
+		if w := get(router, url, nil); w.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusNotFound, url, w.Code)
+		}
+	}
+}
+
+func TestAssetsDevModeReloads(t *testing.T) {
+	static := fstest.MapFS{"js/app.js": {Data: []byte("v1")}}
+	assets, err := utils.NewAssets(static, true)
+	if err != nil {
+		t.Fatalf("Failed to load assets: %v", err)
+	}
+	templates := fstest.MapFS{
+		"layouts/base.html": {Data: []byte(`{{ template "content" . }}`)},
+		"page.html":         {Data: []byte(`{{ define "content" }}{{ asset "js/app.js" }}{{ end }}`)},
+	}
+	router := setupAssetsRouter(t, assets, templates, true)
+
+	if body := get(router, "/page", nil).Body.String(); body != "/static/js/app.js" {
+		t.Errorf("Expected an unhashed URL in dev mode, got %q", body)
+	}
+
+	// Edits are picked up without restarting
+	static["js/app.js"] = &fstest.MapFile{Data: []byte("v2")}
+	templates["page.html"] = &fstest.MapFile{Data: []byte(`{{ define "content" }}edited{{ end }}`)}
+
+	if body := get(router, "/static/js/app.js", nil).Body.String(); body != "v2" {
+		t.Errorf("Expected the edited asset, got %q", body)
+	}
+	if body := get(router, "/page", nil).Body.String(); body != "edited" {
+		t.Errorf("Expected the edited template, got %q", body)
+	}
+}
+
+func TestAssetsIntegrity(t *testing.T) {
+	data := []byte("console.log('hi')")
+	sum := sha512.Sum384(data)
+	expected := "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+
+	for _, dev := range []bool{false, true} {
+		assets, err := utils.NewAssets(fstest.MapFS{"js/app.js": {Data: data}}, dev)
+		if err != nil {
+			t.Fatalf("Failed to load assets: %v", err)
+		}
+		if got := assets.Integrity("js/app.js"); got != expected {
+			t.Errorf("Expected integrity %q with dev=%v, got %q", expected, dev, got)
+		}
+		if got := assets.Integrity("js/missing.js"); got != "" {
+			t.Errorf("Expected no integrity for a missing asset, got %q", got)
+		}
+	}
+}
+
+func TestLayoutLoadsOnlyLocalScripts(t *testing.T) {
+	assets, err := utils.NewAssets(web.Static, false)
+	if err != nil {
+		t.Fatalf("Failed to load assets: %v", err)
+	}
+	layout, err := fs.ReadFile(web.Templates, "layouts/base.html")
+	if err != nil {
+		t.Fatalf("Failed to read layout: %v", err)
+	}
+	templates := fstest.MapFS{
+		"layouts/base.html": {Data: layout},
+		"page.html":         {Data: []byte(`{{ define "content" }}{{ end }}`)},
+	}
+	router := setupAssetsRouter(t, assets, templates, false)
+	body := get(router, "/page", nil).Body.String()
+
+	tags := regexp.MustCompile(`<(script|link)\b[^>]*>`).FindAllString(body, -1)
+	if len(tags) == 0 {
+		t.Fatal("Expected the layout to load scripts and stylesheets")
+	}
+	for _, tag := range tags {
+		if regexp.MustCompile(`(src|href)="(https?:)?//`).MatchString(tag) {
+			t.Errorf("Expected only local assets, got %s", tag)
+		}
+		if !strings.Contains(tag, "integrity=") {
+			t.Errorf("Expected an integrity attribute on %s", tag)
+		}
+	}
+	if !strings.Contains(body, assets.Integrity("vendor/htmx.min.js")) {
+		t.Error("Expected the vendored htmx to be loaded with its integrity hash")
+	}
+}
+
+func TestLayoutAssetsAreEmbedded(t *testing.T) {
+	assets, err := utils.NewAssets(web.Static, false)
+	if err != nil {
+		t.Fatalf("Failed to load assets: %v", err)
+	}
+	layout, err := fs.ReadFile(web.Templates, "layouts/base.html")
+	if err != nil {
+		t.Fatalf("Failed to read layout: %v", err)
+	}
+
+	names := regexp.MustCompile(`\{\{ asset "([^"]+)" \}\}`).FindAllStringSubmatch(string(layout), -1)
+	if len(names) == 0 {
+		t.Fatal("Expected the layout to load assets")
+	}
+	for _, name := range names {
+		// Generated assets are missing until `npm run build` ran and its output was committed
+		if _, err := fs.Stat(web.Static, name[1]); err != nil {
+			t.Errorf("Expected %s to be committed to web/static, got %v", name[1], err)
+			continue
+		}
+		if !strings.Contains(string(layout), `integrity="{{ integrity "`+name[1]+`" }}"`) {
+			t.Errorf("Expected %s to be loaded with its integrity hash", name[1])
+		}
+		if !strings.HasPrefix(assets.Integrity(name[1]), "sha384-") {
+			t.Errorf("Expected an integrity hash for %s", name[1])
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package unit
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+)
+
+// Mock audit repository chaining events in memory like the database does
+type mockAuditRepository struct {
+	events []*domain.AuditEvent
+	head   string
+	// err fails every append
+	err error
+}
+
+func (m *mockAuditRepository) Append(ctx context.Context, event *domain.AuditEvent) error {
+	if m.err != nil {
+		return m.err
+	}
+	event.ID = int64(len(m.events) + 1)
+	event.PrevHash = m.head
+	event.Hash = event.ChainHash(m.head)
+	m.head = event.Hash
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *mockAuditRepository) Find(ctx context.Context, filter domain.AuditFilter) ([]*domain.AuditEvent, error) {
+	var events []*domain.AuditEvent
+	for i := len(m.events) - 1; i >= 0; i-- {
+		e := m.events[i]
+		if (filter.Actor == "" || e.Actor == filter.Actor) && (filter.Action == "" || e.Action == filter.Action) &&
+			(filter.NoteID == 0 || e.NoteID == filter.NoteID) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (m *mockAuditRepository) Walk(ctx context.Context, fn func(*domain.AuditEvent) error) (string, error) {
+	for _, e := range m.events {
+		if err := fn(e); err != nil {
+			return "", err
+		}
+	}
+	return m.head, nil
+}
+
+// Mock transactor counting the units of work committed and rolled back
+type mockTransactor struct {
+	committed, rolledBack int
+}
+
+func (m *mockTransactor) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	txCtx, committed := repositories.WithAfterCommit(ctx)
+	if err := fn(txCtx); err != nil {
+		m.rolledBack++
+		return err
+	}
+	m.committed++
+	committed()
+	return nil
+}
+
+// Create a note service recording into audits, with one note created,
+// updated and deleted by the editor during request "req-1" from 10.0.0.9
+func setupAudit(t *testing.T) (*mockAuditRepository, services.AuditService) {
+	audits := &mockAuditRepository{}
+	repo := newMockRepository()
+	service := services.NewNoteService(repo, newMockShareRepository(repo), newMockUserRepository(), audits, newMockTemplateRepository(), newMockLinkRepository(), &mockTransactor{})
+	ctx := utils.WithRequestInfo(userContext(editorUser), utils.RequestInfo{ID: "req-1", ClientIP: "10.0.0.9"})
+
+	note, err := service.CreateNote(ctx, "Title", "Content", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Error creating note: %v", err)
+	}
+	if _, err := service.UpdateNote(ctx, note.ID, "Title", "Changed"); err != nil {
+		t.Fatalf("Error updating note: %v", err)
+	}
+	if err := service.DeleteNote(ctx, note.ID); err != nil {
+		t.Fatalf("Error deleting note: %v", err)
+	}
+	return audits, services.NewAuditService(audits)
+}
+
+func TestNoteServiceRecordsAuditEvents(t *testing.T) {
+	audits, _ := setupAudit(t)
+
+	if len(audits.events) != 3 {
+		t.Fatalf("Expected 3 audit events, got %d", len(audits.events))
+	}
+	created, updated, deleted := audits.events[0], audits.events[1], audits.events[2]
+	for i, action := range []domain.AuditAction{domain.AuditNoteCreated, domain.AuditNoteUpdated, domain.AuditNoteDeleted} {
+		e := audits.events[i]
+		if e.Action != action || e.Actor != "editor" || e.ActorID != editorUser.ID || e.NoteID != created.NoteID {
+			t.Errorf("Event %d: expected %s by editor, got %+v", i, action, e)
+		}
+		if e.IP != "10.0.0.9" || e.RequestID != "req-1" || e.CreatedAt.IsZero() {
+			t.Errorf("Event %d: expected the request details, got %+v", i, e)
+		}
+	}
+
+	if created.BeforeHash != "" || created.AfterHash == "" {
+		t.Errorf("Expected a created note to only have an after hash, got %+v", created)
+	}
+	if updated.BeforeHash != created.AfterHash || updated.AfterHash == updated.BeforeHash {
+		t.Errorf("Expected the update to chain the note hashes, got %+v", updated)
+	}
+	if deleted.BeforeHash != updated.AfterHash || deleted.AfterHash != "" {
+		t.Errorf("Expected a deleted note to only have a before hash, got %+v", deleted)
+	}
+}
+
+func TestAuditFailureRollsBackChange(t *testing.T) {
+	repo := newMockRepository()
+	audits := &mockAuditRepository{}
+	tx := &mockTransactor{}
+	service := services.NewNoteService(repo, newMockShareRepository(repo), newMockUserRepository(), audits, newMockTemplateRepository(), newMockLinkRepository(), tx)
+	ctx := userContext(editorUser)
+
+	note, err := service.CreateNote(ctx, "Title", "Content", time.Time{}, time.Time{})
+	if err != nil || tx.committed != 1 {
+		t.Fatalf("Expected the note and its event to be committed together, got %v", err)
+	}
+
+	audits.err = errors.New("audit log unavailable")
+	if _, err := service.UpdateNote(ctx, note.ID, "Title", "Changed"); !errors.Is(err, audits.err) {
+		t.Errorf("Expected the update to fail with the audit log, got %v", err)
+	}
+	if err := service.DeleteNote(ctx, note.ID); !errors.Is(err, audits.err) {
+		t.Errorf("Expected the delete to fail with the audit log, got %v", err)
+	}
+	if tx.rolledBack != 2 {
+		t.Errorf("Expected both changes to be rolled back, got %d", tx.rolledBack)
+	}
+}
+
+func TestAuditVerifyDetectsTampering(t *testing.T) {
+	admin := userContext(adminUser)
+
+	audits, service := setupAudit(t)
+	if report, err := service.Verify(admin); err != nil || !report.OK() || report.Events != 3 {
+		t.Fatalf("Expected an intact chain of 3 events, got %+v %v", report, err)
+	}
+	if _, err := service.Verify(userContext(editorUser)); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected only admins to verify, got %v", err)
+	}
+
+	audits.events[1].Actor = "someone else"
+	if report, _ := service.Verify(admin); report.OK() || report.BrokenAt != 2 {
+		t.Errorf("Expected an edited event to break the chain at 2, got %+v", report)
+	}
+
+	audits, service = setupAudit(t)
+	audits.events = append(audits.events[:1], audits.events[2:]...)
+	if report, _ := service.Verify(admin); report.OK() || report.BrokenAt != 3 {
+		t.Errorf("Expected a removed event to break the chain at 3, got %+v", report)
+	}
+
+	audits, service = setupAudit(t)
+	audits.events = audits.events[:2]
+	if report, _ := service.Verify(admin); report.OK() || report.BrokenAt != 0 {
+		t.Errorf("Expected removing the newest event to be detected, got %+v", report)
+	}
+}
+
+func TestAuditPageFiltersAndExports(t *testing.T) {
+	audits, service := setupAudit(t)
+	audits.events[0].Actor = "=HYPERLINK(\"http://evil.example\")"
+
+	r := fixtures.NewRouter(t, nil)
+	adminHandler := handlers.NewAdminHandler(nil, service)
+	r.GET("/admin/audit", signIn(adminUser), adminHandler.Audit)
+	r.GET("/admin/audit.csv", signIn(adminUser), adminHandler.AuditCSV)
+	r.GET("/editor/audit", signIn(editorUser), adminHandler.Audit)
+
+	body := serve(r, "GET", "/admin/audit?action=note.updated", nil, false).Body.String()
+	if !strings.Contains(body, `id="audit-2"`) || strings.Contains(body, `id="audit-1"`) {
+		t.Errorf("Expected only the update to be listed:\n%s", body)
+	}
+	if !strings.Contains(body, `href="/admin/audit.csv?action=note.updated"`) {
+		t.Errorf("Expected the export link to keep the filters:\n%s", body)
+	}
+	if w := serve(r, "GET", "/admin/audit?from=yesterday", nil, false); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid date to be rejected, got %d", w.Code)
+	}
+	if w := serve(r, "GET", "/editor/audit", nil, false); w.Code != http.StatusForbidden {
+		t.Errorf("Expected editors to be refused, got %d", w.Code)
+	}
+
+	w := serve(r, "GET", "/admin/audit.csv", nil, false)
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Errorf("Expected a CSV download, got %q", w.Header().Get("Content-Type"))
+	}
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Error reading CSV: %v", err)
+	}
+	if len(records) != 4 || records[0][0] != "id" || records[3][4] != "note.created" {
+		t.Fatalf("Expected a header and 3 events newest first, got %v", records)
+	}
+	if !strings.HasPrefix(records[3][3], "'=") {
+		t.Errorf("Expected formula-like cells to be escaped, got %q", records[3][3])
+	}
+}
@@ -0,0 +1,150 @@
+package unit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mas-diq/htmx-basic-crud/internals/configs"
+)
+
+// Write content to name inside a temporary directory and return its path
+func writeTempFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestConfigDefaults(t *testing.T) {
+	cfg, err := configs.LoadWithEnv("", filepath.Join(t.TempDir(), ".env"), nil)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	if cfg.Server.Addr != ":8080" {
+		t.Errorf("Expected default addr :8080, got %q", cfg.Server.Addr)
+	}
+	if cfg.Database.QueryTimeout != 5*time.Second {
+		t.Errorf("Expected default query timeout 5s, got %v", cfg.Database.QueryTimeout)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	file := writeTempFile(t, "config.yaml", `
+server:
+  addr: ":9000"
+  read_timeout: 3s
+database:
+  host: file-host
+  name: file-db
+  max_open_conns: 50
+log:
+  level: debug
+`)
+	envFile := writeTempFile(t, ".env", "DB_HOST=dotenv-host\nDB_NAME=dotenv-db\n")
+	env := map[string]string{"DB_NAME": "env-db"}
+
+	cfg, err := configs.LoadWithEnv(file, envFile, env)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	// File overrides defaults
+	if cfg.Server.Addr != ":9000" || cfg.Server.ReadTimeout != 3*time.Second || cfg.Database.MaxOpenConns != 50 {
+		t.Errorf("Expected file values, got %+v", cfg.Server)
+	}
+	// .env overrides the file
+	if cfg.Database.Host != "dotenv-host" {
+		t.Errorf("Expected .env to override the file, got %q", cfg.Database.Host)
+	}
+	// The environment overrides .env
+	if cfg.Database.Name != "env-db" {
+		t.Errorf("Expected the environment to override .env, got %q", cfg.Database.Name)
+	}
+	// Untouched values keep their defaults
+	if cfg.Database.Port != 3306 {
+		t.Errorf("Expected default port, got %d", cfg.Database.Port)
+	}
+}
+
+func TestConfigTOMLFile(t *testing.T) {
+	file := writeTempFile(t, "config.toml", `
+[server]
+addr = "127.0.0.1:9001"
+shutdown_timeout = "45s"
+
+[features]
+metrics = false
+`)
+
+	cfg, err := configs.LoadWithEnv(file, filepath.Join(t.TempDir(), ".env"), nil)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if cfg.Server.Addr != "127.0.0.1:9001" || cfg.Server.ShutdownTimeout != 45*time.Second {
+		t.Errorf("Unexpected server config %+v", cfg.Server)
+	}
+	if cfg.Features.Metrics {
+		t.Error("Expected metrics to be disabled")
+	}
+}
+
+func TestConfigValidationListsEveryError(t *testing.T) {
+	file := writeTempFile(t, "config.yaml", "server:\n  adress: \":80\"\n")
+	env := map[string]string{
+		"DB_PORT":           "not-a-port",
+		"SERVER_ADDR":       "localhost",
+		"LOG_LEVEL":         "loud",
+		"DB_MAX_OPEN_CONNS": "5",
+		"DB_MAX_IDLE_CONNS": "10",
+		"TLS_CERT_FILE":     "cert.pem",
+		"BASE_URL":          "notes.example.com",
+	}
+
+	_, err := configs.LoadWithEnv(file, filepath.Join(t.TempDir(), ".env"), env)
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+
+	for _, expected := range []string{
+		"server.adress: unknown setting",
+		`DB_PORT: "not-a-port" is not an integer`,
+		"server.addr",
+		"log.level",
+		"database.max_idle_conns",
+		"server.tls_cert_file, server.tls_key_file: must be set together",
+		"server.base_url",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to mention %q, got:\n%v", expected, err)
+		}
+	}
+}
+
+func TestConfigPrintRedactsSecrets(t *testing.T) {
+	env := map[string]string{"DB_PASSWORD": "hunter2"}
+	cfg, err := configs.LoadWithEnv("", filepath.Join(t.TempDir(), ".env"), env)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatalf("Error printing config: %v", err)
+	}
+
+	if strings.Contains(buf.String(), "hunter2") {
+		t.Error("Expected the password to be redacted")
+	}
+	if !strings.Contains(buf.String(), "read_timeout: 15s") {
+		t.Errorf("Expected durations to be printed readably, got:\n%s", buf.String())
+	}
+	if cfg.Database.Password != "hunter2" {
+		t.Error("Expected printing not to modify the configuration")
+	}
+}
@@ -0,0 +1,167 @@
+package unit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/middlewares"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+)
+
+// blockingConnector is a database/sql connector whose statements block until
+// their context is done, reporting why they stopped on aborted
+type blockingConnector struct {
+	aborted chan error
+}
+
+func newBlockingDB(t *testing.T) (*sql.DB, chan error) {
+	aborted := make(chan error, 10)
+	db := sql.OpenDB(&blockingConnector{aborted})
+	t.Cleanup(func() { db.Close() })
+	return db, aborted
+}
+
+func (b *blockingConnector) Connect(context.Context) (driver.Conn, error) {
+	return &blockingConn{b.aborted}, nil
+}
+
+func (b *blockingConnector) Driver() driver.Driver { return nil }
+
+type blockingConn struct {
+	aborted chan error
+}
+
+func (c *blockingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare not supported")
+}
+
+func (c *blockingConn) Close() error { return nil }
+
+func (c *blockingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+func (c *blockingConn) QueryContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	<-ctx.Done()
+	c.aborted <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func (c *blockingConn) ExecContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Result, error) {
+	<-ctx.Done()
+	c.aborted <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+// Wait for the blocking driver to report an aborted statement
+func waitAborted(t *testing.T, aborted chan error) error {
+	select {
+	case err := <-aborted:
+		return err
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the query to be aborted")
+		return nil
+	}
+}
+
+func TestRepositoryQueryTimeout(t *testing.T) {
+	db, aborted := newBlockingDB(t)
+	repo := repositories.NewNoteRepository(db, 20*time.Millisecond)
+
+	start := time.Now()
+	_, err := repo.FindAll(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the query to time out quickly, took %v", elapsed)
+	}
+	if err := waitAborted(t, aborted); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the driver to see a deadline, got %v", err)
+	}
+}
+
+func TestRepositoryHonoursCallerCancellation(t *testing.T) {
+	db, aborted := newBlockingDB(t)
+	repo := repositories.NewNoteRepository(db, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	if err := repo.Delete(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if err := waitAborted(t, aborted); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the driver to see a cancellation, got %v", err)
+	}
+}
+
+// Setup a router serving notes from the blocking database
+func setupBlockingRouter(db *sql.DB, queryTimeout time.Duration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.ErrorMiddleware())
+	r.Use(signIn(adminUser))
+
+	noteHandler := handlers.NewNoteHandler(services.NewNoteService(
+		repositories.NewNoteRepository(db, queryTimeout),
+		repositories.NewShareRepository(db, queryTimeout),
+		repositories.NewUserRepository(db, queryTimeout),
+		repositories.NewAuditRepository(db, queryTimeout),
+		repositories.NewNoteTemplateRepository(db, queryTimeout),
+		repositories.NewLinkRepository(db, queryTimeout),
+		repositories.NewTransactor(db),
+	), services.NewTemplateService(repositories.NewNoteTemplateRepository(db, queryTimeout)), services.NewSearchService(
+		repositories.NewNoteRepository(db, queryTimeout),
+		repositories.NewSavedSearchRepository(db, queryTimeout),
+	), testBaseURL)
+	r.GET("/notes/:id", noteHandler.Show)
+
+	return r
+}
+
+func TestCancelledRequestAbortsQuery(t *testing.T) {
+	db, aborted := newBlockingDB(t)
+	router := setupBlockingRouter(db, time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/notes/1", nil)
+	req.Header.Set("Accept", "application/json")
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		router.ServeHTTP(w, req)
+		close(done)
+	}()
+
+	if err := waitAborted(t, aborted); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the query to be cancelled with the request, got %v", err)
+	}
+	<-done
+}
+
+func TestQueryTimeoutReturnsGatewayTimeout(t *testing.T) {
+	db, aborted := newBlockingDB(t)
+	router := setupBlockingRouter(db, 20*time.Millisecond)
+
+	req, _ := http.NewRequest("GET", "/notes/1", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	waitAborted(t, aborted)
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected status %d, got %d", http.StatusGatewayTimeout, w.Code)
+	}
+}
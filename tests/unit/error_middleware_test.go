@@ -0,0 +1,127 @@
+package unit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+)
+
+// Setup a router whose only route fails with the given error
+func setupErrorRouter(t *testing.T, err error) *gin.Engine {
+	r := fixtures.NewRouter(t, nil)
+
+	r.GET("/fail", func(c *gin.Context) {
+		_ = c.Error(err)
+	})
+	r.NoRoute(utils.NotFound)
+
+	return r
+}
+
+func TestErrorMiddlewareRendersHTMLPage(t *testing.T) {
+	router := setupErrorRouter(t, utils.NewNotFoundError("Note not found"))
+
+	req, _ := http.NewRequest("GET", "/fail", nil)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("Expected HTML content type, got %q", w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "<html") || !strings.Contains(w.Body.String(), "Note not found") {
+		t.Errorf("Expected a full error page, got %q", w.Body.String())
+	}
+}
+
+func TestErrorMiddlewareRendersHTMXToast(t *testing.T) {
+	router := setupErrorRouter(t, utils.NewBadRequestError("Title is required"))
+
+	req, _ := http.NewRequest("GET", "/fail", nil)
+	req.Header.Set("HX-Request", "true")
+	req.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if got := w.Header().Get("HX-Retarget"); got != "#toast-container" {
+		t.Errorf("Expected HX-Retarget to be #toast-container, got %q", got)
+	}
+	if got := w.Header().Get("HX-Reswap"); got != "beforeend" {
+		t.Errorf("Expected HX-Reswap to be beforeend, got %q", got)
+	}
+	if strings.Contains(w.Body.String(), "<html") {
+		t.Error("Expected a fragment, got a full page")
+	}
+	if !strings.Contains(w.Body.String(), "Title is required") {
+		t.Errorf("Expected toast to contain the message, got %q", w.Body.String())
+	}
+}
+
+func TestErrorMiddlewareRendersProblemJSON(t *testing.T) {
+	router := setupErrorRouter(t, utils.NewNotFoundError("Note not found"))
+
+	req, _ := http.NewRequest("GET", "/fail", nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), utils.MIMEProblemJSON) {
+		t.Errorf("Expected problem+json content type, got %q", w.Header().Get("Content-Type"))
+	}
+
+	var problem utils.Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("Failed to decode problem: %v", err)
+	}
+	if problem.Status != http.StatusNotFound || problem.Title != "Not Found" ||
+		problem.Detail != "Note not found" || problem.Instance != "/fail" {
+		t.Errorf("Unexpected problem %+v", problem)
+	}
+}
+
+func TestErrorMiddlewareHidesUntypedErrors(t *testing.T) {
+	router := setupErrorRouter(t, errors.New("dial tcp: connection refused"))
+
+	req, _ := http.NewRequest("GET", "/fail", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	if strings.Contains(w.Body.String(), "connection refused") {
+		t.Error("Expected internal error details not to be leaked")
+	}
+}
+
+func TestErrorMiddlewareHandlesUnknownRoutes(t *testing.T) {
+	router := setupErrorRouter(t, nil)
+
+	req, _ := http.NewRequest("GET", "/notes/999/missing", nil)
+	req.Header.Set("Accept", "text/html")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("Expected HTML content type, got %q", w.Header().Get("Content-Type"))
+	}
+}
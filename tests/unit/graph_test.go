@@ -0,0 +1,287 @@
+package unit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+)
+
+func TestNoteMentionsFindsURLsAndTitles(t *testing.T) {
+	notes := []domain.GraphNode{{ID: 1, Title: "Plans"}, {ID: 3, Title: "Go"}, {ID: 4, Title: "Alone"}}
+
+	mentions := domain.NoteMentions("Google is not Go, but see https://notes.example.com/notes/1 and /notes/99", notes)
+	want := map[int64]string{1: domain.MentionURL, 3: domain.MentionTitle, 99: domain.MentionURL}
+	if !reflect.DeepEqual(mentions, want) {
+		t.Errorf("Expected the mentions %v, got %v", want, mentions)
+	}
+	if mentions = domain.NoteMentions("Go and Go again, then /notes/3", notes); !reflect.DeepEqual(mentions, map[int64]string{3: domain.MentionURL}) {
+		t.Errorf("Expected a URL mention to win over a title one, got %v", mentions)
+	}
+	if mentions = domain.NoteMentions("plans (draft)", notes); len(mentions) != 0 {
+		t.Errorf("Expected titles to match exactly, got %v", mentions)
+	}
+}
+
+func TestNoteGraphAroundFocus(t *testing.T) {
+	// 1 -> 2 -> 3 -> 4, with 5 on its own
+	graph := &domain.NoteGraph{
+		Nodes: []domain.GraphNode{{ID: 1, Title: "One"}, {ID: 2, Title: "Two"}, {ID: 3, Title: "Three"}, {ID: 4, Title: "Four"}, {ID: 5, Title: "Five"}},
+		Edges: []domain.GraphEdge{
+			{Source: 1, Target: 2, Via: domain.MentionTitle},
+			{Source: 2, Target: 3, Via: domain.MentionTitle},
+			{Source: 3, Target: 4, Via: domain.MentionTitle},
+		},
+	}
+
+	around := graph.Around(2, 1)
+	if len(around.Nodes) != 3 || len(around.Edges) != 2 {
+		t.Fatalf("Expected the note and its neighbours either way, got %+v", around)
+	}
+	if around.Nodes[0].Depth != 1 || around.Nodes[1].Depth != 0 || around.Nodes[2].Depth != 1 {
+		t.Errorf("Expected the distances from the focus, got %+v", around.Nodes)
+	}
+	if around = graph.Around(1, 3); len(around.Nodes) != 4 || around.Nodes[3].Depth != 3 {
+		t.Errorf("Expected three steps to reach the last note, got %+v", around.Nodes)
+	}
+	if around = graph.Around(5, 2); len(around.Nodes) != 1 || len(around.Edges) != 0 {
+		t.Errorf("Expected a note without mentions on its own, got %+v", around)
+	}
+	if graph.Around(9, 1) != nil {
+		t.Error("Expected no graph around a missing note")
+	}
+}
+
+// Create a note service over repo drawing its graph from the notes of repo
+// and the grants of the returned share repository
+func newGraphNoteService(repo *mockNoteRepository) (services.NoteService, *mockShareRepository) {
+	shares := newMockShareRepository(repo)
+	links := newMockLinkRepository()
+	links.notes = repo
+	links.shares = shares
+	return services.NewNoteService(repo, shares, newMockUserRepository(), &mockAuditRepository{}, newMockTemplateRepository(), links, &mockTransactor{}), shares
+}
+
+// Create a note as user, failing the test on error
+func createNoteAs(t *testing.T, service services.NoteService, user *domain.User, title, content string) *domain.Note {
+	t.Helper()
+	note, err := service.CreateNote(userContext(user), title, content, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to create note %q: %v", title, err)
+	}
+	return note
+}
+
+func TestGetNoteGraphCoversReadableNotes(t *testing.T) {
+	repo := newMockRepository()
+	service, shares := newGraphNoteService(repo)
+	createNoteAs(t, service, editorUser, "Plans", "See Budget")
+	createNoteAs(t, service, adminUser, "Budget", "For /notes/1")
+	createNoteAs(t, service, adminUser, "Secret", "Budget, not Plans")
+	shares.grants[[2]int64{2, editorUser.ID}] = domain.ShareRead
+
+	graph, err := service.GetNoteGraph(userContext(editorUser), 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to build graph: %v", err)
+	}
+	// Titles are only mentions among the notes of one owner
+	want := []domain.GraphEdge{{Source: 2, Target: 1, Via: domain.MentionURL}}
+	if len(graph.Nodes) != 2 || !reflect.DeepEqual(graph.Edges, want) {
+		t.Errorf("Expected the editor's note and the one shared with them, got %+v", graph)
+	}
+	if graph, _ := service.GetNoteGraph(userContext(adminUser), 0, 0); len(graph.Nodes) != 3 || len(graph.Edges) != 2 {
+		t.Errorf("Expected admins to see every note, got %+v", graph)
+	}
+
+	if _, err := service.GetNoteGraph(userContext(editorUser), 3, 1); !errors.Is(err, services.ErrNoteNotFound) {
+		t.Errorf("Expected an unreadable focus note to be missing, got %v", err)
+	}
+	if _, err := service.GetNoteGraph(userContext(editorUser), 1, services.MaxGraphDepth+1); !errors.Is(err, services.ErrInvalidGraphDepth) {
+		t.Errorf("Expected a depth beyond the limit to be rejected, got %v", err)
+	}
+}
+
+func TestNoteGraphFollowsChanges(t *testing.T) {
+	repo := newMockRepository()
+	service, _ := newGraphNoteService(repo)
+	ctx := userContext(editorUser)
+	edges := func() []domain.GraphEdge {
+		t.Helper()
+		graph, err := service.GetNoteGraph(ctx, 0, 0)
+		if err != nil {
+			t.Fatalf("Failed to build graph: %v", err)
+		}
+		return graph.Edges
+	}
+
+	plans := createNoteAs(t, service, editorUser, "Plans", "See Budget and Ideas")
+	budget := createNoteAs(t, service, editorUser, "Budget", "")
+	other := createNoteAs(t, service, editorUser, "Other", "")
+	if got, want := edges(), []domain.GraphEdge{{Source: plans.ID, Target: budget.ID, Via: domain.MentionTitle}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected a note created after the one mentioning it to be linked, got %+v", got)
+	}
+
+	if _, err := service.UpdateNote(ctx, budget.ID, "Numbers", ""); err != nil {
+		t.Fatalf("Failed to rename note: %v", err)
+	}
+	if _, err := service.UpdateNote(ctx, other.ID, "Ideas", ""); err != nil {
+		t.Fatalf("Failed to rename note: %v", err)
+	}
+	if got, want := edges(), []domain.GraphEdge{{Source: plans.ID, Target: other.ID, Via: domain.MentionTitle}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected renames to move the title mentions, got %+v", got)
+	}
+
+	if _, err := service.UpdateNote(ctx, plans.ID, "Plans", "Ideas, then /notes/2"); err != nil {
+		t.Fatalf("Failed to update note: %v", err)
+	}
+	want := []domain.GraphEdge{
+		{Source: plans.ID, Target: budget.ID, Via: domain.MentionURL},
+		{Source: plans.ID, Target: other.ID, Via: domain.MentionTitle},
+	}
+	if got := edges(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the edited content to be linked, got %+v", got)
+	}
+
+	if err := service.DeleteNote(ctx, budget.ID); err != nil {
+		t.Fatalf("Failed to delete note: %v", err)
+	}
+	if got := edges(); len(got) != 1 || got[0].Target != other.ID {
+		t.Errorf("Expected no edges to a deleted note, got %+v", got)
+	}
+}
+
+func TestGetNoteGraphKeepsMostLinkedNodes(t *testing.T) {
+	repo := newMockRepository()
+	service, _ := newGraphNoteService(repo)
+	for i := 0; i < services.MaxGraphNodes; i++ {
+		createNoteAs(t, service, editorUser, fmt.Sprintf("Note %d", i), "")
+	}
+	last := createNoteAs(t, service, editorUser, "Last", "See Note 0")
+
+	graph, err := service.GetNoteGraph(userContext(editorUser), 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to get graph: %v", err)
+	}
+	if len(graph.Nodes) != services.MaxGraphNodes || !graph.Truncated {
+		t.Fatalf("Expected %d nodes of a truncated graph, got %d, truncated %v", services.MaxGraphNodes, len(graph.Nodes), graph.Truncated)
+	}
+	ids := make(map[int64]bool)
+	for _, node := range graph.Nodes {
+		ids[node.ID] = true
+	}
+	// Of the notes without links, the last one created is left out
+	if !ids[1] || !ids[last.ID] || ids[last.ID-1] {
+		t.Errorf("Expected the linked notes to be kept and note %d left out", last.ID-1)
+	}
+	if len(graph.Edges) != 1 {
+		t.Errorf("Expected the edge between the kept notes, got %+v", graph.Edges)
+	}
+
+	graph, err = service.GetNoteGraph(userContext(editorUser), 1, services.MaxGraphDepth)
+	if err != nil || len(graph.Nodes) != 2 || graph.Truncated {
+		t.Errorf("Expected the whole neighbourhood of a focus note, got %+v, %v", graph, err)
+	}
+}
+
+func TestMostLinkedKeepsFocusNote(t *testing.T) {
+	graph := &domain.NoteGraph{
+		Nodes: []domain.GraphNode{{ID: 1, Title: "Hub"}, {ID: 2, Title: "Spoke"}, {ID: 3, Title: "Focus"}},
+		Edges: []domain.GraphEdge{{Source: 2, Target: 1, Via: domain.MentionTitle}},
+	}
+
+	top := graph.MostLinked(2, 3)
+	if want := []domain.GraphNode{{ID: 1, Title: "Hub"}, {ID: 3, Title: "Focus"}}; !reflect.DeepEqual(top.Nodes, want) || !top.Truncated {
+		t.Errorf("Expected the focus note and the most linked note, got %+v", top)
+	}
+	if len(top.Edges) != 0 {
+		t.Errorf("Expected no edges to the note left out, got %+v", top.Edges)
+	}
+	if graph.MostLinked(3, 0) != graph || graph.Truncated {
+		t.Error("Expected a graph within the limit to be returned whole")
+	}
+}
+
+// Set up a router with the graph pages signed in as user
+func setupGraphRouter(t *testing.T, user *domain.User) (*gin.Engine, services.NoteService) {
+	r := fixtures.NewRouter(t, user)
+
+	repo := newMockRepository()
+	service, _ := newGraphNoteService(repo)
+	noteHandler := handlers.NewNoteHandler(service, newTemplateService(), newSearchService(repo), testBaseURL)
+	r.GET("/notes/graph", noteHandler.Graph)
+	r.GET("/notes/graph.json", noteHandler.GraphJSON)
+	r.GET("/notes/:id", noteHandler.Show)
+	return r, service
+}
+
+func TestGraphEndpoints(t *testing.T) {
+	router, service := setupGraphRouter(t, editorUser)
+	createNoteAs(t, service, editorUser, "Plans", "See Budget")
+	createNoteAs(t, service, editorUser, "Budget", "Numbers")
+	createNoteAs(t, service, editorUser, "Other", "")
+
+	w := serve(router, "GET", "/notes/graph.json?focus=2&depth=1", nil, false)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Fatalf("Expected a JSON graph, got %d: %s", w.Code, w.Body.String())
+	}
+	var graph domain.NoteGraph
+	if err := json.Unmarshal(w.Body.Bytes(), &graph); err != nil {
+		t.Fatalf("Failed to decode graph: %v", err)
+	}
+	want := []domain.GraphEdge{{Source: 1, Target: 2, Via: domain.MentionTitle}}
+	if len(graph.Nodes) != 2 || !reflect.DeepEqual(graph.Edges, want) {
+		t.Errorf("Expected the focus note and the note mentioning it, got %+v", graph)
+	}
+
+	w = serve(router, "GET", "/notes/graph.json", nil, false)
+	if body := w.Body.String(); !strings.Contains(body, `"title":"Other"`) || !strings.Contains(body, `"via":"title"`) {
+		t.Errorf("Expected every note without a focus, got %s", body)
+	}
+
+	for _, query := range []string{"focus=x", "focus=1&depth=0", "focus=1&depth=6"} {
+		if w = serve(router, "GET", "/notes/graph.json?"+query, nil, false); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be rejected, got %d", query, w.Code)
+		}
+	}
+	if w = serve(router, "GET", "/notes/graph.json?focus=9", nil, false); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a missing focus note to be a 404, got %d", w.Code)
+	}
+
+	w = serve(router, "GET", "/notes/graph?focus=2&depth=3", nil, false)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `data-src="/notes/graph.json?depth=3&amp;focus=2"`) {
+		t.Fatalf("Expected the page to load the focused graph, got %d: %s", w.Code, body)
+	}
+	if !strings.Contains(body, `<option value="2" selected>Budget</option>`) || !strings.Contains(body, `<option value="3" selected>3</option>`) {
+		t.Error("Expected the filters to show the focus note and depth")
+	}
+}
+
+func TestGraphEndpointTruncatesLargeGraphs(t *testing.T) {
+	router, service := setupGraphRouter(t, editorUser)
+	for i := 0; i <= services.MaxGraphNodes; i++ {
+		createNoteAs(t, service, editorUser, fmt.Sprintf("Note %d", i), "")
+	}
+
+	w := serve(router, "GET", "/notes/graph.json", nil, false)
+	var graph domain.NoteGraph
+	if err := json.Unmarshal(w.Body.Bytes(), &graph); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("Expected a JSON graph, got %d: %s", w.Code, w.Body.String())
+	}
+	if len(graph.Nodes) != services.MaxGraphNodes || !graph.Truncated {
+		t.Errorf("Expected %d nodes of a truncated graph, got %d, truncated %v", services.MaxGraphNodes, len(graph.Nodes), graph.Truncated)
+	}
+	if body := serve(router, "GET", "/notes/graph", nil, false).Body.String(); !strings.Contains(body, "Only the 200 most linked notes are shown") {
+		t.Errorf("Expected the page to explain truncated graphs:\n%s", body)
+	}
+}
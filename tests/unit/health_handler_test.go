@@ -0,0 +1,75 @@
+package unit
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+)
+
+// unreachableConnector is a database/sql connector that can never connect
+type unreachableConnector struct{}
+
+func (unreachableConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, errors.New("dial tcp: connection refused")
+}
+
+func (unreachableConnector) Driver() driver.Driver { return nil }
+
+// Setup a router serving the health probes for db
+func setupHealthRouter(db *sql.DB) (*gin.Engine, *handlers.HealthHandler) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	healthHandler := handlers.NewHealthHandler(db)
+	r.GET("/healthz", healthHandler.Liveness)
+	r.GET("/readyz", healthHandler.Readiness)
+	return r, healthHandler
+}
+
+// Request path and return the status code
+func probe(router *gin.Engine, path string) int {
+	req, _ := http.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestHealthProbesWithReachableDatabase(t *testing.T) {
+	db, _ := newBlockingDB(t)
+	router, healthHandler := setupHealthRouter(db)
+
+	if code := probe(router, "/healthz"); code != http.StatusOK {
+		t.Errorf("Expected liveness %d, got %d", http.StatusOK, code)
+	}
+	if code := probe(router, "/readyz"); code != http.StatusOK {
+		t.Errorf("Expected readiness %d, got %d", http.StatusOK, code)
+	}
+
+	// Once draining, the server is still alive but no longer ready
+	healthHandler.SetDraining()
+	if code := probe(router, "/healthz"); code != http.StatusOK {
+		t.Errorf("Expected liveness %d while draining, got %d", http.StatusOK, code)
+	}
+	if code := probe(router, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readiness %d while draining, got %d", http.StatusServiceUnavailable, code)
+	}
+}
+
+func TestReadinessFailsWithoutDatabase(t *testing.T) {
+	db := sql.OpenDB(unreachableConnector{})
+	defer db.Close()
+	router, _ := setupHealthRouter(db)
+
+	if code := probe(router, "/healthz"); code != http.StatusOK {
+		t.Errorf("Expected liveness %d, got %d", http.StatusOK, code)
+	}
+	if code := probe(router, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected readiness %d, got %d", http.StatusServiceUnavailable, code)
+	}
+}
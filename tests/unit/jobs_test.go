@@ -0,0 +1,424 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/jobs"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+)
+
+// Mock job repository claiming jobs in memory like the database does
+type mockJobRepository struct {
+	mu   sync.Mutex
+	jobs []*domain.Job
+}
+
+func (m *mockJobRepository) Enqueue(ctx context.Context, job *domain.Job) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job.ID = int64(len(m.jobs) + 1)
+	m.jobs = append(m.jobs, job)
+	return job.ID, nil
+}
+
+func (m *mockJobRepository) FindByID(ctx context.Context, id int64) (*domain.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > int64(len(m.jobs)) {
+		return nil, nil
+	}
+	copied := *m.jobs[id-1]
+	return &copied, nil
+}
+
+func (m *mockJobRepository) Find(ctx context.Context, filter domain.JobFilter) ([]*domain.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var jobs []*domain.Job
+	for i := len(m.jobs) - 1; i >= 0; i-- {
+		job := m.jobs[i]
+		if (filter.Status == "" || job.Status == filter.Status) && (filter.Kind == "" || job.Kind == filter.Kind) {
+			copied := *job
+			jobs = append(jobs, &copied)
+		}
+	}
+	return jobs, nil
+}
+
+func (m *mockJobRepository) CountByStatus(ctx context.Context) (map[domain.JobStatus]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := map[domain.JobStatus]int{}
+	for _, job := range m.jobs {
+		counts[job.Status]++
+	}
+	return counts, nil
+}
+
+func (m *mockJobRepository) Claim(ctx context.Context, now time.Time, visibility time.Duration, limit int) ([]*domain.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var jobs []*domain.Job
+	for _, job := range m.jobs {
+		due := job.Status == domain.JobQueued && !job.RunAt.After(now)
+		expired := job.Status == domain.JobRunning && !job.LockedUntil.After(now)
+		if (due || expired) && len(jobs) < limit {
+			job.Status = domain.JobRunning
+			job.Attempts++
+			job.LockedUntil = now.Add(visibility)
+			copied := *job
+			jobs = append(jobs, &copied)
+		}
+	}
+	return jobs, nil
+}
+
+func (m *mockJobRepository) Finish(ctx context.Context, job *domain.Job) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if stored := m.jobs[job.ID-1]; stored.Attempts == job.Attempts {
+		copied := *job
+		m.jobs[job.ID-1] = &copied
+	}
+	return nil
+}
+
+func (m *mockJobRepository) Requeue(ctx context.Context, id int64, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > int64(len(m.jobs)) || m.jobs[id-1].Status != domain.JobDead {
+		return false, nil
+	}
+	job := m.jobs[id-1]
+	job.Status, job.Attempts, job.RunAt, job.LockedUntil = domain.JobQueued, 0, now, time.Time{}
+	return true, nil
+}
+
+// job returns a copy of the stored job with ID id
+func (m *mockJobRepository) job(id int64) domain.Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return *m.jobs[id-1]
+}
+
+// Create a queue whose retries are due at once
+func setupQueue(concurrency, maxAttempts int) (*jobs.Queue, *mockJobRepository) {
+	repo := &mockJobRepository{}
+	queue := jobs.NewQueue(repo, jobs.Config{
+		Concurrency:  concurrency,
+		PollInterval: time.Millisecond,
+		Visibility:   time.Minute,
+		MaxAttempts:  maxAttempts,
+		RetryBackoff: time.Nanosecond,
+	}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return queue, repo
+}
+
+// runAll runs jobs until none is due
+func runAll(t *testing.T, queue *jobs.Queue) {
+	for {
+		time.Sleep(time.Millisecond)
+		ran, err := queue.RunOnce(context.Background())
+		if err != nil {
+			t.Fatalf("Error running job: %v", err)
+		}
+		if !ran {
+			return
+		}
+	}
+}
+
+func TestJobsRunWithTheirPayload(t *testing.T) {
+	queue, repo := setupQueue(1, 3)
+	var got string
+	queue.Register("greet", func(ctx context.Context, payload []byte) error {
+		got = string(payload)
+		return nil
+	})
+
+	id, err := queue.Enqueue(context.Background(), "greet", map[string]string{"name": "Ada"})
+	if err != nil {
+		t.Fatalf("Error enqueueing: %v", err)
+	}
+	later, _ := queue.EnqueueAt(context.Background(), "greet", nil, time.Now().Add(time.Hour))
+	runAll(t, queue)
+
+	if job := repo.job(id); job.Status != domain.JobSucceeded || job.Attempts != 1 || !job.LockedUntil.IsZero() {
+		t.Errorf("Expected the job to succeed at once, got %+v", job)
+	}
+	if got != `{"name":"Ada"}` {
+		t.Errorf("Expected the JSON payload, got %q", got)
+	}
+	if job := repo.job(later); job.Status != domain.JobQueued || job.Attempts != 0 {
+		t.Errorf("Expected a job due later to wait, got %+v", job)
+	}
+}
+
+func TestJobsAreRetriedUntilDead(t *testing.T) {
+	queue, repo := setupQueue(1, 3)
+	var calls int
+	queue.Register("flaky", func(ctx context.Context, payload []byte) error {
+		calls++
+		if calls == 2 {
+			panic("boom")
+		}
+		return errors.New("remote unavailable")
+	})
+	queue.Register("broken", func(ctx context.Context, payload []byte) error {
+		return jobs.Permanent(errors.New("invalid payload"))
+	})
+
+	flaky, _ := queue.Enqueue(context.Background(), "flaky", nil)
+	broken, _ := queue.Enqueue(context.Background(), "broken", nil)
+	if _, err := queue.Enqueue(context.Background(), "unknown", nil); !errors.Is(err, jobs.ErrNoHandler) {
+		t.Errorf("Expected a kind without handler not to be queued, got %v", err)
+	}
+	// Another instance may register kinds this one does not
+	unknown, _ := repo.Enqueue(context.Background(), &domain.Job{Kind: "unknown", Payload: []byte("null"), Status: domain.JobQueued, MaxAttempts: 3})
+	runAll(t, queue)
+
+	if job := repo.job(flaky); job.Status != domain.JobDead || job.Attempts != 3 || calls != 3 || job.LastError != "remote unavailable" {
+		t.Errorf("Expected the job to die after 3 attempts, got %+v after %d calls", job, calls)
+	}
+	if job := repo.job(broken); job.Status != domain.JobDead || job.Attempts != 1 {
+		t.Errorf("Expected a permanent error not to be retried, got %+v", job)
+	}
+	if job := repo.job(unknown); job.Status != domain.JobDead || !strings.Contains(job.LastError, "no handler") {
+		t.Errorf("Expected a job without handler to die, got %+v", job)
+	}
+}
+
+func TestJobsAbandonedAfterVisibilityTimeoutRunAgain(t *testing.T) {
+	queue, repo := setupQueue(1, 2)
+	var calls int
+	queue.Register("slow", func(ctx context.Context, payload []byte) error {
+		calls++
+		return nil
+	})
+	id, _ := queue.Enqueue(context.Background(), "slow", nil)
+
+	// A worker claims the job and dies; its lease runs out
+	if _, err := repo.Claim(context.Background(), time.Now(), -time.Second, 1); err != nil {
+		t.Fatalf("Error claiming: %v", err)
+	}
+	runAll(t, queue)
+	if job := repo.job(id); job.Status != domain.JobSucceeded || job.Attempts != 2 || calls != 1 {
+		t.Errorf("Expected the abandoned job to run again, got %+v after %d calls", job, calls)
+	}
+
+	// The stale worker finishing late cannot overwrite the newer attempt
+	stale := repo.job(id)
+	stale.Attempts, stale.Status = 1, domain.JobDead
+	if err := repo.Finish(context.Background(), &stale); err != nil {
+		t.Fatalf("Error finishing: %v", err)
+	}
+	if job := repo.job(id); job.Status != domain.JobSucceeded {
+		t.Errorf("Expected the stale outcome to be ignored, got %+v", job)
+	}
+}
+
+func TestJobQueueRunsConcurrentlyAndDrainsOnStop(t *testing.T) {
+	queue, repo := setupQueue(3, 3)
+	var running, peak atomic.Int32
+	release := make(chan struct{})
+	started := make(chan struct{}, 3)
+	queue.Register("wait", func(ctx context.Context, payload []byte) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	for range 4 {
+		if _, err := queue.Enqueue(context.Background(), "wait", nil); err != nil {
+			t.Fatalf("Error enqueueing: %v", err)
+		}
+	}
+
+	queue.Start()
+	for range 3 {
+		<-started
+	}
+	stopped := make(chan error)
+	go func() { stopped <- queue.Stop(context.Background()) }()
+	select {
+	case <-stopped:
+		t.Fatal("Expected Stop to wait for the running jobs")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Fatalf("Error stopping: %v", err)
+	}
+
+	if peak.Load() != 3 {
+		t.Errorf("Expected 3 jobs at once, got %d", peak.Load())
+	}
+	counts, _ := repo.CountByStatus(context.Background())
+	if counts[domain.JobSucceeded] != 3 || counts[domain.JobQueued] != 1 {
+		t.Errorf("Expected 3 jobs done and 1 left queued after Stop, got %v", counts)
+	}
+}
+
+func TestJobQueueStopCancelsJobsAfterDeadline(t *testing.T) {
+	queue, repo := setupQueue(1, 3)
+	started := make(chan struct{})
+	queue.Register("stuck", func(ctx context.Context, payload []byte) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	id, _ := queue.Enqueue(context.Background(), "stuck", nil)
+
+	queue.Start()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := queue.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected Stop to give up at the deadline, got %v", err)
+	}
+
+	// The cancelled attempt is still recorded for a retry
+	deadline := time.Now().Add(time.Second)
+	for repo.job(id).Status == domain.JobRunning && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if job := repo.job(id); job.Status != domain.JobQueued || job.LastError == "" {
+		t.Errorf("Expected the cancelled job to be queued again, got %+v", job)
+	}
+}
+
+func TestJobBackoff(t *testing.T) {
+	if got := jobs.Backoff(1, 10*time.Second); got != 10*time.Second {
+		t.Errorf("Expected the base delay first, got %v", got)
+	}
+	if got := jobs.Backoff(3, 10*time.Second); got != 40*time.Second {
+		t.Errorf("Expected the delay to double, got %v", got)
+	}
+	if got := jobs.Backoff(50, 10*time.Second); got != time.Hour {
+		t.Errorf("Expected the delay to stop at an hour, got %v", got)
+	}
+}
+
+func TestPeriodicDrainsOnStop(t *testing.T) {
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	task := jobs.NewPeriodic("test task", func(ctx context.Context) (int, error) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+		return 0, nil
+	}, time.Millisecond, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	task.Start()
+	<-started
+
+	stopped := make(chan error)
+	go func() { stopped <- task.Stop(context.Background()) }()
+	select {
+	case <-stopped:
+		t.Fatal("Expected Stop to wait for the batch in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	if err := <-stopped; err != nil {
+		t.Fatalf("Error stopping task: %v", err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected no batch after Stop, got %d calls", n)
+	}
+}
+
+// Setup the jobs page, signed in as user
+func setupJobRouter(t *testing.T, user *domain.User) (*gin.Engine, *jobs.Queue, *mockJobRepository) {
+	queue, repo := setupQueue(1, 1)
+
+	r := fixtures.NewRouter(t, nil)
+
+	jobHandler := handlers.NewJobHandler(services.NewJobService(repo))
+	admin := r.Group("/admin", signIn(user))
+	admin.GET("/jobs", jobHandler.Index)
+	admin.POST("/jobs/:id/retry", jobHandler.Retry)
+	return r, queue, repo
+}
+
+func TestJobsPage(t *testing.T) {
+	router, queue, repo := setupJobRouter(t, adminUser)
+	queue.Register("ok", func(ctx context.Context, payload []byte) error { return nil })
+	queue.Register("fail", func(ctx context.Context, payload []byte) error { return errors.New("mail server down") })
+	queue.Enqueue(context.Background(), "ok", nil)
+	dead, _ := queue.Enqueue(context.Background(), "fail", map[string]string{"to": "ada@example.com"})
+	queue.Enqueue(context.Background(), "fail", nil)
+	runAll(t, queue)
+
+	w := serve(router, "GET", "/admin/jobs", nil, false)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "mail server down") || !strings.Contains(body, "ada@example.com") {
+		t.Errorf("Expected the jobs with their errors and payloads, got %d", w.Code)
+	}
+	w = serve(router, "GET", "/admin/jobs?status=dead", nil, false)
+	if body := w.Body.String(); !strings.Contains(body, `id="job-2"`) || strings.Contains(body, `id="job-1"`) {
+		t.Error("Expected only the dead jobs")
+	}
+	if w = serve(router, "GET", "/admin/jobs?status=lost", nil, false); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown status to be rejected, got %d", w.Code)
+	}
+
+	if w = serve(router, "POST", "/admin/jobs/1/retry", nil, false); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a succeeded job not to be retried, got %d", w.Code)
+	}
+	w = serve(router, "POST", "/admin/jobs/2/retry", url.Values{"back": {"/admin/jobs?status=dead"}}, false)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/admin/jobs?status=dead" {
+		t.Errorf("Expected a redirect back to the list, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	if job := repo.job(dead); job.Status != domain.JobQueued || job.Attempts != 0 {
+		t.Errorf("Expected the dead job to be queued with fresh attempts, got %+v", job)
+	}
+	if w = serve(router, "POST", "/admin/jobs/2/retry", nil, false); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a queued job not to be retried, got %d", w.Code)
+	}
+	w = serve(router, "POST", "/admin/jobs/3/retry", url.Values{"back": {"https://evil.example/admin/jobs"}}, false)
+	if w.Header().Get("Location") != "/admin/jobs" {
+		t.Errorf("Expected to only return to the jobs page, got %s", w.Header().Get("Location"))
+	}
+
+	router, _, _ = setupJobRouter(t, editorUser)
+	if w = serve(router, "GET", "/admin/jobs", nil, false); w.Code != http.StatusForbidden {
+		t.Errorf("Expected editors to be refused, got %d", w.Code)
+	}
+}
+
+func TestTruncateKeepsCharactersWhole(t *testing.T) {
+	for _, tc := range []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{"remote unavailable", 255, "remote unavailable"},
+		{"remote unavailable", 6, "remote"},
+		{"café", 4, "caf"},
+		{"日本", 2, ""},
+	} {
+		if got := utils.Truncate(tc.s, tc.n); got != tc.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tc.s, tc.n, got, tc.want)
+		}
+	}
+}
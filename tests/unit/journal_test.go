@@ -0,0 +1,185 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+)
+
+// racingNoteRepository misses the journal entry on its first lookup, as if
+// another request created it in between
+type racingNoteRepository struct {
+	*mockNoteRepository
+	missed bool
+}
+
+func (r *racingNoteRepository) FindJournal(ctx context.Context, userID int64, date time.Time) (*domain.Note, error) {
+	if !r.missed {
+		r.missed = true
+		return nil, nil
+	}
+	return r.mockNoteRepository.FindJournal(ctx, userID, date)
+}
+
+func TestOpenJournalCreatesOneEntryADay(t *testing.T) {
+	repo := newMockRepository()
+	service := newNoteService(repo)
+	// Late evening in Berlin is the same calendar day whatever the server's zone
+	berlin := time.FixedZone("CEST", 2*60*60)
+	evening := time.Date(2026, 3, 14, 23, 30, 0, 0, berlin)
+
+	note, created, err := service.OpenJournal(userContext(editorUser), evening)
+	if err != nil || !created {
+		t.Fatalf("Expected the entry to be created, got %v, %v", created, err)
+	}
+	if want := time.Date(2026, 3, 14, 0, 0, 0, 0, time.UTC); !note.JournalDate.Equal(want) {
+		t.Errorf("Expected the entry for %v, got %v", want, note.JournalDate)
+	}
+	if note.Title != "Saturday, 14 March 2026" || note.UserID != editorUser.ID {
+		t.Errorf("Expected the editor's entry titled with the date, got %+v", note)
+	}
+
+	again, created, err := service.OpenJournal(userContext(editorUser), time.Date(2026, 3, 14, 8, 0, 0, 0, time.UTC))
+	if err != nil || created || again.ID != note.ID {
+		t.Errorf("Expected the same entry to be opened, got %v, %v, %v", again, created, err)
+	}
+	other, _, _ := service.OpenJournal(userContext(adminUser), evening)
+	if other.ID == note.ID {
+		t.Error("Expected every user to have their own entry")
+	}
+
+	if found, err := service.GetJournal(userContext(editorUser), evening); err != nil || found.ID != note.ID {
+		t.Errorf("Expected the entry to be found, got %v, %v", found, err)
+	}
+	if _, err := service.GetJournal(userContext(editorUser), evening.AddDate(0, 0, 1)); !errors.Is(err, services.ErrNoteNotFound) {
+		t.Errorf("Expected no entry the next day, got %v", err)
+	}
+	dates, err := service.GetJournalDates(userContext(editorUser), time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || len(dates) != 1 {
+		t.Errorf("Expected one day with an entry in March, got %v, %v", dates, err)
+	}
+
+	if _, _, err := service.OpenJournal(userContext(viewerUser), evening); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected viewers not to create entries, got %v", err)
+	}
+	if _, _, err := service.OpenJournal(userContext(editorUser), time.Date(999, 1, 1, 0, 0, 0, 0, time.UTC)); !errors.Is(err, services.ErrInvalidJournalDate) {
+		t.Errorf("Expected a date before the year 1000 to be rejected, got %v", err)
+	}
+}
+
+func TestOpenJournalLoadsRacingEntry(t *testing.T) {
+	repo := newMockRepository()
+	date := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	repo.notes[1] = &domain.Note{ID: 1, UserID: editorUser.ID, Title: "Written elsewhere", JournalDate: date}
+	repo.nextID = 2
+	service := newNoteService(&racingNoteRepository{mockNoteRepository: repo})
+
+	note, created, err := service.OpenJournal(userContext(editorUser), date)
+	if err != nil || created || note.ID != 1 {
+		t.Errorf("Expected the other request's entry, got %v, %v, %v", note, created, err)
+	}
+	if len(repo.notes) != 1 {
+		t.Error("Expected no second entry for the day")
+	}
+}
+
+// Set up a router with the journal pages signed in as user
+func setupJournalRouter(t *testing.T, user *domain.User) (*gin.Engine, *mockNoteRepository) {
+	r := fixtures.NewRouter(t, user)
+
+	repo := newMockRepository()
+	journalHandler := handlers.NewJournalHandler(newNoteService(repo))
+	r.GET("/journal", journalHandler.Today)
+	r.GET("/journal/:date", journalHandler.Show)
+	r.POST("/journal/:date", journalHandler.Create)
+	return r, repo
+}
+
+func TestJournalPageOpensTodayInUserTimezone(t *testing.T) {
+	// Kiritimati is 14 hours ahead of UTC, so its date often differs from the server's
+	user := *editorUser
+	user.Timezone = "Pacific/Kiritimati"
+	router, repo := setupJournalRouter(t, &user)
+
+	w := serve(router, "GET", "/journal", nil, false)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the journal, got %d: %s", w.Code, w.Body.String())
+	}
+	today := domain.DateOf(time.Now().In(user.Location()))
+	note := repo.notes[1]
+	if note == nil || !note.JournalDate.Equal(today) {
+		t.Fatalf("Expected today's entry in the user's time zone %v, got %+v", today, note)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, note.Title) || !strings.Contains(body, `href="/journal/`+today.AddDate(0, 0, -1).Format(time.DateOnly)+`"`) {
+		t.Error("Expected the entry with a link to the previous day")
+	}
+	if !strings.Contains(body, `title="Journal entry">`+today.Format("2")+`</a>`) {
+		t.Error("Expected today to be highlighted in the calendar")
+	}
+
+	// Opening it again keeps the one entry
+	serve(router, "GET", "/journal", nil, false)
+	if len(repo.notes) != 1 {
+		t.Errorf("Expected one entry, got %d", len(repo.notes))
+	}
+}
+
+func TestJournalPageStartsEntryForOtherDays(t *testing.T) {
+	router, repo := setupJournalRouter(t, editorUser)
+
+	w := serve(router, "GET", "/journal/2026-02-27", nil, false)
+	if body := w.Body.String(); w.Code != http.StatusOK || !strings.Contains(body, "Start entry") || !strings.Contains(body, "February 2026") {
+		t.Fatalf("Expected an offer to start the entry, got %d", w.Code)
+	}
+	if len(repo.notes) != 0 {
+		t.Error("Expected browsing not to create entries")
+	}
+
+	w = serve(router, "POST", "/journal/2026-02-27", url.Values{}, false)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/journal/2026-02-27" {
+		t.Fatalf("Expected a redirect to the entry, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	if note := repo.notes[1]; note == nil || note.Title != "Friday, 27 February 2026" {
+		t.Errorf("Expected the entry to be created, got %+v", note)
+	}
+
+	if w = serve(router, "GET", "/journal/27-02-2026", nil, false); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid date to be rejected, got %d", w.Code)
+	}
+
+	viewer, repo := setupJournalRouter(t, viewerUser)
+	if w = serve(viewer, "GET", "/journal", nil, false); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "Start entry") {
+		t.Errorf("Expected viewers to see the journal without writing, got %d", w.Code)
+	}
+	if len(repo.notes) != 0 {
+		t.Error("Expected no entry to be created for a viewer")
+	}
+}
+
+func TestAccountSavesTimezone(t *testing.T) {
+	router, _, _, users := setupReminderRouter(t, editorUser)
+
+	w := serve(router, "POST", "/account", url.Values{"email": {""}, "timezone": {"Mars/Olympus_Mons"}}, false)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Mars/Olympus_Mons") {
+		t.Errorf("Expected an unknown time zone to be shown again, got %d", w.Code)
+	}
+	if w = serve(router, "POST", "/account", url.Values{"email": {""}, "timezone": {"Local"}}, false); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected Local to be rejected, got %d", w.Code)
+	}
+
+	w = serve(router, "POST", "/account", url.Values{"email": {""}, "timezone": {" Europe/Berlin "}}, false)
+	if w.Code != http.StatusSeeOther || users.users[editorUser.ID].Timezone != "Europe/Berlin" {
+		t.Errorf("Expected the time zone to be saved, got %d", w.Code)
+	}
+}
@@ -0,0 +1,444 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/metrics"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Mock link repository resolving links and mentions among the notes of
+// notes, shared through shares if set; links do not resolve and mentions are
+// not stored while notes is nil
+type mockLinkRepository struct {
+	notes    *mockNoteRepository
+	shares   *mockShareRepository
+	links    map[int64][]*domain.NoteLink
+	mentions map[int64]map[int64]string
+}
+
+func newMockLinkRepository() *mockLinkRepository {
+	return &mockLinkRepository{links: make(map[int64][]*domain.NoteLink), mentions: make(map[int64]map[int64]string)}
+}
+
+func (m *mockLinkRepository) ReplaceLinks(ctx context.Context, sourceID, ownerID int64, titles []string) error {
+	var links []*domain.NoteLink
+	for _, title := range titles {
+		links = append(links, &domain.NoteLink{SourceID: sourceID, TargetTitle: title, TargetID: m.resolve(ownerID, title)})
+	}
+	m.links[sourceID] = links
+	return nil
+}
+
+func (m *mockLinkRepository) ResolveLinks(ctx context.Context, ownerID int64, title string) error {
+	for sourceID, links := range m.links {
+		source := m.source(sourceID)
+		if source == nil || source.UserID != ownerID {
+			continue
+		}
+		for _, link := range links {
+			if strings.EqualFold(link.TargetTitle, title) {
+				link.TargetID = m.resolve(ownerID, title)
+			}
+		}
+	}
+	return nil
+}
+
+func (m *mockLinkRepository) FindLinks(ctx context.Context, sourceID int64) ([]*domain.NoteLink, error) {
+	links := append([]*domain.NoteLink(nil), m.links[sourceID]...)
+	sort.Slice(links, func(i, j int) bool { return links[i].TargetTitle < links[j].TargetTitle })
+	return links, nil
+}
+
+func (m *mockLinkRepository) FindBacklinks(ctx context.Context, targetID int64) ([]*domain.Note, error) {
+	var notes []*domain.Note
+	for sourceID, links := range m.links {
+		source := m.source(sourceID)
+		if source == nil || sourceID == targetID {
+			continue
+		}
+		for _, link := range links {
+			if link.TargetID == targetID {
+				notes = append(notes, source)
+				break
+			}
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].ID > notes[j].ID })
+	return notes, nil
+}
+
+func (m *mockLinkRepository) FindBroken(ctx context.Context, userID int64) ([]*domain.NoteLink, error) {
+	var broken []*domain.NoteLink
+	for sourceID, links := range m.links {
+		source := m.source(sourceID)
+		if source == nil || (userID != 0 && source.UserID != userID) {
+			continue
+		}
+		for _, link := range links {
+			if link.Broken() {
+				copied := *link
+				copied.SourceTitle = source.Title
+				broken = append(broken, &copied)
+			}
+		}
+	}
+	sort.Slice(broken, func(i, j int) bool {
+		if broken[i].SourceID != broken[j].SourceID {
+			return broken[i].SourceID < broken[j].SourceID
+		}
+		return broken[i].TargetTitle < broken[j].TargetTitle
+	})
+	return broken, nil
+}
+
+func (m *mockLinkRepository) FindTitles(ctx context.Context, ownerID int64) ([]domain.GraphNode, error) {
+	var titles []domain.GraphNode
+	for _, note := range m.sortedNotes() {
+		if note.UserID == ownerID {
+			titles = append(titles, domain.GraphNode{ID: note.ID, Title: note.Title})
+		}
+	}
+	return titles, nil
+}
+
+func (m *mockLinkRepository) ReplaceMentions(ctx context.Context, sourceID int64, mentions map[int64]string) error {
+	stored := make(map[int64]string)
+	for target, via := range mentions {
+		if m.source(target) != nil {
+			stored[target] = via
+		}
+	}
+	m.mentions[sourceID] = stored
+	return nil
+}
+
+func (m *mockLinkRepository) FindMentioning(ctx context.Context, ownerID int64, title string, targetID int64) ([]*domain.Note, error) {
+	var notes []*domain.Note
+	for _, note := range m.sortedNotes() {
+		if (note.UserID == ownerID && strings.Contains(strings.ToLower(note.Content), strings.ToLower(title))) ||
+			m.mentions[note.ID][targetID] == domain.MentionTitle {
+			notes = append(notes, note)
+		}
+	}
+	return notes, nil
+}
+
+func (m *mockLinkRepository) FindGraph(ctx context.Context, userID int64) (*domain.NoteGraph, error) {
+	graph := &domain.NoteGraph{Nodes: []domain.GraphNode{}, Edges: []domain.GraphEdge{}}
+	readable := make(map[int64]bool)
+	for _, note := range m.sortedNotes() {
+		shared := m.shares != nil && m.shares.grants[[2]int64{note.ID, userID}] != ""
+		if userID == 0 || note.UserID == userID || shared {
+			readable[note.ID] = true
+			graph.Nodes = append(graph.Nodes, domain.GraphNode{ID: note.ID, Title: note.Title})
+		}
+	}
+	for _, node := range graph.Nodes {
+		var targets []int64
+		for target := range m.mentions[node.ID] {
+			if readable[target] && m.source(target) != nil {
+				targets = append(targets, target)
+			}
+		}
+		sort.Slice(targets, func(i, j int) bool { return targets[i] < targets[j] })
+		for _, target := range targets {
+			graph.Edges = append(graph.Edges, domain.GraphEdge{Source: node.ID, Target: target, Via: m.mentions[node.ID][target]})
+		}
+	}
+	return graph, nil
+}
+
+// sortedNotes returns the stored notes in ID order
+func (m *mockLinkRepository) sortedNotes() []*domain.Note {
+	if m.notes == nil {
+		return nil
+	}
+	var notes []*domain.Note
+	for _, note := range m.notes.notes {
+		notes = append(notes, note)
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].ID < notes[j].ID })
+	return notes
+}
+
+// source returns the stored note with id, nil once it was deleted
+func (m *mockLinkRepository) source(id int64) *domain.Note {
+	if m.notes == nil {
+		return nil
+	}
+	return m.notes.notes[id]
+}
+
+// resolve returns the oldest note of ownerID titled title, 0 if there is none
+func (m *mockLinkRepository) resolve(ownerID int64, title string) int64 {
+	if m.notes == nil {
+		return 0
+	}
+	var target int64
+	for id, note := range m.notes.notes {
+		if note.UserID == ownerID && strings.EqualFold(strings.TrimSpace(note.Title), title) && (target == 0 || id < target) {
+			target = id
+		}
+	}
+	return target
+}
+
+// Create a note service over repo keeping its links in the returned repository
+func newLinkedNoteService(repo *mockNoteRepository) (services.NoteService, *mockLinkRepository, *mockAuditRepository) {
+	links := newMockLinkRepository()
+	links.notes = repo
+	audit := &mockAuditRepository{}
+	service := services.NewNoteService(repo, newMockShareRepository(repo), newMockUserRepository(), audit, newMockTemplateRepository(), links, &mockTransactor{})
+	return service, links, audit
+}
+
+func TestWikiLinksParsesTitles(t *testing.T) {
+	content := "See [[ Groceries ]] and [[groceries]], then [[Plans]].\n[[not\nlinked]] [[]] [[ ]] [x]"
+	if got, want := domain.WikiLinks(content), []string{"Groceries", "Plans"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the links %v, got %v", want, got)
+	}
+	if got := domain.WikiLinks("[[" + strings.Repeat("a", 256) + "]]"); len(got) != 0 {
+		t.Errorf("Expected titles longer than a note title to be ignored, got %v", got)
+	}
+
+	parts := domain.SplitWikiLinks("<b>[[Plans]]</b>")
+	want := []domain.ContentPart{{Text: "<b>"}, {Link: "Plans"}, {Text: "</b>"}}
+	if !reflect.DeepEqual(parts, want) {
+		t.Errorf("Expected the parts %v, got %v", want, parts)
+	}
+
+	renamed, ok := domain.RenameWikiLinks("[[plans]] and [[ Plans ]] but not [[Plans B]]", "Plans", "Roadmap")
+	if !ok || renamed != "[[Roadmap]] and [[Roadmap]] but not [[Plans B]]" {
+		t.Errorf("Expected the links to be renamed, got %q", renamed)
+	}
+	if _, ok := domain.RenameWikiLinks("[[Plans]]", "Plans", "Plans [draft]"); ok {
+		t.Error("Expected links not to be pointed at a title they cannot hold")
+	}
+}
+
+func TestNoteLinksResolveAndBreak(t *testing.T) {
+	repo := newMockRepository()
+	service, links, _ := newLinkedNoteService(repo)
+	ctx := userContext(editorUser)
+
+	source, err := service.CreateNote(ctx, "Index", "Read [[Plans]] and [[Ideas]]", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to create note: %v", err)
+	}
+	broken, _ := service.GetBrokenLinks(ctx)
+	if len(broken) != 2 || broken[0].SourceTitle != "Index" {
+		t.Fatalf("Expected both links to be broken, got %v", broken)
+	}
+
+	// Creating a note with the title fixes the links to it
+	plans, _ := service.CreateNote(ctx, "plans", "", time.Time{}, time.Time{})
+	noteLinks, backlinks, err := service.GetNoteLinks(ctx, source.ID)
+	if err != nil || len(noteLinks) != 2 || len(backlinks) != 0 {
+		t.Fatalf("Expected the note's two links, got %v, %v, %v", noteLinks, backlinks, err)
+	}
+	if noteLinks[1].TargetTitle != "Plans" || noteLinks[1].TargetID != plans.ID {
+		t.Errorf("Expected the link to resolve without regard to case, got %+v", noteLinks[1])
+	}
+	if _, backlinks, _ := service.GetNoteLinks(ctx, plans.ID); len(backlinks) != 1 || backlinks[0].ID != source.ID {
+		t.Errorf("Expected a backlink from the index, got %v", backlinks)
+	}
+
+	// Links resolve among the owner's notes only
+	_, _ = service.CreateNote(userContext(adminUser), "Ideas", "", time.Time{}, time.Time{})
+	if broken, _ := service.GetBrokenLinks(ctx); len(broken) != 1 || broken[0].TargetTitle != "Ideas" {
+		t.Errorf("Expected links not to resolve to another user's note, got %v", broken)
+	}
+
+	if err := service.DeleteNote(ctx, plans.ID); err != nil {
+		t.Fatalf("Failed to delete note: %v", err)
+	}
+	if broken, _ := service.GetBrokenLinks(ctx); len(broken) != 2 {
+		t.Errorf("Expected deleting the target to break the link again, got %v", broken)
+	}
+
+	// Editing the content replaces the links
+	if _, err := service.UpdateNote(ctx, source.ID, "Index", "Nothing here"); err != nil {
+		t.Fatalf("Failed to update note: %v", err)
+	}
+	if len(links.links[source.ID]) != 0 {
+		t.Errorf("Expected the links to be removed, got %v", links.links[source.ID])
+	}
+}
+
+func TestRenamingNoteRewritesLinks(t *testing.T) {
+	repo := newMockRepository()
+	service, _, audit := newLinkedNoteService(repo)
+	ctx := userContext(editorUser)
+
+	target, _ := service.CreateNote(ctx, "Plans", "", time.Time{}, time.Time{})
+	source, _ := service.CreateNote(ctx, "Index", "See [[plans]] and [[Plans B]]", time.Time{}, time.Time{})
+	entries := len(audit.events)
+
+	if _, err := service.UpdateNote(ctx, target.ID, "Roadmap", ""); err != nil {
+		t.Fatalf("Failed to rename note: %v", err)
+	}
+	if got := repo.notes[source.ID].Content; got != "See [[Roadmap]] and [[Plans B]]" {
+		t.Errorf("Expected the link to be rewritten, got %q", got)
+	}
+	if len(audit.events) != entries+2 {
+		t.Errorf("Expected the rename and the rewrite to be audited, got %d entries", len(audit.events)-entries)
+	}
+	if _, backlinks, _ := service.GetNoteLinks(ctx, target.ID); len(backlinks) != 1 {
+		t.Errorf("Expected the rewritten link to keep pointing at the note, got %v", backlinks)
+	}
+
+	// Changing only the case of the title leaves the links alone
+	if _, err := service.UpdateNote(ctx, target.ID, "roadmap", ""); err != nil {
+		t.Fatalf("Failed to update note: %v", err)
+	}
+	if got := repo.notes[source.ID].Content; got != "See [[Roadmap]] and [[Plans B]]" {
+		t.Errorf("Expected the links to be kept, got %q", got)
+	}
+}
+
+// failingBacklinksRepository is a link repository that cannot find backlinks
+type failingBacklinksRepository struct {
+	*mockLinkRepository
+}
+
+func (m failingBacklinksRepository) FindBacklinks(ctx context.Context, targetID int64) ([]*domain.Note, error) {
+	return nil, errors.New("backlinks unavailable")
+}
+
+func TestRenamingNoteRollsBackWhenLinksFail(t *testing.T) {
+	repo := newMockRepository()
+	links := newMockLinkRepository()
+	links.notes = repo
+	tx := &mockTransactor{}
+	service := services.NewNoteService(repo, newMockShareRepository(repo), newMockUserRepository(),
+		&mockAuditRepository{}, newMockTemplateRepository(), failingBacklinksRepository{links}, tx)
+	ctx := userContext(editorUser)
+
+	target, _ := service.CreateNote(ctx, "Plans", "", time.Time{}, time.Time{})
+	committed := tx.committed
+
+	if _, err := service.UpdateNote(ctx, target.ID, "Roadmap", ""); err == nil {
+		t.Fatal("Expected the rename to fail when its links cannot be rewritten")
+	}
+	if tx.committed != committed || tx.rolledBack != 1 {
+		t.Errorf("Expected the rename to roll back with its links, got %d commits and %d rollbacks", tx.committed-committed, tx.rolledBack)
+	}
+}
+
+func TestRenamingNoteRewritesOnlyEditableLinks(t *testing.T) {
+	repo := newMockRepository()
+	links := newMockLinkRepository()
+	links.notes = repo
+	shares := newMockShareRepository(repo)
+	m := metrics.New()
+	service := services.NewInstrumentedNoteService(services.NewNoteService(repo, shares, newMockUserRepository(),
+		&mockAuditRepository{}, newMockTemplateRepository(), links, &mockTransactor{}), m)
+	ctx := userContext(editorUser)
+
+	target, _ := service.CreateNote(ctx, "Plans", "", time.Time{}, time.Time{})
+	shared, _ := service.CreateNote(ctx, "Shared", "See [[Plans]]", time.Time{}, time.Time{})
+	private, _ := service.CreateNote(ctx, "Private", "See [[Plans]]", time.Time{}, time.Time{})
+	otherEditor := &domain.User{ID: 4, Username: "other", Role: domain.RoleEditor}
+	_ = shares.Grant(ctx, target.ID, otherEditor.ID, domain.ShareEdit)
+	_ = shares.Grant(ctx, shared.ID, otherEditor.ID, domain.ShareEdit)
+
+	if _, err := service.UpdateNote(userContext(otherEditor), target.ID, "Roadmap", ""); err != nil {
+		t.Fatalf("Failed to rename note: %v", err)
+	}
+	if got := repo.notes[shared.ID].Content; got != "See [[Roadmap]]" {
+		t.Errorf("Expected the link in the shared note to be rewritten, got %q", got)
+	}
+	if got := repo.notes[private.ID].Content; got != "See [[Plans]]" {
+		t.Errorf("Expected the note the user may not edit to be left alone, got %q", got)
+	}
+	// The rewrite is an update like any other, passing through the decorators
+	if got := testutil.ToFloat64(m.NotesUpdated); got != 2 {
+		t.Errorf("Expected the rename and the rewrite to be counted, got %v", got)
+	}
+}
+
+func TestSuggestLinkTitles(t *testing.T) {
+	repo := newMockRepository()
+	service, _, _ := newLinkedNoteService(repo)
+	ctx := userContext(editorUser)
+	for _, title := range []string{"Plans", "plan [draft]", "Planets", "Ideas"} {
+		_, _ = service.CreateNote(ctx, title, "", time.Time{}, time.Time{})
+	}
+	_, _ = service.CreateNote(userContext(adminUser), "Planning", "", time.Time{}, time.Time{})
+
+	titles, err := service.SuggestLinkTitles(ctx, " plan")
+	if err != nil {
+		t.Fatalf("Failed to suggest titles: %v", err)
+	}
+	if want := []string{"Planets", "Plans"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("Expected the suggestions %v, got %v", want, titles)
+	}
+	if _, err := service.SuggestLinkTitles(context.Background(), "plan"); !errors.Is(err, services.ErrUnauthenticated) {
+		t.Errorf("Expected anonymous callers to be refused, got %v", err)
+	}
+}
+
+// Set up a router with the note pages signed in as user, keeping links
+func setupLinkRouter(t *testing.T, user *domain.User) (*gin.Engine, services.NoteService) {
+	r := fixtures.NewRouter(t, user)
+
+	repo := newMockRepository()
+	service, _, _ := newLinkedNoteService(repo)
+	noteHandler := handlers.NewNoteHandler(service, newTemplateService(), newSearchService(repo), testBaseURL)
+	r.GET("/notes/new", noteHandler.New)
+	r.GET("/notes/broken-links", noteHandler.BrokenLinks)
+	r.GET("/notes/link-suggestions", noteHandler.LinkSuggestions)
+	r.GET("/notes/:id", noteHandler.Show)
+	return r, service
+}
+
+func TestNotePageRendersLinks(t *testing.T) {
+	router, service := setupLinkRouter(t, editorUser)
+	ctx := userContext(editorUser)
+	_, _ = service.CreateNote(ctx, "Plans", "", time.Time{}, time.Time{})
+	_, _ = service.CreateNote(ctx, "Index", "<b>See</b> [[plans]] and [[Ideas & Co]]", time.Time{}, time.Time{})
+
+	w := serve(router, "GET", "/notes/2", nil, false)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `<a href="/notes/1" class="link link-primary">plans</a>`) {
+		t.Fatalf("Expected a link to the note, got %d: %s", w.Code, body)
+	}
+	if !strings.Contains(body, `href="/notes/new?title=Ideas%20%26%20Co"`) || !strings.Contains(body, "&lt;b&gt;See&lt;/b&gt;") {
+		t.Error("Expected the broken link to offer creating the note and the text to be escaped")
+	}
+
+	w = serve(router, "GET", "/notes/1", nil, false)
+	if body := w.Body.String(); !strings.Contains(body, "Linked from") || !strings.Contains(body, `href="/notes/2"`) {
+		t.Error("Expected a backlink from the index")
+	}
+
+	w = serve(router, "GET", "/notes/broken-links", nil, false)
+	if body := w.Body.String(); !strings.Contains(body, "Ideas &amp; Co") || strings.Contains(body, ">plans<") {
+		t.Errorf("Expected only the broken link to be listed, got %s", body)
+	}
+
+	w = serve(router, "GET", "/notes/new?title="+url.QueryEscape("Ideas & Co"), nil, false)
+	if !strings.Contains(w.Body.String(), `value="Ideas &amp; Co"`) {
+		t.Error("Expected the form to be prefilled with the title")
+	}
+
+	w = serve(router, "GET", "/notes/link-suggestions?q=pla", nil, true)
+	if body := w.Body.String(); !strings.Contains(body, `data-title="Plans"`) || strings.Contains(body, "Index") {
+		t.Errorf("Expected the matching title to be suggested, got %s", body)
+	}
+}
@@ -0,0 +1,111 @@
+package unit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/middlewares"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+)
+
+// Setup a router that logs into buf
+func setupLoggerRouter(buf *bytes.Buffer) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.LoggerMiddleware(utils.NewLogger(buf, "debug")))
+
+	r.GET("/notes/:id", func(c *gin.Context) {
+		utils.LoggerFromContext(c.Request.Context()).Info("handler called")
+		c.Status(http.StatusNoContent)
+	})
+
+	return r
+}
+
+// Decode every JSON log line in buf
+func decodeLogLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var lines []map[string]any
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		line := map[string]any{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("Failed to decode log line %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestLoggerMiddlewarePropagatesRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	router := setupLoggerRouter(&buf)
+
+	req, _ := http.NewRequest("GET", "/notes/1", nil)
+	req.Header.Set(middlewares.RequestIDHeader, "abc-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if got := w.Header().Get(middlewares.RequestIDHeader); got != "abc-123" {
+		t.Errorf("Expected request ID to be echoed, got %q", got)
+	}
+
+	lines := decodeLogLines(t, &buf)
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if line["request_id"] != "abc-123" {
+			t.Errorf("Expected request_id abc-123, got %v", line["request_id"])
+		}
+	}
+
+	access := lines[1]
+	if access["method"] != "GET" || access["path"] != "/notes/1" || access["route"] != "/notes/:id" {
+		t.Errorf("Unexpected access log %v", access)
+	}
+	if access["status"] != float64(http.StatusNoContent) {
+		t.Errorf("Expected status %d, got %v", http.StatusNoContent, access["status"])
+	}
+	if _, ok := access["latency"]; !ok {
+		t.Error("Expected latency to be logged")
+	}
+}
+
+func TestLoggerMiddlewareGeneratesRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	router := setupLoggerRouter(&buf)
+
+	for _, incoming := range []string{"", "bad id\nwith newline"} {
+		req, _ := http.NewRequest("GET", "/notes/1", nil)
+		if incoming != "" {
+			req.Header.Set(middlewares.RequestIDHeader, incoming)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		got := w.Header().Get(middlewares.RequestIDHeader)
+		if got == "" || got == incoming {
+			t.Errorf("Expected a generated request ID for %q, got %q", incoming, got)
+		}
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	tests := map[string]string{
+		"debug":   "DEBUG",
+		"INFO":    "INFO",
+		"warning": "WARN",
+		"error":   "ERROR",
+		"bogus":   "INFO",
+	}
+	for input, expected := range tests {
+		if got := utils.ParseLogLevel(input).String(); got != expected {
+			t.Errorf("ParseLogLevel(%q) = %s, expected %s", input, got, expected)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package unit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/metrics"
+	"github.com/mas-diq/htmx-basic-crud/internals/middlewares"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// Scrape the metrics endpoint and return its body
+func scrapeMetrics(t *testing.T, m *metrics.Metrics) string {
+	server := httptest.NewServer(m.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to scrape metrics: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
+
+func TestMetricsMiddlewareRecordsRoutes(t *testing.T) {
+	m := metrics.New()
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.MetricsMiddleware(m))
+	r.GET("/notes/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for _, path := range []string{"/notes/1", "/notes/2", "/missing"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if got := testutil.ToFloat64(m.HTTPRequests.WithLabelValues("GET", "/notes/:id", "200")); got != 2 {
+		t.Errorf("Expected 2 requests for /notes/:id, got %v", got)
+	}
+	if got := testutil.ToFloat64(m.HTTPRequests.WithLabelValues("GET", "unmatched", "404")); got != 1 {
+		t.Errorf("Expected 1 unmatched request, got %v", got)
+	}
+
+	body := scrapeMetrics(t, m)
+	if !strings.Contains(body, `http_request_duration_seconds_count{method="GET",route="/notes/:id"} 2`) {
+		t.Error("Expected latency histogram for /notes/:id")
+	}
+}
+
+func TestInstrumentedServiceCountsMutations(t *testing.T) {
+	m := metrics.New()
+	repo := repositories.NewInstrumentedNoteRepository(newMockRepository(), m)
+	service := services.NewInstrumentedNoteService(newNoteService(repo), m)
+	ctx := userContext(adminUser)
+
+	note, err := service.CreateNote(ctx, "Title", "Content", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Error creating note: %v", err)
+	}
+	if _, err := service.UpdateNote(ctx, note.ID, "New title", "New content"); err != nil {
+		t.Fatalf("Error updating note: %v", err)
+	}
+	if err := service.DeleteNote(ctx, note.ID); err != nil {
+		t.Fatalf("Error deleting note: %v", err)
+	}
+	// Failed mutations are not counted
+	if err := service.DeleteNote(ctx, note.ID); err != services.ErrNoteNotFound {
+		t.Fatalf("Expected ErrNoteNotFound, got %v", err)
+	}
+
+	for name, counter := range map[string]float64{
+		"created": testutil.ToFloat64(m.NotesCreated),
+		"updated": testutil.ToFloat64(m.NotesUpdated),
+		"deleted": testutil.ToFloat64(m.NotesDeleted),
+	} {
+		if counter != 1 {
+			t.Errorf("Expected 1 note %s, got %v", name, counter)
+		}
+	}
+
+	body := scrapeMetrics(t, m)
+	for _, op := range []string{"Create", "FindByID", "Update", "Delete"} {
+		if !strings.Contains(body, `repository_operation_duration_seconds_count{operation="`+op+`",outcome="success"}`) {
+			t.Errorf("Expected repository latency for %s", op)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package unit
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mas-diq/htmx-basic-crud/migrations"
+)
+
+func TestMigrationStatements(t *testing.T) {
+	script := `-- Create the table
+CREATE TABLE a (
+    id INT
+);
+
+-- Seed it
+INSERT INTO a (id) VALUES (1);
+INSERT INTO a (id) VALUES (2)
+`
+
+	expected := []string{
+		"CREATE TABLE a (\n    id INT\n)",
+		"INSERT INTO a (id) VALUES (1)",
+		"INSERT INTO a (id) VALUES (2)",
+	}
+	if got := migrations.Statements(script); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
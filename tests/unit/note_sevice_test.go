@@ -1,10 +1,16 @@
 package unit
 
 import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
 	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
 	"github.com/mas-diq/htmx-basic-crud/internals/services"
 )
 
@@ -12,16 +18,20 @@ import (
 type mockNoteRepository struct {
 	notes  map[int64]*domain.Note
 	nextID int64
+	// reminded holds the reminder time of a note that fired; changing the
+	// note's reminder time makes it due again
+	reminded map[int64]time.Time
 }
 
 func newMockRepository() *mockNoteRepository {
 	return &mockNoteRepository{
-		notes:  make(map[int64]*domain.Note),
-		nextID: 1,
+		notes:    make(map[int64]*domain.Note),
+		nextID:   1,
+		reminded: make(map[int64]time.Time),
 	}
 }
 
-func (m *mockNoteRepository) FindAll() ([]*domain.Note, error) {
+func (m *mockNoteRepository) FindAll(ctx context.Context) ([]*domain.Note, error) {
 	var notes []*domain.Note
 	for _, note := range m.notes {
 		notes = append(notes, note)
@@ -29,7 +39,17 @@ func (m *mockNoteRepository) FindAll() ([]*domain.Note, error) {
 	return notes, nil
 }
 
-func (m *mockNoteRepository) FindByID(id int64) (*domain.Note, error) {
+func (m *mockNoteRepository) FindByOwner(ctx context.Context, userID int64) ([]*domain.Note, error) {
+	var notes []*domain.Note
+	for _, note := range m.notes {
+		if note.UserID == userID {
+			notes = append(notes, note)
+		}
+	}
+	return notes, nil
+}
+
+func (m *mockNoteRepository) FindByID(ctx context.Context, id int64) (*domain.Note, error) {
 	note, exists := m.notes[id]
 	if !exists {
 		return nil, nil
@@ -37,7 +57,12 @@ func (m *mockNoteRepository) FindByID(id int64) (*domain.Note, error) {
 	return note, nil
 }
 
-func (m *mockNoteRepository) Create(note *domain.Note) (int64, error) {
+func (m *mockNoteRepository) Create(ctx context.Context, note *domain.Note) (int64, error) {
+	if !note.JournalDate.IsZero() {
+		if existing, _ := m.FindJournal(ctx, note.UserID, note.JournalDate); existing != nil {
+			return 0, repositories.ErrDuplicate
+		}
+	}
 	id := m.nextID
 	m.nextID++
 	note.ID = id
@@ -45,7 +70,7 @@ func (m *mockNoteRepository) Create(note *domain.Note) (int64, error) {
 	return id, nil
 }
 
-func (m *mockNoteRepository) Update(note *domain.Note) error {
+func (m *mockNoteRepository) Update(ctx context.Context, note *domain.Note) error {
 	if _, exists := m.notes[note.ID]; !exists {
 		return nil
 	}
@@ -53,19 +78,180 @@ func (m *mockNoteRepository) Update(note *domain.Note) error {
 	return nil
 }
 
-func (m *mockNoteRepository) Delete(id int64) error {
+func (m *mockNoteRepository) Delete(ctx context.Context, id int64) error {
 	delete(m.notes, id)
 	return nil
 }
 
+func (m *mockNoteRepository) UpdateSchedule(ctx context.Context, note *domain.Note) error {
+	if stored, exists := m.notes[note.ID]; exists {
+		stored.DueAt, stored.RemindAt = note.DueAt, note.RemindAt
+	}
+	return nil
+}
+
+func (m *mockNoteRepository) FindUpcoming(ctx context.Context, userID int64) ([]*domain.Note, error) {
+	var notes []*domain.Note
+	for _, note := range m.notes {
+		if !note.DueAt.IsZero() && (userID == 0 || note.UserID == userID) {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if !notes[i].DueAt.Equal(notes[j].DueAt) {
+			return notes[i].DueAt.Before(notes[j].DueAt)
+		}
+		return notes[i].ID < notes[j].ID
+	})
+	return notes, nil
+}
+
+func (m *mockNoteRepository) FindDueReminders(ctx context.Context, now time.Time, limit int) ([]*domain.Note, error) {
+	var notes []*domain.Note
+	for _, note := range m.notes {
+		if !m.fired(note) && !note.RemindAt.IsZero() && !note.RemindAt.After(now) {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if !notes[i].RemindAt.Equal(notes[j].RemindAt) {
+			return notes[i].RemindAt.Before(notes[j].RemindAt)
+		}
+		return notes[i].ID < notes[j].ID
+	})
+	return notes[:min(len(notes), limit)], nil
+}
+
+func (m *mockNoteRepository) MarkReminded(ctx context.Context, id int64, remindAt, now time.Time) (bool, error) {
+	note, exists := m.notes[id]
+	if !exists || m.fired(note) || !note.RemindAt.Equal(remindAt) {
+		return false, nil
+	}
+	m.reminded[id] = remindAt
+	return true, nil
+}
+
+func (m *mockNoteRepository) FindJournal(ctx context.Context, userID int64, date time.Time) (*domain.Note, error) {
+	for _, note := range m.notes {
+		if note.UserID == userID && !note.JournalDate.IsZero() && note.JournalDate.Equal(date) {
+			return note, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockNoteRepository) FindJournalDates(ctx context.Context, userID int64, from, to time.Time) ([]time.Time, error) {
+	var dates []time.Time
+	for _, note := range m.notes {
+		if note.UserID == userID && !note.JournalDate.IsZero() && !note.JournalDate.Before(from) && note.JournalDate.Before(to) {
+			dates = append(dates, note.JournalDate)
+		}
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dates, nil
+}
+
+func (m *mockNoteRepository) FindByTitlePrefix(ctx context.Context, userID int64, prefix string, limit int) ([]*domain.Note, error) {
+	var notes []*domain.Note
+	for _, note := range m.notes {
+		if note.UserID == userID && strings.HasPrefix(strings.ToLower(note.Title), strings.ToLower(prefix)) {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].Title < notes[j].Title })
+	if len(notes) > limit {
+		notes = notes[:limit]
+	}
+	return notes, nil
+}
+
+func (m *mockNoteRepository) Search(ctx context.Context, userID int64, query *domain.SearchQuery) ([]*domain.Note, error) {
+	var notes []*domain.Note
+	for _, note := range m.notes {
+		if (userID == 0 || note.UserID == userID) && matchesSearch(note, query) {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].ID > notes[j].ID })
+	return notes, nil
+}
+
+func (m *mockNoteRepository) CountSearch(ctx context.Context, userID int64, query *domain.SearchQuery) (int, error) {
+	notes, err := m.Search(ctx, userID, query)
+	return len(notes), err
+}
+
+func (m *mockNoteRepository) FindByDateRange(ctx context.Context, userID int64, dates domain.DateRange) ([]*domain.Note, error) {
+	var notes []*domain.Note
+	for _, note := range m.notes {
+		at := dates.Time(note)
+		if (userID == 0 || note.UserID == userID) && (dates.From.IsZero() || !at.Before(dates.From)) &&
+			(dates.To.IsZero() || at.Before(dates.To)) {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool { return dates.Time(notes[i]).After(dates.Time(notes[j])) })
+	return notes, nil
+}
+
+// matchesSearch evaluates a search the way the repository's SQL does
+func matchesSearch(note *domain.Note, query *domain.SearchQuery) bool {
+	contains := func(s, substr string) bool {
+		return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+	}
+	within := func(t time.Time, term domain.SearchTerm) bool {
+		return (term.From.IsZero() || !t.Before(term.From)) && (term.To.IsZero() || t.Before(term.To))
+	}
+	for _, term := range query.Terms {
+		var match bool
+		switch term.Field {
+		case domain.SearchText:
+			match = contains(note.Title, term.Text) || contains(note.Content, term.Text)
+		case domain.SearchTitle:
+			match = contains(note.Title, term.Text)
+		case domain.SearchCreated:
+			match = within(note.CreatedAt, term)
+		case domain.SearchUpdated:
+			match = within(note.UpdatedAt, term)
+		}
+		if match == term.Negate {
+			return false
+		}
+	}
+	return true
+}
+
+// fired reports whether the current reminder of note fired
+func (m *mockNoteRepository) fired(note *domain.Note) bool {
+	remindAt, ok := m.reminded[note.ID]
+	return ok && remindAt.Equal(note.RemindAt)
+}
+
+// Users acting in the tests
+var (
+	adminUser  = &domain.User{ID: 1, Username: "admin", Role: domain.RoleAdmin}
+	editorUser = &domain.User{ID: 2, Username: "editor", Role: domain.RoleEditor}
+	viewerUser = &domain.User{ID: 3, Username: "viewer", Role: domain.RoleViewer}
+)
+
+// Context acting on behalf of user
+func userContext(user *domain.User) context.Context {
+	return auth.WithUser(context.Background(), user)
+}
+
+// Create a note service over repo that shares with no one
+func newNoteService(repo repositories.NoteRepository) services.NoteService {
+	return services.NewNoteService(repo, newMockShareRepository(newMockRepository()), newMockUserRepository(), &mockAuditRepository{}, newMockTemplateRepository(), newMockLinkRepository(), &mockTransactor{})
+}
+
 func TestCreateNote(t *testing.T) {
 	repo := newMockRepository()
-	service := services.NewNoteService(repo)
+	service := newNoteService(repo)
 
 	title := "Test Note"
 	content := "This is a test note"
 
-	note, err := service.CreateNote(title, content)
+	note, err := service.CreateNote(userContext(adminUser), title, content, time.Time{}, time.Time{})
 	if err != nil {
 		t.Fatalf("Error creating note: %v", err)
 	}
@@ -92,9 +278,21 @@ func TestCreateNote(t *testing.T) {
 	}
 }
 
+func TestCreateNoteRequiresTitle(t *testing.T) {
+	repo := newMockRepository()
+	service := newNoteService(repo)
+
+	if _, err := service.CreateNote(userContext(adminUser), "   ", "content", time.Time{}, time.Time{}); !errors.Is(err, services.ErrTitleRequired) {
+		t.Errorf("Expected ErrTitleRequired, got %v", err)
+	}
+	if len(repo.notes) != 0 {
+		t.Error("Expected no note to be stored")
+	}
+}
+
 func TestGetNoteByID(t *testing.T) {
 	repo := newMockRepository()
-	service := services.NewNoteService(repo)
+	service := newNoteService(repo)
 
 	// Create a note first
 	now := time.Now()
@@ -108,7 +306,7 @@ func TestGetNoteByID(t *testing.T) {
 	repo.notes[1] = savedNote
 
 	// Get the note
-	note, err := service.GetNoteByID(1)
+	note, err := service.GetNoteByID(userContext(adminUser), 1)
 	if err != nil {
 		t.Fatalf("Error getting note: %v", err)
 	}
@@ -122,7 +320,7 @@ func TestGetNoteByID(t *testing.T) {
 	}
 
 	// Test non-existent note
-	_, err = service.GetNoteByID(999)
+	_, err = service.GetNoteByID(userContext(adminUser), 999)
 	if err != services.ErrNoteNotFound {
 		t.Errorf("Expected ErrNoteNotFound, got %v", err)
 	}
@@ -130,7 +328,7 @@ func TestGetNoteByID(t *testing.T) {
 
 func TestUpdateNote(t *testing.T) {
 	repo := newMockRepository()
-	service := services.NewNoteService(repo)
+	service := newNoteService(repo)
 
 	// Create a note first
 	now := time.Now()
@@ -147,7 +345,7 @@ func TestUpdateNote(t *testing.T) {
 	updatedTitle := "Updated Title"
 	updatedContent := "Updated content"
 
-	note, err := service.UpdateNote(1, updatedTitle, updatedContent)
+	note, err := service.UpdateNote(userContext(adminUser), 1, updatedTitle, updatedContent)
 	if err != nil {
 		t.Fatalf("Error updating note: %v", err)
 	}
@@ -161,7 +359,7 @@ func TestUpdateNote(t *testing.T) {
 	}
 
 	// Test non-existent note
-	_, err = service.UpdateNote(999, "Title", "Content")
+	_, err = service.UpdateNote(userContext(adminUser), 999, "Title", "Content")
 	if err != services.ErrNoteNotFound {
 		t.Errorf("Expected ErrNoteNotFound, got %v", err)
 	}
@@ -169,7 +367,7 @@ func TestUpdateNote(t *testing.T) {
 
 func TestDeleteNote(t *testing.T) {
 	repo := newMockRepository()
-	service := services.NewNoteService(repo)
+	service := newNoteService(repo)
 
 	// Create a note first
 	now := time.Now()
@@ -183,19 +381,19 @@ func TestDeleteNote(t *testing.T) {
 	repo.notes[1] = savedNote
 
 	// Delete the note
-	err := service.DeleteNote(1)
+	err := service.DeleteNote(userContext(adminUser), 1)
 	if err != nil {
 		t.Fatalf("Error deleting note: %v", err)
 	}
 
 	// Verify the note is gone
-	_, err = service.GetNoteByID(1)
+	_, err = service.GetNoteByID(userContext(adminUser), 1)
 	if err != services.ErrNoteNotFound {
 		t.Errorf("Expected ErrNoteNotFound, got %v", err)
 	}
 
 	// Test deleting non-existent note
-	err = service.DeleteNote(999)
+	err = service.DeleteNote(userContext(adminUser), 999)
 	if err != services.ErrNoteNotFound {
 		t.Errorf("Expected ErrNoteNotFound, got %v", err)
 	}
@@ -203,7 +401,7 @@ func TestDeleteNote(t *testing.T) {
 
 func TestGetAllNotes(t *testing.T) {
 	repo := newMockRepository()
-	service := services.NewNoteService(repo)
+	service := newNoteService(repo)
 
 	// Create some notes
 	now := time.Now()
@@ -212,7 +410,7 @@ func TestGetAllNotes(t *testing.T) {
 	repo.notes[3] = &domain.Note{ID: 3, Title: "Note 3", Content: "Content 3", CreatedAt: now, UpdatedAt: now}
 
 	// Get all notes
-	notes, err := service.GetAllNotes()
+	notes, err := service.GetAllNotes(userContext(adminUser))
 	if err != nil {
 		t.Fatalf("Error getting all notes: %v", err)
 	}
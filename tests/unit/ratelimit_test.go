@@ -0,0 +1,181 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/middlewares"
+	"github.com/mas-diq/htmx-basic-crud/internals/ratelimit"
+)
+
+// fakeClock is a manually advanced clock
+type fakeClock struct {
+	now time.Time
+}
+
+func (f *fakeClock) Now() time.Time { return f.now }
+
+func (f *fakeClock) Advance(d time.Duration) { f.now = f.now.Add(d) }
+
+func TestMemoryStoreTokenBucket(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	store := ratelimit.NewMemoryStore(ratelimit.WithClock(clock.Now))
+	limit := ratelimit.Limit{Requests: 3, Per: time.Minute}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		result, _ := store.Take(ctx, "client", limit)
+		if !result.Allowed {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+		if result.Remaining != 2-i {
+			t.Errorf("Expected %d remaining, got %d", 2-i, result.Remaining)
+		}
+	}
+
+	result, _ := store.Take(ctx, "client", limit)
+	if result.Allowed {
+		t.Fatal("Expected the fourth request to be rejected")
+	}
+	if result.RetryAfter != 20*time.Second {
+		t.Errorf("Expected to retry after 20s, got %v", result.RetryAfter)
+	}
+
+	// Other keys have their own bucket
+	if result, _ := store.Take(ctx, "other", limit); !result.Allowed {
+		t.Error("Expected another client to be allowed")
+	}
+
+	// One token is refilled every 20s
+	clock.Advance(20 * time.Second)
+	if result, _ := store.Take(ctx, "client", limit); !result.Allowed {
+		t.Error("Expected a refilled token to be allowed")
+	}
+	if result, _ := store.Take(ctx, "client", limit); result.Allowed {
+		t.Error("Expected only one token to be refilled")
+	}
+}
+
+func TestLimiterLockout(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(ratelimit.WithClock(clock.Now)), ratelimit.Policy{
+		LockoutThreshold: 3,
+		LockoutDuration:  10 * time.Minute,
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if locked, _ := limiter.LoginFailed(ctx, "ip:1.2.3.4"); locked != 0 {
+			t.Fatalf("Expected no lockout after %d failures", i+1)
+		}
+	}
+	clock.Advance(time.Minute)
+	if locked, _ := limiter.LoginFailed(ctx, "ip:1.2.3.4"); locked != 9*time.Minute {
+		t.Errorf("Expected a lockout until 10m after the first failure, got %v", locked)
+	}
+	if locked, _ := limiter.Locked(ctx, "ip:1.2.3.4"); locked == 0 {
+		t.Error("Expected the client to be locked out")
+	}
+	if locked, _ := limiter.Locked(ctx, "ip:5.6.7.8"); locked != 0 {
+		t.Error("Expected other clients not to be locked out")
+	}
+
+	clock.Advance(9 * time.Minute)
+	if locked, _ := limiter.Locked(ctx, "ip:1.2.3.4"); locked != 0 {
+		t.Errorf("Expected the lockout to expire, got %v", locked)
+	}
+
+	// A successful login clears earlier failures
+	limiter.LoginFailed(ctx, "ip:1.2.3.4")
+	limiter.LoginFailed(ctx, "ip:1.2.3.4")
+	limiter.LoginSucceeded(ctx, "ip:1.2.3.4")
+	if locked, _ := limiter.LoginFailed(ctx, "ip:1.2.3.4"); locked != 0 {
+		t.Error("Expected a successful login to reset the failures")
+	}
+}
+
+// Setup a router limited by policy. Requests sending an X-User header are
+// signed in as that user.
+func setupRateLimitRouter(policy ratelimit.Policy) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), policy)
+
+	r := gin.New()
+	r.Use(middlewares.ErrorMiddleware())
+	r.Use(func(c *gin.Context) {
+		if name := c.GetHeader("X-User"); name != "" {
+			middlewares.SetUser(c, &domain.User{Username: name, Role: domain.RoleViewer})
+		}
+	})
+	r.Use(middlewares.RateLimitMiddleware(limiter))
+	r.GET("/notes", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/notes", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	return r
+}
+
+func request(router *gin.Engine, method, path, ip string, header map[string]string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.RemoteAddr = ip + ":1234"
+	req.Header.Set("Accept", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	router := setupRateLimitRouter(ratelimit.Policy{
+		Reads:  ratelimit.Limit{Requests: 5, Per: time.Minute},
+		Writes: ratelimit.Limit{Requests: 2, Per: time.Minute},
+	})
+
+	for i := 0; i < 2; i++ {
+		if w := request(router, "POST", "/notes", "10.0.0.1", nil); w.Code != http.StatusCreated {
+			t.Fatalf("Expected write %d to be allowed, got %d", i+1, w.Code)
+		}
+	}
+
+	w := request(router, "POST", "/notes", "10.0.0.1", nil)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+	expected := map[string]string{
+		"Retry-After":           "30",
+		"X-RateLimit-Limit":     "2",
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     "60",
+	}
+	for header, value := range expected {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("Expected %s %q, got %q", header, value, got)
+		}
+	}
+
+	// Reads have their own limit
+	w = request(router, "GET", "/notes", "10.0.0.1", nil)
+	if w.Code != http.StatusOK || w.Header().Get("X-RateLimit-Limit") != "5" {
+		t.Errorf("Expected reads to use the read limit, got %d %q", w.Code, w.Header().Get("X-RateLimit-Limit"))
+	}
+
+	// Other clients are counted separately, by IP or signed in user
+	if w := request(router, "POST", "/notes", "10.0.0.2", nil); w.Code != http.StatusCreated {
+		t.Errorf("Expected another IP to be allowed, got %d", w.Code)
+	}
+	if w := request(router, "POST", "/notes", "10.0.0.1", map[string]string{"X-User": "alice"}); w.Code != http.StatusCreated {
+		t.Errorf("Expected a signed in user to be allowed, got %d", w.Code)
+	}
+
+	// Unauthenticated headers do not pick a fresh bucket
+	for _, key := range []string{"one", "two"} {
+		if w := request(router, "POST", "/notes", "10.0.0.1", map[string]string{"X-API-Key": key}); w.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected an unvalidated API key to share the IP's limit, got %d", w.Code)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/middlewares"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+)
+
+// testBaseURL is the configured public URL share links are built from
+const testBaseURL = "https://notes.example.com"
+
+// Middleware signing every request in as user
+func signIn(user *domain.User) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		middlewares.SetUser(c, user)
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	tests := []struct {
+		role    domain.Role
+		allowed []domain.Permission
+		denied  []domain.Permission
+	}{
+		{domain.RoleAdmin, []domain.Permission{domain.PermNotesWrite, domain.PermNotesEditAll, domain.PermUsersManage}, nil},
+		{domain.RoleEditor, []domain.Permission{domain.PermNotesRead, domain.PermNotesWrite, domain.PermTemplatesManage},
+			[]domain.Permission{domain.PermNotesReadAll, domain.PermNotesEditAll, domain.PermUsersManage}},
+		{domain.RoleViewer, []domain.Permission{domain.PermNotesRead},
+			[]domain.Permission{domain.PermNotesWrite, domain.PermUsersManage, domain.PermTemplatesManage}},
+		{domain.Role("owner"), nil, []domain.Permission{domain.PermNotesRead}},
+	}
+
+	for _, tt := range tests {
+		for _, p := range tt.allowed {
+			if !tt.role.Can(p) {
+				t.Errorf("Expected %s to have %s", tt.role, p)
+			}
+		}
+		for _, p := range tt.denied {
+			if tt.role.Can(p) {
+				t.Errorf("Expected %s not to have %s", tt.role, p)
+			}
+		}
+	}
+
+	var anonymous *domain.User
+	if anonymous.Can(domain.PermNotesRead) || anonymous.CanRead(&domain.Note{}) {
+		t.Error("Expected a nil user to have no permissions")
+	}
+}
+
+func TestNoteServiceEnforcesRoles(t *testing.T) {
+	repo := newMockRepository()
+	service := newNoteService(repo)
+	otherEditor := &domain.User{ID: 4, Username: "other", Role: domain.RoleEditor}
+
+	note, err := service.CreateNote(userContext(editorUser), "Mine", "content", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Error creating note: %v", err)
+	}
+	if note.UserID != editorUser.ID {
+		t.Errorf("Expected the note to be owned by the editor, got user %d", note.UserID)
+	}
+
+	// Viewers and anonymous requests cannot create notes
+	if _, err := service.CreateNote(userContext(viewerUser), "Title", "", time.Time{}, time.Time{}); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for a viewer, got %v", err)
+	}
+	if _, err := service.CreateNote(context.Background(), "Title", "", time.Time{}, time.Time{}); !errors.Is(err, services.ErrUnauthenticated) {
+		t.Errorf("Expected ErrUnauthenticated without a user, got %v", err)
+	}
+
+	// Other editors can neither see nor change the note
+	if _, err := service.GetNoteByID(userContext(otherEditor), note.ID); !errors.Is(err, services.ErrNoteNotFound) {
+		t.Errorf("Expected the note to be hidden from other editors, got %v", err)
+	}
+	if _, err := service.UpdateNote(userContext(otherEditor), note.ID, "Stolen", ""); !errors.Is(err, services.ErrNoteNotFound) {
+		t.Errorf("Expected other editors not to update the note, got %v", err)
+	}
+	if notes, _ := service.GetAllNotes(userContext(otherEditor)); len(notes) != 0 {
+		t.Errorf("Expected other editors to list no notes, got %d", len(notes))
+	}
+
+	// A viewer who owns a note can read it but not change it
+	repo.notes[10] = &domain.Note{ID: 10, UserID: viewerUser.ID, Title: "Read only"}
+	if _, err := service.GetNoteByID(userContext(viewerUser), 10); err != nil {
+		t.Errorf("Expected the viewer to read their note, got %v", err)
+	}
+	if err := service.DeleteNote(userContext(viewerUser), 10); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for a viewer deleting, got %v", err)
+	}
+
+	// Admins see and change everything
+	if notes, _ := service.GetAllNotes(userContext(adminUser)); len(notes) != 2 {
+		t.Errorf("Expected the admin to list every note, got %d", len(notes))
+	}
+	if _, err := service.UpdateNote(userContext(adminUser), note.ID, "Edited", ""); err != nil {
+		t.Errorf("Expected the admin to update any note, got %v", err)
+	}
+}
+
+// Setup the note and admin routes as served in production for user
+func setupRBACRouter(t *testing.T, user *domain.User) (*gin.Engine, *mockNoteRepository) {
+	r := fixtures.NewRouter(t, user)
+
+	repo := newMockRepository()
+	noteHandler := handlers.NewNoteHandler(newNoteService(repo), newTemplateService(), newSearchService(repo), testBaseURL)
+	notes := r.Group("/", middlewares.RequireLogin())
+	notes.GET("/notes", noteHandler.Index)
+	notes.GET("/notes/new", middlewares.RequirePermission(domain.PermNotesWrite), noteHandler.New)
+	notes.GET("/notes/:id", noteHandler.Show)
+	notes.DELETE("/notes/:id", noteHandler.Delete)
+	notes.GET("/admin/users", middlewares.RequirePermission(domain.PermUsersManage), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	return r, repo
+}
+
+func TestRequireLogin(t *testing.T) {
+	router, _ := setupRBACRouter(t, nil)
+
+	w := serve(router, "GET", "/notes/1", nil, false)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login?next=%2Fnotes%2F1" {
+		t.Errorf("Expected browsers to be redirected to the login page, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	w = serve(router, "DELETE", "/notes/1", nil, true)
+	if w.Code != http.StatusUnauthorized || !strings.HasPrefix(w.Header().Get("HX-Redirect"), "/login") {
+		t.Errorf("Expected HTMX requests to be sent to the login page, got %d %q", w.Code, w.Header().Get("HX-Redirect"))
+	}
+
+	req, _ := http.NewRequest("GET", "/notes", nil)
+	req.Header.Set("Accept", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected API clients to get a 401, got %d", w.Code)
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		user     *domain.User
+		path     string
+		expected int
+	}{
+		{viewerUser, "/notes/new", http.StatusForbidden},
+		{editorUser, "/notes/new", http.StatusOK},
+		{editorUser, "/admin/users", http.StatusForbidden},
+		{adminUser, "/admin/users", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		router, _ := setupRBACRouter(t, tt.user)
+		if w := serve(router, "GET", tt.path, nil, false); w.Code != tt.expected {
+			t.Errorf("%s GET %s: expected %d, got %d", tt.user.Role, tt.path, tt.expected, w.Code)
+		}
+	}
+}
+
+func TestViewerCannotDeleteNote(t *testing.T) {
+	router, repo := setupRBACRouter(t, viewerUser)
+	repo.notes[1] = &domain.Note{ID: 1, UserID: viewerUser.ID, Title: "Mine"}
+
+	if w := serve(router, "DELETE", "/notes/1", nil, true); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a viewer deleting to get a 403, got %d", w.Code)
+	}
+	if _, ok := repo.notes[1]; !ok {
+		t.Error("Expected the note to survive")
+	}
+}
+
+func TestTemplatesHideDisallowedActions(t *testing.T) {
+	tests := []struct {
+		user     *domain.User
+		newNote  bool
+		editNote bool
+		admin    bool
+	}{
+		{adminUser, true, true, true},
+		{editorUser, true, true, false},
+		{viewerUser, false, false, false},
+	}
+
+	for _, tt := range tests {
+		router, repo := setupRBACRouter(t, tt.user)
+		repo.notes[1] = &domain.Note{ID: 1, UserID: tt.user.ID, Title: "Note"}
+
+		body := serve(router, "GET", "/notes", nil, false).Body.String()
+		if got := strings.Contains(body, `href="/notes/new"`); got != tt.newNote {
+			t.Errorf("%s: expected New Note shown=%v", tt.user.Role, tt.newNote)
+		}
+		if got := strings.Contains(body, `href="/notes/1/edit"`); got != tt.editNote {
+			t.Errorf("%s: expected Edit shown=%v", tt.user.Role, tt.editNote)
+		}
+		if got := strings.Contains(body, `hx-delete="/notes/1"`); got != tt.editNote {
+			t.Errorf("%s: expected Delete shown=%v", tt.user.Role, tt.editNote)
+		}
+		if got := strings.Contains(body, `href="/admin/users"`); got != tt.admin {
+			t.Errorf("%s: expected the Users link shown=%v", tt.user.Role, tt.admin)
+		}
+		if !strings.Contains(body, tt.user.Username) {
+			t.Errorf("%s: expected the navbar to show the username", tt.user.Role)
+		}
+
+		show := serve(router, "GET", "/notes/1", nil, false).Body.String()
+		if got := strings.Contains(show, `href="/notes/1/edit"`); got != tt.editNote {
+			t.Errorf("%s: expected Edit on the note page shown=%v", tt.user.Role, tt.editNote)
+		}
+	}
+}
@@ -0,0 +1,543 @@
+package unit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/mail"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+)
+
+// Mock notification repository
+type mockNotificationRepository struct {
+	notifications []*domain.Notification
+}
+
+func (m *mockNotificationRepository) Create(ctx context.Context, notification *domain.Notification) (int64, error) {
+	notification.ID = int64(len(m.notifications) + 1)
+	m.notifications = append(m.notifications, notification)
+	return notification.ID, nil
+}
+
+func (m *mockNotificationRepository) FindByUser(ctx context.Context, userID int64, limit int) ([]*domain.Notification, error) {
+	var notifications []*domain.Notification
+	for i := len(m.notifications) - 1; i >= 0 && len(notifications) < limit; i-- {
+		if m.notifications[i].UserID == userID {
+			notifications = append(notifications, m.notifications[i])
+		}
+	}
+	return notifications, nil
+}
+
+func (m *mockNotificationRepository) CountUnread(ctx context.Context, userID int64) (int, error) {
+	n := 0
+	for _, notification := range m.notifications {
+		if notification.UserID == userID && notification.Unread() {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *mockNotificationRepository) MarkRead(ctx context.Context, userID, id int64, now time.Time) (*domain.Notification, error) {
+	for _, notification := range m.notifications {
+		if notification.ID == id && notification.UserID == userID {
+			if notification.Unread() {
+				notification.ReadAt = now
+			}
+			return notification, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockNotificationRepository) MarkAllRead(ctx context.Context, userID int64, now time.Time) error {
+	for _, notification := range m.notifications {
+		if notification.UserID == userID && notification.Unread() {
+			notification.ReadAt = now
+		}
+	}
+	return nil
+}
+
+// A message received by the SMTP stand-in
+type receivedMail struct {
+	from, to string
+	data     string
+}
+
+// SMTP stand-in speaking just enough of the protocol to accept messages
+type fakeSMTPServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []receivedMail
+	received chan struct{}
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	s := &fakeSMTPServer{listener: listener, received: make(chan struct{}, 10)}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return s
+}
+
+// handle answers one SMTP session
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	_ = text.PrintfLine("220 localhost ESMTP")
+	var msg receivedMail
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch {
+		case verb == "EHLO" || verb == "HELO":
+			_ = text.PrintfLine("250 localhost")
+		case strings.HasPrefix(strings.ToUpper(line), "MAIL FROM:"):
+			msg.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			_ = text.PrintfLine("250 OK")
+		case strings.HasPrefix(strings.ToUpper(line), "RCPT TO:"):
+			msg.to = strings.Trim(line[len("RCPT TO:"):], "<> ")
+			_ = text.PrintfLine("250 OK")
+		case verb == "DATA":
+			_ = text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			lines, err := text.ReadDotLines()
+			if err != nil {
+				return
+			}
+			msg.data = strings.Join(lines, "\n")
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			s.received <- struct{}{}
+			_ = text.PrintfLine("250 OK")
+		case verb == "QUIT":
+			_ = text.PrintfLine("221 Bye")
+			return
+		default:
+			_ = text.PrintfLine("502 Command not implemented")
+		}
+	}
+}
+
+// sender returns an SMTPSender delivering to the stand-in
+func (s *fakeSMTPServer) sender() *mail.SMTPSender {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return mail.NewSMTPSender(mail.Config{Host: "127.0.0.1", Port: addr.Port, From: "notes@example.com"})
+}
+
+// wait returns the next message received, failing after a second
+func (s *fakeSMTPServer) wait(t *testing.T) receivedMail {
+	t.Helper()
+	select {
+	case <-s.received:
+	case <-time.After(time.Second):
+		t.Fatal("Expected an email to be received")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.messages[len(s.messages)-1]
+}
+
+func TestSMTPSenderDeliversMessage(t *testing.T) {
+	server := newFakeSMTPServer(t)
+
+	err := server.sender().Send(context.Background(), mail.Message{
+		To:      "editor@example.com",
+		Subject: "Reminder: Café",
+		Body:    "Line one\n.starts with a dot\n",
+	})
+	if err != nil {
+		t.Fatalf("Error sending email: %v", err)
+	}
+
+	msg := server.wait(t)
+	if msg.from != "notes@example.com" || msg.to != "editor@example.com" {
+		t.Errorf("Expected the envelope to name both addresses, got %q -> %q", msg.from, msg.to)
+	}
+	header, body, _ := strings.Cut(msg.data, "\n\n")
+	if !strings.Contains(header, "To: editor@example.com") || !strings.Contains(header, "Subject: =?utf-8?q?Reminder:_Caf=C3=A9?=") {
+		t.Errorf("Expected encoded headers, got %q", header)
+	}
+	if body != "Line one\n.starts with a dot" {
+		t.Errorf("Expected the body to survive dot stuffing, got %q", body)
+	}
+
+	err = server.sender().Send(context.Background(), mail.Message{To: "a@example.com\r\nBcc: b@example.com", Subject: "x"})
+	if err == nil {
+		t.Error("Expected a line break in a header to be rejected")
+	}
+}
+
+func TestEmailJobDecodesPayload(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	handler := mail.SendHandler(server.sender())
+
+	if err := handler(context.Background(), []byte(`{"to":"editor@example.com","subject":"Hi","body":"Hello"}`)); err != nil {
+		t.Fatalf("Error running email job: %v", err)
+	}
+	if msg := server.wait(t); msg.to != "editor@example.com" {
+		t.Errorf("Expected the email to reach editor@example.com, got %q", msg.to)
+	}
+	if err := handler(context.Background(), []byte(`not json`)); err == nil {
+		t.Error("Expected a malformed payload to fail")
+	}
+}
+
+// Setup a reminder service emailing through a queue to the SMTP stand-in
+func setupReminders(t *testing.T) (services.ReminderService, *mockNoteRepository, *mockNotificationRepository, *fakeSMTPServer, func()) {
+	notes := newMockRepository()
+	notifications := &mockNotificationRepository{}
+	users := newMockUserRepository()
+	users.users[editorUser.ID] = &domain.User{ID: editorUser.ID, Username: "editor", Email: "editor@example.com", Role: domain.RoleEditor, Timezone: "Asia/Tokyo"}
+	users.users[viewerUser.ID] = &domain.User{ID: viewerUser.ID, Username: "viewer", Role: domain.RoleViewer}
+
+	server := newFakeSMTPServer(t)
+	queue, _ := setupQueue(1, 3)
+	queue.Register(mail.SendJob, mail.SendHandler(server.sender()))
+
+	service := services.NewReminderService(notes, notifications, users, queue)
+	return service, notes, notifications, server, func() { runAll(t, queue) }
+}
+
+func TestRemindersFireOnceWithNotificationAndEmail(t *testing.T) {
+	service, notes, notifications, server, runJobs := setupReminders(t)
+	now := time.Now()
+	notes.notes[1] = &domain.Note{ID: 1, UserID: editorUser.ID, Title: "Pay rent", DueAt: now.Add(time.Hour), RemindAt: now.Add(-time.Minute)}
+	notes.notes[2] = &domain.Note{ID: 2, UserID: editorUser.ID, Title: "Later", RemindAt: now.Add(time.Hour)}
+	notes.notes[3] = &domain.Note{ID: 3, UserID: viewerUser.ID, Title: "No email", RemindAt: now.Add(-time.Minute)}
+
+	fired, err := service.FireDue(context.Background())
+	if err != nil {
+		t.Fatalf("Error firing reminders: %v", err)
+	}
+	if fired != 2 {
+		t.Fatalf("Expected the 2 due reminders to fire, got %d", fired)
+	}
+	if len(notifications.notifications) != 2 {
+		t.Fatalf("Expected a notification per reminder, got %d", len(notifications.notifications))
+	}
+	first := notifications.notifications[0]
+	if first.UserID != editorUser.ID || first.NoteID != 1 || first.Message != "Reminder: Pay rent" {
+		t.Errorf("Expected the owner to be notified about the note, got %+v", first)
+	}
+
+	runJobs()
+	msg := server.wait(t)
+	if msg.to != "editor@example.com" || !strings.Contains(msg.data, "Pay rent") {
+		t.Errorf("Expected the reminder to be emailed to the owner, got %+v", msg)
+	}
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	if due := notes.notes[1].DueAt.In(tokyo).Format("Mon 2 Jan 2006 15:04 MST"); !strings.Contains(msg.data, due) {
+		t.Errorf("Expected the due date in the owner's time zone, %s, got:\n%s", due, msg.data)
+	}
+	select {
+	case <-server.received:
+		t.Error("Expected no email for an owner without an address")
+	default:
+	}
+
+	if fired, _ := service.FireDue(context.Background()); fired != 0 {
+		t.Errorf("Expected fired reminders not to fire again, got %d", fired)
+	}
+}
+
+func TestRemindersAreNotEmailedWithoutMailServer(t *testing.T) {
+	notes := newMockRepository()
+	notifications := &mockNotificationRepository{}
+	users := newMockUserRepository()
+	users.users[editorUser.ID] = &domain.User{ID: editorUser.ID, Username: "editor", Email: "editor@example.com", Role: domain.RoleEditor}
+	// The queue has no email job, as when no SMTP host is configured
+	queue, jobRepo := setupQueue(1, 3)
+	service := services.NewReminderService(notes, notifications, users, queue)
+	notes.notes[1] = &domain.Note{ID: 1, UserID: editorUser.ID, Title: "Pay rent", RemindAt: time.Now().Add(-time.Minute)}
+
+	if fired, err := service.FireDue(context.Background()); err != nil || fired != 1 {
+		t.Fatalf("Expected the reminder to fire, got %d, %v", fired, err)
+	}
+	if len(notifications.notifications) != 1 {
+		t.Errorf("Expected the owner to be notified, got %d notifications", len(notifications.notifications))
+	}
+	if len(jobRepo.jobs) != 0 {
+		t.Errorf("Expected no email job, got %+v", jobRepo.jobs[0])
+	}
+}
+
+func TestReschedulingFiresReminderAgain(t *testing.T) {
+	service, notes, notifications, _, _ := setupReminders(t)
+	noteService := newNoteService(notes)
+	ctx := userContext(editorUser)
+	note, err := noteService.CreateNote(ctx, "Call back", "", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Error creating note: %v", err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	if _, err := noteService.ScheduleNote(ctx, note.ID, time.Time{}, past); err != nil {
+		t.Fatalf("Error scheduling note: %v", err)
+	}
+	if fired, _ := service.FireDue(context.Background()); fired != 1 {
+		t.Fatalf("Expected the reminder to fire, got %d", fired)
+	}
+
+	// Saving the same time keeps the reminder fired
+	if _, err := noteService.ScheduleNote(ctx, note.ID, time.Time{}, past); err != nil {
+		t.Fatalf("Error scheduling note: %v", err)
+	}
+	if fired, _ := service.FireDue(context.Background()); fired != 0 {
+		t.Errorf("Expected an unchanged reminder not to fire again, got %d", fired)
+	}
+
+	if _, err := noteService.ScheduleNote(ctx, note.ID, time.Time{}, past.Add(time.Second)); err != nil {
+		t.Fatalf("Error scheduling note: %v", err)
+	}
+	if fired, _ := service.FireDue(context.Background()); fired != 1 {
+		t.Errorf("Expected a changed reminder to fire again, got %d", fired)
+	}
+	if len(notifications.notifications) != 2 {
+		t.Errorf("Expected 2 notifications, got %d", len(notifications.notifications))
+	}
+
+	if _, err := noteService.ScheduleNote(ctx, note.ID, time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}); err != services.ErrInvalidSchedule {
+		t.Errorf("Expected ErrInvalidSchedule for a date past 2037, got %v", err)
+	}
+	if _, err := noteService.ScheduleNote(userContext(viewerUser), note.ID, time.Time{}, time.Time{}); err == nil {
+		t.Error("Expected a viewer not to schedule notes")
+	}
+}
+
+func TestCreateNoteWithSchedule(t *testing.T) {
+	repo := newMockRepository()
+	audit := &mockAuditRepository{}
+	noteService := services.NewNoteService(repo, newMockShareRepository(repo), newMockUserRepository(), audit, newMockTemplateRepository(), newMockLinkRepository(), &mockTransactor{})
+	ctx := userContext(editorUser)
+
+	dueAt := time.Date(2030, 5, 1, 9, 30, 0, 500, time.UTC)
+	note, err := noteService.CreateNote(ctx, "Dentist", "", dueAt, dueAt.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Error creating note: %v", err)
+	}
+	if stored := repo.notes[note.ID]; !stored.DueAt.Equal(dueAt.Truncate(time.Second)) || !stored.RemindAt.Equal(dueAt.Add(-time.Hour).Truncate(time.Second)) {
+		t.Errorf("Expected the schedule to be stored with the note, got %v and %v", stored.DueAt, stored.RemindAt)
+	}
+	if len(audit.events) != 1 || audit.events[0].Action != domain.AuditNoteCreated {
+		t.Errorf("Expected a single created event, got %v", audit.events)
+	}
+
+	if _, err := noteService.CreateNote(ctx, "Later", "", time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC), time.Time{}); err != services.ErrInvalidSchedule {
+		t.Errorf("Expected ErrInvalidSchedule for a date past 2037, got %v", err)
+	}
+	if len(repo.notes) != 1 {
+		t.Error("Expected no note to be created with an invalid schedule")
+	}
+}
+
+// Setup the note, notification and account routes for user
+func setupReminderRouter(t *testing.T, user *domain.User) (*gin.Engine, *mockNoteRepository, *mockNotificationRepository, *mockUserRepository) {
+	r := fixtures.NewRouter(t, user)
+
+	repo := newMockRepository()
+	notifications := &mockNotificationRepository{}
+	users := newMockUserRepository()
+	copied := *user
+	users.users[user.ID] = &copied
+
+	noteHandler := handlers.NewNoteHandler(newNoteService(repo), newTemplateService(), newSearchService(repo), testBaseURL)
+	notificationHandler := handlers.NewNotificationHandler(services.NewNotificationService(notifications))
+	authHandler := handlers.NewAuthHandler(services.NewUserService(users, nil, time.Hour), time.Hour)
+	r.POST("/notes", noteHandler.Create)
+	r.GET("/notes/:id/edit", noteHandler.Edit)
+	r.PUT("/notes/:id", noteHandler.Update)
+	r.GET("/notes/upcoming", noteHandler.Upcoming)
+	r.GET("/notifications", notificationHandler.Index)
+	r.POST("/notifications/read", notificationHandler.ReadAll)
+	r.POST("/notifications/:id/read", notificationHandler.Read)
+	r.GET("/account", authHandler.Account)
+	r.POST("/account", authHandler.UpdateAccount)
+	return r, repo, notifications, users
+}
+
+func TestNoteFormSchedulesNote(t *testing.T) {
+	router, repo, _, _ := setupReminderRouter(t, editorUser)
+
+	w := serve(router, "POST", "/notes", url.Values{
+		"title": {"Dentist"}, "due_at": {"2030-05-01T09:30"}, "remind_at": {"2030-04-30T18:00"},
+	}, false)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect, got %d: %s", w.Code, w.Body.String())
+	}
+	note := repo.notes[1]
+	if want := time.Date(2030, 5, 1, 9, 30, 0, 0, time.Local); !note.DueAt.Equal(want) {
+		t.Errorf("Expected the due date %v, got %v", want, note.DueAt)
+	}
+	if want := time.Date(2030, 4, 30, 18, 0, 0, 0, time.Local); !note.RemindAt.Equal(want) {
+		t.Errorf("Expected the reminder %v, got %v", want, note.RemindAt)
+	}
+
+	// A form without the inputs leaves the schedule alone, empty inputs clear it
+	serve(router, "PUT", "/notes/1", url.Values{"title": {"Dentist"}}, false)
+	if note.DueAt.IsZero() {
+		t.Error("Expected the schedule to survive a form without it")
+	}
+	serve(router, "PUT", "/notes/1", url.Values{"title": {"Dentist"}, "due_at": {""}, "remind_at": {""}}, false)
+	if !note.DueAt.IsZero() || !note.RemindAt.IsZero() {
+		t.Errorf("Expected empty inputs to clear the schedule, got %v and %v", note.DueAt, note.RemindAt)
+	}
+
+	w = serve(router, "POST", "/notes", url.Values{"title": {"Bad"}, "due_at": {"tomorrow"}}, false)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid due date to be rejected, got %d", w.Code)
+	}
+	if len(repo.notes) != 1 {
+		t.Error("Expected no note to be created from an invalid form")
+	}
+
+	// An edit with a schedule that cannot be stored saves nothing
+	w = serve(router, "PUT", "/notes/1", url.Values{"title": {"Orthodontist"}, "due_at": {"2100-01-01T09:00"}, "remind_at": {""}}, false)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a due date past 2037 to be rejected, got %d", w.Code)
+	}
+	if note := repo.notes[1]; note.Title != "Dentist" {
+		t.Errorf("Expected the title to be left alone by a rejected edit, got %q", note.Title)
+	}
+}
+
+func TestNoteFormUsesUserTimezone(t *testing.T) {
+	user := &domain.User{ID: editorUser.ID, Username: "editor", Role: domain.RoleEditor, Timezone: "America/New_York"}
+	router, repo, _, _ := setupReminderRouter(t, user)
+
+	serve(router, "POST", "/notes", url.Values{"title": {"Dentist"}, "due_at": {"2030-05-01T09:30"}, "remind_at": {""}}, false)
+	newYork, _ := time.LoadLocation("America/New_York")
+	if want := time.Date(2030, 5, 1, 9, 30, 0, 0, newYork); !repo.notes[1].DueAt.Equal(want) {
+		t.Errorf("Expected the due date %v, got %v", want, repo.notes[1].DueAt)
+	}
+
+	// The form shows the time as it was entered
+	repo.notes[1].DueAt = repo.notes[1].DueAt.UTC()
+	if body := serve(router, "GET", "/notes/1/edit", nil, false).Body.String(); !strings.Contains(body, `value="2030-05-01T09:30"`) {
+		t.Errorf("Expected the due date in the user's time zone:\n%s", body)
+	}
+}
+
+func TestUpcomingPageListsNotesByDueDate(t *testing.T) {
+	router, repo, _, _ := setupReminderRouter(t, editorUser)
+	now := time.Now()
+	repo.notes[1] = &domain.Note{ID: 1, UserID: editorUser.ID, Title: "Next week", DueAt: now.Add(7 * 24 * time.Hour)}
+	repo.notes[2] = &domain.Note{ID: 2, UserID: editorUser.ID, Title: "Yesterday", DueAt: now.Add(-24 * time.Hour)}
+	repo.notes[3] = &domain.Note{ID: 3, UserID: editorUser.ID, Title: "Undated"}
+	repo.notes[4] = &domain.Note{ID: 4, UserID: viewerUser.ID, Title: "Not mine", DueAt: now}
+
+	w := serve(router, "GET", "/notes/upcoming", nil, false)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected the page, got %d", w.Code)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "Undated") || strings.Contains(body, "Not mine") {
+		t.Error("Expected only the user's notes with a due date")
+	}
+	yesterday, nextWeek := strings.Index(body, "Yesterday"), strings.Index(body, "Next week")
+	if yesterday < 0 || nextWeek < 0 || yesterday > nextWeek {
+		t.Error("Expected the notes soonest first")
+	}
+	if strings.Count(body, "badge-error") != 1 {
+		t.Error("Expected the overdue note to be flagged")
+	}
+}
+
+func TestNotificationsInNavbar(t *testing.T) {
+	router, _, notifications, _ := setupReminderRouter(t, editorUser)
+	now := time.Now()
+	notifications.notifications = []*domain.Notification{
+		{ID: 1, UserID: editorUser.ID, NoteID: 7, Message: "Reminder: Pay rent", CreatedAt: now},
+		{ID: 2, UserID: viewerUser.ID, NoteID: 8, Message: "Reminder: Secret", CreatedAt: now},
+		{ID: 3, UserID: editorUser.ID, Message: "Old news", CreatedAt: now, ReadAt: now},
+	}
+
+	w := serve(router, "GET", "/notifications", nil, true)
+	body := w.Body.String()
+	if !strings.Contains(body, "Reminder: Pay rent") || strings.Contains(body, "Secret") {
+		t.Errorf("Expected only the user's notifications, got %s", body)
+	}
+	if !strings.Contains(body, `indicator-item">1</span>`) {
+		t.Error("Expected the unread count on the bell")
+	}
+
+	w = serve(router, "POST", "/notifications/1/read", nil, false)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/notes/7" {
+		t.Errorf("Expected reading to open the note, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+	if notifications.notifications[0].Unread() {
+		t.Error("Expected the notification to be read")
+	}
+	if w := serve(router, "POST", "/notifications/2/read", nil, false); w.Code != http.StatusNotFound {
+		t.Errorf("Expected another user's notification to be hidden, got %d", w.Code)
+	}
+
+	notifications.notifications[0].ReadAt = time.Time{}
+	w = serve(router, "POST", "/notifications/read", nil, true)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "indicator-item") {
+		t.Errorf("Expected every notification to be read, got %d", w.Code)
+	}
+	if !notifications.notifications[1].Unread() {
+		t.Error("Expected other users' notifications to stay unread")
+	}
+}
+
+func TestAccountPageSetsEmail(t *testing.T) {
+	router, _, _, users := setupReminderRouter(t, editorUser)
+
+	w := serve(router, "POST", "/account", url.Values{"email": {"editor@example.com"}}, false)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect, got %d", w.Code)
+	}
+	if got := users.users[editorUser.ID].Email; got != "editor@example.com" {
+		t.Errorf("Expected the email to be saved, got %q", got)
+	}
+
+	for _, email := range []string{"not an address", "Editor <editor@example.com>"} {
+		w = serve(router, "POST", "/account", url.Values{"email": {email}}, false)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "valid email") {
+			t.Errorf("Expected %q to be rejected, got %d", email, w.Code)
+		}
+	}
+
+	serve(router, "POST", "/account", url.Values{"email": {""}}, false)
+	if got := users.users[editorUser.ID].Email; got != "" {
+		t.Errorf("Expected an empty address to turn email off, got %q", got)
+	}
+
+	// Nothing is saved unless every field is valid
+	w = serve(router, "POST", "/account", url.Values{"email": {"editor@example.com"}, "timezone": {"Mars/Olympus"}}, false)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "time zone") {
+		t.Errorf("Expected the unknown time zone to be rejected, got %d", w.Code)
+	}
+	if got := users.users[editorUser.ID].Email; got != "" {
+		t.Errorf("Expected the email not to be saved with an invalid time zone, got %q", got)
+	}
+}
@@ -0,0 +1,273 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+)
+
+// Mock saved search repository implementation for testing
+type mockSavedSearchRepository struct {
+	searches map[int64]*domain.SavedSearch
+	nextID   int64
+}
+
+func newMockSavedSearchRepository() *mockSavedSearchRepository {
+	return &mockSavedSearchRepository{searches: make(map[int64]*domain.SavedSearch), nextID: 1}
+}
+
+func (m *mockSavedSearchRepository) FindByUser(ctx context.Context, userID int64) ([]*domain.SavedSearch, error) {
+	var searches []*domain.SavedSearch
+	for _, search := range m.searches {
+		if search.UserID == userID {
+			copied := *search
+			searches = append(searches, &copied)
+		}
+	}
+	sort.Slice(searches, func(i, j int) bool { return searches[i].Name < searches[j].Name })
+	return searches, nil
+}
+
+func (m *mockSavedSearchRepository) FindByID(ctx context.Context, id int64) (*domain.SavedSearch, error) {
+	return m.searches[id], nil
+}
+
+func (m *mockSavedSearchRepository) Create(ctx context.Context, search *domain.SavedSearch) (int64, error) {
+	id := m.nextID
+	m.nextID++
+	copied := *search
+	copied.ID = id
+	m.searches[id] = &copied
+	return id, nil
+}
+
+func (m *mockSavedSearchRepository) Delete(ctx context.Context, id int64) error {
+	delete(m.searches, id)
+	return nil
+}
+
+func newSearchService(repo *mockNoteRepository) services.SearchService {
+	return services.NewSearchService(repo, newMockSavedSearchRepository())
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	day := func(month time.Month, d int) time.Time { return time.Date(2026, month, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		input string
+		want  []domain.SearchTerm
+	}{
+		{"", nil},
+		{`budget -draft "q3 plans"`, []domain.SearchTerm{
+			{Field: domain.SearchText, Text: "budget"},
+			{Field: domain.SearchText, Negate: true, Text: "draft"},
+			{Field: domain.SearchText, Text: "q3 plans"},
+		}},
+		{`title:"road map" -Title:old "a:b" well-known`, []domain.SearchTerm{
+			{Field: domain.SearchTitle, Text: "road map"},
+			{Field: domain.SearchTitle, Negate: true, Text: "old"},
+			{Field: domain.SearchText, Text: "a:b"},
+			{Field: domain.SearchText, Text: "well-known"},
+		}},
+		{"created:>2026-01-01 created:<=2026-02-01 updated:2026-03-01", []domain.SearchTerm{
+			{Field: domain.SearchCreated, From: day(1, 2)},
+			{Field: domain.SearchCreated, To: day(2, 2)},
+			{Field: domain.SearchUpdated, From: day(3, 1), To: day(3, 2)},
+		}},
+		{"updated:7d -created:2w", []domain.SearchTerm{
+			{Field: domain.SearchUpdated, From: now.AddDate(0, 0, -7)},
+			{Field: domain.SearchCreated, Negate: true, From: now.AddDate(0, 0, -14)},
+		}},
+		{`- "" other:value`, []domain.SearchTerm{
+			{Field: domain.SearchText, Text: "other:value"},
+		}},
+	}
+	for _, tt := range tests {
+		query, err := domain.ParseSearchQuery(tt.input, now)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(query.Terms, tt.want) {
+			t.Errorf("Expected %q to parse to %+v, got %+v", tt.input, tt.want, query.Terms)
+		}
+	}
+
+	for _, input := range []string{"title:", "created:", "created:yesterday", "updated:0d", "created:>2026-13-01",
+		strings.Repeat("a ", 21), strings.Repeat("a", domain.MaxSearchQuery+1)} {
+		if _, err := domain.ParseSearchQuery(input, now); err == nil {
+			t.Errorf("Expected %q to be rejected", input)
+		}
+	}
+}
+
+func TestSearchNotes(t *testing.T) {
+	repo := newMockRepository()
+	service := newSearchService(repo)
+	old := time.Now().AddDate(0, -1, 0)
+	repo.notes[1] = &domain.Note{ID: 1, UserID: editorUser.ID, Title: "Budget", Content: "Numbers", CreatedAt: old, UpdatedAt: old}
+	repo.notes[2] = &domain.Note{ID: 2, UserID: editorUser.ID, Title: "Plans", Content: "The budget draft", CreatedAt: old, UpdatedAt: time.Now()}
+	repo.notes[3] = &domain.Note{ID: 3, UserID: adminUser.ID, Title: "Budget too", CreatedAt: old, UpdatedAt: old}
+
+	ids := func(notes []*domain.Note) []int64 {
+		var ids []int64
+		for _, note := range notes {
+			ids = append(ids, note.ID)
+		}
+		return ids
+	}
+	tests := []struct {
+		user  *domain.User
+		query string
+		want  []int64
+	}{
+		{editorUser, "budget", []int64{2, 1}},
+		{editorUser, "budget -draft", []int64{1}},
+		{editorUser, "title:budget", []int64{1}},
+		{editorUser, "budget updated:7d", []int64{2}},
+		{adminUser, "title:budget", []int64{3, 1}},
+	}
+	for _, tt := range tests {
+		notes, err := service.SearchNotes(userContext(tt.user), tt.query, domain.DateRange{})
+		if err != nil {
+			t.Errorf("Failed to search %q: %v", tt.query, err)
+			continue
+		}
+		if got := ids(notes); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Expected %q as %s to find %v, got %v", tt.query, tt.user.Username, tt.want, got)
+		}
+	}
+
+	if _, err := service.SearchNotes(userContext(editorUser), "created:soon", domain.DateRange{}); !errors.Is(err, services.ErrInvalidSearch) {
+		t.Errorf("Expected an invalid search to be rejected, got %v", err)
+	}
+	if _, err := service.SearchNotes(context.Background(), "budget", domain.DateRange{}); !errors.Is(err, services.ErrUnauthenticated) {
+		t.Errorf("Expected searches to need a login, got %v", err)
+	}
+}
+
+func TestSavedSearches(t *testing.T) {
+	repo := newMockRepository()
+	service := newSearchService(repo)
+	repo.notes[1] = &domain.Note{ID: 1, UserID: editorUser.ID, Title: "Budget"}
+	repo.notes[2] = &domain.Note{ID: 2, UserID: editorUser.ID, Title: "Budget draft"}
+	editor := userContext(editorUser)
+
+	saved, err := service.SaveSearch(editor, " Budgets ", " title:budget ")
+	if err != nil {
+		t.Fatalf("Failed to save search: %v", err)
+	}
+	if saved.Name != "Budgets" || saved.Query != "title:budget" || saved.UserID != editorUser.ID {
+		t.Errorf("Expected a trimmed search of the editor, got %+v", saved)
+	}
+	if _, err := service.SaveSearch(editor, "All", "-draft"); err != nil {
+		t.Fatalf("Failed to save search: %v", err)
+	}
+
+	searches, err := service.GetSavedSearches(editor)
+	if err != nil {
+		t.Fatalf("Failed to list saved searches: %v", err)
+	}
+	if len(searches) != 2 || searches[0].Name != "All" || searches[0].Count != 1 || searches[1].Count != 2 {
+		t.Errorf("Expected both searches by name with their counts, got %+v", searches)
+	}
+	repo.notes[3] = &domain.Note{ID: 3, UserID: editorUser.ID, Title: "Budget 2027"}
+	if searches, _ = service.GetSavedSearches(editor); searches[1].Count != 3 {
+		t.Errorf("Expected counts to follow the notes, got %+v", searches[1])
+	}
+	if searches, _ = service.GetSavedSearches(userContext(viewerUser)); len(searches) != 0 {
+		t.Errorf("Expected other users to see none of the editor's searches, got %+v", searches)
+	}
+
+	for _, input := range [][2]string{{"", "budget"}, {"Budgets", " "}, {strings.Repeat("n", 101), "budget"}} {
+		if _, err := service.SaveSearch(editor, input[0], input[1]); !errors.Is(err, services.ErrInvalidSavedSearch) {
+			t.Errorf("Expected %q to be rejected, got %v", input, err)
+		}
+	}
+	if _, err := service.SaveSearch(editor, "Soon", "created:soon"); !errors.Is(err, services.ErrInvalidSearch) {
+		t.Errorf("Expected an invalid query to be rejected, got %v", err)
+	}
+
+	if err := service.DeleteSavedSearch(userContext(viewerUser), saved.ID); !errors.Is(err, services.ErrSavedSearchNotFound) {
+		t.Errorf("Expected another user's search to be missing, got %v", err)
+	}
+	if err := service.DeleteSavedSearch(editor, saved.ID); err != nil {
+		t.Fatalf("Failed to delete saved search: %v", err)
+	}
+	if searches, _ = service.GetSavedSearches(editor); len(searches) != 1 {
+		t.Errorf("Expected one search left, got %+v", searches)
+	}
+}
+
+// Set up a router with the notes index and saved searches signed in as user
+func setupSearchRouter(t *testing.T, user *domain.User) (*gin.Engine, *mockNoteRepository) {
+	r := fixtures.NewRouter(t, user)
+
+	repo := newMockRepository()
+	searchService := newSearchService(repo)
+	noteHandler := handlers.NewNoteHandler(newNoteService(repo), newTemplateService(), searchService, testBaseURL)
+	searchHandler := handlers.NewSearchHandler(searchService)
+	r.GET("/notes", noteHandler.Index)
+	r.DELETE("/notes/:id", noteHandler.Delete)
+	r.GET("/searches", searchHandler.Index)
+	r.POST("/searches", searchHandler.Create)
+	r.DELETE("/searches/:id", searchHandler.Delete)
+	return r, repo
+}
+
+func TestSearchPages(t *testing.T) {
+	router, repo := setupSearchRouter(t, editorUser)
+	repo.notes[1] = &domain.Note{ID: 1, UserID: editorUser.ID, Title: "Budget", Content: "Numbers"}
+	repo.notes[2] = &domain.Note{ID: 2, UserID: editorUser.ID, Title: "Plans", Content: "Ideas"}
+
+	w := serve(router, "GET", "/notes?q="+url.QueryEscape("title:budget"), nil, false)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "Budget") || strings.Contains(body, "Plans") {
+		t.Fatalf("Expected only the matching note, got %d: %s", w.Code, body)
+	}
+	if !strings.Contains(body, `name="q" value="title:budget"`) {
+		t.Error("Expected the search to be kept in the form")
+	}
+
+	w = serve(router, "GET", "/notes?q="+url.QueryEscape("created:soon"), nil, false)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "is not a date such as 2026-01-01") {
+		t.Errorf("Expected an invalid search to be explained, got %d: %s", w.Code, w.Body.String())
+	}
+
+	form := url.Values{"name": {"Money"}, "q": {"title:budget"}}
+	w = serve(router, "POST", "/searches", form, true)
+	body = w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, `href="/notes?q=title%3Abudget"`) || !strings.Contains(body, `<span class="badge badge-sm">1</span>`) {
+		t.Fatalf("Expected the sidebar with the saved search and its count, got %d: %s", w.Code, body)
+	}
+	if w = serve(router, "POST", "/searches", url.Values{"name": {""}, "q": {"budget"}}, true); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a search without a name to be rejected, got %d", w.Code)
+	}
+
+	if w = serve(router, "DELETE", "/notes/1", nil, true); w.Header().Get("HX-Trigger") != "notes-changed" {
+		t.Errorf("Expected deleting a note to refresh the counts, got %q", w.Header().Get("HX-Trigger"))
+	}
+	if body = serve(router, "GET", "/searches", nil, true).Body.String(); !strings.Contains(body, `<span class="badge badge-sm">0</span>`) {
+		t.Errorf("Expected the count to follow the deletion, got %s", body)
+	}
+
+	if w = serve(router, "DELETE", "/searches/1", nil, true); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "Money") {
+		t.Errorf("Expected the saved search to be deleted, got %d: %s", w.Code, w.Body.String())
+	}
+	if w = serve(router, "DELETE", "/searches/1", nil, true); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a missing saved search to be a 404, got %d", w.Code)
+	}
+}
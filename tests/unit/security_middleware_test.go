@@ -0,0 +1,252 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/configs"
+	"github.com/mas-diq/htmx-basic-crud/internals/middlewares"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+)
+
+// Setup a router with the security middlewares in front of a page and a
+// state-changing route
+func setupSecurityRouter(t *testing.T, cfg configs.SecurityConfig) *gin.Engine {
+	r := fixtures.NewRouter(t, nil)
+	r.Use(middlewares.SecurityHeadersMiddleware(cfg))
+	if cfg.CSRF {
+		r.Use(middlewares.CSRFMiddleware("test-csrf-key"))
+	}
+
+	r.GET("/page", func(c *gin.Context) {
+		utils.HTMLResponse(c, http.StatusOK, "errors/error.html", gin.H{"title": "Page", "message": "hello"})
+	})
+	r.POST("/notes", func(c *gin.Context) {
+		c.String(http.StatusCreated, "created")
+	})
+	return r
+}
+
+// Fetch the page and return the CSRF cookie and the token embedded in it
+func fetchCSRFToken(t *testing.T, router *gin.Engine) (*http.Cookie, string) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/page", nil)
+	router.ServeHTTP(w, req)
+
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == middlewares.CSRFCookie {
+			cookie = c
+		}
+	}
+	if cookie == nil {
+		t.Fatal("Expected a CSRF cookie")
+	}
+	if !cookie.HttpOnly {
+		t.Error("Expected the CSRF cookie to be HttpOnly")
+	}
+
+	m := regexp.MustCompile(`hx-headers='{"X-CSRF-Token": "([^"]+)"}'`).FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("Expected the token in hx-headers, got:\n%s", w.Body.String())
+	}
+	return cookie, m[1]
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	router := setupSecurityRouter(t, configs.Default().Security)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/page", nil)
+	router.ServeHTTP(w, req)
+
+	expected := map[string]string{
+		"X-Frame-Options":        "DENY",
+		"Referrer-Policy":        "strict-origin-when-cross-origin",
+		"X-Content-Type-Options": "nosniff",
+	}
+	for header, value := range expected {
+		if got := w.Header().Get(header); got != value {
+			t.Errorf("Expected %s %q, got %q", header, value, got)
+		}
+	}
+	if !strings.Contains(w.Header().Get("Permissions-Policy"), "camera=()") {
+		t.Errorf("Expected a Permissions-Policy, got %q", w.Header().Get("Permissions-Policy"))
+	}
+	if w.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("Expected no HSTS header over plain HTTP")
+	}
+
+	// The nonce in the policy is the one the scripts carry
+	csp := w.Header().Get("Content-Security-Policy")
+	m := regexp.MustCompile(`'nonce-([^']+)'`).FindStringSubmatch(csp)
+	if m == nil {
+		t.Fatalf("Expected a nonce in the policy, got %q", csp)
+	}
+	if !strings.Contains(w.Body.String(), `nonce="`+m[1]+`"`) {
+		t.Error("Expected the scripts to carry the policy nonce")
+	}
+
+	// Every request gets a fresh nonce
+	w2 := httptest.NewRecorder()
+	router.ServeHTTP(w2, req)
+	if w2.Header().Get("Content-Security-Policy") == csp {
+		t.Error("Expected a different nonce on every request")
+	}
+}
+
+func TestSecurityHeadersHSTSOverHTTPS(t *testing.T) {
+	router := setupSecurityRouter(t, configs.Default().Security)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/page", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	router.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Strict-Transport-Security"); got != "max-age=31536000; includeSubDomains" {
+		t.Errorf("Unexpected HSTS header %q", got)
+	}
+}
+
+func TestSecurityHeadersConfigurable(t *testing.T) {
+	router := setupSecurityRouter(t, configs.SecurityConfig{
+		ContentSecurityPolicy: "default-src 'none'",
+		FrameOptions:          "SAMEORIGIN",
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/page", nil)
+	router.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Content-Security-Policy"); got != "default-src 'none'" {
+		t.Errorf("Expected the configured policy, got %q", got)
+	}
+	if got := w.Header().Get("X-Frame-Options"); got != "SAMEORIGIN" {
+		t.Errorf("Expected SAMEORIGIN, got %q", got)
+	}
+	for _, header := range []string{"Referrer-Policy", "Permissions-Policy"} {
+		if got := w.Header().Get(header); got != "" {
+			t.Errorf("Expected %s to be disabled, got %q", header, got)
+		}
+	}
+}
+
+func TestCSRFRejectsRequestsWithoutToken(t *testing.T) {
+	router := setupSecurityRouter(t, configs.Default().Security)
+	cookie, _ := fetchCSRFToken(t, router)
+
+	for name, token := range map[string]string{"missing": "", "wrong": "not-the-token"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/notes", nil)
+		req.AddCookie(cookie)
+		if token != "" {
+			req.Header.Set(middlewares.CSRFHeader, token)
+		}
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s token: expected status %d, got %d", name, http.StatusForbidden, w.Code)
+		}
+	}
+
+	// A token without its cookie is rejected too
+	_, token := fetchCSRFToken(t, router)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/notes", nil)
+	req.Header.Set(middlewares.CSRFHeader, token)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without the cookie, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestCSRFAcceptsMatchingToken(t *testing.T) {
+	router := setupSecurityRouter(t, configs.Default().Security)
+	cookie, token := fetchCSRFToken(t, router)
+
+	// HTMX sends the header
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/notes", nil)
+	req.AddCookie(cookie)
+	req.Header.Set(middlewares.CSRFHeader, token)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d with the header, got %d", http.StatusCreated, w.Code)
+	}
+
+	// Plain forms send the field
+	form := url.Values{middlewares.CSRFFormField: {token}}
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/notes", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status %d with the form field, got %d", http.StatusCreated, w.Code)
+	}
+}
+
+func TestCSRFRejectsTokenFromAnotherSession(t *testing.T) {
+	router := setupSecurityRouter(t, configs.Default().Security)
+	cookie, _ := fetchCSRFToken(t, router)
+
+	// Fetch the page as the session a token is issued to
+	tokenFor := func(session string) string {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/page", nil)
+		req.AddCookie(cookie)
+		req.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: session})
+		router.ServeHTTP(w, req)
+		m := regexp.MustCompile(`hx-headers='{"X-CSRF-Token": "([^"]+)"}'`).FindStringSubmatch(w.Body.String())
+		if m == nil {
+			t.Fatalf("Expected the token in hx-headers, got:\n%s", w.Body.String())
+		}
+		return m[1]
+	}
+	post := func(session, token string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/notes", nil)
+		req.AddCookie(cookie)
+		req.AddCookie(&http.Cookie{Name: auth.SessionCookie, Value: session})
+		req.Header.Set(middlewares.CSRFHeader, token)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	alice, bob := tokenFor("session-alice"), tokenFor("session-bob")
+	if alice == bob {
+		t.Fatal("Expected each session to get its own token")
+	}
+	if code := post("session-alice", alice); code != http.StatusCreated {
+		t.Errorf("Expected status %d with the session's own token, got %d", http.StatusCreated, code)
+	}
+	if code := post("session-bob", alice); code != http.StatusForbidden {
+		t.Errorf("Expected status %d with another session's token, got %d", http.StatusForbidden, code)
+	}
+
+	// Signing in invalidates the token issued before
+	if code := post("session-alice", tokenFor("")); code != http.StatusForbidden {
+		t.Errorf("Expected status %d with a token from before signing in, got %d", http.StatusForbidden, code)
+	}
+}
+
+func TestCSRFIgnoresAPIKeyHeader(t *testing.T) {
+	router := setupSecurityRouter(t, configs.Default().Security)
+
+	// An unvalidated header a cross-site form post could add is no way past the check
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/notes", nil)
+	req.Header.Set("X-API-Key", "test-api-key")
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+}
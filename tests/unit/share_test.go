@@ -0,0 +1,331 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+)
+
+// Mock share repository reading notes and users from the other mocks
+type mockShareRepository struct {
+	notes  *mockNoteRepository
+	users  *mockUserRepository
+	grants map[[2]int64]domain.SharePermission
+	links  map[int64]*domain.ShareLink
+	nextID int64
+}
+
+func newMockShareRepository(notes *mockNoteRepository) *mockShareRepository {
+	return &mockShareRepository{
+		notes:  notes,
+		users:  newMockUserRepository(),
+		grants: make(map[[2]int64]domain.SharePermission),
+		links:  make(map[int64]*domain.ShareLink),
+		nextID: 1,
+	}
+}
+
+func (m *mockShareRepository) Grant(ctx context.Context, noteID, userID int64, permission domain.SharePermission) error {
+	m.grants[[2]int64{noteID, userID}] = permission
+	return nil
+}
+
+func (m *mockShareRepository) Revoke(ctx context.Context, noteID, userID int64) error {
+	delete(m.grants, [2]int64{noteID, userID})
+	return nil
+}
+
+func (m *mockShareRepository) FindGrant(ctx context.Context, noteID, userID int64) (domain.SharePermission, error) {
+	return m.grants[[2]int64{noteID, userID}], nil
+}
+
+func (m *mockShareRepository) FindByNote(ctx context.Context, noteID int64) ([]*domain.Share, error) {
+	var shares []*domain.Share
+	for key, permission := range m.grants {
+		if key[0] == noteID {
+			share := &domain.Share{NoteID: noteID, UserID: key[1], Permission: permission}
+			if user := m.users.users[key[1]]; user != nil {
+				share.Username = user.Username
+			}
+			shares = append(shares, share)
+		}
+	}
+	return shares, nil
+}
+
+func (m *mockShareRepository) FindSharedWith(ctx context.Context, userID int64) ([]*domain.Note, error) {
+	var notes []*domain.Note
+	for key, permission := range m.grants {
+		if note := m.notes.notes[key[0]]; note != nil && key[1] == userID {
+			shared := *note
+			shared.Grant = permission
+			notes = append(notes, &shared)
+		}
+	}
+	return notes, nil
+}
+
+func (m *mockShareRepository) CreateLink(ctx context.Context, link *domain.ShareLink) (int64, error) {
+	id := m.nextID
+	m.nextID++
+	m.links[id] = link
+	return id, nil
+}
+
+func (m *mockShareRepository) FindLinksByNote(ctx context.Context, noteID int64) ([]*domain.ShareLink, error) {
+	var links []*domain.ShareLink
+	for _, link := range m.links {
+		if link.NoteID == noteID {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+func (m *mockShareRepository) FindLinkByToken(ctx context.Context, tokenHash string) (*domain.ShareLink, error) {
+	for _, link := range m.links {
+		if link.TokenHash == tokenHash {
+			return link, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockShareRepository) DeleteLink(ctx context.Context, noteID, linkID int64) error {
+	if link := m.links[linkID]; link != nil && link.NoteID == noteID {
+		delete(m.links, linkID)
+	}
+	return nil
+}
+
+// Create a note service whose users are the test users, with a note owned
+// by the editor
+func setupSharing(t *testing.T) (services.NoteService, *mockShareRepository, *domain.Note) {
+	repo := newMockRepository()
+	shares := newMockShareRepository(repo)
+	for _, user := range []*domain.User{adminUser, editorUser, viewerUser} {
+		shares.users.users[user.ID] = user
+	}
+	service := services.NewNoteService(repo, shares, shares.users, &mockAuditRepository{}, newMockTemplateRepository(), newMockLinkRepository(), &mockTransactor{})
+
+	note, err := service.CreateNote(userContext(editorUser), "Shared", "content", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Error creating note: %v", err)
+	}
+	return service, shares, note
+}
+
+func TestNoteServiceSharesWithUsers(t *testing.T) {
+	service, shares, note := setupSharing(t)
+	otherEditor := &domain.User{ID: 4, Username: "other", Role: domain.RoleEditor}
+	shares.users.users[otherEditor.ID] = otherEditor
+	owner := userContext(editorUser)
+
+	if _, err := service.ShareNote(owner, note.ID, "nobody", domain.ShareRead); !errors.Is(err, services.ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+	if _, err := service.ShareNote(owner, note.ID, "editor", domain.ShareRead); !errors.Is(err, services.ErrInvalidShare) {
+		t.Errorf("Expected sharing with the owner to fail, got %v", err)
+	}
+	if _, err := service.ShareNote(owner, note.ID, "viewer", domain.SharePermission("own")); !errors.Is(err, services.ErrInvalidShare) {
+		t.Errorf("Expected an unknown permission to fail, got %v", err)
+	}
+
+	// Readers see the note, in their shared list too, but cannot change it
+	if _, err := service.ShareNote(owner, note.ID, "other", domain.ShareRead); err != nil {
+		t.Fatalf("Error sharing note: %v", err)
+	}
+	if _, err := service.GetNoteByID(userContext(otherEditor), note.ID); err != nil {
+		t.Errorf("Expected the reader to see the note, got %v", err)
+	}
+	if notes, _ := service.GetSharedNotes(userContext(otherEditor)); len(notes) != 1 || notes[0].Grant != domain.ShareRead {
+		t.Errorf("Expected the note in the shared list, got %+v", notes)
+	}
+	if _, err := service.UpdateNote(userContext(otherEditor), note.ID, "Changed", ""); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected readers not to update, got %v", err)
+	}
+
+	// Editors change it but cannot pass it on
+	if _, err := service.ShareNote(owner, note.ID, "other", domain.ShareEdit); err != nil {
+		t.Fatalf("Error sharing note: %v", err)
+	}
+	if _, err := service.UpdateNote(userContext(otherEditor), note.ID, "Changed", ""); err != nil {
+		t.Errorf("Expected the edit grant to allow updates, got %v", err)
+	}
+	if _, err := service.ShareNote(userContext(otherEditor), note.ID, "viewer", domain.ShareRead); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected only the owner to share, got %v", err)
+	}
+
+	// An edit grant does not lift a viewer's role
+	if _, err := service.ShareNote(owner, note.ID, "viewer", domain.ShareEdit); err != nil {
+		t.Fatalf("Error sharing note: %v", err)
+	}
+	if err := service.DeleteNote(userContext(viewerUser), note.ID); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected viewers to stay read-only, got %v", err)
+	}
+
+	// Revoking hides the note again
+	if err := service.UnshareNote(owner, note.ID, otherEditor.ID); err != nil {
+		t.Fatalf("Error unsharing note: %v", err)
+	}
+	if _, err := service.GetNoteByID(userContext(otherEditor), note.ID); !errors.Is(err, services.ErrNoteNotFound) {
+		t.Errorf("Expected the note to be hidden after revoking, got %v", err)
+	}
+}
+
+func TestNoteServiceShareLinks(t *testing.T) {
+	service, shares, note := setupSharing(t)
+	owner := userContext(editorUser)
+	anonymous := context.Background()
+
+	if _, _, err := service.CreateShareLink(userContext(viewerUser), note.ID, "", time.Time{}); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected viewers not to create links, got %v", err)
+	}
+
+	token, link, err := service.CreateShareLink(owner, note.ID, "", time.Time{})
+	if err != nil {
+		t.Fatalf("Error creating link: %v", err)
+	}
+	if link.TokenHash == token || len(token) < 40 {
+		t.Errorf("Expected a long token stored only hashed, got %q", token)
+	}
+	if found, err := service.GetNoteByShareToken(anonymous, token, ""); err != nil || found.ID != note.ID {
+		t.Errorf("Expected the link to open the note, got %+v %v", found, err)
+	}
+	if _, err := service.GetNoteByShareToken(anonymous, token+"x", ""); !errors.Is(err, services.ErrShareLinkNotFound) {
+		t.Errorf("Expected unknown tokens to fail, got %v", err)
+	}
+
+	locked, _, err := service.CreateShareLink(owner, note.ID, "secret", time.Time{})
+	if err != nil {
+		t.Fatalf("Error creating link: %v", err)
+	}
+	for _, password := range []string{"", "wrong"} {
+		if _, err := service.GetNoteByShareToken(anonymous, locked, password); !errors.Is(err, services.ErrSharePassword) {
+			t.Errorf("Expected password %q to be refused, got %v", password, err)
+		}
+	}
+	if _, err := service.GetNoteByShareToken(anonymous, locked, "secret"); err != nil {
+		t.Errorf("Expected the password to open the link, got %v", err)
+	}
+
+	expired, _, err := service.CreateShareLink(owner, note.ID, "", time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Error creating link: %v", err)
+	}
+	if _, err := service.GetNoteByShareToken(anonymous, expired, ""); !errors.Is(err, services.ErrShareLinkNotFound) {
+		t.Errorf("Expected expired links to fail, got %v", err)
+	}
+
+	if err := service.RevokeShareLink(owner, note.ID, link.ID); err != nil {
+		t.Fatalf("Error revoking link: %v", err)
+	}
+	if _, err := service.GetNoteByShareToken(anonymous, token, ""); !errors.Is(err, services.ErrShareLinkNotFound) {
+		t.Errorf("Expected revoked links to fail, got %v", err)
+	}
+	if len(shares.links) != 2 {
+		t.Errorf("Expected two links left, got %d", len(shares.links))
+	}
+}
+
+// Setup the share and public link routes, signed in as the note's owner
+func setupShareRouter(t *testing.T) (*gin.Engine, *domain.Note) {
+	service, _, note := setupSharing(t)
+
+	r := fixtures.NewRouter(t, nil)
+
+	noteHandler := handlers.NewNoteHandler(service, newTemplateService(), newSearchService(newMockRepository()), testBaseURL)
+	r.GET("/s/:token", noteHandler.SharedLink)
+	r.POST("/s/:token", noteHandler.SharedLink)
+	owner := r.Group("/", signIn(editorUser))
+	owner.GET("/notes/:id/share", noteHandler.SharePage)
+	owner.POST("/notes/:id/shares", noteHandler.Share)
+	owner.POST("/notes/:id/links", noteHandler.CreateLink)
+	return r, note
+}
+
+func TestSharePageCreatesLinks(t *testing.T) {
+	router, note := setupShareRouter(t)
+	path := "/notes/1"
+
+	w := serve(router, "POST", path+"/shares", url.Values{"username": {"nobody"}, "permission": {"read"}}, false)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "There is no user named nobody") {
+		t.Errorf("Expected the form to report the unknown user, got %d", w.Code)
+	}
+	w = serve(router, "POST", path+"/shares", url.Values{"username": {"viewer"}, "permission": {"read"}}, false)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != path+"/share" {
+		t.Errorf("Expected a redirect to the share page, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	// The link is built from the configured base URL, not the Host header
+	req, _ := http.NewRequest("POST", path+"/links", strings.NewReader(url.Values{"expires": {"24h"}, "password": {"secret"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Host = "attacker.example"
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	link := regexp.MustCompile(regexp.QuoteMeta(testBaseURL) + `(/s/[A-Za-z0-9_-]+)`).FindStringSubmatch(w.Body.String())
+	if w.Code != http.StatusCreated || link == nil {
+		t.Fatalf("Expected the new link to be shown, got %d:\n%s", w.Code, w.Body.String())
+	}
+	page := serve(router, "GET", path+"/share", nil, false).Body.String()
+	if strings.Contains(page, link[1]) || !strings.Contains(page, "viewer") {
+		t.Errorf("Expected the page to list the grant but not the link URL again:\n%s", page)
+	}
+
+	// The public page asks for the password and then shows the note read-only
+	w = serve(router, "GET", link[1], nil, false)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `name="password"`) {
+		t.Errorf("Expected a password form, got %d", w.Code)
+	}
+	if w.Header().Get("X-Robots-Tag") != "noindex" {
+		t.Error("Expected shared pages to be kept out of search engines")
+	}
+	w = serve(router, "POST", link[1], url.Values{"password": {"secret"}}, false)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, note.Title) {
+		t.Errorf("Expected the note, got %d:\n%s", w.Code, body)
+	}
+	if strings.Contains(body, "/edit") || strings.Contains(body, "hx-delete") {
+		t.Errorf("Expected the shared page to be read-only:\n%s", body)
+	}
+
+	if w := serve(router, "GET", "/s/unknown", nil, false); w.Code != http.StatusNotFound {
+		t.Errorf("Expected unknown links to 404, got %d", w.Code)
+	}
+}
+
+func TestSharedLinkShowsDueDateInUTC(t *testing.T) {
+	service, _, _ := setupSharing(t)
+	owner := userContext(editorUser)
+	due := time.Date(2024, 3, 15, 9, 30, 0, 0, time.FixedZone("CET", 3600))
+	note, err := service.CreateNote(owner, "Deadline", "content", due, time.Time{})
+	if err != nil {
+		t.Fatalf("Error creating note: %v", err)
+	}
+	token, _, err := service.CreateShareLink(owner, note.ID, "", time.Time{})
+	if err != nil {
+		t.Fatalf("Error creating link: %v", err)
+	}
+
+	r := fixtures.NewRouter(t, nil)
+	noteHandler := handlers.NewNoteHandler(service, newTemplateService(), newSearchService(newMockRepository()), testBaseURL)
+	r.GET("/s/:token", noteHandler.SharedLink)
+
+	w := serve(r, "GET", "/s/"+token, nil, false)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "Due: Mar 15, 2024 08:30 UTC") || !strings.Contains(body, "</html>") {
+		t.Errorf("Expected the whole page with the due date in UTC, got %d:\n%s", w.Code, body)
+	}
+}
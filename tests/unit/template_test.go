@@ -0,0 +1,248 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/middlewares"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+)
+
+// Mock note template repository
+type mockTemplateRepository struct {
+	templates map[int64]*domain.NoteTemplate
+	nextID    int64
+}
+
+func newMockTemplateRepository() *mockTemplateRepository {
+	return &mockTemplateRepository{templates: make(map[int64]*domain.NoteTemplate), nextID: 1}
+}
+
+func (m *mockTemplateRepository) FindAll(ctx context.Context) ([]*domain.NoteTemplate, error) {
+	var templates []*domain.NoteTemplate
+	for _, tmpl := range m.templates {
+		templates = append(templates, tmpl)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+func (m *mockTemplateRepository) FindByID(ctx context.Context, id int64) (*domain.NoteTemplate, error) {
+	return m.templates[id], nil
+}
+
+func (m *mockTemplateRepository) Create(ctx context.Context, tmpl *domain.NoteTemplate) (int64, error) {
+	id := m.nextID
+	m.nextID++
+	copied := *tmpl
+	copied.ID = id
+	m.templates[id] = &copied
+	return id, nil
+}
+
+func (m *mockTemplateRepository) Update(ctx context.Context, tmpl *domain.NoteTemplate) error {
+	copied := *tmpl
+	m.templates[tmpl.ID] = &copied
+	return nil
+}
+
+func (m *mockTemplateRepository) Delete(ctx context.Context, id int64) error {
+	delete(m.templates, id)
+	return nil
+}
+
+func (m *mockTemplateRepository) NextCounter(ctx context.Context, id int64) (int64, error) {
+	tmpl, ok := m.templates[id]
+	if !ok {
+		return 0, nil
+	}
+	tmpl.Counter++
+	return tmpl.Counter, nil
+}
+
+// Create a template service with no templates
+func newTemplateService() services.TemplateService {
+	return services.NewTemplateService(newMockTemplateRepository())
+}
+
+func TestTemplateServiceEnforcesRoles(t *testing.T) {
+	service := services.NewTemplateService(newMockTemplateRepository())
+
+	if _, err := service.CreateTemplate(userContext(viewerUser), "Standup", "Standup", ""); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected viewers to be refused, got %v", err)
+	}
+	if _, err := service.GetTemplates(userContext(viewerUser)); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected viewers not to list templates, got %v", err)
+	}
+	if _, err := service.CreateTemplate(context.Background(), "Standup", "Standup", ""); !errors.Is(err, services.ErrUnauthenticated) {
+		t.Errorf("Expected anonymous callers to be refused, got %v", err)
+	}
+
+	tmpl, err := service.CreateTemplate(userContext(editorUser), "  Standup ", "Standup {{date}}", "Yesterday:")
+	if err != nil {
+		t.Fatalf("Expected editors to create templates, got %v", err)
+	}
+	if tmpl.Name != "Standup" || tmpl.CreatedBy != editorUser.ID {
+		t.Errorf("Expected a trimmed template by the editor, got %+v", tmpl)
+	}
+
+	for _, name := range []string{"", strings.Repeat("n", 101)} {
+		if _, err := service.UpdateTemplate(userContext(editorUser), tmpl.ID, name, "Title", ""); !errors.Is(err, services.ErrInvalidTemplate) {
+			t.Errorf("Expected the name %q to be rejected, got %v", name, err)
+		}
+	}
+	if _, err := service.UpdateTemplate(userContext(editorUser), tmpl.ID, "Standup", " ", ""); !errors.Is(err, services.ErrInvalidTemplate) {
+		t.Errorf("Expected an empty title to be rejected, got %v", err)
+	}
+
+	if err := service.DeleteTemplate(userContext(adminUser), tmpl.ID); err != nil {
+		t.Fatalf("Failed to delete template: %v", err)
+	}
+	if _, err := service.GetTemplate(userContext(editorUser), tmpl.ID); !errors.Is(err, services.ErrTemplateNotFound) {
+		t.Errorf("Expected the template to be gone, got %v", err)
+	}
+}
+
+func TestCreateNoteFromTemplateExpandsVariables(t *testing.T) {
+	repo := newMockRepository()
+	templates := newMockTemplateRepository()
+	service := services.NewNoteService(repo, newMockShareRepository(repo), newMockUserRepository(), &mockAuditRepository{}, templates, newMockLinkRepository(), &mockTransactor{})
+	id, _ := templates.Create(context.Background(), &domain.NoteTemplate{
+		Name:    "Standup",
+		Title:   "Standup #{{counter}} on {{ date }}",
+		Content: "By {{user}} on {{weekday}} at {{time}}, see {{unknown}}",
+	})
+
+	today := time.Now()
+	note, err := service.CreateNoteFromTemplate(userContext(editorUser), id, "", "", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to create note: %v", err)
+	}
+	if want := "Standup #1 on " + today.Format("2006-01-02"); note.Title != want {
+		t.Errorf("Expected the title %q, got %q", want, note.Title)
+	}
+	if !strings.HasPrefix(note.Content, "By editor on "+today.Weekday().String()+" at ") {
+		t.Errorf("Expected the user and weekday in the content, got %q", note.Content)
+	}
+	if !strings.HasSuffix(note.Content, "see {{unknown}}") {
+		t.Errorf("Expected unknown variables to be kept, got %q", note.Content)
+	}
+	if note.UserID != editorUser.ID || repo.notes[note.ID] == nil {
+		t.Error("Expected the note to be stored for the editor")
+	}
+
+	// Submitted text replaces the template's and the counter keeps counting
+	note, err = service.CreateNoteFromTemplate(userContext(adminUser), id, "Note {{counter}}", "", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to create note: %v", err)
+	}
+	if note.Title != "Note 2" {
+		t.Errorf("Expected the counter to be bumped, got %q", note.Title)
+	}
+
+	if _, err := service.CreateNoteFromTemplate(userContext(viewerUser), id, "", "", time.Time{}, time.Time{}); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected viewers to be refused, got %v", err)
+	}
+	if _, err := service.CreateNoteFromTemplate(userContext(editorUser), 99, "", "", time.Time{}, time.Time{}); !errors.Is(err, services.ErrTemplateNotFound) {
+		t.Errorf("Expected a missing template to be reported, got %v", err)
+	}
+	if templates.templates[id].Counter != 2 {
+		t.Errorf("Expected refused notes not to bump the counter, got %d", templates.templates[id].Counter)
+	}
+}
+
+// Set up a router with the template pages and the note form signed in as user
+func setupTemplateRouter(t *testing.T, user *domain.User) (*gin.Engine, *mockTemplateRepository, *mockNoteRepository) {
+	r := fixtures.NewRouter(t, user)
+
+	repo := newMockRepository()
+	templates := newMockTemplateRepository()
+	templateService := services.NewTemplateService(templates)
+	noteService := services.NewNoteService(repo, newMockShareRepository(repo), newMockUserRepository(), &mockAuditRepository{}, templates, newMockLinkRepository(), &mockTransactor{})
+	noteHandler := handlers.NewNoteHandler(noteService, templateService, newSearchService(repo), testBaseURL)
+	templateHandler := handlers.NewTemplateHandler(templateService)
+	r.GET("/notes/new", noteHandler.New)
+	r.POST("/notes", noteHandler.Create)
+	group := r.Group("/templates", middlewares.RequirePermission(domain.PermTemplatesManage))
+	group.GET("", templateHandler.Index)
+	group.POST("", templateHandler.Create)
+	group.GET("/:id/edit", templateHandler.Edit)
+	group.POST("/:id", templateHandler.Update)
+	group.DELETE("/:id", templateHandler.Delete)
+	return r, templates, repo
+}
+
+func TestTemplatePagesManageTemplates(t *testing.T) {
+	router, templates, _ := setupTemplateRouter(t, editorUser)
+
+	w := serve(router, "POST", "/templates", url.Values{"name": {"Standup"}, "title": {"Standup {{date}}"}, "content": {"Done:"}}, false)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect, got %d: %s", w.Code, w.Body.String())
+	}
+	w = serve(router, "GET", "/templates", nil, false)
+	if body := w.Body.String(); !strings.Contains(body, "Standup") || !strings.Contains(body, "{{counter}}") {
+		t.Error("Expected the template and the variable help on the page")
+	}
+
+	w = serve(router, "POST", "/templates", url.Values{"name": {""}, "title": {"Kept title"}}, false)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Kept title") {
+		t.Errorf("Expected the form to be shown again with the input, got %d", w.Code)
+	}
+
+	w = serve(router, "POST", "/templates/1", url.Values{"name": {"Daily"}, "title": {"Daily"}, "content": {""}}, false)
+	if w.Code != http.StatusSeeOther || templates.templates[1].Name != "Daily" {
+		t.Errorf("Expected the template to be renamed, got %d", w.Code)
+	}
+	if w = serve(router, "GET", "/templates/2/edit", nil, false); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a missing template to be a 404, got %d", w.Code)
+	}
+
+	if w = serve(router, "DELETE", "/templates/1", nil, true); w.Code != http.StatusOK || len(templates.templates) != 0 {
+		t.Errorf("Expected the template to be deleted, got %d", w.Code)
+	}
+
+	viewer, _, _ := setupTemplateRouter(t, viewerUser)
+	if w = serve(viewer, "GET", "/templates", nil, false); w.Code != http.StatusForbidden {
+		t.Errorf("Expected viewers to be refused, got %d", w.Code)
+	}
+}
+
+func TestNoteFormPicksTemplate(t *testing.T) {
+	router, templates, repo := setupTemplateRouter(t, editorUser)
+	id, _ := templates.Create(context.Background(), &domain.NoteTemplate{Name: "Meeting", Title: "Meeting {{counter}}", Content: "Agenda"})
+
+	w := serve(router, "GET", "/notes/new", nil, false)
+	if body := w.Body.String(); !strings.Contains(body, "New from template") || !strings.Contains(body, ">Meeting</option>") {
+		t.Error("Expected the template picker on the form")
+	}
+
+	w = serve(router, "GET", "/notes/new?template=1", nil, false)
+	body := w.Body.String()
+	if !strings.Contains(body, `value="Meeting {{counter}}"`) || !strings.Contains(body, `name="template_id" value="1"`) {
+		t.Error("Expected the form to be prefilled from the template")
+	}
+	if w = serve(router, "GET", "/notes/new?template=9", nil, false); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a missing template to be a 404, got %d", w.Code)
+	}
+
+	w = serve(router, "POST", "/notes", url.Values{"title": {"Meeting {{counter}}"}, "content": {"Agenda"}, "template_id": {"1"}}, false)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("Expected a redirect, got %d: %s", w.Code, w.Body.String())
+	}
+	if note := repo.notes[1]; note == nil || note.Title != "Meeting 1" {
+		t.Errorf("Expected the variables to be expanded, got %+v", note)
+	}
+	if templates.templates[id].Counter != 1 {
+		t.Error("Expected the template counter to be bumped")
+	}
+}
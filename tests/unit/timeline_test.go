@@ -0,0 +1,175 @@
+package unit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+)
+
+func TestPeriodStart(t *testing.T) {
+	// Thursday 12 March 2026
+	date := time.Date(2026, 3, 12, 18, 30, 0, 0, time.UTC)
+	tests := map[string]time.Time{
+		domain.PeriodDay:   time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC),
+		domain.PeriodWeek:  time.Date(2026, 3, 9, 0, 0, 0, 0, time.UTC),
+		domain.PeriodMonth: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for period, want := range tests {
+		if got := domain.PeriodStart(date, period); !got.Equal(want) {
+			t.Errorf("Expected the %s to start on %v, got %v", period, want, got)
+		}
+	}
+	if got := domain.PeriodStart(time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC), domain.PeriodWeek); got.Day() != 9 {
+		t.Errorf("Expected Sunday to end the week, got %v", got)
+	}
+}
+
+func TestGroupNotes(t *testing.T) {
+	berlin := time.FixedZone("CET", 3600)
+	notes := []*domain.Note{
+		// Sunday 15 March at 23:30 UTC is already Monday in Berlin
+		{ID: 3, CreatedAt: time.Date(2026, 3, 15, 23, 30, 0, 0, time.UTC), UpdatedAt: time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)},
+		{ID: 2, CreatedAt: time.Date(2026, 3, 13, 9, 0, 0, 0, time.UTC)},
+		{ID: 1, CreatedAt: time.Date(2026, 3, 9, 9, 0, 0, 0, time.UTC)},
+	}
+
+	groups := domain.GroupNotes(notes, domain.DateRange{Field: domain.NoteCreated}, domain.PeriodWeek, berlin)
+	if len(groups) != 2 || len(groups[0].Notes) != 1 || len(groups[1].Notes) != 2 {
+		t.Fatalf("Expected the Berlin Monday on its own week, got %+v", groups)
+	}
+	if groups[0].Label() != "Week of 16 March 2026" || groups[1].Notes[0].ID != 2 {
+		t.Errorf("Expected the weeks in the order of their notes, got %q then %+v", groups[0].Label(), groups[1].Notes)
+	}
+
+	groups = domain.GroupNotes(notes[:1], domain.DateRange{Field: domain.NoteUpdated}, domain.PeriodMonth, berlin)
+	if len(groups) != 1 || groups[0].Label() != "January 2026" {
+		t.Errorf("Expected the note grouped by its update, got %+v", groups)
+	}
+	if label := (domain.TimelineGroup{Start: groups[0].Start, Period: domain.PeriodDay}).Label(); label != "Thursday, 1 January 2026" {
+		t.Errorf("Expected days labelled with their weekday, got %q", label)
+	}
+}
+
+func TestGetNotesInRange(t *testing.T) {
+	repo := newMockRepository()
+	service := newNoteService(repo)
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 12, 0, 0, 0, time.UTC) }
+	repo.notes[1] = &domain.Note{ID: 1, UserID: editorUser.ID, CreatedAt: day(1), UpdatedAt: day(20)}
+	repo.notes[2] = &domain.Note{ID: 2, UserID: editorUser.ID, CreatedAt: day(10), UpdatedAt: day(10)}
+	repo.notes[3] = &domain.Note{ID: 3, UserID: adminUser.ID, CreatedAt: day(11), UpdatedAt: day(11)}
+
+	tests := []struct {
+		user  *domain.User
+		dates domain.DateRange
+		want  string
+	}{
+		{editorUser, domain.DateRange{Field: domain.NoteCreated, From: day(5)}, "[2]"},
+		{editorUser, domain.DateRange{Field: domain.NoteUpdated, From: day(5)}, "[1 2]"},
+		{editorUser, domain.DateRange{Field: domain.NoteCreated, To: day(10)}, "[1]"},
+		{adminUser, domain.DateRange{Field: domain.NoteCreated, From: day(5), To: day(12)}, "[3 2]"},
+	}
+	for _, tt := range tests {
+		notes, err := service.GetNotesInRange(userContext(tt.user), tt.dates)
+		if err != nil {
+			t.Fatalf("Failed to fetch notes in range: %v", err)
+		}
+		var ids []int64
+		for _, note := range notes {
+			ids = append(ids, note.ID)
+		}
+		if got := fmt.Sprint(ids); got != tt.want {
+			t.Errorf("Expected %+v as %s to return %s, got %s", tt.dates, tt.user.Username, tt.want, got)
+		}
+	}
+
+	for _, dates := range []domain.DateRange{{Field: "due"}, {Field: domain.NoteCreated, From: day(2), To: day(1)}} {
+		if _, err := service.GetNotesInRange(userContext(editorUser), dates); !errors.Is(err, services.ErrInvalidDateRange) {
+			t.Errorf("Expected %+v to be rejected, got %v", dates, err)
+		}
+	}
+	if _, err := service.GetTimeline(userContext(editorUser), domain.DateRange{Field: domain.NoteCreated}, "year"); !errors.Is(err, services.ErrInvalidPeriod) {
+		t.Errorf("Expected an unknown period to be rejected, got %v", err)
+	}
+
+	searches := newSearchService(repo)
+	notes, err := searches.SearchNotes(userContext(editorUser), "", domain.DateRange{Field: domain.NoteUpdated, From: day(15)})
+	if err != nil || len(notes) != 1 || notes[0].ID != 1 {
+		t.Errorf("Expected searches limited to the range, got %v, %v", notes, err)
+	}
+}
+
+// Set up a router with the note views signed in as user, in UTC
+func setupTimelineRouter(t *testing.T, user *domain.User) (*gin.Engine, *mockNoteRepository) {
+	utc := *user
+	utc.Timezone = "UTC"
+	r := fixtures.NewRouter(t, &utc)
+
+	repo := newMockRepository()
+	noteHandler := handlers.NewNoteHandler(newNoteService(repo), newTemplateService(), newSearchService(repo), testBaseURL)
+	r.GET("/notes", noteHandler.Index)
+	r.GET("/notes/timeline", noteHandler.Timeline)
+	r.GET("/notes/calendar", noteHandler.Calendar)
+	return r, repo
+}
+
+func TestNoteViews(t *testing.T) {
+	router, repo := setupTimelineRouter(t, editorUser)
+	at := func(d, hour int) time.Time { return time.Date(2026, 3, d, hour, 0, 0, 0, time.UTC) }
+	repo.notes[1] = &domain.Note{ID: 1, UserID: editorUser.ID, Title: "Kickoff", CreatedAt: at(2, 9), UpdatedAt: at(2, 9)}
+	repo.notes[2] = &domain.Note{ID: 2, UserID: editorUser.ID, Title: "Review", CreatedAt: at(12, 15), UpdatedAt: at(30, 8)}
+	for i := int64(3); i <= 6; i++ {
+		repo.notes[i] = &domain.Note{ID: i, UserID: editorUser.ID, Title: fmt.Sprintf("Busy %d", i), CreatedAt: at(20, int(i)), UpdatedAt: at(20, int(i))}
+	}
+
+	w := serve(router, "GET", "/notes?from=2026-03-10&to=2026-03-12", nil, false)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "Review") || strings.Contains(body, "Kickoff") || strings.Contains(body, "Busy") {
+		t.Fatalf("Expected the notes created in the range, got %d: %s", w.Code, body)
+	}
+	if !strings.Contains(body, `name="from" value="2026-03-10"`) {
+		t.Error("Expected the range to be kept in the form")
+	}
+	if w = serve(router, "GET", "/notes?from=2026-03-13&to=2026-03-12", nil, false); w.Code != http.StatusBadRequest ||
+		!strings.Contains(w.Body.String(), "the end date must not be before the start date") {
+		t.Errorf("Expected a backwards range to be explained, got %d", w.Code)
+	}
+	if w = serve(router, "GET", "/notes?from=March", nil, false); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid date to be rejected, got %d", w.Code)
+	}
+
+	w = serve(router, "GET", "/notes/timeline?period=month&by=updated", nil, false)
+	body = w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "March 2026") || !strings.Contains(body, "Mon, Mar 30 08:00") {
+		t.Fatalf("Expected notes grouped by month of their update, got %d: %s", w.Code, body)
+	}
+	w = serve(router, "GET", "/notes/timeline?period=day&from=2026-03-12&to=2026-03-12", nil, false)
+	if body = w.Body.String(); !strings.Contains(body, "Thursday, 12 March 2026") || !strings.Contains(body, "15:00") || strings.Contains(body, "Kickoff") {
+		t.Errorf("Expected the one day of the range, got %s", body)
+	}
+	for _, query := range []string{"period=year", "by=due"} {
+		if w = serve(router, "GET", "/notes/timeline?"+query, nil, false); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be rejected, got %d", query, w.Code)
+		}
+	}
+
+	w = serve(router, "GET", "/notes/calendar?month=2026-03", nil, false)
+	body = w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, "March 2026") || !strings.Contains(body, ">Kickoff</a>") {
+		t.Fatalf("Expected the month with its notes, got %d: %s", w.Code, body)
+	}
+	if !strings.Contains(body, `href="/notes?from=2026-03-20&amp;to=2026-03-20&amp;by=created" class="link">+1 more</a>`) {
+		t.Errorf("Expected a busy day to link to the rest of its notes, got %s", body)
+	}
+	if w = serve(router, "GET", "/notes/calendar?month=2026-13", nil, false); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an invalid month to be rejected, got %d", w.Code)
+	}
+}
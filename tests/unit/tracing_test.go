@@ -0,0 +1,102 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/middlewares"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/tracing"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Install an in-memory span exporter as the global tracer provider
+func setupTracing(t *testing.T) *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := tracing.SetupProvider(sdktrace.WithSyncer(exporter))
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+	return exporter
+}
+
+// Find a recorded span by name
+func findSpan(spans tracetest.SpanStubs, name string) *tracetest.SpanStub {
+	for i := range spans {
+		if spans[i].Name == name {
+			return &spans[i]
+		}
+	}
+	return nil
+}
+
+func TestTracingMiddlewareContinuesIncomingTrace(t *testing.T) {
+	exporter := setupTracing(t)
+
+	repo := newMockRepository()
+	repo.notes[1] = domain.NewNote("Traced", "Content")
+	service := newNoteService(repo)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(middlewares.TracingMiddleware())
+	r.GET("/notes/:id", func(c *gin.Context) {
+		id, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+		if _, err := service.GetNoteByID(auth.WithUser(c.Request.Context(), adminUser), id); err != nil {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest("GET", "/notes/1", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exporter.GetSpans()
+	server := findSpan(spans, "GET /notes/:id")
+	if server == nil {
+		t.Fatalf("Expected a server span, got %v", spans)
+	}
+	if server.SpanKind != trace.SpanKindServer {
+		t.Errorf("Expected server span kind, got %v", server.SpanKind)
+	}
+	if server.SpanContext.TraceID().String() != traceID {
+		t.Errorf("Expected trace ID %s, got %s", traceID, server.SpanContext.TraceID())
+	}
+	if server.Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected remote parent span, got %s", server.Parent.SpanID())
+	}
+
+	svc := findSpan(spans, "NoteService.GetNoteByID")
+	if svc == nil {
+		t.Fatal("Expected a NoteService span")
+	}
+	if svc.Parent.SpanID() != server.SpanContext.SpanID() {
+		t.Error("Expected NoteService span to be a child of the server span")
+	}
+}
+
+func TestTracingRecordsServiceErrors(t *testing.T) {
+	exporter := setupTracing(t)
+
+	service := newNoteService(newMockRepository())
+	if _, err := service.GetNoteByID(userContext(adminUser), 999); err != services.ErrNoteNotFound {
+		t.Fatalf("Expected ErrNoteNotFound, got %v", err)
+	}
+
+	span := findSpan(exporter.GetSpans(), "NoteService.GetNoteByID")
+	if span == nil {
+		t.Fatal("Expected a NoteService span")
+	}
+	if span.Status.Description != services.ErrNoteNotFound.Error() {
+		t.Errorf("Expected span status to describe the error, got %q", span.Status.Description)
+	}
+}
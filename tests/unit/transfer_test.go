@@ -0,0 +1,297 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/jobs"
+	"github.com/mas-diq/htmx-basic-crud/internals/repositories"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+)
+
+// Mock transfer repository
+type mockTransferRepository struct {
+	imports map[int64]*domain.NoteImport
+	exports []*domain.NoteExport
+	nextID  int64
+}
+
+func newMockTransferRepository() *mockTransferRepository {
+	return &mockTransferRepository{imports: make(map[int64]*domain.NoteImport), nextID: 1}
+}
+
+func (m *mockTransferRepository) CreateImport(ctx context.Context, upload *domain.NoteImport) (int64, error) {
+	upload.ID = m.nextID
+	m.nextID++
+	m.imports[upload.ID] = upload
+	return upload.ID, nil
+}
+
+func (m *mockTransferRepository) FindImport(ctx context.Context, id int64) (*domain.NoteImport, error) {
+	return m.imports[id], nil
+}
+
+func (m *mockTransferRepository) SetImported(ctx context.Context, id int64, imported int) error {
+	m.imports[id].Imported = imported
+	return nil
+}
+
+func (m *mockTransferRepository) DeleteImport(ctx context.Context, id int64) error {
+	delete(m.imports, id)
+	return nil
+}
+
+func (m *mockTransferRepository) CreateExport(ctx context.Context, export *domain.NoteExport) (int64, error) {
+	export.ID = int64(len(m.exports) + 1)
+	m.exports = append(m.exports, export)
+	return export.ID, nil
+}
+
+func (m *mockTransferRepository) FindExports(ctx context.Context, userID int64, limit int) ([]*domain.NoteExport, error) {
+	var exports []*domain.NoteExport
+	for i := len(m.exports) - 1; i >= 0 && len(exports) < limit; i-- {
+		if m.exports[i].UserID == userID {
+			exports = append(exports, m.exports[i])
+		}
+	}
+	return exports, nil
+}
+
+func (m *mockTransferRepository) FindExport(ctx context.Context, userID, id int64) (*domain.NoteExport, error) {
+	if id < 1 || id > int64(len(m.exports)) || m.exports[id-1].UserID != userID {
+		return nil, nil
+	}
+	return m.exports[id-1], nil
+}
+
+// transferFixture is a transfer service with the repositories it stores to
+type transferFixture struct {
+	service       services.TransferService
+	queue         *jobs.Queue
+	notes         *mockNoteRepository
+	transfers     *mockTransferRepository
+	notifications *mockNotificationRepository
+	transactor    *mockTransactor
+}
+
+// Set up a transfer service whose jobs are registered on a queue
+func setupTransfers() *transferFixture {
+	return setupTransfersWith(newNoteService)
+}
+
+// Set up a transfer service creating and reading notes with the service
+// notes returns for the fixture's note repository
+func setupTransfersWith(notes func(repositories.NoteRepository) services.NoteService) *transferFixture {
+	f := &transferFixture{
+		notes:         newMockRepository(),
+		transfers:     newMockTransferRepository(),
+		notifications: &mockNotificationRepository{},
+		transactor:    &mockTransactor{},
+	}
+	users := newMockUserRepository()
+	for _, user := range []*domain.User{adminUser, editorUser, viewerUser} {
+		users.users[user.ID] = user
+	}
+	f.queue, _ = setupQueue(1, 3)
+	f.service = services.NewTransferService(notes(f.notes), users, f.transfers, f.notifications, f.transactor, f.queue)
+	f.queue.Register(services.ImportJob, f.service.Import)
+	f.queue.Register(services.ExportJob, f.service.Export)
+	return f
+}
+
+func TestImportCreatesNotesInBackground(t *testing.T) {
+	f := setupTransfers()
+	due := time.Date(2030, 5, 1, 9, 30, 0, 0, time.UTC)
+	data := []byte(`[{"id": 7, "title": "Plans", "content": "Soon", "due_at": "2030-05-01T09:30:00Z"}, {"title": "Ideas"}]`)
+
+	count, err := f.service.QueueImport(userContext(editorUser), data)
+	if err != nil || count != 2 {
+		t.Fatalf("Expected 2 notes to be queued, got %d, %v", count, err)
+	}
+	if len(f.notes.notes) != 0 {
+		t.Fatal("Expected the notes to be created by the job, not the request")
+	}
+	runAll(t, f.queue)
+
+	if len(f.notes.notes) != 2 || f.notes.notes[1].UserID != editorUser.ID || !f.notes.notes[1].DueAt.Equal(due) {
+		t.Errorf("Expected the notes to belong to the importer with their schedule, got %+v", f.notes.notes)
+	}
+	if len(f.transfers.imports) != 0 || f.transactor.committed != 1 {
+		t.Errorf("Expected the notes created in one batch and the upload deleted, got %d left", len(f.transfers.imports))
+	}
+	if len(f.notifications.notifications) != 1 || f.notifications.notifications[0].Message != "Imported 2 notes" {
+		t.Errorf("Expected the importer to be notified, got %+v", f.notifications.notifications)
+	}
+
+	for _, data := range []string{`{"title": "Plans"}`, `[]`, `[{"title": " "}]`, `not json`} {
+		if _, err := f.service.QueueImport(userContext(editorUser), []byte(data)); !errors.Is(err, services.ErrInvalidImport) {
+			t.Errorf("Expected %s to be rejected, got %v", data, err)
+		}
+	}
+	if _, err := f.service.QueueImport(userContext(viewerUser), data); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected viewers not to import, got %v", err)
+	}
+}
+
+// Note repository failing to create the note titled failOn, once
+type flakyNoteRepository struct {
+	*mockNoteRepository
+	failOn string
+}
+
+func (r *flakyNoteRepository) Create(ctx context.Context, note *domain.Note) (int64, error) {
+	if note.Title == r.failOn {
+		r.failOn = ""
+		return 0, errors.New("connection lost")
+	}
+	return r.mockNoteRepository.Create(ctx, note)
+}
+
+func TestImportCommitsInBatches(t *testing.T) {
+	hooks := &mockWebhookRepository{}
+	webhookService := services.NewWebhookService(hooks, nil, 3, time.Second)
+	if _, err := webhookService.CreateWebhook(userContext(adminUser), "https://example.com/hook", []domain.WebhookEvent{domain.WebhookNoteCreated}); err != nil {
+		t.Fatalf("Error creating webhook: %v", err)
+	}
+	// A note in the middle of the second batch fails once
+	f := setupTransfersWith(func(repo repositories.NoteRepository) services.NoteService {
+		flaky := &flakyNoteRepository{repo.(*mockNoteRepository), "Note 60"}
+		return services.NewWebhookNoteService(newNoteService(flaky), webhookService)
+	})
+
+	var upload []map[string]string
+	for i := 1; i <= 120; i++ {
+		upload = append(upload, map[string]string{"title": fmt.Sprintf("Note %d", i)})
+	}
+	data, _ := json.Marshal(upload)
+	if _, err := f.service.QueueImport(userContext(editorUser), data); err != nil {
+		t.Fatalf("Error queueing import: %v", err)
+	}
+
+	if _, err := f.queue.RunOnce(context.Background()); err != nil {
+		t.Fatalf("Error running job: %v", err)
+	}
+	if f.transfers.imports[1].Imported != 50 || f.transactor.committed != 1 || f.transactor.rolledBack != 1 {
+		t.Fatalf("Expected the first batch committed and recorded, got %+v", f.transactor)
+	}
+	// The mock repository keeps the notes of the rolled back batch, but
+	// they are not published
+	if len(hooks.deliveries) != 50 {
+		t.Errorf("Expected only the committed notes to be published, got %d deliveries", len(hooks.deliveries))
+	}
+
+	// The retry resumes with the batch that rolled back
+	runAll(t, f.queue)
+	if f.transactor.committed != 3 {
+		t.Errorf("Expected the remaining notes created in 2 more batches, got %d commits", f.transactor.committed)
+	}
+	if len(hooks.deliveries) != 120 || len(f.transfers.imports) != 0 {
+		t.Errorf("Expected a delivery per note and the upload deleted, got %d deliveries", len(hooks.deliveries))
+	}
+}
+
+func TestExportWritesReadableNotes(t *testing.T) {
+	f := setupTransfers()
+	f.notes.notes[1] = &domain.Note{ID: 1, UserID: editorUser.ID, Title: "Mine"}
+	f.notes.notes[2] = &domain.Note{ID: 2, UserID: adminUser.ID, Title: "Theirs"}
+
+	if err := f.service.QueueExport(userContext(editorUser)); err != nil {
+		t.Fatalf("Failed to queue export: %v", err)
+	}
+	runAll(t, f.queue)
+
+	exports, err := f.service.GetExports(userContext(editorUser))
+	if err != nil || len(exports) != 1 || exports[0].Notes != 1 {
+		t.Fatalf("Expected an export of the editor's note, got %+v, %v", exports, err)
+	}
+	export, err := f.service.GetExport(userContext(editorUser), exports[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to fetch export: %v", err)
+	}
+	var notes []domain.Note
+	if err := json.Unmarshal(export.Body, &notes); err != nil || len(notes) != 1 || notes[0].Title != "Mine" {
+		t.Errorf("Expected the JSON of the editor's note, got %s", export.Body)
+	}
+	if len(f.notifications.notifications) != 1 || f.notifications.notifications[0].UserID != editorUser.ID {
+		t.Errorf("Expected the editor to be notified, got %+v", f.notifications.notifications)
+	}
+
+	if _, err := f.service.GetExport(userContext(adminUser), exports[0].ID); !errors.Is(err, services.ErrExportNotFound) {
+		t.Errorf("Expected other users' exports to be missing, got %v", err)
+	}
+}
+
+// Set up the import and export page signed in as user
+func setupTransferRouter(t *testing.T, user *domain.User) (*gin.Engine, *transferFixture) {
+	r := fixtures.NewRouter(t, user)
+
+	f := setupTransfers()
+	transferHandler := handlers.NewTransferHandler(f.service)
+	r.GET("/exports", transferHandler.Index)
+	r.POST("/exports", transferHandler.Export)
+	r.GET("/exports/:id", transferHandler.Download)
+	r.POST("/imports", transferHandler.Import)
+	return r, f
+}
+
+// upload posts data as the file of the import form
+func upload(router *gin.Engine, data string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, _ := form.CreateFormFile("file", "notes.json")
+	file.Write([]byte(data))
+	form.Close()
+
+	req, _ := http.NewRequest("POST", "/imports", &body)
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTransferPages(t *testing.T) {
+	router, f := setupTransferRouter(t, editorUser)
+
+	w := upload(router, `[{"title": "Plans", "content": "Soon"}]`)
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), "Importing 1 notes") {
+		t.Fatalf("Expected the import to be queued, got %d: %s", w.Code, w.Body.String())
+	}
+	if w = upload(router, `{"title": "Plans"}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "JSON export") {
+		t.Errorf("Expected an invalid import to be rejected, got %d", w.Code)
+	}
+
+	if w = serve(router, "POST", "/exports", nil, false); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected the export to be queued, got %d", w.Code)
+	}
+	runAll(t, f.queue)
+
+	w = serve(router, "GET", "/exports", nil, false)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `href="/exports/1"`) {
+		t.Fatalf("Expected the export to be listed, got %d: %s", w.Code, w.Body.String())
+	}
+	// One entry in the mobile menu and one in the navbar
+	if n := strings.Count(w.Body.String(), `<a href="/exports">Import and export</a>`); n != 2 {
+		t.Errorf("Expected the page to be linked once from each menu, got %d links", n)
+	}
+	w = serve(router, "GET", "/exports/1", nil, false)
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Disposition"), "attachment") || !strings.Contains(w.Body.String(), `"title": "Plans"`) {
+		t.Errorf("Expected the export as a download, got %d: %s", w.Code, w.Body.String())
+	}
+	if w = serve(router, "GET", "/exports/9", nil, false); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a missing export to be a 404, got %d", w.Code)
+	}
+}
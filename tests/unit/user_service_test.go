@@ -0,0 +1,306 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/auth"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/middlewares"
+	"github.com/mas-diq/htmx-basic-crud/internals/ratelimit"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+)
+
+// Mock user and session repositories for testing
+type mockUserRepository struct {
+	users    map[int64]*domain.User
+	sessions map[string]mockSession
+	nextID   int64
+}
+
+type mockSession struct {
+	userID    int64
+	expiresAt time.Time
+}
+
+func newMockUserRepository() *mockUserRepository {
+	return &mockUserRepository{
+		users:    make(map[int64]*domain.User),
+		sessions: make(map[string]mockSession),
+		nextID:   1,
+	}
+}
+
+func (m *mockUserRepository) FindAll(ctx context.Context) ([]*domain.User, error) {
+	var users []*domain.User
+	for _, user := range m.users {
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (m *mockUserRepository) FindByID(ctx context.Context, id int64) (*domain.User, error) {
+	return m.users[id], nil
+}
+
+func (m *mockUserRepository) FindByUsername(ctx context.Context, username string) (*domain.User, error) {
+	for _, user := range m.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockUserRepository) Create(ctx context.Context, user *domain.User) (int64, error) {
+	id := m.nextID
+	m.nextID++
+	m.users[id] = user
+	return id, nil
+}
+
+func (m *mockUserRepository) UpdateRole(ctx context.Context, id int64, role domain.Role) error {
+	m.users[id].Role = role
+	return nil
+}
+
+func (m *mockUserRepository) UpdateAccount(ctx context.Context, id int64, email, timezone string) error {
+	m.users[id].Email = email
+	m.users[id].Timezone = timezone
+	return nil
+}
+
+// mockSessionRepository stores sessions in the same mock as the users
+type mockSessionRepository struct {
+	*mockUserRepository
+}
+
+func (m mockSessionRepository) Create(ctx context.Context, tokenHash string, userID int64, expiresAt time.Time) error {
+	m.sessions[tokenHash] = mockSession{userID, expiresAt}
+	return nil
+}
+
+func (m mockSessionRepository) FindUser(ctx context.Context, tokenHash string, now time.Time) (*domain.User, error) {
+	session, ok := m.sessions[tokenHash]
+	if !ok || !session.expiresAt.After(now) {
+		return nil, nil
+	}
+	return m.users[session.userID], nil
+}
+
+func (m mockSessionRepository) Delete(ctx context.Context, tokenHash string) error {
+	delete(m.sessions, tokenHash)
+	return nil
+}
+
+func (m mockSessionRepository) DeleteExpired(ctx context.Context, now time.Time) error {
+	return nil
+}
+
+// Create a user service with an admin account named "root"
+func setupUserService(t *testing.T) (services.UserService, *mockUserRepository) {
+	repo := newMockUserRepository()
+	service := services.NewUserService(repo, mockSessionRepository{repo}, time.Hour)
+	if _, err := service.CreateUser(userContext(auth.System), "root", "correct horse", domain.RoleAdmin); err != nil {
+		t.Fatalf("Error creating user: %v", err)
+	}
+	return service, repo
+}
+
+func TestUserServiceLogin(t *testing.T) {
+	service, repo := setupUserService(t)
+	ctx := context.Background()
+
+	if repo.users[1].PasswordHash == "correct horse" {
+		t.Error("Expected the password to be stored hashed")
+	}
+
+	token, user, err := service.Login(ctx, "root", "correct horse")
+	if err != nil {
+		t.Fatalf("Error logging in: %v", err)
+	}
+	if user.Username != "root" || token == "" {
+		t.Errorf("Expected a session for root, got %q %+v", token, user)
+	}
+	if _, ok := repo.sessions[token]; ok {
+		t.Error("Expected only the token hash to be stored")
+	}
+
+	if found, _ := service.UserForSession(ctx, token); found == nil || found.ID != user.ID {
+		t.Errorf("Expected the session to resolve to root, got %+v", found)
+	}
+	if err := service.Logout(ctx, token); err != nil {
+		t.Fatalf("Error logging out: %v", err)
+	}
+	if found, _ := service.UserForSession(ctx, token); found != nil {
+		t.Error("Expected the session to end on logout")
+	}
+
+	for _, creds := range [][2]string{{"root", "wrong"}, {"nobody", "correct horse"}} {
+		if _, _, err := service.Login(ctx, creds[0], creds[1]); !errors.Is(err, services.ErrInvalidCredentials) {
+			t.Errorf("Expected ErrInvalidCredentials for %q, got %v", creds[0], err)
+		}
+	}
+}
+
+func TestUserServiceManagement(t *testing.T) {
+	service, repo := setupUserService(t)
+	root := repo.users[1]
+
+	if _, err := service.CreateUser(userContext(editorUser), "eve", "long enough", domain.RoleAdmin); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected editors not to create users, got %v", err)
+	}
+	if _, err := service.CreateUser(userContext(root), "root", "long enough", domain.RoleViewer); !errors.Is(err, services.ErrUsernameTaken) {
+		t.Errorf("Expected ErrUsernameTaken, got %v", err)
+	}
+	if _, err := service.CreateUser(userContext(root), "bob", "short", domain.RoleViewer); !errors.Is(err, services.ErrInvalidUser) {
+		t.Errorf("Expected ErrInvalidUser for a short password, got %v", err)
+	}
+
+	bob, err := service.CreateUser(userContext(root), "bob", "long enough", domain.RoleViewer)
+	if err != nil {
+		t.Fatalf("Error creating user: %v", err)
+	}
+	if _, err := service.SetRole(userContext(root), bob.ID, domain.Role("owner")); !errors.Is(err, services.ErrInvalidRole) {
+		t.Errorf("Expected ErrInvalidRole, got %v", err)
+	}
+	if _, err := service.SetRole(userContext(root), root.ID, domain.RoleViewer); !errors.Is(err, services.ErrOwnRole) {
+		t.Errorf("Expected admins not to demote themselves, got %v", err)
+	}
+	if user, err := service.SetRole(userContext(root), bob.ID, domain.RoleEditor); err != nil || user.Role != domain.RoleEditor {
+		t.Errorf("Expected bob to become an editor, got %+v %v", user, err)
+	}
+	if repo.users[bob.ID].Role != domain.RoleEditor {
+		t.Error("Expected the role to be saved")
+	}
+}
+
+// Setup the login routes behind the session and login rate limit middlewares
+func setupLoginRouter(t *testing.T, policy ratelimit.Policy) *gin.Engine {
+	service, _ := setupUserService(t)
+
+	r := fixtures.NewRouter(t, nil)
+	r.Use(middlewares.SessionMiddleware(service))
+
+	authHandler := handlers.NewAuthHandler(service, time.Hour)
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), policy)
+	r.POST("/login", middlewares.LoginRateLimitMiddleware(limiter), authHandler.Login)
+	r.GET("/notes", middlewares.RequireLogin(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(middlewares.UserKey))
+	})
+	return r
+}
+
+// Post the login form
+func login(router *gin.Engine, password, next string) *httptest.ResponseRecorder {
+	form := url.Values{"username": {"root"}, "password": {password}, "next": {next}}
+	req, _ := http.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = "10.0.0.1:1234"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLoginStartsSession(t *testing.T) {
+	router := setupLoginRouter(t, ratelimit.Policy{})
+
+	w := login(router, "correct horse", "/notes")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/notes" {
+		t.Fatalf("Expected a redirect to /notes, got %d %q", w.Code, w.Header().Get("Location"))
+	}
+
+	var session *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == auth.SessionCookie {
+			session = c
+		}
+	}
+	if session == nil || !session.HttpOnly {
+		t.Fatalf("Expected an HttpOnly session cookie, got %+v", session)
+	}
+
+	req, _ := http.NewRequest("GET", "/notes", nil)
+	req.AddCookie(session)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "root" {
+		t.Errorf("Expected the session to sign the request in, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestLoginRejectsOffsiteRedirects(t *testing.T) {
+	router := setupLoginRouter(t, ratelimit.Policy{})
+
+	for _, next := range []string{"https://evil.example", "//evil.example", `/\evil.example`, ""} {
+		if w := login(router, "correct horse", next); w.Header().Get("Location") != "/notes" {
+			t.Errorf("Expected next=%q to fall back to /notes, got %q", next, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestLoginLocksOutAfterFailedAttempts(t *testing.T) {
+	router := setupLoginRouter(t, ratelimit.Policy{LockoutThreshold: 2, LockoutDuration: time.Minute})
+
+	for i := 0; i < 2; i++ {
+		if w := login(router, "wrong", "/notes"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected 401, got %d", i+1, w.Code)
+		}
+	}
+	if w := login(router, "correct horse", "/notes"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the client to be locked out, got %d", w.Code)
+	}
+}
+
+func TestLoginLimitsAttempts(t *testing.T) {
+	router := setupLoginRouter(t, ratelimit.Policy{Logins: ratelimit.Limit{Requests: 2, Per: time.Minute}})
+
+	for i := 0; i < 2; i++ {
+		if w := login(router, "correct horse", "/notes"); w.Code != http.StatusSeeOther {
+			t.Fatalf("Attempt %d: expected a redirect, got %d", i+1, w.Code)
+		}
+	}
+	if w := login(router, "correct horse", "/notes"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+}
+
+func TestAdminPageAssignsRoles(t *testing.T) {
+	service, repo := setupUserService(t)
+	root := repo.users[1]
+	bob, err := service.CreateUser(userContext(root), "bob", "long enough", domain.RoleViewer)
+	if err != nil {
+		t.Fatalf("Error creating user: %v", err)
+	}
+
+	r := fixtures.NewRouter(t, root)
+	adminHandler := handlers.NewAdminHandler(service, services.NewAuditService(&mockAuditRepository{}))
+	r.GET("/admin/users", adminHandler.Users)
+	r.PUT("/admin/users/:id/role", adminHandler.SetRole)
+
+	body := serve(r, "GET", "/admin/users", nil, false).Body.String()
+	if !strings.Contains(body, `hx-put="/admin/users/2/role"`) || !strings.Contains(body, "You cannot change your own role") {
+		t.Errorf("Expected a role picker for bob and a disabled one for root, got:\n%s", body)
+	}
+
+	w := serve(r, "PUT", "/admin/users/2/role", url.Values{"role": {"editor"}}, true)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `<option value="editor" selected>`) {
+		t.Errorf("Expected the updated row, got %d:\n%s", w.Code, w.Body.String())
+	}
+	if bob.Role != domain.RoleEditor {
+		t.Errorf("Expected bob to be an editor, got %s", bob.Role)
+	}
+
+	if w := serve(r, "PUT", "/admin/users/1/role", url.Values{"role": {"viewer"}}, true); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected changing your own role to fail, got %d", w.Code)
+	}
+}
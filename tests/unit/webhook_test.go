@@ -0,0 +1,423 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/domain"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/webhooks"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+)
+
+// Mock webhook repository queueing deliveries in memory
+type mockWebhookRepository struct {
+	mu         sync.Mutex
+	webhooks   []*domain.Webhook
+	deliveries []*domain.WebhookDelivery
+}
+
+func (m *mockWebhookRepository) FindAll(ctx context.Context) ([]*domain.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*domain.Webhook(nil), m.webhooks...), nil
+}
+
+func (m *mockWebhookRepository) FindByID(ctx context.Context, id int64) (*domain.Webhook, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, hook := range m.webhooks {
+		if hook.ID == id {
+			return hook, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockWebhookRepository) Create(ctx context.Context, webhook *domain.Webhook) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	webhook.ID = int64(len(m.webhooks) + 1)
+	m.webhooks = append(m.webhooks, webhook)
+	return webhook.ID, nil
+}
+
+func (m *mockWebhookRepository) Delete(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, hook := range m.webhooks {
+		if hook.ID == id {
+			m.webhooks = append(m.webhooks[:i], m.webhooks[i+1:]...)
+		}
+	}
+	return nil
+}
+
+func (m *mockWebhookRepository) CreateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delivery.ID = int64(len(m.deliveries) + 1)
+	m.deliveries = append(m.deliveries, delivery)
+	return delivery.ID, nil
+}
+
+func (m *mockWebhookRepository) FindDelivery(ctx context.Context, id int64) (*domain.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id < 1 || id > int64(len(m.deliveries)) {
+		return nil, nil
+	}
+	return m.deliveries[id-1], nil
+}
+
+func (m *mockWebhookRepository) FindDeliveries(ctx context.Context, webhookID int64, limit int) ([]*domain.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deliveries []*domain.WebhookDelivery
+	for i := len(m.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if m.deliveries[i].WebhookID == webhookID {
+			deliveries = append(deliveries, m.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *mockWebhookRepository) ClaimDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*domain.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deliveries []*domain.WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.Status == domain.DeliveryPending && !d.NextAttemptAt.After(now) && len(deliveries) < limit {
+			d.NextAttemptAt = now.Add(lease)
+			copied := *d
+			deliveries = append(deliveries, &copied)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *mockWebhookRepository) UpdateDelivery(ctx context.Context, delivery *domain.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *delivery
+	m.deliveries[delivery.ID-1] = &copied
+	return nil
+}
+
+// Receiver recording the deliveries it accepts; it answers the statuses in
+// fail first, then 204
+type receiver struct {
+	t        *testing.T
+	secret   string
+	fail     []int
+	calls    atomic.Int32
+	mu       sync.Mutex
+	payloads []map[string]any
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	call := int(rc.calls.Add(1))
+	body, _ := io.ReadAll(r.Body)
+	timestamp, _ := strconv.ParseInt(r.Header.Get(webhooks.TimestampHeader), 10, 64)
+	if !webhooks.Verify(rc.secret, timestamp, body, r.Header.Get(webhooks.SignatureHeader)) {
+		rc.t.Errorf("Delivery %d has an invalid signature", call)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Header.Get(webhooks.EventHeader) == "" || r.Header.Get(webhooks.DeliveryHeader) == "" {
+		rc.t.Errorf("Delivery %d is missing its event or ID header", call)
+	}
+	if call <= len(rc.fail) {
+		w.WriteHeader(rc.fail[call-1])
+		return
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		rc.t.Errorf("Delivery %d is not JSON: %v", call, err)
+	}
+	rc.mu.Lock()
+	rc.payloads = append(rc.payloads, payload)
+	rc.mu.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Create a webhook service with a webhook for every event posting to a
+// receiver failing with fail first. Retries wait a nanosecond so every
+// DeliverDue call makes one more attempt.
+func setupWebhooks(t *testing.T, maxAttempts int, fail ...int) (services.WebhookService, *mockWebhookRepository, *receiver) {
+	repo := &mockWebhookRepository{}
+	service := services.NewWebhookService(repo, webhooks.NewClient(5*time.Second), maxAttempts, time.Nanosecond)
+
+	rc := &receiver{t: t, fail: fail}
+	server := httptest.NewServer(rc)
+	t.Cleanup(server.Close)
+
+	hook, err := service.CreateWebhook(userContext(adminUser), server.URL+"/hook", domain.WebhookEvents)
+	if err != nil {
+		t.Fatalf("Error creating webhook: %v", err)
+	}
+	rc.secret = hook.Secret
+	return service, repo, rc
+}
+
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"event":"note.created"}`)
+	signature := webhooks.Sign("secret", 1700000000, body)
+
+	if !strings.HasPrefix(signature, "sha256=") || !webhooks.Verify("secret", 1700000000, body, signature) {
+		t.Fatalf("Expected a verifiable sha256 signature, got %q", signature)
+	}
+	if webhooks.Verify("other", 1700000000, body, signature) {
+		t.Error("Expected another secret to fail verification")
+	}
+	if webhooks.Verify("secret", 1700000001, body, signature) {
+		t.Error("Expected another timestamp to fail verification")
+	}
+	if webhooks.Verify("secret", 1700000000, []byte(`{"event":"note.deleted"}`), signature) {
+		t.Error("Expected a changed body to fail verification")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{4, 4 * time.Minute},
+		{30, 6 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := webhooks.Backoff(tt.attempts, 30*time.Second); got != tt.want {
+			t.Errorf("Backoff(%d): expected %v, got %v", tt.attempts, tt.want, got)
+		}
+	}
+}
+
+func TestCreateWebhookValidates(t *testing.T) {
+	service := services.NewWebhookService(&mockWebhookRepository{}, webhooks.NewClient(time.Second), 3, time.Second)
+	admin := userContext(adminUser)
+
+	invalid := []struct {
+		url    string
+		events []domain.WebhookEvent
+	}{
+		{"ftp://example.com/hook", domain.WebhookEvents},
+		{"/relative", domain.WebhookEvents},
+		{"https://example.com/hook", nil},
+		{"https://example.com/hook", []domain.WebhookEvent{"note.archived"}},
+	}
+	for _, tt := range invalid {
+		if _, err := service.CreateWebhook(admin, tt.url, tt.events); !errors.Is(err, services.ErrInvalidWebhook) {
+			t.Errorf("CreateWebhook(%q, %v): expected ErrInvalidWebhook, got %v", tt.url, tt.events, err)
+		}
+	}
+
+	hook, err := service.CreateWebhook(admin, "https://example.com/hook",
+		[]domain.WebhookEvent{domain.WebhookNoteDeleted, domain.WebhookNoteCreated, domain.WebhookNoteDeleted})
+	if err != nil {
+		t.Fatalf("Error creating webhook: %v", err)
+	}
+	if len(hook.Secret) < 32 || len(hook.Events) != 2 {
+		t.Errorf("Expected a random secret and deduplicated events, got %+v", hook)
+	}
+
+	if _, err := service.CreateWebhook(userContext(editorUser), "https://example.com/hook", domain.WebhookEvents); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected only admins to manage webhooks, got %v", err)
+	}
+	if _, err := service.GetWebhooks(context.Background()); !errors.Is(err, services.ErrUnauthenticated) {
+		t.Errorf("Expected anonymous requests to be refused, got %v", err)
+	}
+}
+
+func TestNoteEventsArePublished(t *testing.T) {
+	webhookService, repo, rc := setupWebhooks(t, 3)
+	ctx := userContext(editorUser)
+
+	// A second webhook only hears about deletions
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(other.Close)
+	if _, err := webhookService.CreateWebhook(userContext(adminUser), other.URL,
+		[]domain.WebhookEvent{domain.WebhookNoteDeleted}); err != nil {
+		t.Fatalf("Error creating webhook: %v", err)
+	}
+
+	service := services.NewWebhookNoteService(newNoteService(newMockRepository()), webhookService)
+	note, err := service.CreateNote(ctx, "Title", "Content", time.Date(2030, 5, 1, 9, 30, 0, 0, time.UTC), time.Time{})
+	if err != nil {
+		t.Fatalf("Error creating note: %v", err)
+	}
+	if _, err := service.UpdateNote(ctx, note.ID, "Title", "Changed"); err != nil {
+		t.Fatalf("Error updating note: %v", err)
+	}
+	if _, err := service.UpdateNote(userContext(viewerUser), note.ID, "Title", "Refused"); err == nil {
+		t.Fatal("Expected viewers to be refused")
+	}
+	if err := service.DeleteNote(ctx, note.ID); err != nil {
+		t.Fatalf("Error deleting note: %v", err)
+	}
+
+	if len(repo.deliveries) != 4 {
+		t.Fatalf("Expected 3 deliveries to the first webhook and 1 to the second, got %d", len(repo.deliveries))
+	}
+	if n, err := webhookService.DeliverDue(context.Background()); err != nil || n != 4 {
+		t.Fatalf("Expected 4 deliveries attempted, got %d %v", n, err)
+	}
+	for _, d := range repo.deliveries {
+		if d.Status != domain.DeliverySucceeded {
+			t.Errorf("Expected every delivery to succeed, got %+v", d)
+		}
+	}
+	if len(rc.payloads) != 3 {
+		t.Fatalf("Expected the receiver to get 3 payloads, got %d", len(rc.payloads))
+	}
+
+	created, updated, deleted := rc.payloads[0], rc.payloads[1], rc.payloads[2]
+	if created["event"] != "note.created" || updated["event"] != "note.updated" || deleted["event"] != "note.deleted" {
+		t.Errorf("Expected the events in order, got %v, %v and %v", created["event"], updated["event"], deleted["event"])
+	}
+	if actor := created["actor"].(map[string]any); actor["username"] != "editor" {
+		t.Errorf("Expected the editor as actor, got %v", actor)
+	}
+	if n := created["note"].(map[string]any); n["due_at"] != "2030-05-01T09:30:00Z" {
+		t.Errorf("Expected the created note with its due date, got %v", n)
+	}
+	if n := updated["note"].(map[string]any); n["content"] != "Changed" {
+		t.Errorf("Expected the updated note, got %v", n)
+	}
+	if n := deleted["note"].(map[string]any); len(n) != 1 || n["id"] != float64(note.ID) {
+		t.Errorf("Expected only the ID of a deleted note, got %v", n)
+	}
+}
+
+func TestWebhookDeliveriesAreRetried(t *testing.T) {
+	service, repo, rc := setupWebhooks(t, 5, http.StatusInternalServerError, http.StatusServiceUnavailable)
+	if err := service.Publish(userContext(editorUser), domain.WebhookNoteCreated, &domain.Note{ID: 7, Title: "Title"}); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+
+	for i, want := range []domain.DeliveryStatus{domain.DeliveryPending, domain.DeliveryPending, domain.DeliverySucceeded} {
+		time.Sleep(time.Millisecond)
+		if _, err := service.DeliverDue(context.Background()); err != nil {
+			t.Fatalf("Error delivering: %v", err)
+		}
+		if d := repo.deliveries[0]; d.Status != want || d.Attempts != i+1 {
+			t.Fatalf("Attempt %d: expected %s after %d attempts, got %+v", i+1, want, i+1, d)
+		}
+	}
+	if d := repo.deliveries[0]; d.ResponseCode != http.StatusNoContent || d.Error != "" {
+		t.Errorf("Expected the last attempt to be recorded, got %+v", d)
+	}
+	if n, _ := service.DeliverDue(context.Background()); n != 0 || rc.calls.Load() != 3 {
+		t.Errorf("Expected a delivered event to be sent once, got %d more and %d calls", n, rc.calls.Load())
+	}
+}
+
+func TestWebhookDeliveriesFailAndRedeliver(t *testing.T) {
+	service, repo, rc := setupWebhooks(t, 2, http.StatusInternalServerError, http.StatusInternalServerError)
+	if err := service.Publish(userContext(editorUser), domain.WebhookNoteDeleted, map[string]int64{"id": 7}); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+
+	for range 3 {
+		time.Sleep(time.Millisecond)
+		if _, err := service.DeliverDue(context.Background()); err != nil {
+			t.Fatalf("Error delivering: %v", err)
+		}
+	}
+	failed := repo.deliveries[0]
+	if failed.Status != domain.DeliveryFailed || failed.Attempts != 2 || rc.calls.Load() != 2 {
+		t.Fatalf("Expected the delivery to fail after 2 attempts, got %+v with %d calls", failed, rc.calls.Load())
+	}
+	if failed.ResponseCode != http.StatusInternalServerError || !strings.Contains(failed.Error, "500") {
+		t.Errorf("Expected the failure to be recorded, got %+v", failed)
+	}
+
+	if _, err := service.Redeliver(userContext(editorUser), failed.ID); !errors.Is(err, services.ErrForbidden) {
+		t.Errorf("Expected only admins to redeliver, got %v", err)
+	}
+	if _, err := service.Redeliver(userContext(adminUser), 99); !errors.Is(err, services.ErrDeliveryNotFound) {
+		t.Errorf("Expected unknown deliveries to be reported, got %v", err)
+	}
+	copied, err := service.Redeliver(userContext(adminUser), failed.ID)
+	if err != nil {
+		t.Fatalf("Error redelivering: %v", err)
+	}
+	if n, err := service.DeliverDue(context.Background()); err != nil || n != 1 {
+		t.Fatalf("Expected the copy to be delivered, got %d %v", n, err)
+	}
+	if d := repo.deliveries[copied.ID-1]; d.Status != domain.DeliverySucceeded || string(d.Payload) != string(failed.Payload) {
+		t.Errorf("Expected the copy to succeed with the same payload, got %+v", d)
+	}
+	if repo.deliveries[0].Status != domain.DeliveryFailed {
+		t.Error("Expected the original delivery to stay failed")
+	}
+}
+
+// Setup the webhook pages, signed in as an admin
+func setupWebhookRouter(t *testing.T) (*gin.Engine, *mockWebhookRepository) {
+	repo := &mockWebhookRepository{}
+	service := services.NewWebhookService(repo, webhooks.NewClient(time.Second), 3, time.Second)
+
+	r := fixtures.NewRouter(t, nil)
+
+	webhookHandler := handlers.NewWebhookHandler(service)
+	hooks := r.Group("/admin/webhooks", signIn(adminUser))
+	hooks.GET("", webhookHandler.Index)
+	hooks.POST("", webhookHandler.Create)
+	hooks.GET("/:id", webhookHandler.Show)
+	hooks.DELETE("/:id", webhookHandler.Delete)
+	hooks.POST("/deliveries/:deliveryID/redeliver", webhookHandler.Redeliver)
+	return r, repo
+}
+
+func TestWebhookPages(t *testing.T) {
+	router, repo := setupWebhookRouter(t)
+
+	w := serve(router, "POST", "/admin/webhooks", url.Values{"url": {"javascript:alert(1)"}, "events": {"note.created"}}, false)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "Enter an http or https URL") {
+		t.Errorf("Expected the form to report the invalid URL, got %d", w.Code)
+	}
+	w = serve(router, "POST", "/admin/webhooks", url.Values{"url": {"https://example.com/hook"}, "events": {"note.created", "note.deleted"}}, false)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/admin/webhooks/1" {
+		t.Fatalf("Expected a redirect to the new webhook, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+
+	hook := repo.webhooks[0]
+	if err := services.NewWebhookService(repo, nil, 3, time.Second).Publish(userContext(adminUser), domain.WebhookNoteCreated, &domain.Note{ID: 1}); err != nil {
+		t.Fatalf("Error publishing: %v", err)
+	}
+	w = serve(router, "GET", "/admin/webhooks/1", nil, false)
+	body := w.Body.String()
+	if w.Code != http.StatusOK || !strings.Contains(body, hook.Secret) || !strings.Contains(body, "/admin/webhooks/deliveries/1/redeliver") {
+		t.Errorf("Expected the webhook page with its secret and delivery log, got %d", w.Code)
+	}
+
+	w = serve(router, "POST", "/admin/webhooks/deliveries/1/redeliver", nil, false)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/admin/webhooks/1" || len(repo.deliveries) != 2 {
+		t.Errorf("Expected the delivery to be queued again, got %d with %d deliveries", w.Code, len(repo.deliveries))
+	}
+
+	w = serve(router, "DELETE", "/admin/webhooks/1", nil, true)
+	if w.Code != http.StatusOK || w.Header().Get("HX-Redirect") != "/admin/webhooks" || len(repo.webhooks) != 0 {
+		t.Errorf("Expected the webhook to be deleted, got %d", w.Code)
+	}
+	if w = serve(router, "GET", "/admin/webhooks/1", nil, false); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a deleted webhook to be gone, got %d", w.Code)
+	}
+}
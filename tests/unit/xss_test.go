@@ -0,0 +1,242 @@
+package unit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mas-diq/htmx-basic-crud/internals/handlers"
+	"github.com/mas-diq/htmx-basic-crud/internals/services"
+	"github.com/mas-diq/htmx-basic-crud/internals/utils"
+	"github.com/mas-diq/htmx-basic-crud/tests/fixtures"
+	"golang.org/x/net/html"
+)
+
+// xssPayloads break out of HTML text, attributes, JavaScript strings inside
+// directive expressions and raw text elements. Every one calls alert so a
+// payload that became live markup is easy to spot.
+var xssPayloads = []string{
+	`<script>alert(1)</script>`,
+	`"><img src=x onerror=alert(1)>`,
+	`'><svg onload=alert(1)>`,
+	`', alert(1), '`,
+	`'; alert(1); //`,
+	"line one\nline two'); alert(1); ('",
+	"`${alert(1)}`",
+	`x" @click="alert(1)`,
+	`x' x-init='alert(1)`,
+	`javascript:alert(1)`,
+	`</textarea><script>alert(1)</script>`,
+	`</title><script>alert(1)</script>`,
+	`{{ alert(1) }}`,
+	"\n<b onmouseover=alert(1)>leading newline</b>",
+}
+
+// Setup the note routes with the real templates over the mock repository
+func setupXSSRouter(t *testing.T) (*gin.Engine, services.NoteService) {
+	r := fixtures.NewRouter(t, adminUser)
+
+	repo := newMockRepository()
+	noteService := newNoteService(repo)
+	noteHandler := handlers.NewNoteHandler(noteService, newTemplateService(), newSearchService(repo), testBaseURL)
+	r.GET("/notes", noteHandler.Index)
+	r.POST("/notes", noteHandler.Create)
+	r.GET("/notes/:id", noteHandler.Show)
+	r.GET("/notes/:id/edit", noteHandler.Edit)
+	r.PUT("/notes/:id", noteHandler.Update)
+
+	return r, noteService
+}
+
+// assertInert fails if page contains anything a payload could have turned
+// into running code: inline scripts, event handler attributes, javascript:
+// URLs or payload text inside directives
+func assertInert(t *testing.T, page string, body string) {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("%s: failed to parse HTML: %v", page, err)
+	}
+
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if n.Data == "script" {
+				if n.FirstChild != nil {
+					t.Errorf("%s: inline script %q", page, n.FirstChild.Data)
+				}
+				if src := attr(n, "src"); !strings.HasPrefix(src, utils.AssetPrefix) {
+					t.Errorf("%s: script from %q", page, src)
+				}
+			}
+			for _, a := range n.Attr {
+				name, value := strings.ToLower(a.Key), strings.ToLower(strings.TrimSpace(a.Val))
+				switch {
+				case strings.HasPrefix(name, "on"):
+					t.Errorf("%s: event handler attribute %s=%q on <%s>", page, a.Key, a.Val, n.Data)
+				case strings.HasPrefix(value, "javascript:") && (name == "href" || name == "src" || name == "action"):
+					t.Errorf("%s: javascript URL in %s=%q", page, a.Key, a.Val)
+				case isDirective(name) && strings.Contains(value, "alert"):
+					t.Errorf("%s: payload in directive %s=%q", page, a.Key, a.Val)
+				case isDirective(name) && name != "hx-headers" && strings.ContainsAny(value, "'\"(){}<>"):
+					t.Errorf("%s: directive %s=%q is not a plain reference", page, a.Key, a.Val)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+}
+
+// isDirective reports whether an attribute is evaluated as script by htmx or
+// by Alpine-style frameworks
+func isDirective(name string) bool {
+	return strings.HasPrefix(name, "x-") || strings.HasPrefix(name, ":") ||
+		strings.HasPrefix(name, "@") || strings.HasPrefix(name, "hx-on")
+}
+
+// attr returns the value of the attribute key of n
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// findElement returns the first element matching match in body
+func findElement(t *testing.T, body string, match func(*html.Node) bool) *html.Node {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to parse HTML: %v", err)
+	}
+	var find func(*html.Node) *html.Node
+	find = func(n *html.Node) *html.Node {
+		if n.Type == html.ElementNode && match(n) {
+			return n
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if found := find(c); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	return find(doc)
+}
+
+// textContent returns the text inside n as the browser sees it
+func textContent(n *html.Node) string {
+	var sb strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+		}
+	}
+	return sb.String()
+}
+
+func serve(router *gin.Engine, method, path string, form url.Values, htmx bool) *httptest.ResponseRecorder {
+	var body *strings.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	} else {
+		body = strings.NewReader("")
+	}
+	req, _ := http.NewRequest(method, path, body)
+	req.Header.Set("Accept", "text/html")
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if htmx {
+		req.Header.Set("HX-Request", "true")
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestTemplatesRenderHostileNotesInert(t *testing.T) {
+	router, noteService := setupXSSRouter(t)
+
+	for _, payload := range xssPayloads {
+		note, err := noteService.CreateNote(userContext(adminUser), payload, payload, time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatalf("Error creating note: %v", err)
+		}
+		id := strconv.FormatInt(note.ID, 10)
+		form := url.Values{"title": {payload}, "content": {payload}}
+
+		pages := map[string]*httptest.ResponseRecorder{
+			"index":       serve(router, "GET", "/notes", nil, false),
+			"show":        serve(router, "GET", "/notes/"+id, nil, false),
+			"edit":        serve(router, "GET", "/notes/"+id+"/edit", nil, false),
+			"htmx create": serve(router, "POST", "/notes", form, true),
+			"htmx update": serve(router, "PUT", "/notes/"+id, form, true),
+		}
+		for page, w := range pages {
+			if w.Code != http.StatusOK {
+				t.Fatalf("%s: expected status %d, got %d", page, http.StatusOK, w.Code)
+			}
+			assertInert(t, page+" "+strconv.Quote(payload), w.Body.String())
+		}
+	}
+}
+
+func TestEditFormRoundTripsHostileValues(t *testing.T) {
+	router, noteService := setupXSSRouter(t)
+
+	for _, payload := range xssPayloads {
+		note, err := noteService.CreateNote(userContext(adminUser), payload, payload, time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatalf("Error creating note: %v", err)
+		}
+		body := serve(router, "GET", "/notes/"+strconv.FormatInt(note.ID, 10)+"/edit", nil, false).Body.String()
+
+		// The form reads its initial values from the inputs, so they must
+		// hold the note exactly as saved
+		title := findElement(t, body, func(n *html.Node) bool { return n.Data == "input" && attr(n, "name") == "title" })
+		if title == nil || attr(title, "value") != payload {
+			t.Errorf("Expected the title input to hold %q, got %+v", payload, title)
+		}
+		content := findElement(t, body, func(n *html.Node) bool { return n.Data == "textarea" && attr(n, "name") == "content" })
+		if content == nil || textContent(content) != payload {
+			t.Errorf("Expected the content textarea to hold %q", payload)
+		}
+
+		form := findElement(t, body, func(n *html.Node) bool { return n.Data == "form" && attr(n, "hx-put") != "" })
+		if form == nil || attr(form, "data-component") != "noteForm" {
+			t.Errorf("Expected the form to use the noteForm component without inline script")
+		}
+	}
+}
+
+func TestShowPageDisplaysHostileTitleAsText(t *testing.T) {
+	router, noteService := setupXSSRouter(t)
+
+	for _, payload := range xssPayloads {
+		note, err := noteService.CreateNote(userContext(adminUser), payload, "content", time.Time{}, time.Time{})
+		if err != nil {
+			t.Fatalf("Error creating note: %v", err)
+		}
+		body := serve(router, "GET", "/notes/"+strconv.FormatInt(note.ID, 10), nil, false).Body.String()
+
+		h1 := findElement(t, body, func(n *html.Node) bool { return n.Data == "h1" })
+		if h1 == nil || textContent(h1) != payload {
+			t.Errorf("Expected the heading to show %q as text", payload)
+		}
+		titleEl := findElement(t, body, func(n *html.Node) bool { return n.Data == "title" })
+		if titleEl == nil || !strings.HasPrefix(textContent(titleEl), payload) {
+			t.Errorf("Expected the page title to show %q as text", payload)
+		}
+	}
+}
@@ -4,6 +4,229 @@ document.addEventListener('DOMContentLoaded', function () {
     document.documentElement.setAttribute('data-theme', theme);
 });
 
+// Components. An element names its component in data-component and the
+// parts it works with in data-ref; each is set up once, when the page loads
+// or htmx swaps it in. No script is read from the markup, so the strict CSP
+// needs neither inline scripts nor 'unsafe-eval'.
+const components = {};
+
+htmx.onLoad(function (root) {
+    const elements = root.matches('[data-component]') ? [root] : [];
+    elements.push(...root.querySelectorAll('[data-component]'));
+    elements.forEach(function (el) {
+        const setup = components[el.dataset.component];
+        if (setup && !el.componentReady) {
+            el.componentReady = true;
+            setup(el, refs(el));
+        }
+    });
+});
+
+// refs returns the elements marked with data-ref inside el, by name
+function refs(el) {
+    const found = {};
+    el.querySelectorAll('[data-ref]').forEach(function (ref) {
+        found[ref.dataset.ref] = ref;
+    });
+    return found;
+}
+
+// Note form with client side validation. Typing [[ in the content suggests
+// the titles of other notes to link to.
+components.noteForm = function (form, refs) {
+    const title = form.elements.title;
+    const content = refs.content;
+    const suggestions = refs.suggestions;
+    let suggestTimer = null;
+
+    const validate = function () {
+        const error = title.value.trim() ? '' : 'Title is required';
+        title.classList.toggle('input-error', error !== '');
+        refs.titleError.textContent = error;
+        refs.titleError.hidden = error === '';
+        return error === '';
+    };
+    // htmx sends the form on submit; cancelling its request keeps an invalid
+    // note from being sent
+    form.addEventListener('htmx:beforeRequest', function (event) {
+        if (event.detail.elt === form && !validate()) {
+            event.preventDefault();
+        }
+    });
+
+    // linkStart returns the position of the unclosed [[ before the cursor,
+    // or -1 when the cursor is not in a link
+    const linkStart = function () {
+        const before = content.value.slice(0, content.selectionStart);
+        const match = before.match(/\[\[([^\[\]\n]*)$/);
+        return match ? before.length - match[0].length : -1;
+    };
+    const closeSuggestions = function () {
+        clearTimeout(suggestTimer);
+        suggestions.hidden = true;
+    };
+
+    content.addEventListener('input', function () {
+        clearTimeout(suggestTimer);
+        const start = linkStart();
+        if (start < 0) {
+            closeSuggestions();
+            return;
+        }
+        const query = content.value.slice(start + 2, content.selectionStart);
+        suggestTimer = setTimeout(function () {
+            htmx.ajax('GET', '/notes/link-suggestions', {
+                target: suggestions,
+                swap: 'innerHTML',
+                values: { q: query },
+            }).then(function () {
+                suggestions.hidden = suggestions.children.length === 0;
+            });
+        }, 150);
+    });
+    content.addEventListener('keydown', function (event) {
+        if (event.key === 'Escape') {
+            closeSuggestions();
+        }
+    });
+    suggestions.addEventListener('click', function (event) {
+        const button = event.target.closest('button[data-title]');
+        if (!button) {
+            return;
+        }
+        const start = linkStart();
+        if (start < 0) {
+            closeSuggestions();
+            return;
+        }
+        let rest = content.value.slice(content.selectionStart);
+        if (rest.startsWith(']]')) {
+            rest = rest.slice(2);
+        }
+        const link = '[[' + button.dataset.title + ']]';
+        content.value = content.value.slice(0, start) + link + rest;
+        closeSuggestions();
+        content.focus();
+        content.setSelectionRange(start + link.length, start + link.length);
+    });
+};
+
+// Secret input that stays masked until revealed
+components.secretField = function (el, refs) {
+    refs.toggle.addEventListener('click', function () {
+        const shown = refs.input.type === 'password';
+        refs.input.type = shown ? 'text' : 'password';
+        refs.toggle.textContent = shown ? 'Hide' : 'Show';
+    });
+};
+
+// Graph of notes mentioning each other, loaded from data-src and laid out
+// with a small force simulation
+components.noteGraph = function (el, refs) {
+    const focus = Number(el.dataset.focus);
+
+    const layout = function (graph, width, height) {
+        // The focus note stays in the middle, the others start on a circle
+        const nodes = graph.nodes.map((node, i) => {
+            if (node.id === focus) {
+                return { ...node, x: width / 2, y: height / 2 };
+            }
+            const angle = (2 * Math.PI * i) / graph.nodes.length;
+            return {
+                ...node,
+                x: width / 2 + (width / 3) * Math.cos(angle),
+                y: height / 2 + (height / 3) * Math.sin(angle),
+            };
+        });
+        const byID = new Map(nodes.map((node) => [node.id, node]));
+        const edges = graph.edges.map((edge) => ({ ...edge, from: byID.get(edge.source), to: byID.get(edge.target) }));
+        const k = Math.sqrt((width * height) / Math.max(nodes.length, 1)) * 0.6;
+
+        for (let step = 0, heat = width / 10; step < 300; step++, heat *= 0.98) {
+            nodes.forEach((node) => { node.dx = (width / 2 - node.x) * 0.01; node.dy = (height / 2 - node.y) * 0.01; });
+            for (let i = 0; i < nodes.length; i++) {
+                for (let j = i + 1; j < nodes.length; j++) {
+                    const a = nodes[i], b = nodes[j];
+                    const dx = a.x - b.x, dy = a.y - b.y;
+                    const distance = Math.max(Math.hypot(dx, dy), 0.01);
+                    const force = (k * k) / distance;
+                    a.dx += (dx / distance) * force; a.dy += (dy / distance) * force;
+                    b.dx -= (dx / distance) * force; b.dy -= (dy / distance) * force;
+                }
+            }
+            edges.forEach(({ from, to }) => {
+                const dx = from.x - to.x, dy = from.y - to.y;
+                const distance = Math.max(Math.hypot(dx, dy), 0.01);
+                const force = (distance * distance) / k;
+                from.dx -= (dx / distance) * force; from.dy -= (dy / distance) * force;
+                to.dx += (dx / distance) * force; to.dy += (dy / distance) * force;
+            });
+            nodes.forEach((node) => {
+                if (node.id === focus) {
+                    return;
+                }
+                const length = Math.max(Math.hypot(node.dx, node.dy), 0.01);
+                node.x += (node.dx / length) * Math.min(length, heat);
+                node.y += (node.dy / length) * Math.min(length, heat);
+                node.x = Math.min(width - 20, Math.max(20, node.x));
+                node.y = Math.min(height - 20, Math.max(20, node.y));
+            });
+        }
+        return { nodes, edges };
+    };
+
+    const draw = function (graph) {
+        refs.empty.hidden = graph.nodes.length > 0;
+        refs.truncated.hidden = !graph.truncated;
+        const svg = refs.svg;
+        const [, , width, height] = svg.getAttribute('viewBox').split(' ').map(Number);
+        const { nodes, edges } = layout(graph, width, height);
+        const create = (name, attributes) => {
+            const node = document.createElementNS('http://www.w3.org/2000/svg', name);
+            Object.entries(attributes).forEach(([key, value]) => node.setAttribute(key, value));
+            return node;
+        };
+
+        edges.forEach(({ from, to, via }) => {
+            svg.appendChild(create('line', {
+                x1: from.x, y1: from.y, x2: to.x, y2: to.y,
+                class: 'mention-' + via,
+                'marker-end': 'url(#note-graph-arrow)',
+            }));
+        });
+        nodes.forEach((node) => {
+            const link = create('a', { href: '/notes/' + node.id, class: node.id === focus ? 'focus' : '' });
+            link.appendChild(create('circle', { cx: node.x, cy: node.y, r: node.id === focus ? 9 : 6 }));
+            const label = create('text', { x: node.x + 10, y: node.y + 4 });
+            label.textContent = node.title;
+            link.appendChild(label);
+            svg.appendChild(link);
+        });
+    };
+
+    fetch(el.dataset.src, { headers: { Accept: 'application/json' } })
+        .then((response) => {
+            if (!response.ok) {
+                // Problem details explain errors such as an invalid depth
+                return response.json().then(
+                    (problem) => Promise.reject(new Error(problem.detail)),
+                    () => Promise.reject(new Error(response.statusText)),
+                );
+            }
+            return response.json();
+        })
+        .then(draw)
+        .catch((err) => {
+            refs.error.textContent = err.message || 'Failed to load the graph';
+            refs.error.hidden = false;
+        });
+};
+
+// Error toast that dismisses itself
+components.toast = function (el) {
+    setTimeout(() => el.remove(), 5000);
+};
+
 // Add HTMX enhancements
 document.addEventListener('htmx:configRequest', function (event) {
     // For forms that should be submitted as application/x-www-form-urlencoded
@@ -12,6 +235,15 @@ document.addEventListener('htmx:configRequest', function (event) {
     }
 });
 
+// Let error responses retargeted by the server (e.g. error toasts) be swapped in
+document.addEventListener('htmx:beforeSwap', function (event) {
+    const xhr = event.detail.xhr;
+    if (xhr.status >= 400 && xhr.getResponseHeader('HX-Retarget')) {
+        event.detail.shouldSwap = true;
+        event.detail.isError = false;
+    }
+});
+
 // Add animations on HTMX events for smooth transitions
 document.addEventListener('htmx:beforeSwap', function (event) {
     // Skip on page load
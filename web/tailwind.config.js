@@ -0,0 +1,10 @@
+// Tailwind scans the templates and scripts for class names and emits only
+// the utilities and DaisyUI components they use.
+/** @type {import('tailwindcss').Config} */
+module.exports = {
+    content: ['./web/templates/**/*.html', './web/static/js/**/*.js'],
+    plugins: [require('daisyui')],
+    daisyui: {
+        themes: ['light', 'dark'],
+    },
+};
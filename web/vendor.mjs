@@ -0,0 +1,13 @@
+// Copies the browser build of htmx from node_modules into
+// web/static/vendor so it is embedded in the server binary.
+import { copyFileSync, mkdirSync } from 'node:fs';
+
+const files = {
+    'node_modules/htmx.org/dist/htmx.min.js': 'htmx.min.js',
+};
+
+mkdirSync('web/static/vendor', { recursive: true });
+for (const [from, to] of Object.entries(files)) {
+    copyFileSync(from, `web/static/vendor/${to}`);
+    console.log(`${from} -> web/static/vendor/${to}`);
+}
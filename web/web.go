@@ -0,0 +1,33 @@
+// Package web embeds the HTML templates and static assets so the server
+// binary runs from any working directory.
+//
+// The layout loads only committed assets, so building the server needs no
+// network access: htmx in static/vendor is copied from its npm package by go
+// generate, which also compiles the Tailwind stylesheet static/css/app.css
+// from the templates. The layout links app.css once it is committed.
+package web
+
+//go:generate npm --prefix .. run build
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed templates static
+var files embed.FS
+
+// Templates holds the HTML templates, e.g. "notes/index.html"
+var Templates = sub("templates")
+
+// Static holds the static assets, e.g. "css/styles.css"
+var Static = sub("static")
+
+// sub returns the embedded directory dir as a file system
+func sub(dir string) fs.FS {
+	fsys, err := fs.Sub(files, dir)
+	if err != nil {
+		panic(err)
+	}
+	return fsys
+}